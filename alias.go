@@ -0,0 +1,82 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// aliases maps virtual paths to other virtual paths.
+type aliases struct {
+	mu sync.RWMutex
+	m  map[string]string
+	n  atomic.Int32
+}
+
+// Alias makes the virtual path `alias`, and every path below it, refer to
+// `target` and the paths below it, like a symbolic link that only exists in
+// the namespace of this filesystem. Aliases are resolved after
+// WithPathRewriter and before any other check, so the resulting path is
+// subject to the same escape checks, validators and policies as any other
+// name. They are not listed in their directories and not followed from other
+// aliases. An empty target removes the alias.
+func (f *FileSystem) Alias(alias, target string) error {
+	a, ok := join("/", alias)
+	if !ok || a == "/" {
+		return &os.PathError{Op: "alias", Path: alias, Err: os.ErrInvalid}
+	}
+	if target == "" {
+		f.opts.aliases.set(a, "")
+		return nil
+	}
+	t, ok := join("/", target)
+	if !ok {
+		return errEscape(target)
+	}
+	f.opts.aliases.set(a, t)
+	return nil
+}
+
+func (a *aliases) set(alias, target string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if target == "" {
+		delete(a.m, alias)
+	} else {
+		if a.m == nil {
+			a.m = make(map[string]string)
+		}
+		a.m[alias] = target
+	}
+	a.n.Store(int32(len(a.m)))
+}
+
+// copy returns the aliases for a clone.
+func (a *aliases) copy() map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	m := make(map[string]string, len(a.m))
+	for alias, target := range a.m {
+		m[alias] = target
+	}
+	return m
+}
+
+// resolve replaces the longest alias leading the clean virtual path `name`.
+func (a *aliases) resolve(name string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for p := name; ; {
+		if target, ok := a.m[p]; ok {
+			return target + name[len(p):]
+		}
+		i := len(p) - 1
+		for i > 0 && p[i] != '/' {
+			i--
+		}
+		if i <= 0 {
+			return name
+		}
+		p = p[:i]
+	}
+}
@@ -0,0 +1,98 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"github.com/absfs/absfs"
+)
+
+// anonFile is the state of a file created by CreateAnonymous.
+type anonFile struct {
+	// tmp is the hidden file standing in for the anonymous file if the
+	// underlying filesystem does not support O_TMPFILE
+	tmp    string
+	linked bool
+
+	// path translates names for LinkInto
+	path func(string) (string, error)
+}
+
+// CreateAnonymous creates a file without a name in the directory `dir`,
+// which only becomes visible once File.LinkInto is called, and disappears if
+// the file is closed before. It uses O_TMPFILE where the underlying
+// filesystem supports it, and a hidden file in `dir` otherwise.
+func (f *FileSystem) CreateAnonymous(dir string, perm os.FileMode) (*File, error) {
+	ppath, err := f.path(dir)
+	if err != nil {
+		return nil, err
+	}
+	return createAnonymous(f.fs, f.opts, f.prefix, ppath, dir, perm, f.path)
+}
+
+func createAnonymous(fs absfs.FileSystem, o *options, prefix, ppath, dir string, perm os.FileMode, translate func(string) (string, error)) (*File, error) {
+	if o.cas != nil {
+		return nil, &os.PathError{Op: "createanonymous", Path: dir, Err: errors.ErrUnsupported}
+	}
+	if err := o.modify("createanonymous", ppath); err != nil {
+		return nil, err
+	}
+	anon := &anonFile{path: translate}
+	file := openTmpfile(fs, ppath, perm)
+	if file == nil {
+		anon.tmp = path.Join(ppath, ".basefs-anon-"+randomName())
+		var err error
+		file, err = fs.OpenFile(anon.tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if err != nil {
+			return nil, fixerr(prefix, err)
+		}
+	}
+	f := newFile(fs, o, file, prefix, ppath, dir, os.O_RDWR|os.O_CREATE)
+	f.anon = anon
+	return f, nil
+}
+
+// LinkInto gives a file created by CreateAnonymous the name `name`, which
+// must not exist yet. With the fallback for filesystems without O_TMPFILE,
+// the check for an existing file and the rename are not atomic.
+func (f *File) LinkInto(name string) error {
+	if f.anon == nil || f.anon.linked {
+		return &os.LinkError{Op: "link", Old: f.Name(), New: name, Err: os.ErrInvalid}
+	}
+	ppath, err := f.anon.path(name)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.modify("link", ppath); err != nil {
+		return err
+	}
+	f.opts.creating()
+	if f.anon.tmp == "" {
+		err = linkTmpfile(f.f, ppath)
+	} else if _, err = f.fs.Stat(ppath); err == nil {
+		err = os.ErrExist
+	} else if os.IsNotExist(err) {
+		err = f.fs.Rename(f.anon.tmp, ppath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: f.Name(), New: name, Err: cause(err)}
+	}
+	f.anon.linked = true
+	f.mu.Lock()
+	f.ppath, f.name = ppath, name
+	f.mu.Unlock()
+	f.dirty.Store(true)
+	return nil
+}
+
+// closeAnonymous disposes of an anonymous file which has not been linked.
+func (f *File) closeAnonymous() error {
+	err := f.f.Close()
+	if f.anon.tmp != "" {
+		if err1 := f.fs.Remove(f.anon.tmp); err == nil {
+			err = err1
+		}
+	}
+	return fixerr(f.prefix, err)
+}
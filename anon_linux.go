@@ -0,0 +1,43 @@
+package basefs
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/absfs/absfs"
+	"golang.org/x/sys/unix"
+)
+
+// openTmpfile opens an anonymous file in the directory `dir` with O_TMPFILE,
+// returning nil if the underlying filesystem does not support it or its
+// files don't expose their file descriptors, which are needed to link them.
+func openTmpfile(fs absfs.FileSystem, dir string, perm os.FileMode) absfs.File {
+	f, err := fs.OpenFile(dir, unix.O_TMPFILE|os.O_RDWR, perm)
+	if err != nil {
+		return nil
+	}
+	if _, ok := f.(syscall.Conn); !ok {
+		f.Close()
+		return nil
+	}
+	return f
+}
+
+// linkTmpfile links the anonymous file `f` to `ppath`.
+func linkTmpfile(f absfs.File, ppath string) error {
+	rc, err := f.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := rc.Control(func(fd uintptr) {
+		// linking through /proc does not need CAP_DAC_READ_SEARCH, unlike
+		// AT_EMPTY_PATH
+		proc := "/proc/self/fd/" + strconv.FormatUint(uint64(fd), 10)
+		err = unix.Linkat(unix.AT_FDCWD, proc, unix.AT_FDCWD, ppath, unix.AT_SYMLINK_FOLLOW)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
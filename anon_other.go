@@ -0,0 +1,20 @@
+//go:build !linux
+
+package basefs
+
+import (
+	"errors"
+	"os"
+
+	"github.com/absfs/absfs"
+)
+
+// openTmpfile is not supported on this platform.
+func openTmpfile(fs absfs.FileSystem, dir string, perm os.FileMode) absfs.File {
+	return nil
+}
+
+// linkTmpfile is not supported on this platform.
+func linkTmpfile(f absfs.File, ppath string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,78 @@
+package basefs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestCreateAnonymous(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []absfs.SymlinkFileSystem{ofs, connFS{ofs}} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bfs, err := basefs.NewFS(fs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bfs.Mkdir("/dir", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := func() []os.DirEntry {
+			t.Helper()
+			entries, err := os.ReadDir(filepath.Join(dir, "dir"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return entries
+		}
+
+		// closed before being linked
+		f, err := bfs.CreateAnonymous("/dir", 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("discarded")
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if e := entries(); len(e) != 0 {
+			t.Errorf("%T: got %v, expected no files", fs, e)
+		}
+
+		f, err = bfs.CreateAnonymous("/dir", 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("kept")
+		if err := bfs.WriteFile("/dir/taken", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.LinkInto("/dir/taken"); !os.IsExist(err) {
+			t.Errorf("%T: expected linking over a file to fail, got %v", fs, err)
+		}
+		if err := f.LinkInto("/dir/file.txt"); err != nil {
+			t.Fatalf("%T: %v", fs, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := bfs.ReadFile("/dir/file.txt")
+		if err != nil || string(data) != "kept" {
+			t.Errorf("%T: got %q %v", fs, data, err)
+		}
+		if e := entries(); len(e) != 2 {
+			t.Errorf("%T: got %v, expected file.txt and taken", fs, e)
+		}
+	}
+}
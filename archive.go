@@ -0,0 +1,283 @@
+package basefs
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+var (
+	// ErrUnsafePath is returned when an archive entry or symlink target would
+	// resolve outside the extraction directory.
+	ErrUnsafePath = errors.New("unsafe path in archive")
+
+	// ErrArchiveLimit is returned when an archive exceeds a configured limit.
+	ErrArchiveLimit = errors.New("archive limit exceeded")
+)
+
+// ExtractOption configures ExtractTar and ExtractZip.
+type ExtractOption func(*extractOptions) error
+
+type extractOptions struct {
+	maxSize  int64
+	maxEntry int64
+	maxFiles int
+}
+
+func newExtractOptions(opts []ExtractOption) (*extractOptions, error) {
+	o := new(extractOptions)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// MaxTotalSize limits the total number of bytes extracted from an archive.
+func MaxTotalSize(n int64) ExtractOption {
+	return func(o *extractOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxSize = n
+		return nil
+	}
+}
+
+// MaxEntrySize limits the number of bytes extracted to any single file.
+func MaxEntrySize(n int64) ExtractOption {
+	return func(o *extractOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxEntry = n
+		return nil
+	}
+}
+
+// MaxFiles limits the number of entries extracted from an archive.
+func MaxFiles(n int) ExtractOption {
+	return func(o *extractOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxFiles = n
+		return nil
+	}
+}
+
+// ExtractTar extracts the tar archive read from `r` into the directory `dest`,
+// which is created if needed. Entries with absolute names or ".." elements
+// are rejected with ErrUnsafePath. Symlinks are created if the filesystem
+// supports them and fail with errors.ErrUnsupported otherwise; their targets
+// must be relative and stay within `dest`, see ValidateSymlinkTarget. Hard
+// links are extracted as copies of the files they refer to. Devices and
+// named pipes are skipped. By default there is no limit on the size or number
+// of the extracted files, see MaxTotalSize, MaxEntrySize and MaxFiles.
+func (f *FileSystem) ExtractTar(r io.Reader, dest string, opts ...ExtractOption) error {
+	return extractTar(f.outer(), r, dest, opts)
+}
+
+func extractTar(fs absfs.FileSystem, r io.Reader, dest string, opts []ExtractOption) error {
+	x, err := newExtractor(fs, dest, opts)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = x.extract(hdr, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractor writes archive entries below `dest` while enforcing the limits.
+type extractor struct {
+	fs    absfs.FileSystem
+	dest  string
+	opts  *extractOptions
+	size  int64
+	files int
+}
+
+// newExtractor prepares the extraction into the directory `dest` of `fs`,
+// creating it if needed.
+func newExtractor(fs absfs.FileSystem, dest string, opts []ExtractOption) (*extractor, error) {
+	o, err := newExtractOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	dest = path.Clean("/" + dest)
+	err = fs.MkdirAll(dest, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &extractor{fs: fs, dest: dest, opts: o}, nil
+}
+
+func (x *extractor) extract(hdr *tar.Header, r io.Reader) error {
+	name, err := x.entry(hdr.Name)
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return x.dir(name, perm)
+	case tar.TypeReg, tar.TypeRegA:
+		err = x.write(name, hdr.Name, r, perm)
+	case tar.TypeLink:
+		err = x.link(name, hdr.Name, hdr.Linkname, perm)
+	case tar.TypeSymlink:
+		return x.symlink(name, hdr.Name, hdr.Linkname)
+	default:
+		// devices, fifos and the like are skipped
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return x.fs.Chtimes(name, hdr.ModTime, hdr.ModTime)
+}
+
+// entry returns the path an archive entry is extracted to, counting it
+// against the file limit.
+func (x *extractor) entry(entry string) (string, error) {
+	name, err := SafeJoinForExtraction(x.dest, entry)
+	if err != nil {
+		return "", err
+	}
+	x.files++
+	if x.opts.maxFiles > 0 && x.files > x.opts.maxFiles {
+		return "", &os.PathError{Op: "extract", Path: entry, Err: ErrArchiveLimit}
+	}
+	return name, nil
+}
+
+func (x *extractor) dir(name string, perm os.FileMode) error {
+	err := x.fs.MkdirAll(name, 0755)
+	if err != nil {
+		return err
+	}
+	return x.fs.Chmod(name, perm|0700)
+}
+
+// link extracts a hard link by copying the previously extracted `target`.
+func (x *extractor) link(name, entry, target string, perm os.FileMode) error {
+	target, err := SafeJoinForExtraction(x.dest, target)
+	if err != nil {
+		return err
+	}
+	in, err := x.fs.Open(target)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return x.write(name, entry, in, perm)
+}
+
+func (x *extractor) symlink(name, entry, target string) error {
+	sfs, ok := x.fs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return &os.PathError{Op: "extract", Path: entry, Err: errors.ErrUnsupported}
+	}
+	target, err := ValidateSymlinkTarget(x.dest, name, target)
+	if err != nil {
+		return err
+	}
+	err = x.fs.MkdirAll(path.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	return sfs.Symlink(target, name)
+}
+
+// write copies `r` into the regular file `name`, counting the bytes written
+// against the size limits.
+func (x *extractor) write(name, entry string, r io.Reader, perm os.FileMode) error {
+	err := x.fs.MkdirAll(path.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := x.fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	limit := int64(-1)
+	if x.opts.maxSize > 0 {
+		limit = x.opts.maxSize - x.size
+	}
+	if x.opts.maxEntry > 0 && (limit < 0 || x.opts.maxEntry < limit) {
+		limit = x.opts.maxEntry
+	}
+	if limit >= 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(out, r)
+	x.size += n
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	if err == nil && limit >= 0 && n > limit {
+		err = &os.PathError{Op: "extract", Path: entry, Err: ErrArchiveLimit}
+	}
+	if err != nil {
+		x.fs.Remove(name)
+	}
+	return err
+}
+
+// SafeJoinForExtraction joins the archive entry name `entry` to the directory
+// `base` and returns the cleaned result. Names which are absolute, carry a
+// drive letter, or contain ".." elements are rejected with ErrUnsafePath,
+// whether or not they would resolve within `base`. Backslashes are treated as
+// separators. It can be used to extract archive formats basefs does not
+// support itself.
+func SafeJoinForExtraction(base, entry string) (string, error) {
+	clean := strings.ReplaceAll(entry, "\\", "/")
+	if clean == "" || path.IsAbs(clean) || len(clean) > 1 && clean[1] == ':' {
+		return "", &os.PathError{Op: "extract", Path: entry, Err: ErrUnsafePath}
+	}
+	for _, elem := range strings.Split(clean, "/") {
+		if elem == ".." {
+			return "", &os.PathError{Op: "extract", Path: entry, Err: ErrUnsafePath}
+		}
+	}
+	return path.Join(base, clean), nil
+}
+
+// ValidateSymlinkTarget resolves the target `target` of a symlink extracted
+// to `link`, as returned by SafeJoinForExtraction, and returns the absolute
+// path it refers to. Targets which are absolute or resolve outside of `base`
+// are rejected with ErrUnsafePath.
+func ValidateSymlinkTarget(base, link, target string) (string, error) {
+	clean := strings.ReplaceAll(target, "\\", "/")
+	if clean == "" || path.IsAbs(clean) {
+		return "", &os.PathError{Op: "extract", Path: target, Err: ErrUnsafePath}
+	}
+	base = path.Clean(base)
+	resolved := path.Join(path.Dir(link), clean)
+	inside := within(base, resolved)
+	if base == "." {
+		inside = resolved != ".." && !strings.HasPrefix(resolved, "../")
+	}
+	if resolved == path.Clean(link) || !inside {
+		return "", &os.PathError{Op: "extract", Path: target, Err: ErrUnsafePath}
+	}
+	return resolved, nil
+}
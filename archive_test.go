@@ -0,0 +1,244 @@
+package basefs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+type tarEntry struct {
+	Name string
+	Type byte
+	Data string
+	Link string
+}
+
+func makeTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Typeflag: e.Type, Mode: 0644, Size: int64(len(e.Data)), Linkname: e.Link}
+		if e.Type != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newSymlinkTestFS(t *testing.T) *basefs.SymlinkFileSystem {
+	t.Helper()
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bfs
+}
+
+func TestExtractTar(t *testing.T) {
+	bfs := newSymlinkTestFS(t)
+	archive := makeTar(t, []tarEntry{
+		{Name: "dir/", Type: tar.TypeDir},
+		{Name: "dir/file.txt", Type: tar.TypeReg, Data: "hello"},
+		{Name: "dir/link", Type: tar.TypeSymlink, Link: "file.txt"},
+		{Name: "hard.txt", Type: tar.TypeLink, Link: "dir/file.txt"},
+	})
+	err := bfs.ExtractTar(bytes.NewReader(archive), "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/out/dir/file.txt", "/out/dir/link", "/out/hard.txt"} {
+		info, err := bfs.Stat(name)
+		if err != nil || info.Size() != 5 {
+			t.Errorf("%s: unexpected result %v %v", name, info, err)
+		}
+	}
+
+	unsafe := []tarEntry{
+		{Name: "../escape.txt", Type: tar.TypeReg, Data: "x"},
+		{Name: "/abs.txt", Type: tar.TypeReg, Data: "x"},
+		{Name: "a/../../b", Type: tar.TypeReg, Data: "x"},
+		{Name: "link", Type: tar.TypeSymlink, Link: "../../etc/passwd"},
+		{Name: "link", Type: tar.TypeSymlink, Link: "/etc/passwd"},
+		{Name: "hard", Type: tar.TypeLink, Link: "../outside"},
+	}
+	for _, e := range unsafe {
+		err := bfs.ExtractTar(bytes.NewReader(makeTar(t, []tarEntry{e})), "/unsafe")
+		if !errors.Is(err, basefs.ErrUnsafePath) {
+			t.Errorf("%s -> %s: expected ErrUnsafePath, got %v", e.Name, e.Link, err)
+		}
+	}
+
+	big := makeTar(t, []tarEntry{
+		{Name: "a", Type: tar.TypeReg, Data: "0123456789"},
+		{Name: "b", Type: tar.TypeReg, Data: "0123456789"},
+	})
+	err = bfs.ExtractTar(bytes.NewReader(big), "/big", basefs.MaxTotalSize(15))
+	if !errors.Is(err, basefs.ErrArchiveLimit) {
+		t.Errorf("expected a size limit error, got %v", err)
+	}
+	if _, err := bfs.Stat("/big/b"); err == nil {
+		t.Error("partially extracted file was not removed")
+	}
+	err = bfs.ExtractTar(bytes.NewReader(big), "/many", basefs.MaxFiles(1))
+	if !errors.Is(err, basefs.ErrArchiveLimit) {
+		t.Errorf("expected a file count limit error, got %v", err)
+	}
+}
+
+func TestZip(t *testing.T) {
+	bfs := newSymlinkTestFS(t)
+	err := bfs.MkdirAll("/src/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/src/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	err = bfs.Symlink("/src/dir/file.txt", "/src/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.FromSlash(bfs.Config().Base)
+	err = os.Symlink("../link", filepath.Join(base, "src", "dir", "up"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = bfs.WriteZip(buf, "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bfs.ExtractZip(bytes.NewReader(buf.Bytes()), "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dst/dir/file.txt", "/dst/link", "/dst/dir/up"} {
+		info, err := bfs.Stat(name)
+		if err != nil || info.Size() != 5 {
+			t.Errorf("%s: unexpected result %v %v", name, info, err)
+		}
+	}
+	if target, err := bfs.Readlink("/dst/link"); err != nil || target != "/dst/dir/file.txt" {
+		t.Errorf("unexpected link target %q %v", target, err)
+	}
+
+	// links leaving the archived tree are rejected like ExtractZip does
+	for _, link := range []string{"../../outside", "/outside", "/"} {
+		if err := os.Remove(filepath.Join(base, "src", "dir", "up")); err != nil {
+			t.Fatal(err)
+		}
+		if path.IsAbs(link) {
+			err = bfs.Symlink(link, "/src/dir/up")
+		} else {
+			err = os.Symlink(link, filepath.Join(base, "src", "dir", "up"))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.WriteZip(io.Discard, "/src"); !errors.Is(err, basefs.ErrUnsafePath) {
+			t.Errorf("%s: expected ErrUnsafePath, got %v", link, err)
+		}
+	}
+
+	err = bfs.ExtractZip(bytes.NewReader(buf.Bytes()), "/limited", basefs.MaxEntrySize(4))
+	if !errors.Is(err, basefs.ErrArchiveLimit) {
+		t.Errorf("expected an entry size limit error, got %v", err)
+	}
+
+	buf.Reset()
+	zw := zip.NewWriter(buf)
+	zw.Create("../../escape.txt")
+	zw.Close()
+	err = bfs.ExtractZip(buf, "/unsafe")
+	if !errors.Is(err, basefs.ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+}
+
+func TestSafeJoinForExtraction(t *testing.T) {
+	tests := []struct {
+		Entry    string
+		Expected string
+	}{
+		{"a/b.txt", "/base/a/b.txt"},
+		{"./a//b.txt", "/base/a/b.txt"},
+		{"dir/", "/base/dir"},
+		{"..", ""},
+		{"a/../b", ""},
+		{"a\\..\\..\\b", ""},
+		{"/etc/passwd", ""},
+		{"C:/windows", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		p, err := basefs.SafeJoinForExtraction("/base", test.Entry)
+		if test.Expected == "" {
+			if !errors.Is(err, basefs.ErrUnsafePath) {
+				t.Errorf("%q: expected ErrUnsafePath, got %q %v", test.Entry, p, err)
+			}
+			continue
+		}
+		if err != nil || p != test.Expected {
+			t.Errorf("%q: got %q %v, expected %q", test.Entry, p, err, test.Expected)
+		}
+	}
+
+	links := []struct {
+		Link, Target, Expected string
+	}{
+		{"/base/a/link", "b.txt", "/base/a/b.txt"},
+		{"/base/a/link", "../b.txt", "/base/b.txt"},
+		{"/base/a/link", "../../b.txt", ""},
+		{"/base/a/link", "/base/b.txt", ""},
+		{"/base/link", ".", "/base"},
+		{"/base/link", "link", ""},
+		{"a/link", "../../b", ""},
+	}
+	for _, test := range links {
+		base := "/base"
+		if test.Link[0] != '/' {
+			base = "."
+		}
+		p, err := basefs.ValidateSymlinkTarget(base, test.Link, test.Target)
+		if test.Expected == "" {
+			if !errors.Is(err, basefs.ErrUnsafePath) {
+				t.Errorf("%s -> %s: expected ErrUnsafePath, got %q %v", test.Link, test.Target, p, err)
+			}
+			continue
+		}
+		if err != nil || p != test.Expected {
+			t.Errorf("%s -> %s: got %q %v, expected %q", test.Link, test.Target, p, err, test.Expected)
+		}
+	}
+}
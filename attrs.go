@@ -0,0 +1,190 @@
+package basefs
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AttrOption configures ChmodAll, ChownAll and ChtimesAll.
+type AttrOption func(*attrOptions) error
+
+type attrOptions struct {
+	files  bool
+	dirs   bool
+	follow bool
+}
+
+// FilesOnly leaves directories unchanged.
+func FilesOnly() AttrOption {
+	return func(o *attrOptions) error {
+		o.files = true
+		return nil
+	}
+}
+
+// DirsOnly only changes directories.
+func DirsOnly() AttrOption {
+	return func(o *attrOptions) error {
+		o.dirs = true
+		return nil
+	}
+}
+
+// ChangeLinkTargets also changes the targets of symbolic links in the
+// subtree, which are skipped by default. Links to directories are not
+// descended into.
+func ChangeLinkTargets() AttrOption {
+	return func(o *attrOptions) error {
+		o.follow = true
+		return nil
+	}
+}
+
+// ChmodAll changes the mode of `name` and every file below it to `mode`.
+func (f *FileSystem) ChmodAll(name string, mode os.FileMode, opts ...AttrOption) error {
+	return f.applyAll(name, opts, func(p string) error {
+		return f.outer().Chmod(p, mode)
+	})
+}
+
+// ChownAll changes the owner of `name` and every file below it.
+func (f *FileSystem) ChownAll(name string, uid, gid int, opts ...AttrOption) error {
+	return f.applyAll(name, opts, func(p string) error {
+		return f.outer().Chown(p, uid, gid)
+	})
+}
+
+// ChtimesAll changes the access and modification times of `name` and every
+// file below it.
+func (f *FileSystem) ChtimesAll(name string, atime, mtime time.Time, opts ...AttrOption) error {
+	return f.applyAll(name, opts, func(p string) error {
+		return f.outer().Chtimes(p, atime, mtime)
+	})
+}
+
+// applyAll calls `apply` for the files below `name` selected by `opts`. Files
+// are changed while the tree is walked with FastWalk, directories once the
+// walk is done, deepest first, so that a restrictive mode can't keep the
+// walk from reading them.
+func (f *FileSystem) applyAll(name string, opts []AttrOption, apply func(string) error) error {
+	o := new(attrOptions)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	if o.files && o.dirs {
+		return os.ErrInvalid
+	}
+
+	var mu sync.Mutex
+	var dirs []string
+	err := f.FastWalk(name, func(p string, mode os.FileMode) error {
+		if mode&os.ModeSymlink != 0 {
+			if !o.follow {
+				return nil
+			}
+			info, err := f.outer().Stat(p)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			mode = info.Mode().Type()
+		}
+		if mode.IsDir() {
+			if !o.files {
+				mu.Lock()
+				dirs = append(dirs, p)
+				mu.Unlock()
+			}
+			return nil
+		}
+		if o.dirs {
+			return nil
+		}
+		return apply(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if err := apply(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttrMask selects the metadata applied by SetAttrs.
+type AttrMask uint8
+
+const (
+	AttrMode AttrMask = 1 << iota
+	AttrOwner
+	AttrTimes
+)
+
+// Attrs describes a change to the metadata of a file. Only the fields
+// selected by Set are applied.
+type Attrs struct {
+	Set   AttrMask
+	Mode  os.FileMode
+	Uid   int
+	Gid   int
+	Atime time.Time
+	Mtime time.Time
+}
+
+// SetAttrsFS is implemented by filesystems which can change several kinds of
+// metadata of a file at once, e.g. in a single request to a remote server.
+type SetAttrsFS interface {
+	SetAttrs(name string, attrs Attrs) error
+}
+
+// SetAttrs applies the owner, mode and times selected by `attrs` to the named
+// file. It is passed on to the underlying filesystem if it implements
+// SetAttrsFS, otherwise it calls Chown, Chmod and Chtimes in this order, so
+// that a mode with setuid or setgid bits is not cleared by the change of
+// owner, and stops at the first error.
+func (f *FileSystem) SetAttrs(name string, attrs Attrs) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.modify("setattrs", ppath); err != nil {
+		return err
+	}
+
+	if attrs.Set&AttrMode != 0 {
+		attrs.Mode = f.opts.execMode(f.fs, ppath, attrs.Mode)
+	}
+	if sfs, ok := f.fs.(SetAttrsFS); ok && f.opts.binds.get(ppath) == nil {
+		if err := sfs.SetAttrs(ppath, attrs); err != nil {
+			return f.fixerr(err)
+		}
+		f.opts.record("setattrs", vpath(f.prefix, ppath), "")
+		return nil
+	}
+	if attrs.Set&AttrOwner != 0 {
+		if err := f.Chown(name, attrs.Uid, attrs.Gid); err != nil {
+			return err
+		}
+	}
+	if attrs.Set&AttrMode != 0 {
+		if err := f.Chmod(name, attrs.Mode); err != nil {
+			return err
+		}
+	}
+	if attrs.Set&AttrTimes != 0 {
+		if err := f.Chtimes(name, attrs.Atime, attrs.Mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
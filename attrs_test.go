@@ -0,0 +1,140 @@
+package basefs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestChmodAll(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/dir/a":     "a",
+		"/dir/sub/b": "b",
+		"/outside":   "c",
+	})
+	dir := filepath.FromSlash(basefs.Prefix(bfs))
+	if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(dir, "dir", "link")); err != nil {
+		t.Skip(err)
+	}
+
+	if err := bfs.ChmodAll("/dir", 0600, basefs.FilesOnly()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.ChmodAll("/dir", 0700, basefs.DirsOnly()); err != nil {
+		t.Fatal(err)
+	}
+	modes := map[string]os.FileMode{
+		"/dir":       os.ModeDir | 0700,
+		"/dir/a":     0600,
+		"/dir/sub":   os.ModeDir | 0700,
+		"/dir/sub/b": 0600,
+		"/outside":   0644,
+	}
+	for name, mode := range modes {
+		info, err := bfs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != mode {
+			t.Errorf("%s: got mode %s, expected %s", name, info.Mode(), mode)
+		}
+	}
+
+	if err := bfs.ChmodAll("/dir", 0640, basefs.FilesOnly(), basefs.ChangeLinkTargets()); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := bfs.Stat("/outside"); err != nil || info.Mode() != 0640 {
+		t.Errorf("expected the link target to be changed, got %v %v", info.Mode(), err)
+	}
+
+	if err := bfs.ChmodAll("/dir", 0600, basefs.FilesOnly(), basefs.DirsOnly()); err != os.ErrInvalid {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestChtimesAll(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/dir/a":     "a",
+		"/dir/sub/b": "b",
+	})
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := bfs.ChtimesAll("/dir", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dir", "/dir/a", "/dir/sub", "/dir/sub/b"} {
+		info, err := bfs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: got %s, expected %s", name, info.ModTime(), mtime)
+		}
+	}
+}
+
+// attrsFS counts the calls to SetAttrs.
+type attrsFS struct {
+	*osfs.FileSystem
+	calls int
+}
+
+func (fs *attrsFS) SetAttrs(name string, attrs basefs.Attrs) error {
+	fs.calls++
+	if err := fs.Chmod(name, attrs.Mode); err != nil {
+		return err
+	}
+	return fs.Chtimes(name, attrs.Atime, attrs.Mtime)
+}
+
+func TestSetAttrs(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	afs := &attrsFS{FileSystem: ofs}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	attrs := basefs.Attrs{Set: basefs.AttrMode | basefs.AttrTimes, Mode: 0600, Atime: mtime, Mtime: mtime}
+
+	for _, fs := range []absfs.FileSystem{ofs, afs} {
+		bfs, err := basefs.NewFileSystem(fs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.WriteFile("/file", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.SetAttrs("/file", attrs); err != nil {
+			t.Fatal(err)
+		}
+		info, err := bfs.Stat("/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != 0600 || !info.ModTime().Equal(mtime) {
+			t.Errorf("got %s %s", info.Mode(), info.ModTime())
+		}
+		if err := bfs.Remove("/file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if afs.calls != 1 {
+		t.Errorf("expected SetAttrs to be passed on once, got %d calls", afs.calls)
+	}
+
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.SetAttrs("/missing", attrs); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrBaseInvalid is returned when the base directory has vanished or been
+// replaced since the filesystem was created.
+var ErrBaseInvalid = errors.New("base directory is no longer valid")
+
+// WithRevalidateBase checks the base directory before every operation and
+// fails with ErrBaseInvalid if it no longer exists, is no longer a directory
+// or, if the underlying filesystem is the os filesystem, is no longer the
+// same directory as when the filesystem was created.
+func WithRevalidateBase() Option {
+	return func(o *options) error {
+		o.revalidate = true
+		return nil
+	}
+}
+
+// WithCreateBase creates the base directory and any missing parents with the
+// permissions `perm` if it doesn't exist, rather than failing.
+func WithCreateBase(perm os.FileMode) Option {
+	return func(o *options) error {
+		o.createBase = true
+		o.basePerm = perm
+		return nil
+	}
+}
+
+// WithLazyBase defers checking, and with WithCreateBase creating, the base
+// directory until the filesystem is first used, so that creating the
+// filesystem does not access the underlying filesystem. Operations fail until
+// the base directory exists, and it is checked again on every operation until
+// then. Other options may still access the underlying filesystem when the
+// filesystem is created.
+func WithLazyBase() Option {
+	return func(o *options) error {
+		o.lazy = true
+		return nil
+	}
+}
+
+// initBase checks the base directory, creating it first if requested.
+func (o *options) initBase(fs absfs.FileSystem) error {
+	if o.createBase {
+		err := fs.MkdirAll(o.base, o.basePerm)
+		if err != nil {
+			return err
+		}
+	}
+	info, err := fs.Stat(o.base)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	o.baseInfo = info
+	return nil
+}
+
+// ready checks the base directory on first use if WithLazyBase was given.
+func (o *options) ready(fs absfs.FileSystem) error {
+	if !o.lazy || o.baseReady.Load() {
+		return nil
+	}
+	o.baseMu.Lock()
+	defer o.baseMu.Unlock()
+	if o.baseReady.Load() {
+		return nil
+	}
+	err := o.initBase(fs)
+	if err != nil {
+		return fixerr(o.base, err)
+	}
+	o.baseReady.Store(true)
+	return nil
+}
+
+// WithFailClosed makes the filesystem fail every operation with
+// ErrBaseInvalid once it has seen the base directory vanish or, with
+// WithRevalidateBase, change identity. This prevents writing to a directory
+// recreated at the same path. The base is checked whenever the underlying
+// filesystem reports that a file does not exist.
+func WithFailClosed() Option {
+	return func(o *options) error {
+		o.failClosed = true
+		return nil
+	}
+}
+
+// checkBase verifies that the base directory is still the one the filesystem
+// was created with.
+func (o *options) checkBase(fs absfs.FileSystem) error {
+	if o.failed.Load() {
+		return &os.PathError{Op: "revalidate", Path: "/", Err: ErrBaseInvalid}
+	}
+	if !o.validBase(fs) {
+		if o.failClosed {
+			o.failed.Store(true)
+		}
+		return &os.PathError{Op: "revalidate", Path: "/", Err: ErrBaseInvalid}
+	}
+	return nil
+}
+
+// validBase reports whether the base directory still exists and, if it can be
+// determined, is the same directory the filesystem was created with.
+func (o *options) validBase(fs absfs.FileSystem) bool {
+	info, err := fs.Stat(o.base)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	// os.SameFile can only compare the FileInfos of the os package
+	return o.baseInfo == nil || !os.SameFile(o.baseInfo, o.baseInfo) || os.SameFile(o.baseInfo, info)
+}
+
+// observe checks in fail closed mode whether `err`, returned by the
+// underlying filesystem, was caused by the base directory disappearing.
+func (o *options) observe(fs absfs.FileSystem, err error) {
+	if !o.failClosed || err == nil || !os.IsNotExist(err) || o.failed.Load() {
+		return
+	}
+	if !o.validBase(fs) {
+		o.failed.Store(true)
+	}
+}
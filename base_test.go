@@ -0,0 +1,596 @@
+package basefs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestRevalidateBase(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "base")
+	err = os.Mkdir(base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(base), basefs.WithRevalidateBase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the base with a different directory at the same path
+	err = os.Rename(base, filepath.Join(dir, "moved"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/dir"); !errors.Is(err, basefs.ErrBaseInvalid) {
+		t.Errorf("expected the base to be invalid once moved, got %v", err)
+	}
+	err = os.MkdirAll(filepath.Join(base, "dir"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/dir"); !errors.Is(err, basefs.ErrBaseInvalid) {
+		t.Errorf("expected the base to be invalid once replaced, got %v", err)
+	}
+}
+
+func TestCreateBase(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(filepath.Join(dir, "a", "b"))
+
+	if _, err := basefs.NewFileSystem(ofs, base); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing base to fail, got %v", err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, base, basefs.WithCreateBase(0700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := bfs.Stat("/")
+	if err != nil || !info.IsDir() {
+		t.Fatalf("got %v %v", info, err)
+	}
+	// an existing base is left alone
+	if _, err := basefs.NewFileSystem(ofs, base, basefs.WithCreateBase(0700)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLazyBase(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "base")
+
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(base), basefs.WithLazyBase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/"); !os.IsNotExist(err) {
+		t.Fatalf("expected the missing base to fail, got %v", err)
+	}
+	err = os.Mkdir(base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := filepath.ToSlash(filepath.Join(dir, "other"))
+	cfs, err := basefs.NewFileSystem(ofs, other, basefs.WithLazyBase(), basefs.WithCreateBase(0755))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Fatalf("base created before first use: %v", err)
+	}
+	if err := cfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailClosed(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "base")
+	err = os.Mkdir(base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(base), basefs.WithFailClosed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/missing"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	if err := bfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.RemoveAll(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/dir"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	err = os.Mkdir(base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Mkdir("/dir", 0755); !errors.Is(err, basefs.ErrBaseInvalid) {
+		t.Errorf("expected the filesystem to have failed, got %v", err)
+	}
+}
+
+func TestRootBase(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	bfs, err := basefs.NewFS(ofs, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bfs.Mkdir(dir+"/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bfs.Symlink(dir+"/dir", dir+"/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := bfs.Readlink(dir + "/link")
+	if err != nil || target != dir+"/dir" {
+		t.Errorf("got %q %v, expected %q", target, err, dir+"/dir")
+	}
+	info, err := bfs.Stat("../../.." + dir + "/dir/../dir")
+	if err != nil || !info.IsDir() {
+		t.Errorf("got %v %v", info, err)
+	}
+
+	var walked []string
+	err = bfs.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		walked = append(walked, p)
+		return err
+	})
+	if err != nil || len(walked) != 3 || walked[0] != dir {
+		t.Errorf("walked %q %v", walked, err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Chdir("/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := bfs.Clone(basefs.WithQuota(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !clone.Config().Symlinks {
+		t.Error("the clone does not report symlink support")
+	}
+	if cwd, _ := clone.Getwd(); cwd != "/a" {
+		t.Errorf("clone starts in %q", cwd)
+	}
+	if err := clone.Chdir("b"); err != nil {
+		t.Fatal(err)
+	}
+	if cwd, _ := bfs.Getwd(); cwd != "/a" {
+		t.Errorf("changing the directory of the clone moved the original to %q", cwd)
+	}
+
+	err = clone.WriteFile("/a/b/big", make([]byte, 100), 0644)
+	if !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the quota of the clone to be exceeded, got %v", err)
+	}
+	if err := bfs.WriteFile("/a/big", make([]byte, 100), 0644); err != nil {
+		t.Errorf("the quota of the clone applied to the original: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "big")); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCloneOptions fails when a new option is not carried over to clones.
+func TestCloneOptions(t *testing.T) {
+	// locks and per filesystem state, which clone copies by hand or not at all
+	want := []string{"baseMu", "baseReady", "failed", "aliases", "binds", "hidden", "files", "closers"}
+	if got := basefs.UnclonedOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("clone doesn't copy %q", got)
+	}
+}
+
+func TestCloneSiblings(t *testing.T) {
+	deny := func(name string) basefs.PathValidator {
+		return basefs.PathValidatorFunc(func(p string) error {
+			if p == name {
+				return errors.New("denied " + name)
+			}
+			return nil
+		})
+	}
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"a": "a", "b": "b", "c": "c"})
+	// spare capacity lets appends to the parent's slices write in place
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir),
+		basefs.WithValidator(deny("/x")), basefs.WithValidator(deny("/y")), basefs.WithValidator(deny("/z")),
+		basefs.WithDeny("/x"), basefs.WithDeny("/y"), basefs.WithDeny("/z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := bfs.Clone(basefs.WithValidator(deny("/a")), basefs.WithDeny("/c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := bfs.Clone(basefs.WithValidator(deny("/b")), basefs.WithDeny("/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fs     *basefs.FileSystem
+		name   string
+		denied bool
+	}{
+		{a, "/a", true},
+		{a, "/b", false},
+		{a, "/c", true},
+		{b, "/a", true},
+		{b, "/b", true},
+		{b, "/c", false},
+		{bfs, "/a", false},
+		{bfs, "/b", false},
+		{bfs, "/c", false},
+	}
+	for i, test := range tests {
+		_, err := test.fs.Stat(test.name)
+		if denied := err != nil; denied != test.denied {
+			t.Errorf("%d: %s: got %v", i, test.name, err)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+	bfs, err := basefs.NewFileSystem(ofs, base, basefs.WithQuota(1000), basefs.WithStatCache(time.Second),
+		basefs.WithIntegrity(base+"/.index", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := bfs.Config()
+	if c.Base != base || c.Symlinks || c.Quota != 1000 || c.StatCache != basefs.Duration(time.Second) || c.Integrity != base+"/.index" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"quota":1000`) || strings.Contains(string(data), "read_ahead") {
+		t.Errorf("unexpected JSON %s", data)
+	}
+	if strings.Contains(fmt.Sprintf("%#v", bfs), "secret") {
+		t.Error("the integrity key is exposed")
+	}
+	if s := fmt.Sprint(bfs); s != "basefs:"+base {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "public", "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"public/docs/a.txt", "public/secret.key", "private.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := basefs.LoadConfig(strings.NewReader(`{
+	"base": "` + base + `",
+	"symlinks": true,
+	"read_only": true,
+	"allow": ["/public"],
+	"deny": ["*.key"],
+	"stat_cache": "5s"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := basefs.NewFromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, ok := fs.(*basefs.SymlinkFileSystem)
+	if !ok {
+		t.Fatalf("got %T", fs)
+	}
+
+	if _, err := bfs.ReadFile("/public/docs/a.txt"); err != nil {
+		t.Error(err)
+	}
+	if _, err := bfs.ReadDir("/"); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{"/private.txt", "/public/secret.key", "/public/../private.txt"} {
+		if _, err := bfs.ReadFile(name); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s: expected a permission error, got %v", name, err)
+		}
+	}
+	if err := bfs.WriteFile("/public/new.txt", nil, 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+	if err := bfs.Remove("/public/docs/a.txt"); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+
+	data, err := json.Marshal(bfs.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := basefs.LoadConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s: %s", data, err)
+	}
+	if !reflect.DeepEqual(loaded, bfs.Config()) {
+		t.Errorf("got %+v from %s", loaded, data)
+	}
+
+	if _, err := basefs.LoadConfig(strings.NewReader(`{"base": "/", "bogus": 1}`)); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	if _, err := basefs.NewFromConfig(basefs.Config{Base: base, Backend: "missing"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir) + "/base"
+
+	var audit bytes.Buffer
+	fs, err := basefs.New().WithAudit(&audit).Deny("/private").CreateBase(0755).Base(base).WithQuota(100).Build(ofs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.(*basefs.SymlinkFileSystem); !ok {
+		t.Errorf("got %T", fs)
+	}
+	if err := fs.Mkdir("/public", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("/private", 0755); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+	if !strings.Contains(audit.String(), `"path":"/public"`) || strings.Count(audit.String(), "\n") != 1 {
+		t.Errorf("unexpected audit log %q", audit.String())
+	}
+
+	ro, err := basefs.New().Base(base).ReadOnly().Build(opaque{ofs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ro.(*basefs.FileSystem); !ok {
+		t.Errorf("got %T", ro)
+	}
+	if err := ro.Mkdir("/other", 0755); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+
+	if _, err := basefs.New().Base(base).Base(base).Build(ofs); err == nil {
+		t.Error("expected an error setting the base twice")
+	}
+	if fs, err := basefs.New().Base(base + "/missing").Build(ofs); err == nil || fs != nil {
+		t.Errorf("expected a nil filesystem and an error, got %v, %v", fs, err)
+	}
+}
+
+func TestNewFiler(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFiler(struct{ absfs.Filer }{ofs}, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bfs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/a/b/c/file", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Truncate("/a/b/c/file", 2); err != nil {
+		t.Fatal(err)
+	}
+	data, err := bfs.ReadFile("/a/b/c/file")
+	if err != nil || string(data) != "he" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if _, err := bfs.Open("/../etc/passwd"); err == nil {
+		t.Error("escaped the base directory")
+	}
+	if err := bfs.RemoveAll("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Errorf("expected /a to be removed, got %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bfs.Capabilities()
+	if !c.Write || !c.Symlinks || !c.Watch || !c.NativeWatch {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+
+	ro, err := basefs.NewFileSystem(opaque{ofs}, filepath.ToSlash(dir), basefs.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = ro.Capabilities()
+	if c.Write || c.Symlinks || c.Chown || c.SparseFiles || c.NativeWatch || !c.Watch {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+}
+
+func TestAs(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inner.Mkdir("/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	outer, err := basefs.NewFileSystem(inner, "/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var host *osfs.FileSystem
+	if !basefs.As(outer, &host) || host != ofs {
+		t.Error("As did not find the os filesystem")
+	}
+	var bfs *basefs.FileSystem
+	if !basefs.As(outer, &bfs) || bfs != outer {
+		t.Error("As did not stop at the outermost basefs")
+	}
+	if !basefs.As(outer.Unwrap(), &bfs) || bfs != inner {
+		t.Error("As did not find the inner basefs")
+	}
+	var sfs *basefs.SymlinkFileSystem
+	if basefs.As(outer, &sfs) {
+		t.Error("As found a SymlinkFileSystem")
+	}
+	if basefs.Prefix(outer) != "/sub" || basefs.Unwrap(outer) != inner {
+		t.Error("Prefix or Unwrap did not recognize a FileSystem")
+	}
+
+	f, err := outer.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var of *osfs.File
+	if !basefs.As(f, &of) {
+		t.Error("As did not find the os file")
+	}
+}
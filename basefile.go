@@ -2,10 +2,14 @@ package basefs
 
 import (
 	"errors"
+	"hash"
 	"io"
+	iofs "io/fs"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/absfs/absfs"
@@ -15,6 +19,77 @@ type File struct {
 	f      absfs.File
 	prefix string
 	name   string
+
+	fs    absfs.FileSystem
+	opts  *options
+	ppath string
+	flags int
+	dirty atomic.Bool
+
+	// guards name and ppath, which change when the file is renamed with
+	// WithStableHandles
+	mu sync.Mutex
+
+	// entries of the directory and the position in them, with WithDirCache
+	dirents []os.FileInfo
+	dirpos  int
+
+	// virtual files of the directory still to be listed, see RegisterVirtual
+	virtuals []os.FileInfo
+	listed   bool
+
+	// buffered sequential reads, with WithReadAhead
+	ra *readAhead
+
+	// buffered writes, with WithWriteBuffer
+	wb *writeBuffer
+
+	// the transformed stream of data written, or read once reading starts,
+	// with WithWriteTransformer and WithReadTransformer
+	transformed bool
+	tw          io.WriteCloser
+	tr          io.Reader
+
+	// checksum of the data written since the file was truncated, with
+	// WithChecksums
+	sum hash.Hash
+
+	// files created by CreateAnonymous
+	anon *anonFile
+
+	// the size counted against the quotas and the offset of the next write,
+	// for files opened for writing while quotas are configured
+	tracked bool
+	size    int64
+	off     int64
+}
+
+// newFile wraps `file` opened at `ppath` on the underlying filesystem `fs`.
+// Files created or truncated by opening them are considered modified.
+func newFile(fs absfs.FileSystem, opts *options, file absfs.File, prefix, ppath, name string, flags int) *File {
+	f := &File{f: file, prefix: prefix, name: name, fs: fs, opts: opts, ppath: ppath, flags: flags}
+	if flags&(os.O_CREATE|os.O_TRUNC) != 0 && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.dirty.Store(true)
+	}
+	if opts.readAhead > 0 && flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		f.ra = newReadAhead(file, opts.readAhead)
+	}
+	if opts.writeBuffer > 0 && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.wb = newWriteBuffer(file, opts.writeBuffer)
+	}
+	f.transform(flags)
+	if opts.checksums != nil && flags&os.O_TRUNC != 0 && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.sum = opts.checksums.newHash()
+	}
+	opts.files.add(f)
+	return f
+}
+
+// modified marks the file contents as changed if `n` bytes were written.
+func (f *File) modified(n int) {
+	if n > 0 && !f.dirty.Load() {
+		f.dirty.Store(true)
+	}
 }
 
 func fixerr(prefix string, err error) error {
@@ -34,62 +109,215 @@ func fixerr(prefix string, err error) error {
 	}
 }
 
+// cause strips the path, which may be on the underlying filesystem, from the
+// error `err` of an operation.
+func cause(err error) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		return perr.Err
+	}
+	var lerr *os.LinkError
+	if errors.As(err, &lerr) {
+		return lerr.Err
+	}
+	return err
+}
+
 func (f *File) Name() string {
-	return f.name
+	_, name := f.location()
+	return name
+}
+
+// location returns the path of the file on the underlying filesystem and its
+// name.
+func (f *File) location() (ppath, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ppath, f.name
 }
 
 func (f *File) Read(p []byte) (n int, err error) {
+	defer f.profile("read")()
+	if f.transformed {
+		if f.tw != nil {
+			return 0, f.stream("read")
+		}
+		if f.tr == nil {
+			f.tr = f.opts.transformReader(fileReader{f})
+		}
+		n, err = f.tr.Read(p)
+		return n, fixerr(f.prefix, err)
+	}
+	return f.read(p)
+}
+
+func (f *File) read(p []byte) (n int, err error) {
+	f.unhash()
+	if f.ra != nil {
+		n, err = f.ra.Read(p)
+		return n, fixerr(f.prefix, err)
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
 	n, err = f.f.Read(p)
+	f.advance(int64(n))
 
 	return n, fixerr(f.prefix, err)
 }
 
 func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	defer f.profile("read")()
+	if err := f.stream("read"); err != nil {
+		return 0, err
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
 	n, err = f.f.ReadAt(b, off)
 
 	return n, fixerr(f.prefix, err)
 }
 
 func (f *File) Write(p []byte) (n int, err error) {
-	n, err = f.f.Write(p)
+	defer f.profile("write")()
+	if f.tw != nil {
+		n, err = f.tw.Write(p)
+		return n, fixerr(f.prefix, err)
+	}
+	return f.write(p)
+}
+
+func (f *File) write(p []byte) (n int, err error) {
+	off, err := f.claim("write", -1, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	if f.wb != nil {
+		n, err = f.wb.write(p)
+	} else {
+		n, err = f.f.Write(p)
+	}
+	f.seeked(off + int64(n))
+	if f.sum != nil {
+		f.sum.Write(p[:n])
+	}
+	f.modified(n)
+	if err == nil {
+		err = f.syncWrite()
+	}
 
 	return n, fixerr(f.prefix, err)
 }
 
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	defer f.profile("write")()
+	if err := f.stream("write"); err != nil {
+		return 0, err
+	}
+	f.unhash()
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	if _, err := f.claim("write", off, int64(len(b))); err != nil {
+		return 0, err
+	}
 	n, err = f.f.WriteAt(b, off)
+	f.modified(n)
+	if err == nil {
+		err = f.syncWrite()
+	}
 
 	return n, fixerr(f.prefix, err)
 }
 
 func (f *File) Close() error {
-	err := f.f.Close()
+	f.opts.files.remove(f)
+	if f.ra != nil {
+		f.ra.wait()
+	}
+	if f.anon != nil && !f.anon.linked {
+		return f.closeAnonymous()
+	}
+	var err error
+	if f.tw != nil {
+		err = f.tw.Close()
+	}
+	if err1 := f.flush(); err == nil {
+		err = err1
+	}
+	if err == nil && f.dirty.Load() && f.opts.syncPolicy == SyncOnClose {
+		err = f.fsync()
+	}
+	if err1 := f.f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil && f.dirty.Load() {
+		ppath, _ := f.location()
+		err = f.opts.written(f.fs, ppath, vpath(f.prefix, ppath), f.digest())
+	}
 
 	return fixerr(f.prefix, err)
 }
 
 func (f *File) Seek(offset int64, whence int) (ret int64, err error) {
+	if err := f.stream("seek"); err != nil {
+		return 0, err
+	}
+	f.unhash()
+	if f.ra != nil {
+		ret, err = f.ra.Seek(offset, whence)
+		return ret, fixerr(f.prefix, err)
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
 	ret, err = f.f.Seek(offset, whence)
+	if err == nil {
+		f.seeked(ret)
+	}
 
 	return ret, fixerr(f.prefix, err)
 }
 
 func (f *File) Stat() (os.FileInfo, error) {
+	if err := f.flush(); err != nil {
+		return nil, err
+	}
 	info, err := f.f.Stat()
 	if err != nil {
 		return nil, fixerr(f.prefix, err)
 	}
 
-	return &fileinfo{info, path.Base(f.name)}, nil
+	_, name := f.location()
+	return &fileinfo{info, path.Base(name)}, nil
 }
 
 func (f *File) Sync() error {
-	return fixerr(f.prefix, f.f.Sync())
+	defer f.profile("sync")()
+	return f.fsync()
 }
 
 func (f *File) Readdir(n int) (dirs []os.FileInfo, err error) {
+	defer f.profile("readdir")()
 	// fmt.Printf("absfs/basefs Readdir %d\n", n)
-	dirs, err = f.f.Readdir(n)
+	if f.opts.dirs != nil {
+		return f.cachedReaddir(n)
+	}
+	for {
+		dirs, err = f.f.Readdir(n)
+		read := len(dirs)
+		f.entries(dirs)
+		dirs = f.visible(dirs)
+		// Keep reading if every entry read was hidden, as an empty batch
+		// without an error would not be allowed.
+		if len(dirs) > 0 || read == 0 || n <= 0 || err != nil {
+			break
+		}
+	}
+	if f.opts.binds.virtual.Load() > 0 {
+		dirs, err = f.addVirtual(dirs, n, err)
+	}
 	// if err != nil {
 	// 	fmt.Printf("absfs/basefs Readdir Error %s\n", err)
 	// }
@@ -97,20 +325,111 @@ func (f *File) Readdir(n int) (dirs []os.FileInfo, err error) {
 }
 
 func (f *File) Readdirnames(n int) (names []string, err error) {
-	names, err = f.f.Readdirnames(n)
+	if f.opts.dirs != nil || f.opts.binds.virtual.Load() > 0 {
+		infos, err := f.Readdir(n)
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names, err
+	}
+	defer f.profile("readdir")()
+	dir, _ := f.location()
+	for {
+		names, err = f.f.Readdirnames(n)
+		read := len(names)
+		visible := names[:0]
+		for _, name := range names {
+			name = path.Base(name)
+			if f.opts.visible(path.Join(dir, name)) {
+				visible = append(visible, name)
+			}
+		}
+		names = visible
+		if len(names) > 0 || read == 0 || n <= 0 || err != nil {
+			break
+		}
+	}
 	return names, fixerr(f.prefix, err)
 }
 
+// entries replaces the FileInfos read from the directory with ones reporting
+// the base name only, in case the underlying filesystem includes the path.
+func (f *File) entries(infos []os.FileInfo) {
+	dir, _ := f.location()
+	for i, info := range infos {
+		name := path.Base(info.Name())
+		infos[i] = &fileinfo{f.opts.stat(path.Join(dir, name), info), name}
+	}
+}
+
+// visible returns the entries of `infos` which are neither hidden, see Hide,
+// nor replaced by virtual files, see RegisterVirtual.
+func (f *File) visible(infos []os.FileInfo) []os.FileInfo {
+	if !f.opts.reshaped() {
+		return infos
+	}
+	dir, _ := f.location()
+	var visible []os.FileInfo
+	for _, info := range infos {
+		p := path.Join(dir, info.Name())
+		if b := f.opts.binds.get(p); b != nil && b.content != nil {
+			continue
+		}
+		if f.opts.visible(p) {
+			visible = append(visible, info)
+		}
+	}
+	return visible
+}
+
 func (f *File) Truncate(size int64) error {
-	return fixerr(f.prefix, f.f.Truncate(size))
+	defer f.profile("truncate")()
+	if err := f.stream("truncate"); err != nil {
+		return err
+	}
+	f.unhash()
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if err := f.resize("truncate", size); err != nil {
+		return err
+	}
+	err := f.f.Truncate(size)
+	if err == nil {
+		f.dirty.Store(true)
+		err = f.syncWrite()
+	}
+	return fixerr(f.prefix, err)
 }
 
 func (f *File) WriteString(s string) (n int, err error) {
-	n, err = f.f.WriteString(s)
+	if f.tw != nil {
+		return f.Write([]byte(s))
+	}
+	defer f.profile("write")()
+	off, err := f.claim("write", -1, int64(len(s)))
+	if err != nil {
+		return 0, err
+	}
+	if f.wb != nil {
+		n, err = f.wb.writeString(s)
+	} else {
+		n, err = f.f.WriteString(s)
+	}
+	f.seeked(off + int64(n))
+	if f.sum != nil {
+		io.WriteString(f.sum, s[:n])
+	}
+	f.modified(n)
+	if err == nil {
+		err = f.syncWrite()
+	}
 
 	return n, fixerr(f.prefix, err)
 }
 
+// fileinfo reports the virtual name of a file. It also serves as the
+// fs.DirEntry of the file.
 type fileinfo struct {
 	info os.FileInfo
 	name string
@@ -139,3 +458,11 @@ func (i *fileinfo) Sys() interface{} {
 func (i *fileinfo) IsDir() bool {
 	return i.info.IsDir()
 }
+
+func (i *fileinfo) Type() iofs.FileMode {
+	return i.info.Mode().Type()
+}
+
+func (i *fileinfo) Info() (iofs.FileInfo, error) {
+	return i, nil
+}
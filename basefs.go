@@ -4,23 +4,31 @@ import (
 	"errors"
 	"os"
 	"path"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/absfs/absfs"
 )
 
+// SymlinkFileSystem is a FileSystem on top of a filesystem supporting symbolic
+// links, adding the methods to work with them.
 type SymlinkFileSystem struct {
-	fs     absfs.SymlinkFileSystem
-	cwd    string
-	prefix string
+	*fileSystem
+}
+
+// fileSystem allows embedding FileSystem without exporting the field.
+type fileSystem = FileSystem
+
+func newSymlinkFileSystem(fs absfs.SymlinkFileSystem, cwd, prefix string, o *options) *SymlinkFileSystem {
+	f := newFileSystem(fs, cwd, prefix, o)
+	f.sfs = fs
+	return &SymlinkFileSystem{f}
 }
 
 // NewFS creates a new FileSystem from a `absfs.FileSystem` compatible object
 // and a path. The path must be an absolute path and must already exist in the
-// fs provided otherwise an error is returned.
-func NewFS(fs absfs.SymlinkFileSystem, dir string) (*SymlinkFileSystem, error) {
+// fs provided, unless the WithCreateBase option is given, otherwise an error
+// is returned. Options enable optional behavior such as journaling.
+func NewFS(fs absfs.SymlinkFileSystem, dir string, opts ...Option) (*SymlinkFileSystem, error) {
 	if dir == "" {
 		return nil, os.ErrInvalid
 	}
@@ -28,271 +36,77 @@ func NewFS(fs absfs.SymlinkFileSystem, dir string) (*SymlinkFileSystem, error) {
 	if !path.IsAbs(dir) {
 		return nil, errors.New("not an absolute path")
 	}
-	info, err := fs.Stat(dir)
+	o, err := newOptions(fs, dir, opts)
 	if err != nil {
 		return nil, err
 	}
-	if !info.IsDir() {
-		return nil, errors.New("not a directory")
-	}
-
-	return &SymlinkFileSystem{fs, "/", dir}, nil
-}
-
-// OpenFile opens a file using the given flags and the given mode.
-func (f *SymlinkFileSystem) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
-	// flag := absfs.Flags(flags)
-	ppath, err := f.path(name)
-	if err != nil {
-		return new(absfs.InvalidFile), err
-	}
-
-	file, err := f.fs.OpenFile(ppath, flags, perm)
-	if err != nil {
-		return new(absfs.InvalidFile), err
-	}
-
-	return &File{file, f.prefix, name}, fixerr(f.prefix, err)
-}
-
-// Mkdir creates a directory in the filesystem, return an error if any
-// happens.
-func (f *SymlinkFileSystem) Mkdir(name string, perm os.FileMode) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
-	err = f.fs.Mkdir(ppath, perm)
-	return fixerr(f.prefix, err)
-}
-
-// Remove removes a file identified by name, returning an error, if any
-// happens.
-func (f *SymlinkFileSystem) Remove(name string) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
-
-	err = f.fs.Remove(ppath)
-	return fixerr(f.prefix, err)
-}
-
-func (f *SymlinkFileSystem) Rename(oldname, newname string) error {
-	linkErr := os.LinkError{Op: "rename", Old: oldname, New: newname}
-	oldpath, err := f.path(oldname)
-	if err != nil {
-		linkErr.Err = err
-		return &linkErr
-	}
-	newpath, err := f.path(newname)
-	if err != nil {
-		linkErr.Err = err
-		return &linkErr
-	}
-	err = f.fs.Rename(oldpath, newpath)
-	return fixerr(f.prefix, err)
-}
-
-// Stat returns the FileInfo structure describing file. If there is an error,
-// it will be of type *PathError.
-func (f *SymlinkFileSystem) Stat(name string) (os.FileInfo, error) {
-	ppath, err := f.path(name)
-	if err != nil {
-		return nil, err
-	}
-
-	info, err := f.fs.Stat(ppath)
-	if err != nil {
-		return nil, fixerr(f.prefix, err)
-	}
-
-	return &fileinfo{info, path.Base(name)}, nil
-}
-
-//Chmod changes the mode of the named file to mode.
-func (f *SymlinkFileSystem) Chmod(name string, mode os.FileMode) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
 
-	err = f.fs.Chmod(ppath, mode)
-	return fixerr(f.prefix, err)
+	return newSymlinkFileSystem(fs, "/", dir, o), nil
 }
 
-//Chtimes changes the access and modification times of the named file
-func (f *SymlinkFileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
-	err = f.fs.Chtimes(ppath, atime, mtime)
-	return fixerr(f.prefix, err)
-}
-
-//Chown changes the owner and group ids of the named file
-func (f *SymlinkFileSystem) Chown(name string, uid, gid int) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
-
-	err = f.fs.Chown(ppath, uid, gid)
-	return fixerr(f.prefix, err)
-}
-
-func (f *SymlinkFileSystem) Separator() uint8 {
-	return '/'
-}
-
-func (f *SymlinkFileSystem) ListSeparator() uint8 {
-	return ':'
-}
-
-func (f *SymlinkFileSystem) Chdir(dir string) error {
-	dir = path.Clean(dir)
-	if path.IsAbs(dir) {
-		f.cwd = dir
-		return nil
-	}
-
-	f.cwd = path.Join(f.cwd, dir)
-	return nil
-}
-
-func (f *SymlinkFileSystem) Getwd() (dir string, err error) {
-	return f.cwd, nil
-}
-
-func (f *SymlinkFileSystem) TempDir() string {
-	tmpdir := f.fs.TempDir()
-
-	if strings.HasPrefix(tmpdir, f.prefix+"/") {
-		return strings.TrimPrefix(tmpdir, f.prefix)
-	}
-
-	// We can't return the underlying TempDir if it breaks out of the prefix path.
-	return "/tmp"
-}
-
-func (f *SymlinkFileSystem) Open(name string) (absfs.File, error) {
+func (f *SymlinkFileSystem) Lstat(name string) (os.FileInfo, error) {
+	defer f.opts.profile("lstat", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := f.fs.Open(ppath)
-	if err != nil {
-		err = fixerr(f.prefix, err)
-		return nil, err
-	}
-
-	return &File{file, f.prefix, name}, nil
-}
-
-func (f *SymlinkFileSystem) Create(name string) (absfs.File, error) {
-	ppath, err := f.path(name)
-	if err != nil {
-		return nil, err
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.lstat(name)
 	}
-
-	file, err := f.fs.Create(ppath)
+	info, err := f.opts.lookup(ppath, true, f.sfs.Lstat)
 	if err != nil {
-		return nil, err
+		return nil, f.fixerr(err)
 	}
 
-	return &File{file, f.prefix, name}, err
+	return f.opts.stat(ppath, info), nil
 }
 
-func (f *SymlinkFileSystem) MkdirAll(name string, perm os.FileMode) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
-	}
-
-	return f.fs.MkdirAll(ppath, perm)
-}
+// ess
 
-func (f *SymlinkFileSystem) RemoveAll(name string) error {
+func (f *SymlinkFileSystem) Lchown(name string, uid, gid int) error {
+	defer f.opts.profile("lchown", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
-
-	return f.fs.RemoveAll(ppath)
-}
-
-func (f *SymlinkFileSystem) Truncate(name string, size int64) error {
-	ppath, err := f.path(name)
-	if err != nil {
+	if err := f.opts.modify("lchown", ppath); err != nil {
 		return err
 	}
 
-	return f.fs.Truncate(ppath, size)
-}
-
-func (f *SymlinkFileSystem) path(name string) (string, error) {
-	if name == "" {
-		name = f.cwd
-		//return "", &os.PathError{Op: "open", Path: "", Err: errors.New("no such file or directory")}
-	}
-
-	if name == "/" {
-		return f.prefix, nil
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.fixerr("lchown", name, b.fs.Chown(b.path, uid, gid))
 	}
-
-	if !path.IsAbs(name) {
-		name = path.Clean(name)
-	}
-	name = filepath.Join(f.prefix, name)
-
-	// We mustn't let any trickery escape the prefix path.
-	if !strings.HasPrefix(name, f.prefix) {
-		return "", &os.PathError{Op: "open", Path: name, Err: errors.New("no such file or directory")}
-	}
-	return name, nil
-}
-
-func (f *SymlinkFileSystem) Lstat(name string) (os.FileInfo, error) {
-	ppath, err := f.path(name)
+	err = f.sfs.Lchown(ppath, uid, gid)
 	if err != nil {
-		return nil, err
-	}
-
-	info, err := f.fs.Lstat(ppath)
-	return info, fixerr(f.prefix, err)
-}
-
-// ess
-
-func (f *SymlinkFileSystem) Lchown(name string, uid, gid int) error {
-	ppath, err := f.path(name)
-	if err != nil {
-		return err
+		return f.fixerr(err)
 	}
-
-	err = f.fs.Lchown(ppath, uid, gid)
-	return fixerr(f.prefix, err)
+	f.opts.record("lchown", vpath(f.prefix, ppath), "")
+	return nil
 }
 
 func (f *SymlinkFileSystem) Readlink(name string) (string, error) {
+	defer f.opts.profile("readlink", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return "", err
 	}
 
-	target, err := f.fs.Readlink(ppath)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.readlink(name)
+	}
+	target, err := f.sfs.Readlink(ppath)
 	if err != nil {
 		return "", err
 	}
 
-	target = strings.TrimPrefix(target, f.prefix)
+	target = vpath(f.prefix, target)
 
-	return target, fixerr(f.prefix, err)
+	return target, f.fixerr(err)
 }
 
 func (f *SymlinkFileSystem) Symlink(oldname, newname string) error {
+	defer f.opts.profile("symlink", newname)()
 	poldname, err := f.path(oldname)
 	if err != nil {
 		return err
@@ -301,21 +115,46 @@ func (f *SymlinkFileSystem) Symlink(oldname, newname string) error {
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("symlink", pnewname); err != nil {
+		return err
+	}
 
-	err = f.fs.Symlink(poldname, pnewname)
-	return fixerr(f.prefix, err)
+	err = f.sfs.Symlink(poldname, pnewname)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("symlink", vpath(f.prefix, pnewname), oldname)
+	return f.fixerr(f.opts.syncParents(f.fs, pnewname))
 }
 
 type FileSystem struct {
 	fs     absfs.FileSystem
 	cwd    string
 	prefix string
+	opts   *options
+
+	// sfs is fs if the FileSystem is wrapped by a SymlinkFileSystem
+	sfs absfs.SymlinkFileSystem
+}
+
+func newFileSystem(fs absfs.FileSystem, cwd, prefix string, o *options) *FileSystem {
+	return &FileSystem{fs: fs, cwd: cwd, prefix: prefix, opts: o}
+}
+
+// outer returns the filesystem with the methods `f` supports, to be passed to
+// code detecting optional interfaces such as symlink support.
+func (f *FileSystem) outer() absfs.FileSystem {
+	if f.sfs != nil {
+		return &SymlinkFileSystem{f}
+	}
+	return f
 }
 
 // NewFileSystem creates a new FileSystem from a `absfs.FileSystem` compatible object
 // and a path. The path must be an absolute path and must already exist in the
-// fs provided otherwise an error is returned.
-func NewFileSystem(fs absfs.FileSystem, dir string) (*FileSystem, error) {
+// fs provided, unless the WithCreateBase option is given, otherwise an error
+// is returned. Options enable optional behavior such as journaling.
+func NewFileSystem(fs absfs.FileSystem, dir string, opts ...Option) (*FileSystem, error) {
 	if dir == "" {
 		return nil, os.ErrInvalid
 	}
@@ -323,57 +162,77 @@ func NewFileSystem(fs absfs.FileSystem, dir string) (*FileSystem, error) {
 	if !path.IsAbs(dir) {
 		return nil, errors.New("not an absolute path")
 	}
-	info, err := fs.Stat(dir)
+	o, err := newOptions(fs, dir, opts)
 	if err != nil {
 		return nil, err
 	}
-	if !info.IsDir() {
-		return nil, errors.New("not a directory")
-	}
 
-	return &FileSystem{fs, "/", dir}, nil
+	return newFileSystem(fs, "/", dir, o), nil
 }
 
 // OpenFile opens a file using the given flags and the given mode.
 func (f *FileSystem) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	defer f.opts.profile("open", name)()
 	// flag := absfs.Flags(flags)
 	ppath, err := f.path(name)
 	if err != nil {
 		return new(absfs.InvalidFile), err
 	}
 
-	file, err := f.fs.OpenFile(ppath, flags, perm)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.open(name, flags, perm)
+	}
+	file, err := f.opts.openFile(f.fs, ppath, flags, perm)
 	if err != nil {
 		return new(absfs.InvalidFile), err
 	}
 
-	return &File{file, f.prefix, name}, fixerr(f.prefix, err)
+	bf := newFile(f.fs, f.opts, file, f.prefix, ppath, name, flags)
+	bf.track()
+	return bf, nil
 }
 
 // Mkdir creates a directory in the filesystem, return an error if any
 // happens.
 func (f *FileSystem) Mkdir(name string, perm os.FileMode) error {
+	defer f.opts.profile("mkdir", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("mkdir", ppath); err != nil {
+		return err
+	}
 	err = f.fs.Mkdir(ppath, perm)
-	return fixerr(f.prefix, err)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("mkdir", vpath(f.prefix, ppath), "")
+	return f.fixerr(f.opts.syncParents(f.fs, ppath))
 }
 
 // Remove removes a file identified by name, returning an error, if any
 // happens.
 func (f *FileSystem) Remove(name string) error {
+	defer f.opts.profile("remove", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("remove", ppath); err != nil {
+		return err
+	}
 
 	err = f.fs.Remove(ppath)
-	return fixerr(f.prefix, err)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("remove", vpath(f.prefix, ppath), "")
+	return f.fixerr(f.opts.syncParents(f.fs, ppath))
 }
 
 func (f *FileSystem) Rename(oldname, newname string) error {
+	defer f.opts.profile("rename", oldname)()
 	linkErr := os.LinkError{Op: "rename", Old: oldname, New: newname}
 	oldpath, err := f.path(oldname)
 	if err != nil {
@@ -385,56 +244,110 @@ func (f *FileSystem) Rename(oldname, newname string) error {
 		linkErr.Err = err
 		return &linkErr
 	}
+	if err := f.opts.modify("rename", oldpath); err != nil {
+		linkErr.Err = err
+		return &linkErr
+	}
+	if err := f.opts.modify("rename", newpath); err != nil {
+		linkErr.Err = err
+		return &linkErr
+	}
 	err = f.fs.Rename(oldpath, newpath)
-	return fixerr(f.prefix, err)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("rename", vpath(f.prefix, oldpath), vpath(f.prefix, newpath))
+	return f.fixerr(f.opts.syncParents(f.fs, oldpath, newpath))
 }
 
 // Stat returns the FileInfo structure describing file. If there is an error,
 // it will be of type *PathError.
 func (f *FileSystem) Stat(name string) (os.FileInfo, error) {
+	defer f.opts.profile("stat", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := f.fs.Stat(ppath)
+	return f.statPath(ppath, name)
+}
+
+// statPath returns the FileInfo of `ppath`, the translation of `name`.
+func (f *FileSystem) statPath(ppath, name string) (os.FileInfo, error) {
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.stat(name)
+	}
+	info, err := f.opts.lookup(ppath, false, f.fs.Stat)
 	if err != nil {
-		return nil, fixerr(f.prefix, err)
+		return nil, f.fixerr(err)
 	}
 
-	return &fileinfo{info, path.Base(name)}, nil
+	return &fileinfo{f.opts.stat(ppath, info), path.Base(name)}, nil
 }
 
 //Chmod changes the mode of the named file to mode.
 func (f *FileSystem) Chmod(name string, mode os.FileMode) error {
+	defer f.opts.profile("chmod", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("chmod", ppath); err != nil {
+		return err
+	}
 
-	err = f.fs.Chmod(ppath, mode)
-	return fixerr(f.prefix, err)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.fixerr("chmod", name, b.fs.Chmod(b.path, mode))
+	}
+	err = f.fs.Chmod(ppath, f.opts.execMode(f.fs, ppath, mode))
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("chmod", vpath(f.prefix, ppath), "")
+	return nil
 }
 
 //Chtimes changes the access and modification times of the named file
 func (f *FileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	defer f.opts.profile("chtimes", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("chtimes", ppath); err != nil {
+		return err
+	}
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.fixerr("chtimes", name, b.fs.Chtimes(b.path, atime, mtime))
+	}
 	err = f.fs.Chtimes(ppath, atime, mtime)
-	return fixerr(f.prefix, err)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("chtimes", vpath(f.prefix, ppath), "")
+	return nil
 }
 
 //Chown changes the owner and group ids of the named file
 func (f *FileSystem) Chown(name string, uid, gid int) error {
+	defer f.opts.profile("chown", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("chown", ppath); err != nil {
+		return err
+	}
 
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.fixerr("chown", name, b.fs.Chown(b.path, uid, gid))
+	}
 	err = f.fs.Chown(ppath, uid, gid)
-	return fixerr(f.prefix, err)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	f.opts.record("chown", vpath(f.prefix, ppath), "")
+	return nil
 }
 
 func (f *FileSystem) Separator() uint8 {
@@ -463,8 +376,8 @@ func (f *FileSystem) Getwd() (dir string, err error) {
 func (f *FileSystem) TempDir() string {
 	tmpdir := f.fs.TempDir()
 
-	if strings.HasPrefix(tmpdir, f.prefix+"/") {
-		return strings.TrimPrefix(tmpdir, f.prefix)
+	if tmpdir != f.prefix && within(f.prefix, tmpdir) {
+		return vpath(f.prefix, tmpdir)
 	}
 
 	// We can't return the underlying TempDir if it breaks out of the prefix path.
@@ -472,126 +385,168 @@ func (f *FileSystem) TempDir() string {
 }
 
 func (f *FileSystem) Open(name string) (absfs.File, error) {
+	defer f.opts.profile("open", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := f.fs.Open(ppath)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.open(name, os.O_RDONLY, 0)
+	}
+	file, err := f.opts.openFile(f.fs, ppath, os.O_RDONLY, 0)
 	if err != nil {
-		err = fixerr(f.prefix, err)
+		err = f.fixerr(err)
 		return nil, err
 	}
 
-	return &File{file, f.prefix, name}, nil
+	return newFile(f.fs, f.opts, file, f.prefix, ppath, name, os.O_RDONLY), nil
 }
 
 func (f *FileSystem) Create(name string) (absfs.File, error) {
+	defer f.opts.profile("create", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := f.fs.Create(ppath)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.open(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	}
+	file, err := f.opts.openFile(f.fs, ppath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return nil, err
 	}
 
-	return &File{file, f.prefix, name}, err
+	bf := newFile(f.fs, f.opts, file, f.prefix, ppath, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+	bf.track()
+	return bf, nil
 }
 
 func (f *FileSystem) MkdirAll(name string, perm os.FileMode) error {
+	defer f.opts.profile("mkdirall", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("mkdir", ppath); err != nil {
+		return err
+	}
 
-	return f.fs.MkdirAll(ppath, perm)
+	err = f.fs.MkdirAll(ppath, perm)
+	if err != nil {
+		return err
+	}
+	f.opts.record("mkdirall", vpath(f.prefix, ppath), "")
+	return f.fixerr(f.opts.syncParents(f.fs, ppath))
 }
 
 func (f *FileSystem) RemoveAll(name string) error {
+	defer f.opts.profile("removeall", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("remove", ppath); err != nil {
+		return err
+	}
 
-	return f.fs.RemoveAll(ppath)
+	err = f.fs.RemoveAll(ppath)
+	if err != nil {
+		return err
+	}
+	f.opts.record("removeall", vpath(f.prefix, ppath), "")
+	return f.fixerr(f.opts.syncParents(f.fs, ppath))
 }
 
 func (f *FileSystem) Truncate(name string, size int64) error {
+	defer f.opts.profile("truncate", name)()
 	ppath, err := f.path(name)
 	if err != nil {
 		return err
 	}
+	if err := f.opts.modify("truncate", ppath); err != nil {
+		return err
+	}
 
-	return f.fs.Truncate(ppath, size)
+	if b := f.opts.binds.get(ppath); b != nil {
+		return b.fixerr("truncate", name, b.fs.Truncate(b.path, size))
+	}
+	if err := f.opts.resize(f.fs, ppath, size); err != nil {
+		return &os.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	err = f.opts.truncate(f.fs, ppath, size)
+	if err != nil {
+		f.opts.settle(f.fs, ppath)
+		return err
+	}
+	return f.fixerr(f.opts.recordContent(f.fs, "truncate", ppath, vpath(f.prefix, ppath), nil))
+}
+
+// fixerr translates an error of the underlying filesystem, checking first
+// whether it was caused by the base directory disappearing.
+func (f *FileSystem) fixerr(err error) error {
+	f.opts.observe(f.fs, err)
+	return fixerr(f.prefix, err)
 }
 
 func (f *FileSystem) path(name string) (string, error) {
+	ppath, err := f.resolve(name)
+	if err != nil || !f.opts.restricted() {
+		return ppath, err
+	}
+	if err := f.opts.permit(ppath); err != nil {
+		return "", err
+	}
+	return ppath, nil
+}
+
+// resolve returns the path on the underlying filesystem of `name`.
+func (f *FileSystem) resolve(name string) (string, error) {
+	if err := f.opts.ready(f.fs); err != nil {
+		return "", err
+	}
+	if f.opts.revalidate || f.opts.failed.Load() {
+		if err := f.opts.checkBase(f.fs); err != nil {
+			return "", err
+		}
+	}
 	if name == "" {
 		name = f.cwd
 		//return "", &os.PathError{Op: "open", Path: "", Err: errors.New("no such file or directory")}
 	}
+	if len(f.opts.rewriters) > 0 || f.opts.aliases.n.Load() > 0 {
+		var err error
+		if name, err = f.opts.rewrite(name); err != nil {
+			return "", err
+		}
+	}
+
+	// With the root as the base no name can escape it, so cleaning suffices.
+	if f.prefix == "/" {
+		if path.IsAbs(name) {
+			return path.Clean(name), nil
+		}
+		return path.Clean("/" + name), nil
+	}
 
 	if name == "/" {
 		return f.prefix, nil
 	}
 
-	if !path.IsAbs(name) {
-		name = path.Clean(name)
+	if f.opts.paths != nil {
+		if ppath, ok := f.opts.paths.get(name); ok {
+			return ppath, nil
+		}
 	}
-	name = filepath.Join(f.prefix, name)
 
 	// We mustn't let any trickery escape the prefix path.
-	if !strings.HasPrefix(name, f.prefix) {
-		return "", &os.PathError{Op: "open", Path: name, Err: errors.New("no such file or directory")}
-	}
-	return name, nil
-}
-
-type walker interface {
-	Walk(string, func(string, os.FileInfo, error) error) error
-}
-
-type fastwalker interface {
-	FastWalk(string, func(string, os.FileMode) error) error
-}
-
-var errNoWalk = errors.New("walk function not supported by underlying filesystem")
-var errNoFastWalk = errors.New("fastwalk function not supported by underlying filesystem")
-
-func (fs *SymlinkFileSystem) Walk(name string, fn filepath.WalkFunc) error {
-	ppath, err := fs.path(name)
-	if err != nil {
-		return err
-	}
-	wfs, ok := fs.fs.(walker)
+	ppath, ok := join(f.prefix, name)
 	if !ok {
-		return errNoWalk
+		return "", errEscape(name)
 	}
-	return wfs.Walk(ppath, func(path string, info os.FileInfo, err error) error {
-		p := strings.TrimPrefix(path, fs.prefix)
-		if p == "" {
-			p = "/"
-		}
-		return fn(p, info, err)
-	})
-}
-
-func (fs *SymlinkFileSystem) FastWalk(name string, fn absfs.FastWalkFunc) error {
-	ppath, err := fs.path(name)
-	if err != nil {
-		return err
-	}
-	wfs, ok := fs.fs.(fastwalker)
-	if !ok {
-		return errNoFastWalk
+	if f.opts.paths != nil {
+		f.opts.paths.put(name, ppath)
 	}
-	return wfs.FastWalk(ppath, func(path string, mode os.FileMode) error {
-		p := strings.TrimPrefix(path, fs.prefix)
-		if p == "" {
-			p = "/"
-		}
-		return fn(p, mode)
-	})
+	return ppath, nil
 }
@@ -2,11 +2,14 @@ package basefs_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -153,6 +156,418 @@ func TestWalk(t *testing.T) {
 	})
 }
 
+func TestWalkFollowSymlinks(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/dir/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/dir/sub/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("/dir", "/link"); err != nil {
+		t.Skip(err)
+	}
+	if err := bfs.Symlink("/dir", "/dir/sub/loop"); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(opts ...basefs.WalkOption) []string {
+		var paths []string
+		err := bfs.Walk("/", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+
+	paths := walk()
+	expected := "/ /dir /dir/sub /dir/sub/file /dir/sub/loop /link"
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+
+	// Every directory is walked once, the link to /dir and the loop back to
+	// it are reported without their entries.
+	paths = walk(basefs.FollowSymlinks())
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+
+	paths = nil
+	err = bfs.FastWalk("/link", func(path string, mode os.FileMode) error {
+		if path == "/link" && !mode.IsDir() {
+			t.Errorf("expected /link to be reported as a directory, got %s", mode)
+		}
+		paths = append(paths, path)
+		return nil
+	}, basefs.FollowSymlinks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "/link /link/sub /link/sub/file /link/sub/loop"
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Opts  []basefs.WalkOption
+		Fails bool
+	}{
+		{[]basefs.WalkOption{basefs.MaxDepth(3)}, false},
+		{[]basefs.WalkOption{basefs.MaxDepth(2)}, true},
+		{[]basefs.WalkOption{basefs.MaxEntries(4)}, false},
+		{[]basefs.WalkOption{basefs.MaxEntries(3)}, true},
+	}
+	for i, test := range tests {
+		count := 0
+		err := bfs.Walk("/", func(path string, info os.FileInfo, err error) error {
+			count++
+			return err
+		}, test.Opts...)
+		if !test.Fails {
+			if err != nil || count != 4 {
+				t.Errorf("%d: walked %d files: %v", i, count, err)
+			}
+			continue
+		}
+		if !errors.Is(err, basefs.ErrWalkLimit) {
+			t.Errorf("%d: expected ErrWalkLimit, got %v", i, err)
+		}
+		err = bfs.FastWalk("/", func(path string, mode os.FileMode) error {
+			return nil
+		}, test.Opts...)
+		if !errors.Is(err, basefs.ErrWalkLimit) {
+			t.Errorf("%d: FastWalk: expected ErrWalkLimit, got %v", i, err)
+		}
+	}
+
+	err = bfs.Walk("/", func(string, os.FileInfo, error) error { return nil }, basefs.MaxDepth(0))
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for MaxDepth(0), got %v", err)
+	}
+}
+
+func TestWalkDeep(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := filepath.Join(dir, strings.Repeat("d/", 1000))
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "wide"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "wide", fmt.Sprint(i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]basefs.WalkOption{{basefs.MaxDepth(2000)}, {basefs.ReadBatch(7)}} {
+		seen := make(map[string]bool)
+		err := bfs.Walk("/", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if seen[path] {
+				t.Errorf("%s walked twice", path)
+			}
+			seen[path] = true
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the root, the nested directories, "wide" and its files
+		if len(seen) != 1+1000+1+100 {
+			t.Errorf("walked %d files", len(seen))
+		}
+		if !seen["/"+strings.Repeat("d/", 999)+"d"] || !seen["/wide/99"] {
+			t.Error("missed the deepest directory or a file")
+		}
+	}
+
+	// SkipDir for a file ends the walk of its directory.
+	count := 0
+	err = bfs.Walk("/wide", func(path string, info os.FileInfo, err error) error {
+		count++
+		if count == 10 {
+			return filepath.SkipDir
+		}
+		return err
+	}, basefs.ReadBatch(3))
+	if err != nil || count != 10 {
+		t.Errorf("walked %d files after SkipDir: %v", count, err)
+	}
+	err = bfs.Walk("/", func(string, os.FileInfo, error) error { return nil }, basefs.ReadBatch(0))
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for ReadBatch(0), got %v", err)
+	}
+}
+
+// lockedFS refuses to open directories named "locked".
+type lockedFS struct {
+	*osfs.FileSystem
+}
+
+func (fs lockedFS) Open(name string) (absfs.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs lockedFS) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	if filepath.Base(name) == "locked" {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return fs.FileSystem.OpenFile(name, flags, perm)
+}
+
+func TestWalkContinueOnError(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(lockedFS{ofs}, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a/locked", "/b/locked", "/c"} {
+		if err := bfs.MkdirAll(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var paths []string
+	fn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	}
+	err = bfs.Walk("/", fn, basefs.ContinueOnError())
+	if !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+	if strings.Count(err.Error(), "locked") != 2 {
+		t.Errorf("expected both locked directories to be reported, got %q", err)
+	}
+	expected := "/ /a /a/locked /b /b/locked /c"
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+
+	paths = nil
+	err = bfs.Walk("/", fn, basefs.MaxDepth(10))
+	if !errors.Is(err, os.ErrPermission) || len(paths) != 2 {
+		t.Errorf("expected the walk to stop at /a/locked, got %q: %v", paths, err)
+	}
+}
+
+func TestFastWalkChan(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/a/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for r := range bfs.FastWalkChan(context.Background(), "/") {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		paths = append(paths, r.Path)
+	}
+	sort.Strings(paths)
+	expected := "/ /a /a/b /a/file"
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+
+	var last basefs.WalkResult
+	for r := range bfs.FastWalkChan(context.Background(), "/missing") {
+		last = r
+	}
+	if !os.IsNotExist(last.Err) {
+		t.Errorf("expected a not exist error, got %v", last.Err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := bfs.FastWalkChan(ctx, "/", basefs.ContinueOnError())
+	<-results
+	cancel()
+	for r := range results {
+		if r.Err != nil {
+			t.Errorf("unexpected error after cancel: %v", r.Err)
+		}
+	}
+}
+
+func TestFastWalkOrdered(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, name := range []string{"/a", "/b", "/c"} {
+		expected = append(expected, name)
+		for _, sub := range []string{"/x", "/y", "/z"} {
+			if err := bfs.MkdirAll(name+sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, name+sub)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		paths := []string{}
+		err = bfs.FastWalk("/", func(path string, mode os.FileMode) error {
+			paths = append(paths, path)
+			return nil
+		}, basefs.Ordered())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(paths, " ") != "/ "+strings.Join(expected, " ") {
+			t.Fatalf("got %q", paths)
+		}
+	}
+}
+
+func TestWalkSkip(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a/skip", "/b/found", "/c"} {
+		if err := bfs.MkdirAll(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.WriteFile(name+"/file", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// visit skips /a/skip and stops at /b/found.
+	visit := func(paths *[]string, mu *sync.Mutex, path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*paths = append(*paths, path)
+		switch path {
+		case "/a/skip":
+			return filepath.SkipDir
+		case "/b/found":
+			return filepath.SkipAll
+		}
+		return nil
+	}
+
+	for _, opts := range [][]basefs.WalkOption{nil, {basefs.Ordered()}} {
+		var paths []string
+		var mu sync.Mutex
+		err := bfs.Walk("/", func(path string, info os.FileInfo, err error) error {
+			return visit(&paths, &mu, path)
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "/ /a /a/skip /b /b/found"
+		if strings.Join(paths, " ") != expected {
+			t.Errorf("Walk: got %q, expected %q", paths, expected)
+		}
+
+		paths = nil
+		err = bfs.FastWalk("/", func(path string, mode os.FileMode) error {
+			return visit(&paths, &mu, path)
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range paths {
+			if strings.HasPrefix(p, "/a/skip/") || strings.HasPrefix(p, "/b/found/") {
+				t.Errorf("FastWalk: %s should have been skipped", p)
+			}
+		}
+	}
+}
+
 func TestOpenFile(t *testing.T) {
 	// var err error
 	// var ofs absfs.FileSystem
@@ -419,3 +834,55 @@ func TestSymlinks(t *testing.T) {
 	}
 
 }
+
+func TestProfileHook(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithProfileHook(0, func(basefs.ProfileSample) {})); err == nil {
+		t.Error("accepted a sampling rate of 0")
+	}
+
+	var mu sync.Mutex
+	var samples []basefs.ProfileSample
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir),
+		basefs.WithProfileLabels(context.Background()),
+		basefs.WithProfilePaths(),
+		basefs.WithProfileHook(1, func(s basefs.ProfileSample) {
+			mu.Lock()
+			samples = append(samples, s)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := bfs.Stat("/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var ops []string
+	for _, s := range samples {
+		ops = append(ops, s.Op)
+		if s.Path != "/file.txt" || s.Backend != "*osfs.FileSystem" || s.Duration < 0 {
+			t.Errorf("unexpected sample %+v", s)
+		}
+	}
+	if strings.Join(ops, " ") != "create write stat" {
+		t.Errorf("sampled %q, want create, write and stat", ops)
+	}
+}
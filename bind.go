@@ -0,0 +1,237 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// binding is a file of another filesystem bound into the namespace, or a
+// virtual file with generated contents.
+type binding struct {
+	fs       absfs.FileSystem
+	path     string
+	writable bool
+
+	// whether the binding is a directory mounted with MountReadOnly
+	mount bool
+
+	// contents of a virtual file, see RegisterVirtual
+	content func() ([]byte, error)
+}
+
+// bindings maps paths on the underlying filesystem to bound and virtual files.
+type bindings struct {
+	mu      sync.RWMutex
+	m       map[string]*binding
+	n       atomic.Int32
+	virtual atomic.Int32
+	mounts  atomic.Int32
+}
+
+// get returns the binding of `ppath`, which is a binding of its own or a
+// file below a mounted directory.
+func (b *bindings) get(ppath string) *binding {
+	if b.n.Load() == 0 {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if bf := b.m[ppath]; bf != nil || b.mounts.Load() == 0 {
+		return bf
+	}
+	for dir := path.Dir(ppath); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if bf := b.m[dir]; bf != nil && bf.mount {
+			return &binding{fs: bf.fs, path: path.Join(bf.path, ppath[len(dir):]), mount: true}
+		}
+	}
+	return nil
+}
+
+func (b *bindings) copy() map[string]*binding {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	m := make(map[string]*binding, len(b.m))
+	for ppath, bf := range b.m {
+		m[ppath] = bf
+	}
+	return m
+}
+
+func (b *bindings) set(ppath string, bf *binding) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bf == nil {
+		delete(b.m, ppath)
+	} else {
+		if b.m == nil {
+			b.m = make(map[string]*binding)
+		}
+		b.m[ppath] = bf
+	}
+	b.n.Store(int32(len(b.m)))
+	virtual, mounts := 0, 0
+	for _, bf := range b.m {
+		if bf.content != nil {
+			virtual++
+		}
+		if bf.mount {
+			mounts++
+		}
+	}
+	b.virtual.Store(int32(virtual))
+	b.mounts.Store(int32(mounts))
+}
+
+// remove removes the binding of `ppath` itself and reports whether there was
+// one.
+func (b *bindings) remove(ppath string) bool {
+	b.mu.RLock()
+	_, ok := b.m[ppath]
+	b.mu.RUnlock()
+	if ok {
+		b.set(ppath, nil)
+	}
+	return ok
+}
+
+// BindOption configures BindFile.
+type BindOption func(*binding)
+
+// BindWritable allows the bound file to be written to and its metadata to be
+// changed. Bound files are read only otherwise.
+func BindWritable() BindOption {
+	return func(b *binding) {
+		b.writable = true
+	}
+}
+
+// BindFile makes the regular file `realPath` of the filesystem `fs` appear at
+// the virtual path `virtualPath`, without giving access to anything else on
+// `fs`, e.g. to place a configuration file into a sandbox. Opening, reading
+// and, with BindWritable, writing and changing the metadata of the virtual
+// path use the bound file. Writes to a read only binding fail with EROFS, and
+// removing or renaming the virtual path fails with EBUSY. As with bind mounts
+// the bound file replaces whatever exists at the virtual path, and is only
+// listed in its directory if a file of that name exists there. The checks of
+// the filesystem's options apply to the virtual path, but bound files are not
+// subject to the content store, integrity, scanner or journal.
+func (f *FileSystem) BindFile(virtualPath string, fs absfs.FileSystem, realPath string, opts ...BindOption) error {
+	ppath, err := f.path(virtualPath)
+	if err != nil {
+		return err
+	}
+	if ppath == f.prefix {
+		return &os.PathError{Op: "bind", Path: virtualPath, Err: os.ErrInvalid}
+	}
+	info, err := fs.Stat(realPath)
+	if err != nil {
+		return &os.PathError{Op: "bind", Path: virtualPath, Err: cause(err)}
+	}
+	if !info.Mode().IsRegular() {
+		return &os.PathError{Op: "bind", Path: virtualPath, Err: errors.New("not a regular file")}
+	}
+	b := &binding{fs: fs, path: realPath}
+	for _, opt := range opts {
+		opt(b)
+	}
+	f.opts.binds.set(ppath, b)
+	return nil
+}
+
+// Unbind removes the binding of `virtualPath` made with BindFile or
+// MountReadOnly.
+func (f *FileSystem) Unbind(virtualPath string) error {
+	ppath, err := f.path(virtualPath)
+	if err != nil {
+		return err
+	}
+	if !f.opts.binds.remove(ppath) {
+		return &os.PathError{Op: "unbind", Path: virtualPath, Err: syscall.EINVAL}
+	}
+	return nil
+}
+
+// check returns the error of the operation `op` on the virtual path `name`
+// of the binding, if it is not allowed.
+func (b *binding) check(op, name string) error {
+	if b.content != nil || b.mount {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+	}
+	switch op {
+	case "open", "chmod", "chtimes", "chown", "lchown", "truncate", "setattrs":
+		if !b.writable {
+			return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+		}
+		return nil
+	}
+	return &os.PathError{Op: op, Path: name, Err: syscall.EBUSY}
+}
+
+// fixerr reports errors of the bound file under the virtual path `name`.
+func (b *binding) fixerr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &os.PathError{Op: op, Path: name, Err: cause(err)}
+}
+
+func (b *binding) open(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	if b.mount {
+		return b.openMounted(name, flags, perm)
+	}
+	if flags&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND) != 0 {
+		if err := b.check("open", name); err != nil {
+			return nil, err
+		}
+	}
+	if flags&O_DIRECTORY != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTDIR}
+	}
+	if b.content != nil {
+		return b.openVirtual(name)
+	}
+	file, err := b.fs.OpenFile(b.path, flags&^(os.O_CREATE|O_NOFOLLOW|O_DIRECTORY), perm)
+	if err != nil {
+		return nil, b.fixerr("open", name, err)
+	}
+	return &boundFile{File: file, name: name, b: b}, nil
+}
+
+func (b *binding) stat(name string) (os.FileInfo, error) {
+	if b.content != nil {
+		return b.statVirtual(name)
+	}
+	info, err := b.fs.Stat(b.path)
+	if err != nil {
+		return nil, b.fixerr("stat", name, err)
+	}
+	return &fileinfo{info, path.Base(name)}, nil
+}
+
+// boundFile is an open bound file, which reports its virtual name.
+type boundFile struct {
+	absfs.File
+	name string
+	b    *binding
+}
+
+func (f *boundFile) Name() string {
+	return f.name
+}
+
+func (f *boundFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, f.b.fixerr("stat", f.name, err)
+	}
+	return &fileinfo{info, path.Base(f.name)}, nil
+}
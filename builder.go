@@ -0,0 +1,129 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/absfs/absfs"
+)
+
+// The layers a Builder applies its options in, from the base directory
+// outwards.
+const (
+	layerBase = iota
+	layerPolicy
+	layerQuota
+	layerAudit
+	layerCustom
+)
+
+// Builder composes a filesystem step by step. The options given are applied
+// in a fixed order regardless of the order of the calls: the base directory
+// first, then access policies, quotas, auditing and finally options added
+// with With. The first error encountered is returned by Build.
+type Builder struct {
+	dir  string
+	opts []layered
+	err  error
+}
+
+type layered struct {
+	layer int
+	opt   Option
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return new(Builder)
+}
+
+func (b *Builder) add(layer int, opt Option) *Builder {
+	b.opts = append(b.opts, layered{layer, opt})
+	return b
+}
+
+// Base sets the base directory, an absolute path on the underlying
+// filesystem. It must be called exactly once.
+func (b *Builder) Base(dir string) *Builder {
+	if b.dir != "" && b.err == nil {
+		b.err = errors.New("basefs: base directory set twice")
+	}
+	b.dir = dir
+	return b
+}
+
+// CreateBase adds WithCreateBase.
+func (b *Builder) CreateBase(perm os.FileMode) *Builder {
+	return b.add(layerBase, WithCreateBase(perm))
+}
+
+// ReadOnly adds WithReadOnly.
+func (b *Builder) ReadOnly() *Builder {
+	return b.add(layerPolicy, WithReadOnly())
+}
+
+// Allow adds WithAllow.
+func (b *Builder) Allow(patterns ...string) *Builder {
+	return b.add(layerPolicy, WithAllow(patterns...))
+}
+
+// Deny adds WithDeny.
+func (b *Builder) Deny(patterns ...string) *Builder {
+	return b.add(layerPolicy, WithDeny(patterns...))
+}
+
+// WithQuota adds WithQuota.
+func (b *Builder) WithQuota(bytes int64) *Builder {
+	return b.add(layerQuota, WithQuota(bytes))
+}
+
+// WithAudit records every mutation as a line of JSON written to `w`, see
+// Journal.
+func (b *Builder) WithAudit(w io.Writer) *Builder {
+	return b.add(layerAudit, WithJournal(NewJournal(w)))
+}
+
+// With adds arbitrary options, applied after all others.
+func (b *Builder) With(opts ...Option) *Builder {
+	for _, opt := range opts {
+		b.add(layerCustom, opt)
+	}
+	return b
+}
+
+// Options returns the options collected so far in the order they are applied.
+func (b *Builder) Options() []Option {
+	sorted := make([]layered, len(b.opts))
+	copy(sorted, b.opts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].layer < sorted[j].layer
+	})
+	opts := make([]Option, len(sorted))
+	for i, l := range sorted {
+		opts[i] = l.opt
+	}
+	return opts
+}
+
+// Build creates the filesystem on top of `fs`. The result is a
+// SymlinkFileSystem if `fs` supports symlinks and a FileSystem otherwise.
+func (b *Builder) Build(fs absfs.FileSystem) (absfs.FileSystem, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if sfs, ok := fs.(absfs.SymlinkFileSystem); ok {
+		return filesystem(NewFS(sfs, b.dir, b.Options()...))
+	}
+	return filesystem(NewFileSystem(fs, b.dir, b.Options()...))
+}
+
+// filesystem returns the result of a constructor as an interface, which is
+// nil on errors.
+func filesystem[T absfs.FileSystem](fs T, err error) (absfs.FileSystem, error) {
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
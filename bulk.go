@@ -0,0 +1,190 @@
+package basefs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+
+	"github.com/absfs/absfs"
+)
+
+// ReadFileFS is implemented by filesystems which can read a whole file at
+// once more efficiently than through Open. Unlike fs.ReadFileFS it does not
+// require the Open method of fs.FS, which conflicts with absfs.
+//
+// The bulk operations ReadFile, WriteFile and ReadDir are delegated to the
+// underlying filesystem if it implements ReadFileFS, WriteFileFS or ReadDirFS
+// respectively, with the path translated, unless an option needs to see the
+// individual file operations:
+//
+//   - no operation is delegated with WithContentStore, as files are not
+//     stored under their names
+//   - ReadFile is not delegated with WithIntegrity or WithNegativeCache
+//   - ReadFile and WriteFile are not delegated with WithRegularFilesOnly
+//   - ReadFile is not delegated with WithReadTransformer, and WriteFile not
+//     with WithWriteTransformer
+//   - ReadDir is not delegated with WithDirCache or virtual files
+//   - no operation is delegated for files bound with BindFile or below
+//     directories mounted with MountReadOnly
+//
+// Files written by a delegated WriteFile are still subject to the scanner,
+// content type, quota and journal options. Otherwise the operations are
+// emulated with OpenFile and the filesystem's File methods.
+type ReadFileFS interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// WriteFileFS is implemented by filesystems which can write a whole file at
+// once more efficiently than through OpenFile.
+type WriteFileFS interface {
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// ReadDirFS is implemented by filesystems which can list a directory more
+// efficiently than through Open and Readdir. Unlike fs.ReadDirFS it does not
+// require the Open method of fs.FS, which conflicts with absfs.
+type ReadDirFS interface {
+	ReadDir(name string) ([]iofs.DirEntry, error)
+}
+
+// ReadFile returns the contents of the named file.
+func (f *FileSystem) ReadFile(name string) ([]byte, error) {
+	ppath, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := f.fs.(ReadFileFS); ok && f.opts.cas == nil && f.opts.integrity == nil && f.opts.missing == nil && !f.opts.regularOnly && len(f.opts.readTransformers) == 0 && f.opts.binds.get(ppath) == nil {
+		data, err := r.ReadFile(ppath)
+		return data, f.fixerr(err)
+	}
+	return readFile(f.outer(), name)
+}
+
+// WriteFile writes `data` to the named file, creating it with the
+// permissions `perm` if necessary, and truncating it otherwise.
+func (f *FileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if w, ok := f.fs.(WriteFileFS); ok && f.opts.cas == nil && !f.opts.regularOnly && len(f.opts.writeTransformers) == 0 && f.opts.binds.get(ppath) == nil {
+		if err := f.opts.modify("open", ppath); err != nil {
+			return err
+		}
+		if _, err := f.opts.admit(f.fs, ppath, os.O_WRONLY|os.O_CREATE); err != nil {
+			return &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		if err := f.opts.resize(f.fs, ppath, int64(len(data))); err != nil {
+			return &os.PathError{Op: "write", Path: name, Err: err}
+		}
+		f.opts.creating()
+		if err := w.WriteFile(ppath, data, perm); err != nil {
+			f.opts.settle(f.fs, ppath)
+			return f.fixerr(err)
+		}
+		if err := f.opts.syncParents(f.fs, ppath); err != nil {
+			return f.fixerr(err)
+		}
+		if p := f.opts.syncPolicy; p == SyncAlways || p == SyncOnClose {
+			if err := syncPath(f.fs, ppath); err != nil {
+				return f.fixerr(err)
+			}
+		}
+		var digest []byte
+		if f.opts.checksums != nil {
+			h := f.opts.checksums.newHash()
+			h.Write(data)
+			digest = h.Sum(nil)
+		}
+		return fixerr(f.prefix, f.opts.written(f.fs, ppath, vpath(f.prefix, ppath), digest))
+	}
+	return writeFile(f.outer(), name, data, perm)
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (f *FileSystem) ReadDir(name string) ([]iofs.DirEntry, error) {
+	ppath, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := f.fs.(ReadDirFS); ok && f.opts.cas == nil && f.opts.dirs == nil && f.opts.binds.virtual.Load() == 0 && f.opts.binds.get(ppath) == nil {
+		entries, err := r.ReadDir(ppath)
+		visible := entries[:0]
+		for _, e := range entries {
+			if f.opts.visible(path.Join(ppath, path.Base(e.Name()))) {
+				visible = append(visible, &virtualEntry{e})
+			}
+		}
+		return visible, f.fixerr(err)
+	}
+	return readDirEntries(f.outer(), name)
+}
+
+func readFile(fs absfs.FileSystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var size int
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		size = int(info.Size())
+	}
+	data := make([]byte, 0, size+512)
+	for {
+		n, err := f.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err != nil {
+			if err == io.EOF {
+				return data, nil
+			}
+			return data, err
+		}
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+	}
+}
+
+func writeFile(fs absfs.FileSystem, name string, data []byte, perm os.FileMode) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func readDirEntries(fs absfs.FileSystem, name string) ([]iofs.DirEntry, error) {
+	infos, err := readDir(fs, name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		fi, ok := info.(*fileinfo)
+		if !ok {
+			fi = &fileinfo{info, path.Base(info.Name())}
+		}
+		entries[i] = fi
+	}
+	return entries, nil
+}
+
+// virtualEntry is an entry returned by the ReadDir method of the underlying
+// filesystem, whose FileInfo is made to report the name of the entry.
+type virtualEntry struct {
+	iofs.DirEntry
+}
+
+func (e *virtualEntry) Info() (iofs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &fileinfo{info, e.Name()}, nil
+}
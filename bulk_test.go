@@ -0,0 +1,120 @@
+package basefs_test
+
+import (
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+// bulkFS adds native bulk operations to osfs, counting their use.
+type bulkFS struct {
+	*osfs.FileSystem
+	calls int
+}
+
+func (fs *bulkFS) ReadFile(name string) ([]byte, error) {
+	fs.calls++
+	return os.ReadFile(name)
+}
+
+func (fs *bulkFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	fs.calls++
+	return os.WriteFile(name, data, perm)
+}
+
+func (fs *bulkFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	fs.calls++
+	entries, err := os.ReadDir(name)
+	for i, e := range entries {
+		entries[i] = leakyEntry{e, name}
+	}
+	return entries, err
+}
+
+// leakyEntry reports the full path on the underlying filesystem as the name
+// in its FileInfo.
+type leakyEntry struct {
+	iofs.DirEntry
+	dir string
+}
+
+func (e leakyEntry) Info() (iofs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return leakyInfo{info, filepath.Join(e.dir, e.Name())}, nil
+}
+
+type leakyInfo struct {
+	iofs.FileInfo
+	name string
+}
+
+func (i leakyInfo) Name() string {
+	return i.name
+}
+
+func TestBulk(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Bulk  bool
+		Opts  []basefs.Option
+		Calls int
+	}{
+		{false, nil, 0},
+		{true, nil, 4},
+		// ReadFile is not delegated with the negative cache
+		{true, []basefs.Option{basefs.WithNegativeCache(10, time.Hour)}, 2},
+	}
+	for i, test := range tests {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bulk := &bulkFS{FileSystem: ofs}
+		var bfs *basefs.SymlinkFileSystem
+		if test.Bulk {
+			bfs, err = basefs.NewFS(bulk, filepath.ToSlash(dir), test.Opts...)
+		} else {
+			bfs, err = basefs.NewFS(ofs, filepath.ToSlash(dir), test.Opts...)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = bfs.WriteFile("/file.txt", []byte("hello"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := bfs.ReadFile("file.txt")
+		if err != nil || string(data) != "hello" {
+			t.Errorf("%d: got %q %v", i, data, err)
+		}
+		entries, err := bfs.ReadDir("/")
+		if err != nil || len(entries) != 1 || entries[0].Name() != "file.txt" {
+			t.Errorf("%d: got %v %v", i, entries, err)
+		}
+		if len(entries) == 1 {
+			info, err := entries[0].Info()
+			if err != nil || info.Name() != "file.txt" || !entries[0].Type().IsRegular() {
+				t.Errorf("%d: got %v %v", i, info, err)
+			}
+		}
+		if _, err := bfs.ReadFile("/missing"); !os.IsNotExist(err) {
+			t.Errorf("%d: expected a missing file, got %v", i, err)
+		}
+		if bulk.calls != test.Calls {
+			t.Errorf("%d: got %d native calls, expected %d", i, bulk.calls, test.Calls)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package basefs
+
+import (
+	"runtime"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+)
+
+// Capabilities describes the features a filesystem supports, taking both the
+// underlying filesystem and the configured options into account.
+type Capabilities struct {
+	// Write is false for read only filesystems.
+	Write bool `json:"write"`
+
+	// Symlinks reports support for symbolic links.
+	Symlinks bool `json:"symlinks"`
+
+	// Hardlinks and Xattrs report support for hard links and extended
+	// attributes, which basefs doesn't provide.
+	Hardlinks bool `json:"hardlinks"`
+	Xattrs    bool `json:"xattrs"`
+
+	// Chown reports whether ownership can be changed at all. Changing it
+	// usually requires privileges nonetheless.
+	Chown bool `json:"chown"`
+
+	// SparseFiles reports whether SeekData and SeekHole locate the holes in
+	// sparse files instead of treating each file as a single data region.
+	SparseFiles bool `json:"sparse_files"`
+
+	// SecureRemove reports whether RemoveSecure can overwrite files in
+	// place.
+	SecureRemove bool `json:"secure_remove"`
+
+	// Locking reports support for file locks, which basefs doesn't provide.
+	Locking bool `json:"locking"`
+
+	// Watch reports support for Watch. NativeWatch is true if changes are
+	// reported by the operating system instead of found by polling.
+	Watch       bool `json:"watch"`
+	NativeWatch bool `json:"native_watch"`
+}
+
+// Capabilities reports the features supported by the filesystem.
+func (f *FileSystem) Capabilities() Capabilities {
+	_, host := f.fs.(*osfs.FileSystem)
+	_, symlinks := f.outer().(absfs.SymlinkFileSystem)
+	return Capabilities{
+		Write:        !f.opts.readOnly,
+		Symlinks:     symlinks,
+		Chown:        !f.opts.readOnly && !(host && runtime.GOOS == "windows"),
+		SparseFiles:  host && hasSparseSeek && f.opts.cas == nil,
+		SecureRemove: !f.opts.readOnly && host && f.opts.cas == nil,
+		Watch:        true,
+		NativeWatch:  host,
+	}
+}
@@ -0,0 +1,290 @@
+package basefs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// refMagic starts every reference file written in content store mode.
+const refMagic = "basefs-object sha256:"
+
+// WithContentStore enables content addressed storage. The contents of every
+// file written through basefs are stored once per distinct SHA-256 hash below
+// `dir`, an absolute path on the underlying filesystem, and the file inside
+// the base is replaced by a small reference to the stored object. References
+// are resolved transparently, so the tree looks and behaves as usual through
+// basefs. The store keeps an index of the references it wrote in "refs.json"
+// in `dir`, so that only those are resolved, without reading the files, and
+// files written before the store was enabled, or behind its back, are read as
+// they are even if they look like references.
+func WithContentStore(dir string) Option {
+	return func(o *options) error {
+		if !path.IsAbs(dir) {
+			return &os.PathError{Op: "contentstore", Path: dir, Err: errors.New("not an absolute path")}
+		}
+		o.casDir = path.Clean(dir)
+		return nil
+	}
+}
+
+type contentStore struct {
+	fs  absfs.FileSystem
+	dir string
+
+	// the references written by the store, by virtual path
+	refs *integrityIndex
+}
+
+// newContentStore opens the content store in `dir` on the underlying
+// filesystem `fs` for the files below `base`.
+func newContentStore(fs absfs.FileSystem, dir, base string) (*contentStore, error) {
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	cs := &contentStore{fs: fs, dir: dir, refs: &integrityIndex{path: path.Join(dir, "refs.json")}}
+	if err := cs.refs.load(fs, base); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+type reference struct {
+	sum  string
+	size int64
+}
+
+func (cs *contentStore) object(sum string) string {
+	return path.Join(cs.dir, sum[:2], sum[2:])
+}
+
+// resolve reports whether the regular file at `ppath`, described by `info`,
+// is a reference written by the store.
+func (cs *contentStore) resolve(ppath string, info os.FileInfo) (reference, bool) {
+	var ref reference
+	if !info.Mode().IsRegular() {
+		return ref, false
+	}
+	cs.refs.mu.Lock()
+	line, ok := cs.refs.sums[vpath(cs.refs.prefix, ppath)]
+	cs.refs.mu.Unlock()
+	if !ok {
+		return ref, false
+	}
+	_, err := fmt.Sscanf(line, "%64s %d", &ref.sum, &ref.size)
+	if err != nil || info.Size() != int64(len(ref.String())) {
+		return ref, false
+	}
+	return ref, true
+}
+
+// String returns the contents of the reference file.
+func (ref reference) String() string {
+	return fmt.Sprintf("%s%s %d\n", refMagic, ref.sum, ref.size)
+}
+
+// stat returns `info` for `ppath` with the size of the referenced object.
+func (cs *contentStore) stat(ppath string, info os.FileInfo) os.FileInfo {
+	if ref, ok := cs.resolve(ppath, info); ok {
+		return &sizedInfo{info, ref.size}
+	}
+	return info
+}
+
+func (cs *contentStore) openFile(ppath string, flags int, perm os.FileMode) (absfs.File, error) {
+	// Open the target read only, which creates it or fails with the errors
+	// expected for the original flags.
+	target, err := cs.fs.OpenFile(ppath, flags&^(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND), perm)
+	if err != nil {
+		return nil, err
+	}
+	info, err := target.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		if err == nil && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+			err = &os.PathError{Op: "open", Path: ppath, Err: syscall.EISDIR}
+		}
+		if err != nil {
+			target.Close()
+			return nil, err
+		}
+		return target, nil
+	}
+
+	var body absfs.File = target
+	ref, isRef := cs.resolve(ppath, info)
+	if isRef {
+		body, err = cs.fs.Open(cs.object(ref.sum))
+		target.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &casFile{File: body, info: info}, nil
+	}
+	defer body.Close()
+
+	stage := path.Join(cs.dir, "tmp-"+randomName())
+	f, err := cs.fs.OpenFile(stage, os.O_RDWR|os.O_CREATE|os.O_EXCL|flags&os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if flags&os.O_TRUNC == 0 {
+		_, err = io.Copy(f, body)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			f.Close()
+			cs.fs.Remove(stage)
+			return nil, err
+		}
+	}
+	return &casFile{File: f, info: info, cs: cs, ppath: ppath, stage: stage}, nil
+}
+
+// commit moves the staged contents into the store and points the target at
+// them.
+func (cs *contentStore) commit(stage, ppath string, perm os.FileMode) error {
+	sum, err := hashFile(cs.fs, stage, sha256.New)
+	if err != nil {
+		return err
+	}
+	info, err := cs.fs.Stat(stage)
+	if err != nil {
+		return err
+	}
+	ref := reference{hex.EncodeToString(sum), info.Size()}
+
+	obj := cs.object(ref.sum)
+	if _, err := cs.fs.Stat(obj); err == nil {
+		cs.fs.Remove(stage)
+	} else {
+		err = cs.fs.MkdirAll(path.Dir(obj), 0755)
+		if err == nil {
+			err = cs.fs.Rename(stage, obj)
+		}
+		if err == nil {
+			err = cs.fs.Chmod(obj, 0444)
+		}
+		if err != nil {
+			cs.fs.Remove(stage)
+			return err
+		}
+	}
+
+	f, err := cs.fs.OpenFile(ppath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, ref.String())
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	cs.refs.mu.Lock()
+	defer cs.refs.mu.Unlock()
+	return cs.refs.append(indexChange{vpath(cs.refs.prefix, ppath), fmt.Sprintf("%s %d", ref.sum, ref.size)})
+}
+
+// prune removes every stored object not referenced from the base.
+func (cs *contentStore) prune() (int, error) {
+	used := make(map[string]bool)
+	cs.refs.mu.Lock()
+	for _, line := range cs.refs.sums {
+		sum, _, _ := strings.Cut(line, " ")
+		used[sum] = true
+	}
+	cs.refs.mu.Unlock()
+
+	removed := 0
+	err := walk(cs.fs, cs.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		// the index and staging files are next to the object directories
+		if path.Dir(p) == cs.dir {
+			return nil
+		}
+		sum := strings.Replace(strings.TrimPrefix(p, cs.dir+"/"), "/", "", 1)
+		if used[sum] {
+			return nil
+		}
+		if err := cs.fs.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// PruneObjects removes stored objects which are no longer referenced by any
+// file in the base, returning the number of objects removed. It must not be
+// used while other filesystems share the same content store.
+func (f *FileSystem) PruneObjects() (int, error) {
+	if f.opts.cas == nil {
+		return 0, errNoContentStore
+	}
+	return f.opts.cas.prune()
+}
+
+var errNoContentStore = errors.New("content store not enabled")
+
+func randomName() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// casFile is a file opened in content store mode. Read handles read the stored
+// object directly, write handles write to a staging file which is committed
+// to the store on Close.
+type casFile struct {
+	absfs.File
+	info  os.FileInfo
+	cs    *contentStore
+	ppath string
+	stage string
+}
+
+func (f *casFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &sizedInfo{f.info, info.Size()}, nil
+}
+
+func (f *casFile) Close() error {
+	err := f.File.Close()
+	if f.cs == nil {
+		return err
+	}
+	if err != nil {
+		f.cs.fs.Remove(f.stage)
+		return err
+	}
+	return f.cs.commit(f.stage, f.ppath, f.info.Mode().Perm())
+}
+
+// sizedInfo overrides the size reported by a FileInfo.
+type sizedInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i *sizedInfo) Size() int64 {
+	return i.size
+}
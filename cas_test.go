@@ -0,0 +1,149 @@
+package basefs_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestContentStore(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	err = os.Mkdir(filepath.Join(dir, "base"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := dir + "/objects"
+
+	bfs, err := basefs.NewFileSystem(ofs, dir+"/base", basefs.WithContentStore(objects))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/a.txt", "/b.txt"} {
+		f, err := bfs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("duplicate contents")
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func() int {
+		n := 0
+		filepath.Walk(objects, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && filepath.Dir(p) != objects {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected a single stored object, found %d", n)
+	}
+
+	info, err := bfs.Stat("/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len("duplicate contents")) {
+		t.Errorf("unexpected size %d", info.Size())
+	}
+
+	f, err := bfs.OpenFile("/b.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(", changed")
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"/a.txt": "duplicate contents", "/b.txt": "duplicate contents, changed"} {
+		f, err := bfs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || string(data) != expected {
+			t.Errorf("%s: got %q %v, expected %q", name, data, err, expected)
+		}
+	}
+
+	if err = bfs.Remove("/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := bfs.PruneObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || count() != 1 {
+		t.Errorf("pruned %d objects, %d left", n, count())
+	}
+}
+
+func TestContentStoreForgedReference(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	if err := os.Mkdir(dir+"/base", 0755); err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, dir+"/base", basefs.WithContentStore(dir+"/objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/secret.txt", []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file planted behind the back of the store, referring to its object
+	sum := sha256.Sum256([]byte("secret"))
+	forged := fmt.Sprintf("basefs-object sha256:%x 6\n", sum)
+	if err := os.WriteFile(dir+"/base/forged.txt", []byte(forged), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := bfs.ReadFile("/forged.txt")
+	if err != nil || string(data) != forged {
+		t.Errorf("got %q %v, expected the planted file as it is", data, err)
+	}
+
+	// references follow renames, and the index survives reopening the store
+	if err := bfs.Rename("/secret.txt", "/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	bfs, err = basefs.NewFileSystem(ofs, dir+"/base", basefs.WithContentStore(dir+"/objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = bfs.ReadFile("/moved.txt")
+	if err != nil || string(data) != "secret" {
+		t.Errorf("got %q %v", data, err)
+	}
+	if n, err := bfs.PruneObjects(); err != nil || n != 0 {
+		t.Errorf("pruned %d objects, %v, expected the referenced object to be kept", n, err)
+	}
+}
@@ -0,0 +1,67 @@
+package basefs
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash"
+	"os"
+	"path"
+)
+
+// ErrNoChecksum is returned by Checksum for files without a recorded
+// checksum.
+var ErrNoChecksum = errors.New("no checksum recorded")
+
+// WithChecksums records a checksum of every file written through basefs in
+// the index file `index`, an absolute path on the underlying filesystem, using
+// hashes created by `h`, or SHA-256 if `h` is nil. Files written sequentially
+// after being created or truncated, as by Create and WriteFile, are hashed as
+// the data is written, other files are read once when they are closed. The
+// checksums follow renames and are available from Checksum, so that files
+// can later be verified without hashing them first. Like the integrity index,
+// changes are appended to "<index>.log" until they are merged into the index.
+func WithChecksums(index string, h func() hash.Hash) Option {
+	return func(o *options) error {
+		if !path.IsAbs(index) {
+			return &os.PathError{Op: "checksums", Path: index, Err: errors.New("not an absolute path")}
+		}
+		o.checksums = &integrityIndex{path: path.Clean(index), hash: h}
+		return nil
+	}
+}
+
+// Checksum returns the checksum recorded for the named file with
+// WithChecksums, or fails with ErrNoChecksum.
+func (f *FileSystem) Checksum(name string) ([]byte, error) {
+	ppath, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	name = vpath(f.prefix, ppath)
+	if f.opts.checksums == nil {
+		return nil, &os.PathError{Op: "checksum", Path: name, Err: ErrNoChecksum}
+	}
+	ix := f.opts.checksums
+	ix.mu.Lock()
+	sum, ok := ix.sums[name]
+	ix.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "checksum", Path: name, Err: ErrNoChecksum}
+	}
+	return hex.DecodeString(sum)
+}
+
+// digest returns the checksum of the data written to the file, if all of it
+// was written sequentially since the file was truncated.
+func (f *File) digest() []byte {
+	if f.sum == nil {
+		return nil
+	}
+	return f.sum.Sum(nil)
+}
+
+// unhash stops hashing the data written to the file, after an operation
+// which makes it impossible to tell the resulting contents.
+func (f *File) unhash() {
+	f.sum = nil
+}
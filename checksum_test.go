@@ -0,0 +1,81 @@
+package basefs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestChecksums(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	if err := os.Mkdir(dir+"/base", 0755); err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, dir+"/base", basefs.WithChecksums(dir+"/sums.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(fs *basefs.FileSystem, name, content string) {
+		t.Helper()
+		sum, err := fs.Checksum(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sha256.Sum256([]byte(content))
+		if !bytes.Equal(sum, want[:]) {
+			t.Errorf("%s: wrong checksum", name)
+		}
+	}
+
+	f, err := bfs.Create("/streamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello "))
+	f.WriteString("world")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(bfs, "/streamed", "hello world")
+
+	if err := bfs.WriteFile("/whole", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check(bfs, "/whole", "data")
+
+	f, err = bfs.OpenFile("/whole", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("D"), 0)
+	f.Close()
+	check(bfs, "/whole", "Data")
+
+	if err := bfs.Rename("/whole", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	check(bfs, "/moved", "Data")
+	if _, err := bfs.Checksum("/whole"); !errors.Is(err, basefs.ErrNoChecksum) {
+		t.Errorf("expected ErrNoChecksum, got %v", err)
+	}
+
+	reopened, err := basefs.NewFileSystem(ofs, dir+"/base", basefs.WithChecksums(dir+"/sums.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened, "/streamed", "hello world")
+}
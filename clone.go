@@ -0,0 +1,135 @@
+package basefs
+
+import "github.com/absfs/absfs"
+
+// Clone returns a new filesystem with the same underlying filesystem and base
+// directory, starting in the current working directory of `f`. The working
+// directories of both change independently afterwards. `opts` are applied on
+// top of the options of `f` and only affect the clone, giving for example a
+// request its own quota. Caches are shared, files opened through the clone are
+// closed by its Close.
+func (f *SymlinkFileSystem) Clone(opts ...Option) (*SymlinkFileSystem, error) {
+	o, err := f.opts.clone(f.fs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newSymlinkFileSystem(f.sfs, f.cwd, f.prefix, o), nil
+}
+
+// Clone returns a new filesystem with the same underlying filesystem and base
+// directory, starting in the current working directory of `f`. The working
+// directories of both change independently afterwards. `opts` are applied on
+// top of the options of `f` and only affect the clone, giving for example a
+// request its own quota. Caches are shared, files opened through the clone are
+// closed by its Close.
+func (f *FileSystem) Clone(opts ...Option) (*FileSystem, error) {
+	o, err := f.opts.clone(f.fs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newFileSystem(f.fs, f.cwd, f.prefix, o), nil
+}
+
+// clone copies the configuration in `o` and applies `opts` to the copy,
+// preparing the content store and integrity index if they were changed. The
+// options hold locks, so they are copied field by field; TestCloneOptions
+// fails when a field is missed.
+func (o *options) clone(fs absfs.FileSystem, opts []Option) (*options, error) {
+	c := &options{
+		base:       o.base,
+		revalidate: o.revalidate,
+		createBase: o.createBase,
+		basePerm:   o.basePerm,
+		lazy:       o.lazy,
+		failClosed: o.failClosed,
+
+		journal:   o.journal,
+		casDir:    o.casDir,
+		cas:       o.cas,
+		integrity: o.integrity,
+		checksums: o.checksums,
+		intentLog: o.intentLog,
+
+		scanner:     o.scanner,
+		quarantine:  o.quarantine,
+		deniedTypes: o.deniedTypes,
+		quota:       o.quota,
+		counter:     o.counter,
+		ledger:      o.ledger,
+		regularOnly: o.regularOnly,
+		noExec:      o.noExec,
+		subtrees:    o.subtrees,
+
+		readOnly:   o.readOnly,
+		allow:      o.allow,
+		deny:       o.deny,
+		validators: o.validators,
+		rewriters:  o.rewriters,
+
+		paths:   o.paths,
+		stats:   o.stats,
+		missing: o.missing,
+		dirs:    o.dirs,
+
+		readAhead:   o.readAhead,
+		writeBuffer: o.writeBuffer,
+		syncPolicy:  o.syncPolicy,
+		dirSync:     o.dirSync,
+
+		writeTransformers: o.writeTransformers,
+		readTransformers:  o.readTransformers,
+
+		stableHandles: o.stableHandles,
+
+		shutdown: o.shutdown,
+
+		backend:      o.backend,
+		profileCtx:   o.profileCtx,
+		profilePaths: o.profilePaths,
+		profileRate:  o.profileRate,
+		profileHook:  o.profileHook,
+		profileCount: o.profileCount,
+	}
+	o.baseMu.Lock()
+	c.baseInfo = o.baseInfo
+	c.baseReady.Store(o.baseReady.Load())
+	o.baseMu.Unlock()
+	c.failed.Store(o.failed.Load())
+	for alias, target := range o.aliases.copy() {
+		c.aliases.set(alias, target)
+	}
+	c.hidden.add(o.hidden.copy()...)
+	for ppath, b := range o.binds.copy() {
+		c.binds.set(ppath, b)
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.casDir != o.casDir {
+		c.cas = nil
+		if c.casDir != "" {
+			cas, err := newContentStore(fs, c.casDir, c.base)
+			if err != nil {
+				return nil, err
+			}
+			c.cas = cas
+		}
+	}
+	if c.integrity != o.integrity && c.integrity != nil {
+		err := c.integrity.load(fs, c.base)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.checksums != o.checksums && c.checksums != nil {
+		err := c.checksums.load(fs, c.base)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.watchShutdown()
+	return c, nil
+}
@@ -0,0 +1,146 @@
+package basefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrClosed is returned by walks, copies and watches which were interrupted
+// because the filesystem was closed, and by those started afterwards.
+var ErrClosed = errors.New("filesystem closed")
+
+// closers tracks resources like watchers which are released when the
+// filesystem is closed, and whether it was closed.
+type closers struct {
+	mu     sync.Mutex
+	m      map[io.Closer]struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func (c *closers) add(cl io.Closer) {
+	c.mu.Lock()
+	if c.m == nil {
+		c.m = make(map[io.Closer]struct{})
+	}
+	c.m[cl] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *closers) remove(cl io.Closer) {
+	c.mu.Lock()
+	delete(c.m, cl)
+	c.mu.Unlock()
+}
+
+// doneChan returns a channel which is closed when the filesystem is closed.
+func (c *closers) doneChan() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done == nil {
+		c.done = make(chan struct{})
+	}
+	return c.done
+}
+
+// shut marks the filesystem closed, interrupting the operations in progress.
+func (c *closers) shut() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done == nil {
+		c.done = make(chan struct{})
+	}
+	if !c.closed {
+		close(c.done)
+		c.closed = true
+	}
+}
+
+// isClosed reports whether the filesystem was closed.
+func (c *closers) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// take removes and returns all tracked resources.
+func (c *closers) take() []io.Closer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]io.Closer, 0, len(c.m))
+	for cl := range c.m {
+		list = append(list, cl)
+	}
+	c.m = nil
+	return list
+}
+
+// Close interrupts the walks, copies and watches in progress, which return
+// ErrClosed, closes the files opened through the filesystem which are still
+// open, stops its watchers and removes the paths registered with
+// RemoveOnClose. The underlying filesystem is not closed. The filesystem
+// should not be used after Close.
+func (f *FileSystem) Close() error {
+	return f.opts.close()
+}
+
+func (o *options) close() error {
+	o.closers.shut()
+	var errs []error
+	for _, f := range o.files.list() {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, cl := range o.closers.take() {
+		if err := cl.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closed fails with ErrClosed if the filesystem was closed.
+func (o *options) closed(op, name string) error {
+	if o.closers.isClosed() {
+		return &os.PathError{Op: op, Path: name, Err: ErrClosed}
+	}
+	return nil
+}
+
+// interrupted returns ErrClosed in place of `err` if the operation failed
+// because the filesystem was closed while it was running.
+func (o *options) interrupted(op, name string, err error) error {
+	if err != nil && !errors.Is(err, ErrClosed) && o.closers.isClosed() {
+		return &os.PathError{Op: op, Path: name, Err: ErrClosed}
+	}
+	return err
+}
+
+// WithShutdown closes the filesystem, as Close does, when `ctx` is done, e.g.
+// to tie a sandbox to the lifetime of a request or of the process. Clones are
+// closed along with it.
+func WithShutdown(ctx context.Context) Option {
+	return func(o *options) error {
+		o.shutdown = ctx
+		return nil
+	}
+}
+
+// watchShutdown closes the filesystem when the shutdown context is done.
+func (o *options) watchShutdown() {
+	if o.shutdown == nil {
+		return
+	}
+	done := o.closers.doneChan()
+	go func() {
+		select {
+		case <-o.shutdown.Done():
+			o.close()
+		case <-done:
+		}
+	}()
+}
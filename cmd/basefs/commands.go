@@ -0,0 +1,354 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// abs returns `p` as a clean absolute path, resolving relative paths against
+// the working directory.
+func (e *env) abs(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	cwd, _ := e.fs.Getwd()
+	return path.Join("/", cwd, p)
+}
+
+func newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+// walk calls `fn` for `root` and every file below it in lexical order,
+// without following symlinks.
+func (e *env) walk(root string, fn func(p string, info os.FileInfo) error) error {
+	root = e.abs(root)
+	info, err := e.fs.Lstat(root)
+	if err != nil {
+		return err
+	}
+	return e.walkInfo(root, info, fn)
+}
+
+func (e *env) walkInfo(p string, info os.FileInfo, fn func(p string, info os.FileInfo) error) error {
+	if err := fn(p, info); err != nil || !info.IsDir() {
+		return err
+	}
+	infos, err := e.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if err := e.walkInfo(path.Join(p, info.Name()), info, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *env) readDir(p string) ([]os.FileInfo, error) {
+	f, err := e.fs.Open(e.abs(p))
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, err
+}
+
+func ls(e *env, args []string) error {
+	flags := newFlags("ls")
+	long := flags.Bool("l", false, "long listing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	print := func(info os.FileInfo) {
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		if *long {
+			fmt.Fprintf(e.stdout, "%s %10d %s %s\n", info.Mode(), info.Size(), info.ModTime().Format("2006-01-02 15:04"), name)
+			return
+		}
+		fmt.Fprintln(e.stdout, name)
+	}
+
+	for i, p := range paths {
+		info, err := e.fs.Stat(e.abs(p))
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			print(info)
+			continue
+		}
+		if len(paths) > 1 {
+			if i > 0 {
+				fmt.Fprintln(e.stdout)
+			}
+			fmt.Fprintf(e.stdout, "%s:\n", p)
+		}
+		infos, err := e.readDir(p)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			print(info)
+		}
+	}
+	return nil
+}
+
+func cat(e *env, args []string) error {
+	for _, p := range args {
+		f, err := e.fs.Open(e.abs(p))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(e.stdout, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cp(e *env, args []string) error {
+	flags := newFlags("cp")
+	recursive := flags.Bool("r", false, "copy directories recursively")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: cp [-r] src dst")
+	}
+	src, dst := e.abs(flags.Arg(0)), e.abs(flags.Arg(1))
+	if info, err := e.fs.Stat(dst); err == nil && info.IsDir() {
+		dst = path.Join(dst, path.Base(src))
+	}
+	info, err := e.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && !*recursive {
+		return fmt.Errorf("%s is a directory (not copied)", src)
+	}
+
+	return e.walk(src, func(p string, info os.FileInfo) error {
+		target := path.Join(dst, strings.TrimPrefix(p, src))
+		switch {
+		case info.IsDir():
+			return e.fs.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := e.fs.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return e.fs.Symlink(link, target)
+		}
+		return e.copyFile(p, target, info.Mode().Perm())
+	})
+}
+
+func (e *env) copyFile(src, dst string, perm os.FileMode) error {
+	in, err := e.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := e.fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func mv(e *env, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: mv src dst")
+	}
+	src, dst := e.abs(args[0]), e.abs(args[1])
+	if info, err := e.fs.Stat(dst); err == nil && info.IsDir() {
+		dst = path.Join(dst, path.Base(src))
+	}
+	return e.fs.Rename(src, dst)
+}
+
+func rm(e *env, args []string) error {
+	flags := newFlags("rm")
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	for _, p := range flags.Args() {
+		p = e.abs(p)
+		var err error
+		if *recursive {
+			if _, err = e.fs.Lstat(p); err == nil {
+				err = e.fs.RemoveAll(p)
+			}
+		} else {
+			err = e.fs.Remove(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mkdir(e *env, args []string) error {
+	flags := newFlags("mkdir")
+	parents := flags.Bool("p", false, "create parent directories as needed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	for _, p := range flags.Args() {
+		p = e.abs(p)
+		var err error
+		if *parents {
+			err = e.fs.MkdirAll(p, 0755)
+		} else {
+			err = e.fs.Mkdir(p, 0755)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func du(e *env, args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for _, p := range args {
+		var total int64
+		err := e.walk(p, func(_ string, info os.FileInfo) error {
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "%d\t%s\n", total, p)
+	}
+	return nil
+}
+
+func find(e *env, args []string) error {
+	root := "."
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root, args = args[0], args[1:]
+	}
+	flags := newFlags("find")
+	name := flags.String("name", "", "match base names against the glob")
+	typ := flags.String("type", "", "match only files (f) or directories (d)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if _, err := path.Match(*name, ""); err != nil {
+		return err
+	}
+	if *typ != "" && *typ != "f" && *typ != "d" {
+		return fmt.Errorf("invalid type %q", *typ)
+	}
+
+	// Print paths relative to root as it was given, like find(1).
+	absroot := e.abs(root)
+	return e.walk(root, func(p string, info os.FileInfo) error {
+		if *typ == "f" && info.IsDir() || *typ == "d" && !info.IsDir() {
+			return nil
+		}
+		if *name != "" {
+			if ok, _ := path.Match(*name, info.Name()); !ok {
+				return nil
+			}
+		}
+		fmt.Fprintln(e.stdout, path.Join(root, strings.TrimPrefix(p, absroot)))
+		return nil
+	})
+}
+
+func tarCmd(e *env, args []string) error {
+	flags := newFlags("tar")
+	create := flags.Bool("c", false, "create an archive")
+	extract := flags.Bool("x", false, "extract an archive")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *create == *extract || flags.NArg() != 1 {
+		return errors.New("usage: tar -c path | tar -x dest")
+	}
+	if *extract {
+		return e.fs.ExtractTar(e.stdin, e.abs(flags.Arg(0)))
+	}
+
+	root := e.abs(flags.Arg(0))
+	tw := tar.NewWriter(e.stdout)
+	err := e.walk(root, func(p string, info os.FileInfo) error {
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			var err error
+			if link, err = e.fs.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		// Entries are named relative to the parent of root.
+		hdr.Name = path.Base(root) + p[len(root):]
+		if root == "/" {
+			if p == root {
+				return nil
+			}
+			hdr.Name = p[1:]
+		}
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := e.fs.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		return err
+	})
+	if err1 := tw.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
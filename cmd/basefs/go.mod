@@ -0,0 +1,26 @@
+module github.com/absfs/basefs/cmd/basefs
+
+go 1.22.0
+
+require (
+	github.com/absfs/basefs v0.0.0
+	github.com/absfs/basefs/grpcfs v0.0.0
+	github.com/absfs/osfs v0.0.0-20220705103527-80b6215cf130
+	golang.org/x/term v0.23.0
+	google.golang.org/grpc v1.67.1
+)
+
+require (
+	github.com/absfs/absfs v0.0.0-20230318165928-6f31c6ac7458 // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
+
+replace (
+	github.com/absfs/basefs => ../../
+	github.com/absfs/basefs/grpcfs => ../../grpcfs
+)
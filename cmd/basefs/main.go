@@ -0,0 +1,116 @@
+// Command basefs runs file commands against a base directory through the
+// basefs layer, so paths are confined to the base exactly as they are for
+// programs using the package.
+//
+// Usage:
+//
+//	basefs [-base dir] command [arguments]
+//
+// The commands are:
+//
+//	ls [-l] [path ...]        list directories
+//	cat path ...              print files
+//	cp [-r] src dst           copy files or, with -r, directories
+//	mv src dst                rename files
+//	rm [-r] path ...          remove files or, with -r, directories
+//	mkdir [-p] path ...       create directories
+//	du path ...               print the total size of each tree
+//	find [path] [-name glob] [-type f|d]
+//	                          print matching paths
+//	tar -c path               write a tar archive of path to stdout
+//	tar -x dest               extract a tar archive from stdin into dest
+//	shell                     run commands interactively
+//
+// The shell keeps a working directory, completes paths with the tab key and
+// can switch to other backends with its mount command, see help in the shell.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// env is the environment commands run in.
+type env struct {
+	fs     *basefs.SymlinkFileSystem
+	stdin  io.Reader
+	stdout io.Writer
+
+	// closeFS closes fs, and the connection it uses if any
+	closeFS func() error
+}
+
+type command func(e *env, args []string) error
+
+var commands = map[string]command{
+	"ls":    ls,
+	"cat":   cat,
+	"cp":    cp,
+	"mv":    mv,
+	"rm":    rm,
+	"mkdir": mkdir,
+	"du":    du,
+	"find":  find,
+	"tar":   tarCmd,
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("basefs", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	base := flags.String("base", ".", "base `directory` all paths are confined to")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: basefs [-base dir] command [arguments]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "basefs: unknown command %q\n", flags.Arg(0))
+		return 2
+	}
+
+	fs, err := open(*base)
+	if err != nil {
+		fmt.Fprintf(stderr, "basefs: %v\n", err)
+		return 1
+	}
+	e := &env{fs, stdin, stdout, fs.Close}
+	err = cmd(e, flags.Args()[1:])
+	if err1 := e.closeFS(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "basefs %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+// open returns a filesystem rooted at the directory `base` of the host.
+func open(base string) (*basefs.SymlinkFileSystem, error) {
+	dir, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		return nil, err
+	}
+	return basefs.NewFS(ofs, filepath.ToSlash(dir))
+}
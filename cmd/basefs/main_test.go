@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive []byte
+	tests := []struct {
+		Args   string
+		Stdin  func() []byte
+		Output string
+		Status int
+	}{
+		{Args: "mkdir -p a/b", Output: ""},
+		{Args: "cp hello.txt a/b", Output: ""},
+		{Args: "cat a/b/hello.txt", Output: "hello\n"},
+		{Args: "ls a/b", Output: "hello.txt\n"},
+		{Args: "cp a copy", Status: 1},
+		{Args: "cp -r a copy", Output: ""},
+		{Args: "mv copy/b/hello.txt copy/moved.txt", Output: ""},
+		{Args: "find -name *.txt", Output: "a/b/hello.txt\ncopy/moved.txt\nhello.txt\n"},
+		{Args: "find copy -type d", Output: "copy\ncopy/b\n"},
+		{Args: "du a copy", Output: "6\ta\n6\tcopy\n"},
+		{Args: "tar -c a"},
+		{Args: "tar -x restored", Stdin: func() []byte { return archive }, Output: ""},
+		{Args: "cat restored/a/b/hello.txt", Output: "hello\n"},
+		{Args: "rm copy", Status: 1},
+		{Args: "rm -r copy restored", Output: ""},
+		{Args: "ls", Output: "a/\nhello.txt\n"},
+		{Args: "cat ../../etc/passwd", Status: 1},
+		{Args: "bogus", Status: 2},
+	}
+
+	for _, test := range tests {
+		var stdin []byte
+		if test.Stdin != nil {
+			stdin = test.Stdin()
+		}
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		args := append([]string{"-base", dir}, strings.Fields(test.Args)...)
+		status := run(args, bytes.NewReader(stdin), stdout, stderr)
+		if status != test.Status {
+			t.Fatalf("%s: exit status %d, expected %d: %s", test.Args, status, test.Status, stderr)
+		}
+		if test.Args == "tar -c a" {
+			archive = stdout.Bytes()
+			continue
+		}
+		if status == 0 && stdout.String() != test.Output {
+			t.Errorf("%s: got %q, expected %q", test.Args, stdout, test.Output)
+		}
+	}
+}
+
+func TestShell(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	err := os.WriteFile(filepath.Join(other, "other.txt"), []byte("other\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := strings.Join([]string{
+		"mkdir -p a/b",
+		"cd a",
+		"pwd",
+		"cd b",
+		"pwd",
+		"cd ..",
+		"ls",
+		"cd /missing",
+		"pwd",
+		"mount os " + other,
+		"cat other.txt",
+		"exit",
+		"pwd",
+	}, "\n")
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	status := run([]string{"-base", dir, "shell"}, strings.NewReader(script), stdout, stderr)
+	if status != 0 {
+		t.Fatalf("exit status %d: %s", status, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	expected := []string{"/a", "/a/b", "b/", "", "/a", "other"}
+	if len(lines) != len(expected) {
+		t.Fatalf("got %q", lines)
+	}
+	for i, line := range expected {
+		if i == 3 {
+			if !strings.HasPrefix(lines[i], "cd: ") {
+				t.Errorf("expected an error changing to a missing directory, got %q", lines[i])
+			}
+			continue
+		}
+		if lines[i] != line {
+			t.Errorf("line %d: got %q, expected %q", i, lines[i], line)
+		}
+	}
+}
+
+func TestMountCloses(t *testing.T) {
+	fs, err := open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := 0
+	e := &env{fs: fs, stdout: new(bytes.Buffer), closeFS: func() error {
+		closed++
+		return fs.Close()
+	}}
+	if err := e.exec("mount", []string{"os", t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Errorf("the previous filesystem was closed %d times", closed)
+	}
+	if e.fs == fs {
+		t.Error("the filesystem was not replaced")
+	}
+	if err := e.exec("mount", []string{"os", "/missing/dir"}); err == nil {
+		t.Fatal("expected an error mounting a missing directory")
+	}
+	if closed != 1 {
+		t.Error("a failed mount closed the previous filesystem")
+	}
+	if err := e.closeFS(); err != nil {
+		t.Error(err)
+	}
+}
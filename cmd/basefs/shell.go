@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/basefs/grpcfs"
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func init() {
+	// registered here as the shell itself runs the other commands
+	commands["shell"] = shell
+}
+
+// backends open the filesystems which can be mounted in the shell, returning
+// a function closing the filesystem and the resources it uses.
+var backends = map[string]func(arg string) (*basefs.SymlinkFileSystem, func() error, error){
+	"os": func(dir string) (*basefs.SymlinkFileSystem, func() error, error) {
+		fs, err := open(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fs, fs.Close, nil
+	},
+	"grpc": func(addr string) (*basefs.SymlinkFileSystem, func() error, error) {
+		cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		fs, err := basefs.NewFS(grpcfs.NewClient(cc), "/")
+		if err != nil {
+			cc.Close()
+			return nil, nil, err
+		}
+		return fs, func() error { return errors.Join(fs.Close(), cc.Close()) }, nil
+	},
+}
+
+const shellHelp = `commands:
+  cd [dir]                  change the working directory
+  pwd                       print the working directory
+  mount os dir              explore the directory dir of the host
+  mount grpc host:port      explore a filesystem served by grpcfs
+  exit                      leave the shell
+  ls, cat, cp, mv, rm, mkdir, du, find, tar
+                            as on the command line
+`
+
+// shell reads commands from stdin until it is closed or exit is entered. If
+// stdin is a terminal it offers line editing and tab completion of paths.
+func shell(e *env, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: shell")
+	}
+	var readLine func() (string, error)
+	if f, ok := e.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(f.Fd()), state)
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{f, e.stdout}, "")
+		t.AutoCompleteCallback = e.complete
+		e.stdout = t
+		readLine = func() (string, error) {
+			cwd, _ := e.fs.Getwd()
+			t.SetPrompt(cwd + "> ")
+			return t.ReadLine()
+		}
+	} else {
+		scanner := bufio.NewScanner(e.stdin)
+		readLine = func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}
+	}
+
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "exit" || fields[0] == "quit" {
+			return nil
+		}
+		if err := e.exec(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(e.stdout, "%s: %v\n", fields[0], err)
+		}
+	}
+}
+
+// exec runs a single shell command.
+func (e *env) exec(name string, args []string) error {
+	switch name {
+	case "help":
+		fmt.Fprint(e.stdout, shellHelp)
+		return nil
+	case "pwd":
+		cwd, _ := e.fs.Getwd()
+		fmt.Fprintln(e.stdout, cwd)
+		return nil
+	case "cd":
+		dir := "/"
+		if len(args) > 0 {
+			dir = e.abs(args[0])
+		}
+		info, err := e.fs.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return e.fs.Chdir(dir)
+	case "mount":
+		if len(args) != 2 || backends[args[0]] == nil {
+			return errors.New("usage: mount os dir | mount grpc host:port")
+		}
+		fs, closeFS, err := backends[args[0]](args[1])
+		if err != nil {
+			return err
+		}
+		err = e.closeFS()
+		e.fs, e.closeFS = fs, closeFS
+		return err
+	case "shell":
+		return errors.New("already in the shell")
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return errors.New("unknown command, try help")
+	}
+	return cmd(e, args)
+}
+
+// complete is the tab completion callback of the terminal, completing the
+// path under the cursor from the entries of its directory.
+func (e *env) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := strings.LastIndexByte(line[:pos], ' ') + 1
+	word := line[start:pos]
+	dir, prefix := path.Split(word)
+
+	infos, err := e.readDir(dir)
+	if err != nil {
+		return "", 0, false
+	}
+	var matches []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), prefix) {
+			name := info.Name()
+			if info.IsDir() {
+				name += "/"
+			}
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	sort.Strings(matches)
+	// complete the longest common prefix of the matches
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) > 1 && common == prefix {
+		fmt.Fprintln(e.stdout, strings.Join(matches, "  "))
+		return "", 0, false
+	}
+	completed := line[:start] + dir + common
+	return completed + line[pos:], len(completed), true
+}
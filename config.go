@@ -0,0 +1,252 @@
+package basefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+)
+
+// Config describes the configuration of a filesystem. Paths are paths on the
+// underlying filesystem, zero values stand for disabled options. Secrets such
+// as the key of the integrity index are not included. A Config can be loaded
+// with LoadConfig and turned into a filesystem with NewFromConfig.
+type Config struct {
+	Base     string `json:"base" yaml:"base"`
+	Backend  string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Symlinks bool   `json:"symlinks" yaml:"symlinks"`
+
+	CreateBase     bool        `json:"create_base,omitempty" yaml:"create_base,omitempty"`
+	BasePerm       os.FileMode `json:"base_perm,omitempty" yaml:"base_perm,omitempty"`
+	LazyBase       bool        `json:"lazy_base,omitempty" yaml:"lazy_base,omitempty"`
+	RevalidateBase bool        `json:"revalidate_base,omitempty" yaml:"revalidate_base,omitempty"`
+	FailClosed     bool        `json:"fail_closed,omitempty" yaml:"fail_closed,omitempty"`
+
+	Journal      bool   `json:"journal,omitempty" yaml:"journal,omitempty"`
+	ContentStore string `json:"content_store,omitempty" yaml:"content_store,omitempty"`
+	Integrity    string `json:"integrity,omitempty" yaml:"integrity,omitempty"`
+	Checksums    string `json:"checksums,omitempty" yaml:"checksums,omitempty"`
+	IntentLog    string `json:"intent_log,omitempty" yaml:"intent_log,omitempty"`
+
+	Scanner            bool     `json:"scanner,omitempty" yaml:"scanner,omitempty"`
+	Quarantine         string   `json:"quarantine,omitempty" yaml:"quarantine,omitempty"`
+	DeniedContentTypes []string `json:"denied_content_types,omitempty" yaml:"denied_content_types,omitempty"`
+	Quota              int64    `json:"quota,omitempty" yaml:"quota,omitempty"`
+	RegularFilesOnly   bool     `json:"regular_files_only,omitempty" yaml:"regular_files_only,omitempty"`
+	NoExec             bool     `json:"no_exec,omitempty" yaml:"no_exec,omitempty"`
+
+	ReadOnly bool     `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+	Allow    []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny     []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+
+	Subtrees map[string]SubtreePolicy `json:"subtrees,omitempty" yaml:"subtrees,omitempty"`
+
+	PathCache        int      `json:"path_cache,omitempty" yaml:"path_cache,omitempty"`
+	StatCache        Duration `json:"stat_cache,omitempty" yaml:"stat_cache,omitempty"`
+	NegativeCache    int      `json:"negative_cache,omitempty" yaml:"negative_cache,omitempty"`
+	NegativeCacheTTL Duration `json:"negative_cache_ttl,omitempty" yaml:"negative_cache_ttl,omitempty"`
+	DirCache         Duration `json:"dir_cache,omitempty" yaml:"dir_cache,omitempty"`
+
+	ReadAhead   int        `json:"read_ahead,omitempty" yaml:"read_ahead,omitempty"`
+	WriteBuffer int        `json:"write_buffer,omitempty" yaml:"write_buffer,omitempty"`
+	SyncPolicy  SyncPolicy `json:"sync_policy,omitempty" yaml:"sync_policy,omitempty"`
+	DirSync     bool       `json:"dir_sync,omitempty" yaml:"dir_sync,omitempty"`
+
+	StableHandles bool `json:"stable_handles,omitempty" yaml:"stable_handles,omitempty"`
+}
+
+// Config returns the configuration of the filesystem.
+func (f *FileSystem) Config() Config {
+	c := f.opts.config()
+	_, c.Symlinks = f.outer().(absfs.SymlinkFileSystem)
+	return c
+}
+
+// String returns the base directory of the filesystem.
+func (f *FileSystem) String() string {
+	return "basefs:" + f.prefix
+}
+
+// GoString describes the filesystem for the %#v verb.
+func (f *SymlinkFileSystem) GoString() string {
+	return fmt.Sprintf("&basefs.SymlinkFileSystem{fs: %T, prefix: %q, cwd: %q, config: %+v}", f.fs, f.prefix, f.cwd, f.Config())
+}
+
+// GoString describes the filesystem for the %#v verb.
+func (f *FileSystem) GoString() string {
+	return fmt.Sprintf("&basefs.FileSystem{fs: %T, prefix: %q, cwd: %q, config: %+v}", f.fs, f.prefix, f.cwd, f.Config())
+}
+
+func (o *options) config() Config {
+	c := Config{
+		Base:           o.base,
+		CreateBase:     o.createBase,
+		LazyBase:       o.lazy,
+		RevalidateBase: o.revalidate,
+		FailClosed:     o.failClosed,
+
+		Journal:      o.journal != nil,
+		ContentStore: o.casDir,
+		IntentLog:    o.intentLog,
+
+		Scanner:            o.scanner != nil,
+		Quarantine:         o.quarantine,
+		DeniedContentTypes: o.deniedTypes,
+		Quota:              o.quota,
+		RegularFilesOnly:   o.regularOnly,
+		NoExec:             o.noExec,
+
+		ReadOnly: o.readOnly,
+		Allow:    o.allow,
+		Deny:     o.deny,
+
+		Subtrees: o.subtreePolicies(),
+
+		ReadAhead:   o.readAhead,
+		WriteBuffer: o.writeBuffer,
+		SyncPolicy:  o.syncPolicy,
+		DirSync:     o.dirSync,
+
+		StableHandles: o.stableHandles,
+	}
+	if o.createBase {
+		c.BasePerm = o.basePerm
+	}
+	if o.integrity != nil {
+		c.Integrity = o.integrity.path
+	}
+	if o.checksums != nil {
+		c.Checksums = o.checksums.path
+	}
+	if o.paths != nil {
+		c.PathCache = o.paths.size
+	}
+	if o.stats != nil {
+		c.StatCache = Duration(o.stats.ttl)
+	}
+	if o.missing != nil {
+		c.NegativeCache, c.NegativeCacheTTL = o.missing.size, Duration(o.missing.ttl)
+	}
+	if o.dirs != nil {
+		c.DirCache = Duration(o.dirs.ttl)
+	}
+	return c
+}
+
+// Duration is a time.Duration written as a string such as "1m30s" in
+// configuration files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+// LoadConfig reads a Config in JSON from `r`. Unknown fields are rejected.
+// Config has yaml tags as well, so YAML files can be decoded into it with a
+// package such as gopkg.in/yaml.v3, which this package doesn't depend on.
+func LoadConfig(r io.Reader) (Config, error) {
+	var c Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("basefs: config: %w", err)
+	}
+	return c, nil
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]func() (absfs.FileSystem, error){
+		"os": func() (absfs.FileSystem, error) { return osfs.NewFS() },
+	}
+)
+
+// RegisterBackend makes the underlying filesystem returned by `open`
+// available to NewFromConfig as `name`. The backend "os", the filesystem of
+// the host, is always available.
+func RegisterBackend(name string, open func() (absfs.FileSystem, error)) {
+	backendsMu.Lock()
+	backends[name] = open
+	backendsMu.Unlock()
+}
+
+// NewFromConfig creates a filesystem as described by `c`, on top of the
+// backend named in `c`, "os" if none is named. It returns a SymlinkFileSystem
+// if c.Symlinks is set and a FileSystem otherwise. Journaling and scanning
+// can't be configured declaratively, so c.Journal and c.Scanner are ignored.
+// An integrity index is created without a key, and checksums use SHA-256.
+// `opts` are applied after the options from `c`.
+func NewFromConfig(c Config, opts ...Option) (absfs.FileSystem, error) {
+	name := c.Backend
+	if name == "" {
+		name = "os"
+	}
+	backendsMu.Lock()
+	open, ok := backends[name]
+	backendsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("basefs: unknown backend %q", name)
+	}
+	fs, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(c.options(), opts...)
+	if !c.Symlinks {
+		return filesystem(NewFileSystem(fs, c.Base, opts...))
+	}
+	sfs, ok := fs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return nil, errors.New("basefs: backend " + name + " does not support symlinks")
+	}
+	return filesystem(NewFS(sfs, c.Base, opts...))
+}
+
+// options returns the options configuring a filesystem as described by `c`.
+func (c Config) options() []Option {
+	var opts []Option
+	add := func(cond bool, opt Option) {
+		if cond {
+			opts = append(opts, opt)
+		}
+	}
+	add(c.CreateBase, WithCreateBase(c.BasePerm))
+	add(c.LazyBase, WithLazyBase())
+	add(c.RevalidateBase, WithRevalidateBase())
+	add(c.FailClosed, WithFailClosed())
+	add(c.ContentStore != "", WithContentStore(c.ContentStore))
+	add(c.Integrity != "", WithIntegrity(c.Integrity, nil))
+	add(c.Checksums != "", WithChecksums(c.Checksums, nil))
+	add(c.IntentLog != "", WithIntentLog(c.IntentLog))
+	add(c.Quarantine != "", WithQuarantine(c.Quarantine))
+	add(len(c.DeniedContentTypes) > 0, WithDeniedContentTypes(c.DeniedContentTypes...))
+	add(c.Quota > 0, WithQuota(c.Quota))
+	add(c.RegularFilesOnly, WithRegularFilesOnly())
+	add(c.NoExec, WithNoExec())
+	add(c.ReadOnly, WithReadOnly())
+	add(len(c.Allow) > 0, WithAllow(c.Allow...))
+	add(len(c.Deny) > 0, WithDeny(c.Deny...))
+	add(c.PathCache > 0, WithPathCache(c.PathCache))
+	add(c.StatCache > 0, WithStatCache(time.Duration(c.StatCache)))
+	add(c.NegativeCache > 0, WithNegativeCache(c.NegativeCache, time.Duration(c.NegativeCacheTTL)))
+	add(c.DirCache > 0, WithDirCache(time.Duration(c.DirCache)))
+	add(c.ReadAhead > 0, WithReadAhead(c.ReadAhead))
+	add(c.WriteBuffer > 0, WithWriteBuffer(c.WriteBuffer))
+	add(c.SyncPolicy != 0, WithSyncPolicy(c.SyncPolicy))
+	add(c.DirSync, WithDirSync())
+	add(c.StableHandles, WithStableHandles())
+	return append(opts, subtreeOptions(c.Subtrees)...)
+}
@@ -0,0 +1,92 @@
+package basefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// ErrDeniedContentType is wrapped by the error returned from Close when a
+// written file is rejected by the content type policy.
+var ErrDeniedContentType = errors.New("content type denied")
+
+// WithDeniedContentTypes rejects files written through basefs whose sniffed
+// content type matches one of `types`, either exactly ("text/html") or by
+// top level type ("application/*"). Rejected files are handled like files
+// rejected by a scanner, see WithScanner.
+func WithDeniedContentTypes(types ...string) Option {
+	return func(o *options) error {
+		for _, t := range types {
+			mt, _, err := mime.ParseMediaType(t)
+			if err != nil {
+				return err
+			}
+			o.deniedTypes = append(o.deniedTypes[:len(o.deniedTypes):len(o.deniedTypes)], mt)
+		}
+		return nil
+	}
+}
+
+// DetectContentType returns the MIME type of the named file as determined by
+// http.DetectContentType from its first 512 bytes.
+func (f *FileSystem) DetectContentType(name string) (string, error) {
+	return detectContentType(f.outer(), name)
+}
+
+func detectContentType(fs absfs.FileSystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sniff(f)
+}
+
+func sniff(r io.Reader) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// deniedType reports whether the media type `ctype` is denied by the policy.
+func (o *options) deniedType(ctype string) bool {
+	mt, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	for _, denied := range o.deniedTypes {
+		if denied == mt || strings.HasSuffix(denied, "/*") && strings.HasPrefix(mt, denied[:len(denied)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType rejects the file at `ppath` if its content type is denied.
+func (o *options) checkContentType(fs absfs.FileSystem, ppath, name string) error {
+	f, err := o.open(fs, ppath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	ctype, err := sniff(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !o.deniedType(ctype) {
+		return nil
+	}
+	return o.reject(fs, ppath, name, "write", fmt.Errorf("%w: %s", ErrDeniedContentType, ctype))
+}
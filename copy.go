@@ -0,0 +1,500 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+)
+
+// CopyOption configures CopyFile and CopyDir.
+type CopyOption func(*copyOptions) error
+
+type copyOptions struct {
+	sparse   bool
+	check    bool
+	preserve Preserved
+	links    linkMode
+	skipped  func(name string)
+}
+
+// linkMode is the handling of symbolic links by CopyDir.
+type linkMode int
+
+const (
+	preserveLinks linkMode = iota
+	dereferenceLinks
+	skipLinks
+)
+
+func newCopyOptions(opts []CopyOption) (*copyOptions, error) {
+	o := &copyOptions{preserve: PreserveTimes}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// CheckSpace makes CopyFile and CopyDir reserve the space for the files to
+// copy with Reserve before copying any of them, and hold it until the copy is
+// done. Files replaced by the copy are not taken into account.
+func CheckSpace() CopyOption {
+	return func(o *copyOptions) error {
+		o.check = true
+		return nil
+	}
+}
+
+// reserve reserves `n` bytes on `fs` if the option is set and `fs` keeps
+// reservations, returning the function releasing them.
+func (o *copyOptions) reserve(fs absfs.FileSystem, n int64) (func(), error) {
+	r, ok := fs.(interface {
+		Reserve(int64) (*Reservation, error)
+	})
+	if !o.check || !ok {
+		return func() {}, nil
+	}
+	res, err := r.Reserve(n)
+	if err != nil {
+		return nil, err
+	}
+	return res.Release, nil
+}
+
+// Preserved selects the metadata which is copied along with the contents.
+// Permissions are always copied.
+type Preserved uint8
+
+const (
+	// PreserveTimes copies the modification time, which also becomes the
+	// access time of the copy.
+	PreserveTimes Preserved = 1 << iota
+
+	// PreserveOwner copies the owner and group, which usually requires
+	// privileges.
+	PreserveOwner
+
+	// PreserveXattrs copies the extended attributes other than ACLs of files
+	// on the host.
+	PreserveXattrs
+
+	// PreserveACLs copies the POSIX ACLs of files on the host, which Linux
+	// stores as extended attributes.
+	PreserveACLs
+
+	PreserveAll = PreserveTimes | PreserveOwner | PreserveXattrs | PreserveACLs
+)
+
+// Preserve sets the metadata copied by CopyFile and CopyDir, PreserveTimes by
+// default. Metadata which the source doesn't report or the destination can't
+// store, e.g. ownership without the privileges to change it or extended
+// attributes of files which aren't on the host, is skipped without an error.
+func Preserve(p Preserved) CopyOption {
+	return func(o *copyOptions) error {
+		if p&^PreserveAll != 0 {
+			return os.ErrInvalid
+		}
+		o.preserve = p
+		return nil
+	}
+}
+
+// Sparse makes CopyFile copy only the data regions of the source file,
+// leaving holes in the copy where the source has them, so copies of sparse
+// files such as disk images don't become fully allocated.
+func Sparse() CopyOption {
+	return func(o *copyOptions) error {
+		o.sparse = true
+		return nil
+	}
+}
+
+// PreserveSymlinks makes CopyDir recreate symbolic links as links, which is
+// the default. Links pointing into the copied directory are re-targeted to
+// the same place in the copy, others keep pointing where they did.
+func PreserveSymlinks() CopyOption {
+	return func(o *copyOptions) error {
+		o.links = preserveLinks
+		return nil
+	}
+}
+
+// DereferenceSymlinks makes CopyDir copy the files and directories symbolic
+// links point to in place of the links. Broken links fail the copy.
+func DereferenceSymlinks() CopyOption {
+	return func(o *copyOptions) error {
+		o.links = dereferenceLinks
+		return nil
+	}
+}
+
+// SkipSymlinks makes CopyDir leave symbolic links out of the copy, calling
+// `report`, if it isn't nil, with the name of each link skipped.
+func SkipSymlinks(report func(name string)) CopyOption {
+	return func(o *copyOptions) error {
+		o.links, o.skipped = skipLinks, report
+		return nil
+	}
+}
+
+// CopyFile copies the contents, permissions and modification time, or the
+// metadata selected with Preserve, of the regular file `src` to `dst`,
+// replacing `dst` if it exists. With
+// WithIntentLog, the copy is written to a temporary file which replaces `dst`
+// once it is complete. Closing the filesystem interrupts the copy, which then
+// fails with ErrClosed.
+func (f *FileSystem) CopyFile(src, dst string, opts ...CopyOption) error {
+	if err := f.opts.closed("copy", src); err != nil {
+		return err
+	}
+	var err error
+	if f.opts.intentLog != "" {
+		err = f.replace("copy", dst, func(tmp string) error {
+			return copyWithin(f.outer(), src, tmp, opts)
+		})
+	} else {
+		err = copyWithin(f.outer(), src, dst, opts)
+	}
+	return f.opts.interrupted("copy", src, err)
+}
+
+func copyWithin(fs absfs.FileSystem, src, dst string, opts []CopyOption) error {
+	o, err := newCopyOptions(opts)
+	if err != nil {
+		return err
+	}
+	info, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		err := error(os.ErrInvalid)
+		if info.IsDir() {
+			err = syscall.EISDIR
+		}
+		return &os.PathError{Op: "copy", Path: src, Err: err}
+	}
+	release, err := o.reserve(fs, info.Size())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return copyFile(fs, src, fs, dst, info, o)
+}
+
+// CopyDir copies the directory `src` and everything below it to `dst`, which
+// must not be inside `src`. Directories are created as needed and files
+// replace existing ones of the same name. Permissions and modification times,
+// or the metadata selected with Preserve, are copied for files and
+// directories. Symbolic links are handled as selected with PreserveSymlinks,
+// DereferenceSymlinks or SkipSymlinks, and other special files are left out.
+// Like CopyFile, it fails with ErrClosed if the filesystem is closed, leaving
+// the files copied so far in place.
+func (f *FileSystem) CopyDir(src, dst string, opts ...CopyOption) error {
+	spath, err := f.path(src)
+	if err != nil {
+		return err
+	}
+	dpath, err := f.path(dst)
+	if err != nil {
+		return err
+	}
+	if within(spath, dpath) {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: os.ErrInvalid}
+	}
+	if err := f.opts.closed("copy", src); err != nil {
+		return err
+	}
+	err = copyDir(f.outer(), src, dst, f.opts.closers.doneChan(), opts)
+	return f.opts.interrupted("copy", src, err)
+}
+
+// copyDir copies the tree `src` to `dst` on `fs`, until `done` is closed.
+func copyDir(fs absfs.FileSystem, src, dst string, done <-chan struct{}, opts []CopyOption) error {
+	o, err := newCopyOptions(opts)
+	if err != nil {
+		return err
+	}
+	info, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "copy", Path: src, Err: syscall.ENOTDIR}
+	}
+	if o.check {
+		var size int64
+		err := walk(fs, src, func(name string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		release, err := o.reserve(fs, size)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	c := &dirCopy{fs: fs, o: o, done: done, dirs: make(map[string]dirSource)}
+	if err := c.copy(path.Clean(src), path.Clean(dst), nil); err != nil {
+		return err
+	}
+
+	// Directories are created writable and get their metadata once their
+	// contents are copied, deepest first.
+	names := make([]string, 0, len(c.dirs))
+	for name := range c.dirs {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		d := c.dirs[name]
+		if err := fs.Chmod(name, d.info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := copyMeta(fs, d.name, fs, name, d.info, o.preserve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirCopy is a copy of a directory tree in progress.
+type dirCopy struct {
+	fs   absfs.FileSystem
+	o    *copyOptions
+	done <-chan struct{}
+	dirs map[string]dirSource
+}
+
+// dirSource is the source of a directory created by a copy.
+type dirSource struct {
+	name string
+	info os.FileInfo
+}
+
+// copy copies the tree `root` to `croot`. `seen` holds the directories
+// entered through symbolic links on the way, to detect cycles.
+func (c *dirCopy) copy(root, croot string, seen []fileID) error {
+	return walk(c.fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-c.done:
+			return &os.PathError{Op: "copy", Path: name, Err: ErrClosed}
+		default:
+		}
+		rel, _ := trimDir(root, name)
+		dst := path.Join(croot, rel)
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			err := c.fs.Mkdir(dst, mode.Perm()|0700)
+			if err != nil && !os.IsExist(err) {
+				return err
+			}
+			c.dirs[dst] = dirSource{name, info}
+			return nil
+		case mode&os.ModeSymlink != 0:
+			return c.symlink(root, croot, name, dst, info, seen)
+		case mode.IsRegular():
+			return copyFile(c.fs, name, c.fs, dst, info, c.o)
+		}
+		return nil
+	})
+}
+
+// symlink copies the symbolic link `name` in the tree `root`, which is copied
+// to `croot`, to `dst`, replacing a file there. Links are skipped on
+// filesystems without symbolic links.
+func (c *dirCopy) symlink(root, croot, name, dst string, info os.FileInfo, seen []fileID) error {
+	switch c.o.links {
+	case skipLinks:
+		if c.o.skipped != nil {
+			c.o.skipped(name)
+		}
+		return nil
+	case dereferenceLinks:
+		target, err := c.fs.Stat(name)
+		if err != nil {
+			return err
+		}
+		if target.Mode().IsRegular() {
+			return copyFile(c.fs, name, c.fs, dst, target, c.o)
+		}
+		if !target.IsDir() {
+			return nil
+		}
+		if id, ok := identify(target); ok {
+			for _, s := range seen {
+				if s == id {
+					return &os.PathError{Op: "copy", Path: name, Err: syscall.ELOOP}
+				}
+			}
+			seen = append(seen[:len(seen):len(seen)], id)
+		} else if len(seen) == maxSymlinks {
+			return &os.PathError{Op: "copy", Path: name, Err: syscall.ELOOP}
+		} else {
+			seen = append(seen[:len(seen):len(seen)], fileID{})
+		}
+		return c.copy(name, dst, seen)
+	}
+
+	sfs, ok := c.fs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return nil
+	}
+	target, err := sfs.Readlink(name)
+	if err != nil {
+		return err
+	}
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(name), target)
+	}
+	if rest, ok := trimDir(root, target); ok {
+		target = path.Join(croot, rest)
+	}
+	if err := sfs.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := sfs.Symlink(target, dst); err != nil {
+		return err
+	}
+	return copyMeta(c.fs, name, c.fs, dst, info, c.o.preserve)
+}
+
+// copySymlink recreates the symbolic link `src` on `sfs` as `dst` on `dfs`,
+// replacing `dst` if it exists. Absolute targets are taken to be in the tree
+// of `sfs` and moved below `root`, the directory of `dfs` the tree is copied
+// to. Links are skipped if either filesystem doesn't support them.
+func copySymlink(sfs absfs.FileSystem, src string, dfs absfs.FileSystem, dst, root string) error {
+	slinks, ok := sfs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return nil
+	}
+	dlinks, ok := dfs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return nil
+	}
+	target, err := slinks.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if path.IsAbs(target) {
+		target = path.Join(root, target)
+	}
+	if err := dlinks.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return dlinks.Symlink(target, dst)
+}
+
+// copyFile copies the contents, mode and modification time, or the metadata
+// selected in `o`, of the regular file `src` on `sfs` to `dst` on `dfs`. `o`
+// may be nil. Other types of files fail with EINVAL, so that a copy never
+// gets the mode of a symbolic link.
+func copyFile(sfs absfs.FileSystem, src string, dfs absfs.FileSystem, dst string, info os.FileInfo, o *copyOptions) error {
+	if !info.Mode().IsRegular() {
+		return &os.PathError{Op: "copy", Path: src, Err: os.ErrInvalid}
+	}
+	in, err := sfs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := dfs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if o != nil && o.sparse {
+		err = copySparse(out, in, info.Size())
+	} else {
+		_, err = io.Copy(out, in)
+	}
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+
+	p := PreserveTimes
+	if o != nil {
+		p = o.preserve
+	}
+	if err := dfs.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return copyMeta(sfs, src, dfs, dst, info, p)
+}
+
+// copyMeta applies the metadata of `src` on `sfs`, described by `info`,
+// selected by `p` to `dst` on `dfs`. Symbolic links only get their owner and
+// extended attributes copied.
+func copyMeta(sfs absfs.FileSystem, src string, dfs absfs.FileSystem, dst string, info os.FileInfo, p Preserved) error {
+	link := info.Mode()&os.ModeSymlink != 0
+	if p&PreserveOwner != 0 {
+		if uid, gid, ok := owner(info); ok {
+			var err error
+			if lfs, ok := dfs.(absfs.SymlinkFileSystem); ok && link {
+				err = lfs.Lchown(dst, uid, gid)
+			} else if !link {
+				err = dfs.Chown(dst, uid, gid)
+			}
+			if err != nil && !os.IsPermission(err) && !errors.Is(err, errors.ErrUnsupported) {
+				return err
+			}
+		}
+	}
+	if p&(PreserveXattrs|PreserveACLs) != 0 {
+		spath, ok := hostName(sfs, src)
+		dpath, ok1 := hostName(dfs, dst)
+		if ok && ok1 {
+			err := copyHostXattrs(spath, dpath, p&PreserveXattrs != 0, p&PreserveACLs != 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if p&PreserveTimes != 0 && !link {
+		return dfs.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// hostName returns the path of `name` on the host, if `fs` is an os
+// filesystem or a FileSystem storing its files directly on one.
+func hostName(fs absfs.FileSystem, name string) (string, bool) {
+	if h, ok := fs.(interface{ hostName(string) (string, bool) }); ok {
+		return h.hostName(name)
+	}
+	if _, ok := fs.(*osfs.FileSystem); ok {
+		return filepath.FromSlash(name), true
+	}
+	return "", false
+}
+
+func (f *FileSystem) hostName(name string) (string, bool) {
+	if f.opts.cas != nil {
+		return "", false
+	}
+	ppath, err := f.path(name)
+	if err != nil || f.opts.binds.get(ppath) != nil {
+		return "", false
+	}
+	return hostName(f.fs, ppath)
+}
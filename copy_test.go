@@ -0,0 +1,162 @@
+package basefs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestCopyDir(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{
+		"/src/a.txt":          "a",
+		"/src/sub/b.txt":      "b",
+		"/src/readonly/c.txt": "c",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "src", "link")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub", "readonly/c.txt"} {
+		if err := os.Chtimes(filepath.Join(dir, "src", name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "src", "readonly"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dir, "src", "readonly"), 0755)
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bfs.CopyDir("/src", "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dir, "dst", "readonly"), 0755)
+	for name, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "readonly/c.txt": "c"} {
+		data, err := os.ReadFile(filepath.Join(dir, "dst", name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q %v", name, data, err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "dst", "link")); err != nil || target != filepath.Join(dir, "dst", "a.txt") {
+		t.Errorf("link: got %q %v", target, err)
+	}
+	for _, name := range []string{"a.txt", "sub"} {
+		info, err := os.Stat(filepath.Join(dir, "dst", name))
+		if err != nil || !info.ModTime().Equal(old) {
+			t.Errorf("%s: modification time not preserved: %v", name, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "dst", "readonly")); err != nil || info.Mode().Perm() != 0555 {
+		t.Errorf("readonly: mode not preserved: %v", err)
+	}
+
+	if err := bfs.CopyDir("/src/sub", "/fresh", basefs.Preserve(0)); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "fresh", "b.txt")); err != nil || info.ModTime().Equal(old) {
+		t.Errorf("modification time preserved without PreserveTimes: %v", err)
+	}
+	if err := bfs.CopyDir("/src", "/src/sub/inside"); err == nil {
+		t.Error("expected copying a directory into itself to fail")
+	}
+	if err := bfs.CopyFile("/src/a.txt", "/owned", basefs.Preserve(basefs.PreserveAll)); err != nil {
+		t.Errorf("preserving all metadata: %v", err)
+	}
+}
+
+func TestCopyDirSymlinks(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{
+		"/src/a.txt":     "a",
+		"/src/sub/b.txt": "b",
+		"/outside.txt":   "outside",
+	})
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"/src/inside": "/src/a.txt", "/src/outside": "/outside.txt", "/src/subdir": "/src/sub"} {
+		if err := bfs.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readlink := func(name string) string {
+		t.Helper()
+		target, err := bfs.Readlink(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+
+	if err := bfs.CopyDir("/src", "/links", basefs.PreserveSymlinks()); err != nil {
+		t.Fatal(err)
+	}
+	if got := readlink("/links/inside"); got != "/links/a.txt" {
+		t.Errorf("inside: target %q, want /links/a.txt", got)
+	}
+	if got := readlink("/links/subdir"); got != "/links/sub" {
+		t.Errorf("subdir: target %q, want /links/sub", got)
+	}
+	if got := readlink("/links/outside"); got != "/outside.txt" {
+		t.Errorf("outside: target %q, want /outside.txt", got)
+	}
+
+	if err := bfs.CopyDir("/src", "/copies", basefs.DereferenceSymlinks()); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"inside": "a", "outside": "outside", "subdir/b.txt": "b"} {
+		info, err := os.Lstat(filepath.Join(dir, "copies", name))
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("%s: not copied as a file: %v", name, err)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "copies", name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q %v", name, data, err)
+		}
+	}
+
+	var skipped []string
+	if err := bfs.CopyDir("/src", "/nolinks", basefs.SkipSymlinks(func(name string) { skipped = append(skipped, name) })); err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 3 || skipped[0] != "/src/inside" {
+		t.Errorf("skipped %v, want the three links", skipped)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "nolinks"))
+	if err != nil || len(entries) != 2 {
+		t.Errorf("%d entries in the copy without links, want 2 (%v)", len(entries), err)
+	}
+
+	if err := bfs.Symlink("/src", "/src/sub/loop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.CopyDir("/src", "/cycle", basefs.DereferenceSymlinks()); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("expected ELOOP copying a cycle, got %v", err)
+	}
+}
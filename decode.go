@@ -0,0 +1,60 @@
+package basefs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DecodeJSONLines calls `fn` with each JSON value of the named file in JSON
+// Lines format, one value per line, reading the file as it goes rather than
+// loading it at once. Blank lines are skipped. A line which isn't valid JSON
+// fails with an error giving its number, wrapped in an *os.PathError. It
+// stops at the first error, including one returned by `fn`, and returns it.
+func (f *FileSystem) DecodeJSONLines(name string, fn func(json.RawMessage) error) error {
+	n := 0
+	return f.ForEachLine(name, func(line string) error {
+		n++
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+		if !json.Valid([]byte(line)) {
+			return &os.PathError{Op: "decode", Path: name, Err: fmt.Errorf("line %d: invalid JSON", n)}
+		}
+		return fn(json.RawMessage(line))
+	})
+}
+
+// DecodeCSV calls `fn` with each record of the named CSV file, read as
+// encoding/csv does by default, reading the file as it goes. `fn` may keep
+// the records. Parse errors are *csv.ParseError, giving the line, wrapped in
+// an *os.PathError. It stops at the first error, including one returned by
+// `fn`, and returns it.
+func (f *FileSystem) DecodeCSV(name string, fn func(record []string) error) error {
+	file, err := f.outer().Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return &os.PathError{Op: "decode", Path: name, Err: err}
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package basefs_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/data.jsonl": "{\"a\": 1}\n\n[2]\n",
+		"/bad.jsonl":  "1\n{\n",
+		"/data.csv":   "name,size\n\"a, b\",2\n",
+		"/bad.csv":    "a,b\nc\n",
+	})
+
+	var values []string
+	err := bfs.DecodeJSONLines("/data.jsonl", func(v json.RawMessage) error {
+		values = append(values, string(v))
+		return nil
+	})
+	if err != nil || len(values) != 2 || values[0] != `{"a": 1}` || values[1] != "[2]" {
+		t.Errorf("DecodeJSONLines read %q, %v", values, err)
+	}
+	err = bfs.DecodeJSONLines("/bad.jsonl", func(json.RawMessage) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+
+	var records [][]string
+	err = bfs.DecodeCSV("/data.csv", func(record []string) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil || len(records) != 2 || records[1][0] != "a, b" || records[1][1] != "2" {
+		t.Errorf("DecodeCSV read %q, %v", records, err)
+	}
+	var perr *csv.ParseError
+	if err := bfs.DecodeCSV("/bad.csv", func([]string) error { return nil }); !errors.As(err, &perr) || perr.Line != 2 {
+		t.Errorf("expected a parse error for line 2, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package basefs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/absfs/absfs"
+)
+
+// ChangeKind describes how an entry differs between two trees.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota + 1
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// Change is a single difference found by Diff. Old describes the entry in the
+// receiving filesystem and New the entry in the other filesystem, either is
+// nil for added and removed entries.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  os.FileInfo
+	New  os.FileInfo
+}
+
+// DiffOption configures Diff.
+type DiffOption func(*diffOptions) error
+
+type diffOptions struct {
+	content bool
+	ignore  []string
+}
+
+// CompareContent compares regular files of equal size by a SHA-256 hash of
+// their contents rather than by modification time.
+func CompareContent() DiffOption {
+	return func(o *diffOptions) error {
+		o.content = true
+		return nil
+	}
+}
+
+// Ignore skips entries whose virtual paths match any of the glob patterns on
+// both sides of the comparison, see Include for the pattern syntax.
+func Ignore(patterns ...string) DiffOption {
+	return func(o *diffOptions) error {
+		for _, pattern := range patterns {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.ignore = append(o.ignore, patterns...)
+		return nil
+	}
+}
+
+// Diff returns the changes that turn this filesystem's tree into the tree of
+// `other`, in lexical order. Added entries only exist in `other` and removed
+// entries only exist in this filesystem. Files are considered modified when
+// their type, permissions, size or modification time differ.
+func (f *FileSystem) Diff(other absfs.FileSystem, opts ...DiffOption) ([]Change, error) {
+	var changes []Change
+	err := diff(f.outer(), other, opts, func(c Change) error {
+		changes = append(changes, c)
+		return nil
+	})
+	return changes, err
+}
+
+// diff compares the trees rooted at "/" of `a` and `b` and calls `fn` with
+// every change turning `a` into `b`.
+func diff(a, b absfs.FileSystem, opts []DiffOption, fn func(Change) error) error {
+	var o diffOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return err
+		}
+	}
+
+	return o.diffDir(a, b, "/", fn)
+}
+
+// diffDir merges the sorted listings of the directory `dir` in both trees.
+func (o *diffOptions) diffDir(a, b absfs.FileSystem, dir string, fn func(Change) error) error {
+	ainfos, err := readDir(a, dir)
+	if err != nil {
+		return err
+	}
+	binfos, err := readDir(b, dir)
+	if err != nil {
+		return err
+	}
+
+	ainfos, binfos = o.filter(dir, ainfos), o.filter(dir, binfos)
+	for len(ainfos) > 0 || len(binfos) > 0 {
+		switch {
+		case len(binfos) == 0 || len(ainfos) > 0 && ainfos[0].Name() < binfos[0].Name():
+			err = o.diffTree(a, path.Join(dir, ainfos[0].Name()), ainfos[0], Removed, fn)
+			ainfos = ainfos[1:]
+		case len(ainfos) == 0 || binfos[0].Name() < ainfos[0].Name():
+			err = o.diffTree(b, path.Join(dir, binfos[0].Name()), binfos[0], Added, fn)
+			binfos = binfos[1:]
+		default:
+			err = o.diffEntry(a, b, path.Join(dir, ainfos[0].Name()), ainfos[0], binfos[0], fn)
+			ainfos, binfos = ainfos[1:], binfos[1:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter drops ignored entries from the listing of `dir`.
+func (o *diffOptions) filter(dir string, infos []os.FileInfo) []os.FileInfo {
+	if len(o.ignore) == 0 {
+		return infos
+	}
+	kept := infos[:0]
+	for _, info := range infos {
+		if !matchAny(o.ignore, path.Join(dir, info.Name())) {
+			kept = append(kept, info)
+		}
+	}
+	return kept
+}
+
+// diffTree reports `name` and everything below it as added or removed.
+func (o *diffOptions) diffTree(fs absfs.FileSystem, name string, info os.FileInfo, kind ChangeKind, fn func(Change) error) error {
+	return walkDir(fs, name, info, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if matchAny(o.ignore, p) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		c := Change{Path: p, Kind: kind, Old: info}
+		if kind == Added {
+			c.Old, c.New = nil, info
+		}
+		return fn(c)
+	})
+}
+
+// diffChildren reports everything below the directory `dir` as added or
+// removed.
+func (o *diffOptions) diffChildren(fs absfs.FileSystem, dir string, kind ChangeKind, fn func(Change) error) error {
+	infos, err := readDir(fs, dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range o.filter(dir, infos) {
+		err = o.diffTree(fs, path.Join(dir, info.Name()), info, kind, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *diffOptions) diffEntry(a, b absfs.FileSystem, name string, ainfo, binfo os.FileInfo, fn func(Change) error) error {
+	if ainfo.IsDir() != binfo.IsDir() {
+		if err := fn(Change{name, Modified, ainfo, binfo}); err != nil {
+			return err
+		}
+		if ainfo.IsDir() {
+			return o.diffChildren(a, name, Removed, fn)
+		}
+		return o.diffChildren(b, name, Added, fn)
+	}
+	modified := ainfo.Mode() != binfo.Mode()
+	if !modified && !ainfo.IsDir() {
+		var err error
+		modified, err = o.differ(a, b, name, ainfo, binfo)
+		if err != nil {
+			return err
+		}
+	}
+	if modified {
+		if err := fn(Change{name, Modified, ainfo, binfo}); err != nil {
+			return err
+		}
+	}
+	if ainfo.IsDir() {
+		return o.diffDir(a, b, name, fn)
+	}
+	return nil
+}
+
+// differ compares the contents of two files with equal modes.
+func (o *diffOptions) differ(a, b absfs.FileSystem, name string, ainfo, binfo os.FileInfo) (bool, error) {
+	if ainfo.Size() != binfo.Size() {
+		return true, nil
+	}
+	if !o.content {
+		return !ainfo.ModTime().Equal(binfo.ModTime()), nil
+	}
+	ahash, err := hashFile(a, name, sha256.New)
+	if err != nil {
+		return false, err
+	}
+	bhash, err := hashFile(b, name, sha256.New)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(ahash, bhash), nil
+}
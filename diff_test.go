@@ -0,0 +1,194 @@
+package basefs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+// writeTree creates the files in `files` below `dir`, names ending in a slash
+// are created as directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestFS(t *testing.T, files map[string]string) *basefs.FileSystem {
+	t.Helper()
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, files)
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bfs
+}
+
+func TestDiff(t *testing.T) {
+	a := newTestFS(t, map[string]string{
+		"/same.txt":     "same",
+		"/changed.txt":  "old",
+		"/removed/x":    "x",
+		"/kind":         "file",
+		"/dir/keep.txt": "keep",
+	})
+	b := newTestFS(t, map[string]string{
+		"/same.txt":     "same",
+		"/changed.txt":  "new",
+		"/added/y":      "y",
+		"/kind/":        "",
+		"/dir/keep.txt": "keep",
+	})
+
+	changes, err := a.Diff(b, basefs.CompareContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path string
+		Kind basefs.ChangeKind
+	}{
+		{"/added", basefs.Added},
+		{"/added/y", basefs.Added},
+		{"/changed.txt", basefs.Modified},
+		{"/kind", basefs.Modified},
+		{"/removed", basefs.Removed},
+		{"/removed/x", basefs.Removed},
+	}
+	if len(changes) != len(tests) {
+		t.Fatalf("got %d changes, expected %d: %v", len(changes), len(tests), changes)
+	}
+	for i, test := range tests {
+		if changes[i].Path != test.Path || changes[i].Kind != test.Kind {
+			t.Errorf("%d: got %s %s, expected %s %s", i, changes[i].Kind, changes[i].Path, test.Kind, test.Path)
+		}
+	}
+}
+
+func TestSyncTo(t *testing.T) {
+	src := newTestFS(t, map[string]string{
+		"/same.txt":      "same",
+		"/changed.txt":   "new",
+		"/added/y":       "y",
+		"/kind/z":        "z",
+		"/skip/data.tmp": "tmp",
+	})
+	dst := newTestFS(t, map[string]string{
+		"/same.txt":    "same",
+		"/changed.txt": "old",
+		"/removed/x":   "x",
+		"/kind":        "file",
+	})
+
+	opts := []basefs.SyncOption{basefs.SyncDiffOptions(basefs.CompareContent(), basefs.Ignore("*.tmp"))}
+	changes, err := src.SyncTo(dst, append(opts, basefs.DryRun())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 7 {
+		t.Fatalf("dry run reported %d changes: %v", len(changes), changes)
+	}
+	if _, err := dst.Stat("/removed/x"); err != nil {
+		t.Fatalf("dry run modified the destination: %s", err)
+	}
+
+	_, err = src.SyncTo(dst, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err = src.Diff(dst, basefs.CompareContent(), basefs.Ignore("*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("trees differ after sync: %v", changes)
+	}
+}
+
+func TestSyncToSymlinks(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFS := func(files map[string]string) (*basefs.SymlinkFileSystem, string) {
+		t.Helper()
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTree(t, dir, files)
+		bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bfs, dir
+	}
+	src, _ := newFS(map[string]string{"/target": "secret", "/dir/file": "file"})
+	for _, link := range [][2]string{{"/target", "/link"}, {"/dir", "/dirlink"}, {"/missing", "/dangling"}} {
+		if err := src.Symlink(link[0], link[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst, dir := newFS(map[string]string{"/link": "old"})
+
+	if _, err := src.SyncTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{"link": "/target", "dirlink": "/dir", "dangling": "/missing"} {
+		p := filepath.Join(dir, name)
+		info, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s: synced as %v, want a symbolic link", name, info.Mode())
+			continue
+		}
+		if got, _ := os.Readlink(p); got != filepath.Join(dir, target) {
+			t.Errorf("%s: links to %s, want %s", name, got, filepath.Join(dir, target))
+		}
+	}
+
+	// Links are skipped for destinations without symbolic links.
+	plain := newTestFS(t, nil)
+	if _, err := src.SyncTo(plain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Stat("/link"); !os.IsNotExist(err) {
+		t.Errorf("expected /link to be skipped, got %v", err)
+	}
+	if data, err := plain.ReadFile("/target"); err != nil || string(data) != "secret" {
+		t.Errorf("/target = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,119 @@
+package basefs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithDirCache remembers the entries read from directories for `ttl`, so
+// that listing the same directories repeatedly does not reach the underlying
+// filesystem. Like the stat cache it is emptied by any mutation through the
+// filesystem, while changes made to the underlying filesystem directly may go
+// unnoticed until the entries expire.
+func WithDirCache(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl <= 0 {
+			return os.ErrInvalid
+		}
+		o.dirs = &dirCache{ttl: ttl, entries: make(map[string]dirEntry)}
+		return nil
+	}
+}
+
+// dirCache memoizes the entries of directories on the underlying filesystem.
+type dirCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]dirEntry
+	sweepAt int
+
+	// generation, bumped by clear so that listings which raced with a
+	// mutation are not stored
+	gen uint64
+}
+
+type dirEntry struct {
+	infos   []os.FileInfo
+	expires time.Time
+}
+
+// lookup returns the cached entries of the directory `ppath`, calling
+// `read` if there are none. The returned slice must not be modified.
+func (c *dirCache) lookup(ppath string, read func() ([]os.FileInfo, error)) ([]os.FileInfo, error) {
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[ppath]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.infos, nil
+	}
+
+	infos, err := read()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return infos, nil
+	}
+	if len(c.entries) >= c.sweepAt {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2*len(c.entries) + 256
+	}
+	c.entries[ppath] = dirEntry{infos, now.Add(c.ttl)}
+	return infos, nil
+}
+
+// clear empties the cache.
+func (c *dirCache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.gen++
+	c.mu.Unlock()
+}
+
+// cachedReaddir implements Readdir for a file when the directory cache is
+// enabled, reading all entries at once and handing them out in batches.
+func (f *File) cachedReaddir(n int) ([]os.FileInfo, error) {
+	if f.dirents == nil {
+		ppath, _ := f.location()
+		infos, err := f.opts.dirs.lookup(ppath, func() ([]os.FileInfo, error) {
+			infos, err := f.f.Readdir(-1)
+			if err != nil {
+				return nil, err
+			}
+			f.entries(infos)
+			return infos, nil
+		})
+		if err != nil {
+			return nil, fixerr(f.prefix, err)
+		}
+		f.dirents = f.visible(infos)
+		if f.opts.binds.virtual.Load() > 0 {
+			dir, _ := f.location()
+			f.dirents = append(f.dirents[:len(f.dirents):len(f.dirents)], f.opts.listVirtual(dir)...)
+		}
+	}
+
+	rest := f.dirents[f.dirpos:]
+	if n <= 0 {
+		f.dirpos = len(f.dirents)
+		return append([]os.FileInfo(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	f.dirpos += n
+	return append([]os.FileInfo(nil), rest[:n]...), nil
+}
@@ -0,0 +1,46 @@
+package basefs
+
+import (
+	"os"
+
+	"github.com/absfs/absfs"
+)
+
+// Dup returns a new handle for the open file, with its own offset starting at
+// the beginning of the file, so that several goroutines can read a file
+// without sharing, and racing on, its offset. The handle is opened with the
+// access mode and O_APPEND flag of `f` and must be closed separately. Where
+// the file exposes its descriptor, the handle is opened through it and
+// refers to the same file even if it was renamed or removed since, elsewhere
+// the file is opened again by its current path. Writing through a duplicate
+// stops the checksum of `f` from being computed as it is written, see
+// WithChecksums, so it is read when `f` is closed.
+func (f *File) Dup() (absfs.File, error) {
+	ppath, name := f.location()
+	if !f.opts.files.open(f) {
+		return nil, &os.PathError{Op: "dup", Path: name, Err: os.ErrClosed}
+	}
+	flags := f.flags & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR | os.O_APPEND)
+	file, ok := reopenHost(f.f, flags)
+	if !ok {
+		p := ppath
+		if f.anon != nil && !f.anon.linked {
+			p = f.anon.tmp
+		}
+		var err error
+		if p == "" {
+			err = os.ErrNotExist
+		} else {
+			file, err = f.fs.OpenFile(p, flags, 0)
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "dup", Path: name, Err: cause(err)}
+		}
+	}
+	if flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.unhash()
+	}
+	d := newFile(f.fs, f.opts, file, f.prefix, ppath, name, flags)
+	d.track()
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package basefs
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// reopenHost opens the file `f` again through its file descriptor, if it
+// exposes one. Unlike dup(2), opening /proc/self/fd/N creates a new open file
+// description with its own offset.
+func reopenHost(f absfs.File, flags int) (absfs.File, bool) {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+	var file *os.File
+	cerr := rc.Control(func(fd uintptr) {
+		file, err = os.OpenFile("/proc/self/fd/"+strconv.FormatUint(uint64(fd), 10), flags|syscall.O_CLOEXEC, 0)
+	})
+	if cerr != nil || err != nil {
+		return nil, false
+	}
+	return file, true
+}
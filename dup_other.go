@@ -0,0 +1,10 @@
+//go:build !linux
+
+package basefs
+
+import "github.com/absfs/absfs"
+
+// reopenHost can't open files through their descriptors on this platform.
+func reopenHost(f absfs.File, flags int) (absfs.File, bool) {
+	return nil, false
+}
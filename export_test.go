@@ -0,0 +1,92 @@
+package basefs
+
+import (
+	"context"
+	"reflect"
+	"unsafe"
+)
+
+// Path exposes the path translation for benchmarks.
+func (f *SymlinkFileSystem) Path(name string) (string, error) {
+	return f.path(name)
+}
+
+// CachedPaths returns the number of entries in the path cache.
+func (f *SymlinkFileSystem) CachedPaths() int {
+	f.opts.paths.mu.Lock()
+	defer f.opts.paths.mu.Unlock()
+	return f.opts.paths.order.Len()
+}
+
+// UnclonedOptions returns the names of the option fields which clone doesn't
+// copy as they are. Every other field is filled with a value and must come
+// out of clone unchanged.
+func UnclonedOptions() []string {
+	o := new(options)
+	var skipped []string
+	v := reflect.ValueOf(o).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !fill(field(v, i)) {
+			skipped = append(skipped, v.Type().Field(i).Name)
+		}
+	}
+	c, err := o.clone(nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		a, b := field(v, i), field(cv, i)
+		if a.Kind() != reflect.Struct && !same(a, b) {
+			skipped = append(skipped, v.Type().Field(i).Name)
+		}
+	}
+	return skipped
+}
+
+// field returns the settable field `i` of `v`.
+func field(v reflect.Value, i int) reflect.Value {
+	f := v.Field(i)
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+}
+
+// fill sets `v` to a value other than its zero value, reporting false for
+// structs, which hold locks or per filesystem state.
+func fill(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+	case reflect.Func:
+		v.Set(reflect.MakeFunc(v.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+	case reflect.Interface:
+		for _, s := range []any{context.Background(), &virtualInfo{}} {
+			if reflect.TypeOf(s).Implements(v.Type()) {
+				v.Set(reflect.ValueOf(s))
+				return true
+			}
+		}
+		panic("no value for " + v.Type().String())
+	default:
+		return false
+	}
+	return true
+}
+
+// same reports whether `a` and `b` hold the same value, or refer to the same.
+func same(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Func, reflect.Map:
+		return a.Pointer() == b.Pointer() && (a.Kind() != reflect.Slice || a.Len() == b.Len())
+	}
+	return a.Interface() == b.Interface()
+}
@@ -0,0 +1,365 @@
+package basefs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestOpenFlags(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("/dir", "/link"); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		Name  string
+		Flags int
+		Fails bool
+	}{
+		{"/dir", basefs.O_DIRECTORY, false},
+		{"/link", basefs.O_DIRECTORY, false},
+		{"/file", basefs.O_DIRECTORY, true},
+		{"/file", basefs.O_NOFOLLOW, false},
+		{"/link", basefs.O_NOFOLLOW, true},
+		{"/link", basefs.O_NOFOLLOW | basefs.O_DIRECTORY, true},
+		{"/new", os.O_WRONLY | os.O_CREATE | basefs.O_NOFOLLOW, false},
+	}
+	for _, test := range tests {
+		f, err := bfs.OpenFile(test.Name, test.Flags, 0644)
+		if test.Fails {
+			if err == nil {
+				f.Close()
+				t.Errorf("%s %#x: expected an error", test.Name, test.Flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %#x: %s", test.Name, test.Flags, err)
+			continue
+		}
+		f.Close()
+	}
+}
+
+func TestSparse(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const size = 4 << 20
+	f, err := bfs.Create("/image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("start"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("middle"), size/2); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	holes := func(name string) (int64, int64) {
+		f, err := bfs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		sf := f.(basefs.SparseFile)
+		if off, err := sf.SeekData(0); err != nil || off != 0 {
+			t.Fatalf("%s: SeekData(0) = %d, %v", name, off, err)
+		}
+		hole, err := sf.SeekHole(0)
+		if err != nil || hole <= 0 || hole > size {
+			t.Fatalf("%s: SeekHole(0) = %d, %v", name, hole, err)
+		}
+		if _, err := sf.SeekData(size); !errors.Is(err, syscall.ENXIO) {
+			t.Fatalf("%s: SeekData past the end: %v", name, err)
+		}
+		next, err := sf.SeekData(hole)
+		if hole == size {
+			next = -1
+		} else if err != nil {
+			t.Fatalf("%s: SeekData(%d): %v", name, hole, err)
+		}
+		return hole, next
+	}
+
+	if err := bfs.CopyFile("/image", "/copy", basefs.Sparse()); err != nil {
+		t.Fatal(err)
+	}
+	hole, next := holes("/image")
+	copyHole, copyNext := holes("/copy")
+	if copyHole != hole || copyNext != next {
+		t.Errorf("copy has data at %d..%d, %d, source at %d..%d, %d", 0, copyHole, copyNext, 0, hole, next)
+	}
+	data, err := bfs.ReadFile("/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, size)
+	copy(expected, "start")
+	copy(expected[size/2:], "middle")
+	if !bytes.Equal(data, expected) {
+		t.Error("copy differs from the source")
+	}
+
+	if err := bfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.CopyFile("/dir", "/dircopy"); err == nil {
+		t.Error("expected an error copying a directory")
+	}
+}
+
+// leakyDirFS returns directory entries named by their full path on the host.
+type leakyDirFS struct {
+	*osfs.FileSystem
+}
+
+func (fs leakyDirFS) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	f, err := fs.FileSystem.OpenFile(name, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return leakyDir{f, name}, nil
+}
+
+type leakyDir struct {
+	absfs.File
+	name string
+}
+
+func (d leakyDir) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(n)
+	for i, info := range infos {
+		infos[i] = leakyInfo{info, filepath.Join(d.name, info.Name())}
+	}
+	return infos, err
+}
+
+func (d leakyDir) Readdirnames(n int) ([]string, error) {
+	names, err := d.File.Readdirnames(n)
+	for i, name := range names {
+		names[i] = filepath.Join(d.name, name)
+	}
+	return names, err
+}
+
+func TestReaddirNames(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]basefs.Option{nil, {basefs.WithDirCache(time.Minute)}} {
+		bfs, err := basefs.NewFS(leakyDirFS{ofs}, filepath.ToSlash(dir), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := bfs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos, err := f.Readdir(-1)
+		f.Close()
+		if err != nil || len(infos) != 1 || infos[0].Name() != "file" {
+			t.Errorf("Readdir: got %v, %v", infos, err)
+		}
+
+		f, err = bfs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil || len(names) != 1 || names[0] != "file" {
+			t.Errorf("Readdirnames: got %q, %v", names, err)
+		}
+	}
+}
+
+func TestStableHandles(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(connFS{ofs}, filepath.ToSlash(dir), basefs.WithStableHandles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/a", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/a/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := bfs.Rename("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "/b/file" {
+		t.Errorf("got name %q after renaming the directory", f.Name())
+	}
+	if _, err := f.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rename on the host is only noticed by Path.
+	err = os.Rename(filepath.Join(dir, "b", "file"), filepath.Join(dir, "b", "moved"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := f.(*basefs.File).Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS == "linux" && p != "/b/moved" {
+		t.Errorf("got path %q after renaming the file on the host", p)
+	}
+	if err := os.Remove(filepath.Join(dir, "b", "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.(*basefs.File).Path(); runtime.GOOS == "linux" && !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error for a removed file, got %v", err)
+	}
+}
+
+func TestDup(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []absfs.SymlinkFileSystem{ofs, connFS{ofs}} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bfs, err := basefs.NewFS(fs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.WriteFile("/file.txt", []byte("hello world"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := bfs.Open("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 6)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			t.Fatal(err)
+		}
+		d, err := f.(*basefs.File).Dup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name() != "/file.txt" {
+			t.Errorf("duplicate named %s", d.Name())
+		}
+		data, err := io.ReadAll(d)
+		if err != nil || string(data) != "hello world" {
+			t.Errorf("duplicate read %q, %v", data, err)
+		}
+		data, err = io.ReadAll(f)
+		if err != nil || string(data) != "world" {
+			t.Errorf("original read %q after the duplicate, %v", data, err)
+		}
+		if _, err := d.Write([]byte("x")); err == nil {
+			t.Error("duplicate of a read only file is writable")
+		}
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.(*basefs.File).Dup(); err == nil {
+			t.Error("duplicated a closed file")
+		}
+	}
+}
+
+func TestFullIO(t *testing.T) {
+	bfs := newTestFS(t, nil)
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bf := f.(*basefs.File)
+	if n, err := bf.WriteAll([]byte("hello world")); n != 11 || err != nil {
+		t.Fatalf("WriteAll() = %d, %v", n, err)
+	}
+
+	buf := make([]byte, 5)
+	if n, err := bf.ReadFullAt(buf, 6); n != 5 || err != nil || string(buf) != "world" {
+		t.Errorf("ReadFullAt(6) = %d, %v, %q", n, err, buf)
+	}
+	if n, err := bf.ReadFullAt(buf, 8); n != 3 || err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFullAt(8) = %d, %v, want 3, ErrUnexpectedEOF", n, err)
+	}
+	if n, err := bf.ReadFullAt(buf, 11); n != 0 || err != io.EOF {
+		t.Errorf("ReadFullAt(11) = %d, %v, want 0, EOF", n, err)
+	}
+
+	data, err := io.ReadAll(bf.SectionReader(2, 7))
+	if err != nil || string(data) != "llo wor" {
+		t.Errorf("SectionReader read %q, %v", data, err)
+	}
+	if off, err := f.Seek(0, io.SeekCurrent); off != 11 || err != nil {
+		t.Errorf("offset moved to %d, %v", off, err)
+	}
+}
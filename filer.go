@@ -0,0 +1,127 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// NewFiler creates a new FileSystem on top of a backend implementing only
+// absfs.Filer. Open, Create, MkdirAll, RemoveAll and Truncate are emulated
+// with the methods of the Filer, Chdir and Getwd of the underlying filesystem
+// fail with ErrUnsupported, which basefs never calls. If `fs` implements
+// absfs.FileSystem, NewFiler is equivalent to NewFileSystem.
+func NewFiler(fs absfs.Filer, dir string, opts ...Option) (*FileSystem, error) {
+	if full, ok := fs.(absfs.FileSystem); ok {
+		return NewFileSystem(full, dir, opts...)
+	}
+	return NewFileSystem(filerFS{fs}, dir, opts...)
+}
+
+// filerFS completes an absfs.Filer to an absfs.FileSystem.
+type filerFS struct {
+	absfs.Filer
+}
+
+func (filerFS) Separator() uint8 {
+	return '/'
+}
+
+func (filerFS) ListSeparator() uint8 {
+	return ':'
+}
+
+func (filerFS) Chdir(dir string) error {
+	return &os.PathError{Op: "chdir", Path: dir, Err: errors.ErrUnsupported}
+}
+
+func (filerFS) Getwd() (string, error) {
+	return "", &os.PathError{Op: "getwd", Path: "", Err: errors.ErrUnsupported}
+}
+
+func (filerFS) TempDir() string {
+	return ""
+}
+
+func (fs filerFS) Open(name string) (absfs.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs filerFS) Create(name string) (absfs.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (fs filerFS) MkdirAll(name string, perm os.FileMode) error {
+	info, err := fs.Stat(name)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	if parent := path.Dir(name); parent != name {
+		if err := fs.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	err = fs.Mkdir(name, perm)
+	if err != nil {
+		// the directory may have been created concurrently
+		if info, err1 := fs.Stat(name); err1 == nil && info.IsDir() {
+			return nil
+		}
+	}
+	return err
+}
+
+func (fs filerFS) RemoveAll(name string) error {
+	stat := fs.Stat
+	if l, ok := fs.Filer.(lstater); ok {
+		// don't descend into linked directories
+		stat = l.Lstat
+	}
+	info, err := stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		f, err := fs.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		for _, n := range names {
+			if err := fs.RemoveAll(path.Join(name, n)); err != nil {
+				return err
+			}
+		}
+	}
+	err = fs.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (fs filerFS) Truncate(name string, size int64) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
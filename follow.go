@@ -0,0 +1,175 @@
+package basefs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// FollowOption configures Follow.
+type FollowOption func(*followOptions) error
+
+type followOptions struct {
+	fromEnd bool
+}
+
+// FromEnd makes Follow skip the current contents of the file and only
+// deliver data appended later.
+func FromEnd() FollowOption {
+	return func(o *followOptions) error {
+		o.fromEnd = true
+		return nil
+	}
+}
+
+// follower is the reader returned by Follow.
+type follower struct {
+	fs   *FileSystem
+	name string
+	w    *Watcher
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	file   absfs.File
+	info   os.FileInfo
+	offset int64
+	err    error
+}
+
+// Follow returns a reader delivering the contents of the named file and then
+// the data appended to it, like `tail -f`. Reads at the end of the file block
+// until more data is written or the reader is closed. If the file is
+// truncated, reading continues from its start, and if it is replaced, e.g. by
+// log rotation, the new file is opened once the old one is read to the end.
+// Reads fail with ErrClosed once the filesystem is closed.
+// Replacements are only detected where the underlying filesystem reports
+// device and inode numbers.
+func (f *FileSystem) Follow(name string, opts ...FollowOption) (io.ReadCloser, error) {
+	o := new(followOptions)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	file, err := f.outer().Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = &os.PathError{Op: "follow", Path: name, Err: os.ErrInvalid}
+	}
+	if err == nil && o.fromEnd {
+		_, err = file.Seek(info.Size(), io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// The directory is watched, so that the file is still seen after it
+	// has been replaced.
+	w, err := f.Watch(path.Dir(name))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r := &follower{fs: f, name: name, w: w, done: make(chan struct{}), file: file, info: info}
+	if o.fromEnd {
+		r.offset = info.Size()
+	}
+	return r, nil
+}
+
+func (r *follower) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		n, err := r.read(p)
+		r.mu.Unlock()
+		if n > 0 || err != nil {
+			return n, r.fs.opts.interrupted("read", r.name, err)
+		}
+
+		// Wait for a change, with a timeout in case events were missed.
+		select {
+		case <-r.done:
+			return 0, os.ErrClosed
+		case <-r.w.Events:
+		case <-r.w.Errors:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// read reads from the current file, and checks whether it was truncated or
+// replaced when it is at its end.
+func (r *follower) read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := r.file.Read(p)
+	r.offset += int64(n)
+	if n > 0 || err != io.EOF {
+		return n, err
+	}
+
+	info, err := r.fs.outer().Stat(r.name)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if replaced(r.info, info) {
+		file, err := r.fs.outer().Open(r.name)
+		if err != nil {
+			return 0, nil
+		}
+		r.file.Close()
+		r.file, r.info, r.offset = file, info, 0
+		return 0, nil
+	}
+	if info.Size() < r.offset {
+		if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.offset = 0
+	}
+	return 0, nil
+}
+
+// replaced reports whether `cur` describes a different file than `old`.
+func replaced(old, cur os.FileInfo) bool {
+	a, ok := identify(old)
+	if !ok {
+		return false
+	}
+	b, ok := identify(cur)
+	return ok && a != b
+}
+
+// Close stops following the file and makes blocked and future reads fail with
+// os.ErrClosed.
+func (r *follower) Close() error {
+	var err error
+	r.once.Do(func() {
+		close(r.done)
+		err = r.w.Close()
+		r.mu.Lock()
+		if err1 := r.file.Close(); err == nil {
+			err = err1
+		}
+		r.file = nil
+		r.mu.Unlock()
+	})
+	return err
+}
@@ -0,0 +1,99 @@
+package basefs_test
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absfs/basefs"
+)
+
+// readN reads `n` bytes from `r`, failing the test if they don't arrive in
+// time.
+func readN(t *testing.T, r io.Reader, n int) string {
+	t.Helper()
+	done := make(chan string, 1)
+	go func() {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- string(buf)
+	}()
+	select {
+	case s := <-done:
+		return s
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out reading")
+		return ""
+	}
+}
+
+func TestFollow(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/log/app.log": "first\n",
+	})
+	r, err := bfs.Follow("/log/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	appendFile := func(name, data string) {
+		f, err := bfs.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s := readN(t, r, 6); s != "first\n" {
+		t.Errorf("got %q", s)
+	}
+	appendFile("/log/app.log", "second\n")
+	if s := readN(t, r, 7); s != "second\n" {
+		t.Errorf("got %q", s)
+	}
+
+	// Truncation starts over.
+	if err := bfs.Truncate("/log/app.log", 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile("/log/app.log", "new\n")
+	if s := readN(t, r, 4); s != "new\n" {
+		t.Errorf("after truncation got %q", s)
+	}
+
+	// Rotation opens the new file.
+	if err := bfs.Rename("/log/app.log", "/log/app.log.1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile("/log/app.log", "rotated\n")
+	if s := readN(t, r, 8); s != "rotated\n" {
+		t.Errorf("after rotation got %q", s)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != os.ErrClosed {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+
+	r, err = bfs.Follow("/log/app.log", basefs.FromEnd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	appendFile("/log/app.log", "tail\n")
+	if s := readN(t, r, 5); s != "tail\n" {
+		t.Errorf("from end got %q", s)
+	}
+}
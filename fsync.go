@@ -0,0 +1,245 @@
+package basefs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// Syncer is implemented by filesystems which can commit all of their pending
+// writes to stable storage at once, like syncfs(2).
+type Syncer interface {
+	Sync() error
+}
+
+// SyncPolicy controls when the data written to files through basefs is synced
+// to stable storage, see WithSyncPolicy.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs a file after every write to it, as with O_SYNC.
+	SyncAlways SyncPolicy = iota + 1
+
+	// SyncOnClose syncs files which were written to when they are closed.
+	SyncOnClose
+
+	// SyncNever makes File.Sync and FileSystem.Sync only flush write buffers,
+	// and skips the syncs done by WriteFileAtomic and CopyFile, trading
+	// durability for throughput, e.g. for scratch space.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncOnClose:
+		return "on_close"
+	case SyncNever:
+		return "never"
+	}
+	return ""
+}
+
+func (p SyncPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *SyncPolicy) UnmarshalText(text []byte) error {
+	for _, v := range []SyncPolicy{0, SyncAlways, SyncOnClose, SyncNever} {
+		if v.String() == string(text) {
+			*p = v
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sync policy %q", text)
+}
+
+// WithSyncPolicy sets when data written through basefs is synced. Without it,
+// files are only synced when Sync is called on them or on the filesystem.
+func WithSyncPolicy(p SyncPolicy) Option {
+	return func(o *options) error {
+		if p < 0 || p > SyncNever {
+			return os.ErrInvalid
+		}
+		o.syncPolicy = p
+		return nil
+	}
+}
+
+// fsync flushes the write buffer of the file and syncs it, unless the sync
+// policy is SyncNever.
+func (f *File) fsync() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if f.opts.syncPolicy == SyncNever {
+		return nil
+	}
+	return fixerr(f.prefix, f.f.Sync())
+}
+
+// syncWrite syncs the file after a successful write if the sync policy is
+// SyncAlways.
+func (f *File) syncWrite() error {
+	if f.opts.syncPolicy != SyncAlways {
+		return nil
+	}
+	return f.fsync()
+}
+
+// openFiles tracks the files opened through a filesystem which have not been
+// closed yet.
+type openFiles struct {
+	mu    sync.Mutex
+	files map[*File]struct{}
+}
+
+func (o *openFiles) add(f *File) {
+	o.mu.Lock()
+	if o.files == nil {
+		o.files = make(map[*File]struct{})
+	}
+	o.files[f] = struct{}{}
+	o.mu.Unlock()
+}
+
+func (o *openFiles) remove(f *File) {
+	o.mu.Lock()
+	delete(o.files, f)
+	o.mu.Unlock()
+}
+
+// open reports whether `f` is still open.
+func (o *openFiles) open(f *File) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.files[f]
+	return ok
+}
+
+// list returns the open files.
+func (o *openFiles) list() []*File {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	files := make([]*File, 0, len(o.files))
+	for f := range o.files {
+		files = append(files, f)
+	}
+	return files
+}
+
+// Sync commits the contents of the filesystem to stable storage. If the
+// underlying filesystem implements Syncer the call is delegated to it,
+// otherwise every file opened through the filesystem which is still open is
+// synced, followed by the directories holding them and the base directory.
+// With SyncNever, only the write buffers of the open files are flushed.
+func (f *FileSystem) Sync() error {
+	return syncAll(f.fs, f.prefix, f.opts)
+}
+
+func syncAll(fs absfs.FileSystem, prefix string, o *options) error {
+	if s, ok := fs.(Syncer); ok && o.syncPolicy != SyncNever {
+		return fixerr(prefix, s.Sync())
+	}
+
+	var errs []error
+	dirs := map[string]bool{prefix: true}
+	for _, file := range o.files.list() {
+		err := file.fsync()
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			errs = append(errs, fixerr(prefix, err))
+		}
+		ppath, _ := file.location()
+		dirs[path.Dir(ppath)] = true
+	}
+
+	if o.syncPolicy == SyncNever {
+		return errors.Join(errs...)
+	}
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Strings(names)
+	for _, dir := range names {
+		err := syncDir(fs, dir)
+		if err != nil {
+			errs = append(errs, fixerr(prefix, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithDirSync syncs the parent directory after files are created, removed or
+// renamed through basefs, and directories made, including by WriteFile,
+// WriteFileAtomic and CopyFile, so that the change survives a power loss even
+// if the data of the file itself was synced. For renames both parents are
+// synced. Filesystems which can't sync directories are not affected.
+func WithDirSync() Option {
+	return func(o *options) error {
+		o.dirSync = true
+		return nil
+	}
+}
+
+// SyncDir syncs the named directory, making the creation, removal and
+// renaming of its entries durable.
+func (f *FileSystem) SyncDir(name string) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	info, err := f.fs.Stat(ppath)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "syncdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return f.fixerr(syncDir(f.fs, ppath))
+}
+
+// syncParents syncs the directories holding `ppaths` on the underlying
+// filesystem `fs` if WithDirSync is set.
+func (o *options) syncParents(fs absfs.FileSystem, ppaths ...string) error {
+	if !o.dirSync {
+		return nil
+	}
+	var errs []error
+	for i, ppath := range ppaths {
+		dir := path.Dir(ppath)
+		if i > 0 && dir == path.Dir(ppaths[i-1]) {
+			continue
+		}
+		if err := syncDir(fs, dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncDir syncs the directory `dir`, so that the entries created or removed
+// in it are durable. Directories which have been removed, and platforms which
+// cannot sync directories, are ignored.
+func syncDir(fs absfs.FileSystem, dir string) error {
+	d, err := fs.Open(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	d.Close()
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, errors.ErrUnsupported) || os.IsPermission(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,331 @@
+package basefs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestSync(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bfs.Mkdir("/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("durable")
+	r, err := bfs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	if err := bfs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "dir", "file.txt"))
+	if err != nil || string(data) != "durable" {
+		t.Errorf("got %q %v", data, err)
+	}
+
+	// files which were removed while open don't fail the sync
+	err = bfs.RemoveAll("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncCountFS counts the syncs of the files it opens.
+type syncCountFS struct {
+	*osfs.FileSystem
+	syncs *int
+}
+
+func (fs syncCountFS) Open(name string) (absfs.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs syncCountFS) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	f, err := fs.FileSystem.OpenFile(name, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return syncCountFile{f, fs.syncs}, nil
+}
+
+type syncCountFile struct {
+	absfs.File
+	syncs *int
+}
+
+func (f syncCountFile) Sync() error {
+	*f.syncs++
+	return f.File.Sync()
+}
+
+func TestSyncPolicy(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		policy basefs.SyncPolicy
+		syncs  int
+	}{
+		{0, 1},
+		{basefs.SyncAlways, 3},
+		{basefs.SyncOnClose, 2},
+		{basefs.SyncNever, 0},
+	} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		syncs := 0
+		fs := syncCountFS{ofs, &syncs}
+		bfs, err := basefs.NewFileSystem(fs, filepath.ToSlash(dir), basefs.WithSyncPolicy(test.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := bfs.Create("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("one")
+		f.Write([]byte("two"))
+		if err := f.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if syncs != test.syncs {
+			t.Errorf("%v: %d syncs, want %d", test.policy, syncs, test.syncs)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+		if err != nil || string(data) != "onetwo" {
+			t.Errorf("%v: got %q %v", test.policy, data, err)
+		}
+	}
+
+	if _, err := basefs.NewFileSystem(ofs, "/", basefs.WithSyncPolicy(basefs.SyncNever+1)); err == nil {
+		t.Error("expected an invalid sync policy to be rejected")
+	}
+}
+
+func TestDirSync(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncs := 0
+	bfs, err := basefs.NewFileSystem(syncCountFS{ofs, &syncs}, filepath.ToSlash(dir), basefs.WithDirSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := func(what string, want int, fn func() error) {
+		t.Helper()
+		syncs = 0
+		if err := fn(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if syncs != want {
+			t.Errorf("%s: %d syncs, want %d", what, syncs, want)
+		}
+	}
+
+	step("create", 1, func() error {
+		f, err := bfs.Create("/file.txt")
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	})
+	step("mkdir", 1, func() error { return bfs.Mkdir("/dir", 0755) })
+	step("rename", 2, func() error { return bfs.Rename("/file.txt", "/dir/file.txt") })
+	step("remove", 1, func() error { return bfs.Remove("/dir/file.txt") })
+	step("syncdir", 1, func() error { return bfs.SyncDir("/dir") })
+
+	if err := bfs.WriteFile("/file.txt", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.SyncDir("/file.txt"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("expected ENOTDIR syncing a file, got %v", err)
+	}
+	if err := bfs.SyncDir("/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bfs.Watch("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := bfs.Watch("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	if err := bfs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("expected the file to be closed")
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("expected the watcher to be closed")
+	}
+	if err := bfs.Close(); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+}
+
+func TestCloseInterrupts(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"/src/a": "a", "/src/c": "c", "/src/d/e": "e"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithShutdown(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("/src/a", "/src/b"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := bfs.Watch("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy is interrupted when it skips /src/b.
+	err = bfs.CopyDir("/src", "/dst", basefs.SkipSymlinks(func(string) {
+		cancel()
+		for !errors.Is(w.Err(), basefs.ErrClosed) {
+			runtime.Gosched()
+		}
+	}))
+	if !errors.Is(err, basefs.ErrClosed) {
+		t.Errorf("CopyDir: expected ErrClosed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dst", "a")); err != nil {
+		t.Errorf("file copied before the interruption: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dst", "c")); !os.IsNotExist(err) {
+		t.Errorf("file copied after the interruption: %v", err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("expected the watcher to be closed")
+	}
+
+	if err := bfs.Walk("/", func(string, os.FileInfo, error) error { return nil }); !errors.Is(err, basefs.ErrClosed) {
+		t.Errorf("Walk: expected ErrClosed, got %v", err)
+	}
+	if err := bfs.CopyFile("/src/a", "/copy"); !errors.Is(err, basefs.ErrClosed) {
+		t.Errorf("CopyFile: expected ErrClosed, got %v", err)
+	}
+	if _, err := bfs.Watch("/"); !errors.Is(err, basefs.ErrClosed) {
+		t.Errorf("Watch: expected ErrClosed, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "base")
+	err = os.Mkdir(base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := bfs.Ping(ctx, basefs.ProbeWrite()); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("probe file left behind: %v %v", entries, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bfs.Ping(canceled); err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+
+	err = os.Remove(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bfs.Ping(ctx)
+	if !os.IsNotExist(err) || strings.Contains(err.Error(), dir) {
+		t.Errorf("expected a not exist error without the base path, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package basefs
+
+import (
+	"io"
+	"os"
+)
+
+// ReadFullAt reads exactly len(buf) bytes starting at the offset `off` of
+// the file, retrying short reads, as io.ReadFull does for readers. It
+// returns io.EOF if nothing was read because `off` is at or past the end of
+// the file, and io.ErrUnexpectedEOF if the end was reached after reading
+// only part of `buf`.
+func (f *File) ReadFullAt(buf []byte, off int64) (int, error) {
+	var total int
+	for total < len(buf) {
+		n, err := f.ReadAt(buf[total:], off+int64(total))
+		total += n
+		switch {
+		case err == io.EOF && total > 0 && total < len(buf):
+			return total, io.ErrUnexpectedEOF
+		case err == io.EOF && total == len(buf):
+			return total, nil
+		case err != nil:
+			return total, err
+		case n == 0:
+			return total, &os.PathError{Op: "read", Path: f.Name(), Err: io.ErrNoProgress}
+		}
+	}
+	return total, nil
+}
+
+// WriteAll writes all of `p` at the current offset, retrying short writes,
+// and returns the number of bytes written, which is less than len(p) only
+// with an error. It fails with io.ErrShortWrite if the underlying file stops
+// accepting data without reporting an error.
+func (f *File) WriteAll(p []byte) (int, error) {
+	var total int
+	for total < len(p) {
+		n, err := f.Write(p[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, &os.PathError{Op: "write", Path: f.Name(), Err: io.ErrShortWrite}
+		}
+	}
+	return total, nil
+}
+
+// SectionReader returns a reader of the `n` bytes of the file starting at the
+// offset `off`, which reads with ReadAt and so doesn't use or move the offset
+// of the file. Several section readers can be used concurrently.
+func (f *File) SectionReader(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(f, off, n)
+}
@@ -0,0 +1,67 @@
+package basefs
+
+import (
+	"path"
+	"strings"
+)
+
+// match reports whether the slash separated path `name` matches `pattern`.
+// In addition to the syntax understood by path.Match, a `**` element matches
+// zero or more path elements. A pattern without any slashes is matched
+// against the last element of `name` only.
+func match(pattern, name string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		return path.Match(pattern, path.Base(name))
+	}
+
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchParts(pattern, name[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
+
+// validPattern returns path.ErrBadPattern if `pattern` is malformed.
+func validPattern(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether `name` matches any of `patterns`. Malformed
+// patterns never match.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
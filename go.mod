@@ -6,6 +6,8 @@ require (
 	github.com/absfs/absfs v0.0.0-20230318165928-6f31c6ac7458
 	github.com/absfs/fstesting v0.0.0-20180810212821-8b575cdeb80d
 	github.com/absfs/osfs v0.0.0-20220705103527-80b6215cf130
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/sys v0.24.0
 )
 
 require (
@@ -13,5 +15,4 @@ require (
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/xtgo/set v1.0.0 // indirect
-	golang.org/x/sys v0.1.0 // indirect
 )
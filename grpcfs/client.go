@@ -0,0 +1,252 @@
+package grpcfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/absfs/absfs"
+	"google.golang.org/grpc"
+)
+
+// Client is an absfs.SymlinkFileSystem accessing a filesystem served by
+// Register over a gRPC connection. Files are not held open on the server,
+// every read or write of a Client file is a separate streaming call.
+type Client struct {
+	cc  grpc.ClientConnInterface
+	ctx context.Context
+	cwd string
+}
+
+// NewClient returns a Client using the connection `cc`.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc, ctx: context.Background(), cwd: "/"}
+}
+
+// WithContext returns a copy of the client which makes its calls with `ctx`.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+func (c *Client) abs(name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(c.cwd, name)
+	}
+	return path.Clean(name)
+}
+
+func (c *Client) invoke(method, op, name string, req, resp any) error {
+	if resp == nil {
+		resp = &empty{}
+	}
+	err := c.cc.Invoke(c.ctx, "/"+ServiceName+"/"+method, req, resp, grpc.ForceCodec(codec{}))
+	return fromStatus(op, name, err)
+}
+
+func (c *Client) stream(i int) (grpc.ClientStream, error) {
+	desc := &serviceDesc.Streams[i]
+	return c.cc.NewStream(c.ctx, desc, "/"+ServiceName+"/"+desc.StreamName, grpc.ForceCodec(codec{}))
+}
+
+// OpenFile opens the named file. Files created or truncated by the flags are
+// created or truncated on the server before OpenFile returns.
+func (c *Client) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	name = c.abs(name)
+	info := new(fileInfo)
+	err := c.invoke("Open", "open", name, &openRequest{name, toWire(flags), uint32(perm)}, info)
+	if err != nil {
+		return nil, err
+	}
+	return &file{c: c, name: name, flags: flags &^ (os.O_CREATE | os.O_EXCL | os.O_TRUNC)}, nil
+}
+
+func (c *Client) Open(name string) (absfs.File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *Client) Create(name string) (absfs.File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *Client) Mkdir(name string, perm os.FileMode) error {
+	name = c.abs(name)
+	return c.invoke("Mkdir", "mkdir", name, &modeRequest{name, uint32(perm)}, nil)
+}
+
+func (c *Client) MkdirAll(name string, perm os.FileMode) error {
+	name = c.abs(name)
+	return c.invoke("MkdirAll", "mkdir", name, &modeRequest{name, uint32(perm)}, nil)
+}
+
+func (c *Client) Remove(name string) error {
+	name = c.abs(name)
+	return c.invoke("Remove", "remove", name, &pathRequest{name}, nil)
+}
+
+func (c *Client) RemoveAll(name string) error {
+	name = c.abs(name)
+	return c.invoke("RemoveAll", "removeall", name, &pathRequest{name}, nil)
+}
+
+func (c *Client) Rename(oldpath, newpath string) error {
+	oldpath, newpath = c.abs(oldpath), c.abs(newpath)
+	return c.invoke("Rename", "rename", oldpath, &pairRequest{oldpath, newpath}, nil)
+}
+
+func (c *Client) Stat(name string) (os.FileInfo, error) {
+	name = c.abs(name)
+	info := new(fileInfo)
+	err := c.invoke("Stat", "stat", name, &pathRequest{name}, info)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteInfo{info}, nil
+}
+
+func (c *Client) Lstat(name string) (os.FileInfo, error) {
+	name = c.abs(name)
+	info := new(fileInfo)
+	err := c.invoke("Lstat", "lstat", name, &pathRequest{name}, info)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteInfo{info}, nil
+}
+
+func (c *Client) Chmod(name string, mode os.FileMode) error {
+	name = c.abs(name)
+	return c.invoke("Chmod", "chmod", name, &modeRequest{name, uint32(mode)}, nil)
+}
+
+func (c *Client) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	name = c.abs(name)
+	return c.invoke("Chtimes", "chtimes", name, &timesRequest{name, atime, mtime}, nil)
+}
+
+func (c *Client) Chown(name string, uid, gid int) error {
+	name = c.abs(name)
+	return c.invoke("Chown", "chown", name, &ownerRequest{name, uid, gid}, nil)
+}
+
+func (c *Client) Lchown(name string, uid, gid int) error {
+	name = c.abs(name)
+	return c.invoke("Lchown", "lchown", name, &ownerRequest{name, uid, gid}, nil)
+}
+
+func (c *Client) Truncate(name string, size int64) error {
+	name = c.abs(name)
+	return c.invoke("Truncate", "truncate", name, &sizeRequest{name, size}, nil)
+}
+
+func (c *Client) Readlink(name string) (string, error) {
+	name = c.abs(name)
+	resp := new(linkResponse)
+	err := c.invoke("Readlink", "readlink", name, &pathRequest{name}, resp)
+	return resp.Target, err
+}
+
+func (c *Client) Symlink(oldname, newname string) error {
+	newname = c.abs(newname)
+	return c.invoke("Symlink", "symlink", newname, &pairRequest{oldname, newname}, nil)
+}
+
+func (c *Client) Separator() uint8 {
+	return '/'
+}
+
+func (c *Client) ListSeparator() uint8 {
+	return ':'
+}
+
+func (c *Client) Chdir(dir string) error {
+	dir = c.abs(dir)
+	info, err := c.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "chdir", Path: dir, Err: os.ErrInvalid}
+	}
+	c.cwd = dir
+	return nil
+}
+
+func (c *Client) Getwd() (string, error) {
+	return c.cwd, nil
+}
+
+func (c *Client) TempDir() string {
+	return "/tmp"
+}
+
+// readAt reads up to len(p) bytes of the file `name` at `off` using a Read
+// stream.
+func (c *Client) readAt(name string, p []byte, off int64) (int, error) {
+	s, err := c.stream(0)
+	if err != nil {
+		return 0, fromStatus("read", name, err)
+	}
+	err = s.SendMsg(&readRequest{name, off, int64(len(p))})
+	if err == nil {
+		err = s.CloseSend()
+	}
+	n := 0
+	for err == nil {
+		ch := new(chunk)
+		err = s.RecvMsg(ch)
+		n += copy(p[n:], ch.Data)
+	}
+	if err == io.EOF && n < len(p) {
+		return n, io.EOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, fromStatus("read", name, err)
+}
+
+// writeAt writes `p` to the file `name` at `off`, or at its end if `flags`
+// include os.O_APPEND, using a Write stream.
+func (c *Client) writeAt(name string, flags int, p []byte, off int64) (int, error) {
+	s, err := c.stream(1)
+	if err != nil {
+		return 0, fromStatus("write", name, err)
+	}
+	req := &writeRequest{Name: name, Flags: toWire(flags), Offset: off}
+	for i := 0; err == nil && (i == 0 || i < len(p)); i += chunkSize {
+		req.Data = p[i:min(i+chunkSize, len(p))]
+		err = s.SendMsg(req)
+		req = &writeRequest{}
+	}
+	if err == nil {
+		err = s.CloseSend()
+	}
+	resp := new(writeResponse)
+	if err == nil || err == io.EOF {
+		err = s.RecvMsg(resp)
+	}
+	if err != nil {
+		return 0, fromStatus("write", name, err)
+	}
+	if resp.N != int64(len(p)) {
+		return int(resp.N), &os.PathError{Op: "write", Path: name, Err: io.ErrShortWrite}
+	}
+	return len(p), nil
+}
+
+// remoteInfo implements os.FileInfo for file information received from the
+// server.
+type remoteInfo struct {
+	i *fileInfo
+}
+
+func (r *remoteInfo) Name() string       { return r.i.Name }
+func (r *remoteInfo) Size() int64        { return r.i.Size }
+func (r *remoteInfo) Mode() os.FileMode  { return os.FileMode(r.i.Mode) }
+func (r *remoteInfo) ModTime() time.Time { return r.i.ModTime }
+func (r *remoteInfo) IsDir() bool        { return r.Mode().IsDir() }
+func (r *remoteInfo) Sys() any           { return nil }
@@ -0,0 +1,158 @@
+package grpcfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// file is a file opened by a Client. It only holds the name, flags and
+// offset of the file, its contents are read and written on the server.
+type file struct {
+	c      *Client
+	name   string
+	flags  int
+	off    int64
+	closed bool
+
+	entries []os.FileInfo
+}
+
+func (f *file) check(op string, write bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if write && f.flags&(os.O_WRONLY|os.O_RDWR) == 0 || !write && f.flags&os.O_WRONLY != 0 {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return f.c.readAt(f.name, p, off)
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if f.flags&os.O_APPEND != 0 {
+		if err := f.check("write", true); err != nil {
+			return 0, err
+		}
+		return f.c.writeAt(f.name, f.flags, p, 0)
+	}
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	return f.c.writeAt(f.name, f.flags&^os.O_APPEND, p, off)
+}
+
+func (f *file) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += info.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// Sync does nothing, writes are complete when they return.
+func (f *file) Sync() error {
+	return nil
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.c.Stat(f.name)
+}
+
+func (f *file) Truncate(size int64) error {
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	return f.c.Truncate(f.name, size)
+}
+
+// Readdir lists the directory on the first call and returns the entries in
+// batches of `n` from this listing.
+func (f *file) Readdir(n int) ([]os.FileInfo, error) {
+	if f.entries == nil {
+		resp := new(dirResponse)
+		err := f.c.invoke("ReadDir", "readdir", f.name, &pathRequest{f.name}, resp)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = make([]os.FileInfo, len(resp.Entries))
+		for i, e := range resp.Entries {
+			f.entries[i] = &remoteInfo{e}
+		}
+		sort.Slice(f.entries, func(i, j int) bool {
+			return f.entries[i].Name() < f.entries[j].Name()
+		})
+	}
+	if n <= 0 {
+		infos := f.entries
+		f.entries = f.entries[len(f.entries):]
+		return infos, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	infos := f.entries[:n]
+	f.entries = f.entries[n:]
+	return infos, nil
+}
+
+func (f *file) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = path.Base(info.Name())
+	}
+	return names, err
+}
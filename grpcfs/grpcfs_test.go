@@ -0,0 +1,133 @@
+package grpcfs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/basefs/grpcfs"
+	"github.com/absfs/osfs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newClient(t *testing.T) (*grpcfs.Client, string) {
+	t.Helper()
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpcfs.ServerOption())
+	grpcfs.Register(s, bfs)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	dial := func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.DialContext(ctx)
+	}
+	cc, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(dial), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return grpcfs.NewClient(cc), dir
+}
+
+func TestClient(t *testing.T) {
+	c, dir := newClient(t)
+
+	err := c.MkdirAll("/a/b", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	f, err := c.Create("/a/b/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("wrote %d bytes: %v", n, err)
+	}
+	f.Close()
+	ondisk, err := os.ReadFile(filepath.Join(dir, "a", "b", "file.bin"))
+	if err != nil || !bytes.Equal(ondisk, data) {
+		t.Fatalf("unexpected contents on disk: %d bytes %v", len(ondisk), err)
+	}
+
+	f, err = c.Open("/a/b/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes: %v", len(got), err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("expected an error writing to a read only file")
+	}
+	f.Close()
+
+	f, err = c.OpenFile("/a/b/file.bin", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("!")
+	f.Close()
+	info, err := c.Stat("a/b/file.bin")
+	if err != nil || info.Size() != int64(len(data)+1) {
+		t.Errorf("unexpected size after append: %v %v", info, err)
+	}
+
+	err = c.Rename("/a/b/file.bin", "/a/moved.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil || len(names) != 2 || names[0] != "b" || names[1] != "moved.bin" {
+		t.Errorf("unexpected directory entries %q %v", names, err)
+	}
+
+	if _, err := c.Stat("/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := c.Stat("/../../" + filepath.Base(dir)); !os.IsNotExist(err) {
+		t.Errorf("expected the base to confine the client, got %v", err)
+	}
+	err = c.Symlink("/a/moved.bin", "/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err := c.Readlink("/link"); err != nil || target != "/a/moved.bin" {
+		t.Errorf("unexpected link target %q %v", target, err)
+	}
+}
+
+func TestCodecNotRegistered(t *testing.T) {
+	newClient(t)
+	if c := encoding.GetCodec(grpcfs.ContentSubtype); c != nil {
+		t.Errorf("the codec is registered globally as %q", c.Name())
+	}
+}
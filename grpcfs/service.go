@@ -0,0 +1,427 @@
+// Package grpcfs defines a gRPC service for the absfs filesystem API, with a
+// server exposing a local filesystem, typically a basefs, and a Client which
+// implements absfs.SymlinkFileSystem on top of it.
+//
+// The service "basefs.FileSystem" has unary methods for every filesystem
+// operation, a server streaming Read method and a client streaming Write
+// method. Messages are encoded as JSON using the "basefs-json" content
+// subtype, so no generated code is required on either side. The codec is not
+// registered with gRPC: servers are created with ServerOption and the Client
+// sets it on each call.
+package grpcfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/absfs/absfs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the fully qualified name of the gRPC service.
+const ServiceName = "basefs.FileSystem"
+
+// ContentSubtype is the content subtype used by the service's codec.
+const ContentSubtype = "basefs-json"
+
+// chunkSize is the largest amount of file data sent in a single message.
+const chunkSize = 64 << 10
+
+// ServerOption makes a server use the service's codec. Servers the service
+// is registered on must be created with it, and then use it for every
+// service they serve.
+func ServerOption() grpc.ServerOption {
+	return grpc.ForceServerCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return ContentSubtype
+}
+
+// messages
+
+type empty struct{}
+
+type pathRequest struct {
+	Name string `json:"name"`
+}
+
+type openRequest struct {
+	Name  string `json:"name"`
+	Flags uint32 `json:"flags"`
+	Perm  uint32 `json:"perm"`
+}
+
+type pairRequest struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type modeRequest struct {
+	Name string `json:"name"`
+	Mode uint32 `json:"mode"`
+}
+
+type timesRequest struct {
+	Name  string    `json:"name"`
+	Atime time.Time `json:"atime"`
+	Mtime time.Time `json:"mtime"`
+}
+
+type ownerRequest struct {
+	Name string `json:"name"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+}
+
+type sizeRequest struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type readRequest struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// writeRequest is sent one or more times on a Write stream. The name, flags
+// and offset of the first message apply to the whole stream.
+type writeRequest struct {
+	Name   string `json:"name,omitempty"`
+	Flags  uint32 `json:"flags,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+type writeResponse struct {
+	N int64 `json:"n"`
+}
+
+type chunk struct {
+	Data []byte `json:"data"`
+}
+
+type fileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+}
+
+type dirResponse struct {
+	Entries []*fileInfo `json:"entries"`
+}
+
+type linkResponse struct {
+	Target string `json:"target"`
+}
+
+func newFileInfo(info os.FileInfo) *fileInfo {
+	return &fileInfo{info.Name(), info.Size(), uint32(info.Mode()), info.ModTime()}
+}
+
+// flags on the wire, independent of the values of the os package
+const (
+	wireWRONLY = 1 << iota
+	wireRDWR
+	wireAPPEND
+	wireCREATE
+	wireEXCL
+	wireSYNC
+	wireTRUNC
+)
+
+var wireFlags = []struct {
+	os   int
+	wire uint32
+}{
+	{os.O_WRONLY, wireWRONLY},
+	{os.O_RDWR, wireRDWR},
+	{os.O_APPEND, wireAPPEND},
+	{os.O_CREATE, wireCREATE},
+	{os.O_EXCL, wireEXCL},
+	{os.O_SYNC, wireSYNC},
+	{os.O_TRUNC, wireTRUNC},
+}
+
+func toWire(flags int) uint32 {
+	var w uint32
+	for _, f := range wireFlags {
+		if flags&f.os != 0 {
+			w |= f.wire
+		}
+	}
+	return w
+}
+
+func fromWire(w uint32) int {
+	var flags int
+	for _, f := range wireFlags {
+		if w&f.wire != 0 {
+			flags |= f.os
+		}
+	}
+	return flags
+}
+
+// Register registers the service on `s`, serving the filesystem `fs`.
+func Register(s grpc.ServiceRegistrar, fs absfs.SymlinkFileSystem) {
+	s.RegisterService(&serviceDesc, &server{fs})
+}
+
+type server struct {
+	fs absfs.SymlinkFileSystem
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("Open", func(s *server, r *openRequest) (*fileInfo, error) {
+			f, err := s.fs.OpenFile(r.Name, fromWire(r.Flags), os.FileMode(r.Perm))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return nil, err
+			}
+			return newFileInfo(info), nil
+		}),
+		unary("Stat", func(s *server, r *pathRequest) (*fileInfo, error) {
+			info, err := s.fs.Stat(r.Name)
+			if err != nil {
+				return nil, err
+			}
+			return newFileInfo(info), nil
+		}),
+		unary("Lstat", func(s *server, r *pathRequest) (*fileInfo, error) {
+			info, err := s.fs.Lstat(r.Name)
+			if err != nil {
+				return nil, err
+			}
+			return newFileInfo(info), nil
+		}),
+		unary("ReadDir", func(s *server, r *pathRequest) (*dirResponse, error) {
+			f, err := s.fs.Open(r.Name)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			infos, err := f.Readdir(-1)
+			if err != nil {
+				return nil, err
+			}
+			resp := &dirResponse{Entries: make([]*fileInfo, len(infos))}
+			for i, info := range infos {
+				resp.Entries[i] = newFileInfo(info)
+			}
+			return resp, nil
+		}),
+		unary("Readlink", func(s *server, r *pathRequest) (*linkResponse, error) {
+			target, err := s.fs.Readlink(r.Name)
+			if err != nil {
+				return nil, err
+			}
+			return &linkResponse{target}, nil
+		}),
+		unary("Mkdir", func(s *server, r *modeRequest) (*empty, error) {
+			return nil, s.fs.Mkdir(r.Name, os.FileMode(r.Mode))
+		}),
+		unary("MkdirAll", func(s *server, r *modeRequest) (*empty, error) {
+			return nil, s.fs.MkdirAll(r.Name, os.FileMode(r.Mode))
+		}),
+		unary("Remove", func(s *server, r *pathRequest) (*empty, error) {
+			return nil, s.fs.Remove(r.Name)
+		}),
+		unary("RemoveAll", func(s *server, r *pathRequest) (*empty, error) {
+			return nil, s.fs.RemoveAll(r.Name)
+		}),
+		unary("Rename", func(s *server, r *pairRequest) (*empty, error) {
+			return nil, s.fs.Rename(r.Old, r.New)
+		}),
+		unary("Symlink", func(s *server, r *pairRequest) (*empty, error) {
+			return nil, s.fs.Symlink(r.Old, r.New)
+		}),
+		unary("Chmod", func(s *server, r *modeRequest) (*empty, error) {
+			return nil, s.fs.Chmod(r.Name, os.FileMode(r.Mode))
+		}),
+		unary("Chtimes", func(s *server, r *timesRequest) (*empty, error) {
+			return nil, s.fs.Chtimes(r.Name, r.Atime, r.Mtime)
+		}),
+		unary("Chown", func(s *server, r *ownerRequest) (*empty, error) {
+			return nil, s.fs.Chown(r.Name, r.UID, r.GID)
+		}),
+		unary("Lchown", func(s *server, r *ownerRequest) (*empty, error) {
+			return nil, s.fs.Lchown(r.Name, r.UID, r.GID)
+		}),
+		unary("Truncate", func(s *server, r *sizeRequest) (*empty, error) {
+			return nil, s.fs.Truncate(r.Name, r.Size)
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Read", Handler: readHandler, ServerStreams: true},
+		{StreamName: "Write", Handler: writeHandler, ClientStreams: true},
+	},
+}
+
+// unary returns the description of the unary method `name` implemented by
+// `fn`. A nil response is sent as an empty message.
+func unary[Req, Resp any](name string, fn func(*server, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			h := func(ctx context.Context, req any) (any, error) {
+				resp, err := fn(srv.(*server), req.(*Req))
+				if err != nil {
+					return nil, toStatus(err)
+				}
+				if resp == nil {
+					return &empty{}, nil
+				}
+				return resp, nil
+			}
+			if interceptor == nil {
+				return h(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			return interceptor(ctx, req, info, h)
+		},
+	}
+}
+
+func readHandler(srv any, stream grpc.ServerStream) error {
+	s := srv.(*server)
+	r := new(readRequest)
+	if err := stream.RecvMsg(r); err != nil {
+		return err
+	}
+	f, err := s.fs.Open(r.Name)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer f.Close()
+
+	var in io.Reader = io.NewSectionReader(f, r.Offset, 1<<63-1-r.Offset)
+	if r.Length >= 0 {
+		in = io.LimitReader(in, r.Length)
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			if err := stream.SendMsg(&chunk{buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+}
+
+func writeHandler(srv any, stream grpc.ServerStream) error {
+	s := srv.(*server)
+	r := new(writeRequest)
+	if err := stream.RecvMsg(r); err != nil {
+		return err
+	}
+	flags := fromWire(r.Flags)
+	f, err := s.fs.OpenFile(r.Name, flags, 0)
+	if err != nil {
+		return toStatus(err)
+	}
+	if flags&os.O_APPEND == 0 {
+		_, err = f.Seek(r.Offset, io.SeekStart)
+	}
+
+	var n int64
+	for err == nil {
+		var wrote int
+		wrote, err = f.Write(r.Data)
+		n += int64(wrote)
+		if err != nil {
+			break
+		}
+		r.Data = nil
+		err = stream.RecvMsg(r)
+		if err == io.EOF {
+			err = nil
+			break
+		}
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return toStatus(err)
+	}
+	return stream.SendMsg(&writeResponse{n})
+}
+
+// toStatus converts a filesystem error into a gRPC status error.
+func toStatus(err error) error {
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		code = codes.NotFound
+	case errors.Is(err, os.ErrExist):
+		code = codes.AlreadyExists
+	case errors.Is(err, os.ErrPermission):
+		code = codes.PermissionDenied
+	case errors.Is(err, os.ErrInvalid):
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
+
+// fromStatus converts a gRPC status error returned for the operation `op` on
+// `name` into a filesystem error.
+func fromStatus(op, name string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	var e error
+	switch st.Code() {
+	case codes.NotFound:
+		e = os.ErrNotExist
+	case codes.AlreadyExists:
+		e = os.ErrExist
+	case codes.PermissionDenied:
+		e = os.ErrPermission
+	case codes.InvalidArgument:
+		e = os.ErrInvalid
+	default:
+		e = errors.New(st.Message())
+	}
+	return &os.PathError{Op: op, Path: name, Err: e}
+}
@@ -0,0 +1,100 @@
+package basefs
+
+import (
+	"os"
+	"strings"
+)
+
+// WithStableHandles keeps open files associated with their current names.
+// Files renamed through the filesystem, directly or by renaming a directory
+// above them, report their new names from Name and File.Path, and are
+// finalized under them on Close, e.g. for the journal and integrity index.
+// File.Path also notices renames made outside of basefs on Linux, if the
+// files of the underlying filesystem expose their descriptors through
+// syscall.Conn. Reads and writes are not affected by renames either way, as
+// they go to the open file.
+func WithStableHandles() Option {
+	return func(o *options) error {
+		o.stableHandles = true
+		return nil
+	}
+}
+
+// moved updates the open files at or below the virtual path `name` after it
+// was renamed to `target`, relative to the base directory `base`.
+func (o *openFiles) moved(base, name, target string) {
+	oldpath, _ := join(base, name)
+	newpath, _ := join(base, target)
+	for _, f := range o.list() {
+		f.mu.Lock()
+		if rest, ok := trimDir(oldpath, f.ppath); ok {
+			f.ppath = newpath + rest
+			f.name = vpath(f.prefix, f.ppath)
+			if cf, ok := f.f.(*casFile); ok && cf.cs != nil {
+				cf.ppath = f.ppath
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// exchanged updates the paths of the open files after the virtual paths
+// `name` and `target` were exchanged.
+func (o *openFiles) exchanged(base, name, target string) {
+	apath, _ := join(base, name)
+	bpath, _ := join(base, target)
+	for _, f := range o.list() {
+		f.mu.Lock()
+		if rest, ok := trimDir(apath, f.ppath); ok {
+			f.ppath = bpath + rest
+		} else if rest, ok := trimDir(bpath, f.ppath); ok {
+			f.ppath = apath + rest
+		} else {
+			f.mu.Unlock()
+			continue
+		}
+		f.name = vpath(f.prefix, f.ppath)
+		if cf, ok := f.f.(*casFile); ok && cf.cs != nil {
+			cf.ppath = f.ppath
+		}
+		f.mu.Unlock()
+	}
+}
+
+// trimDir returns the remainder of `p` if it is `dir` or inside it.
+func trimDir(dir, p string) (string, bool) {
+	if p == dir {
+		return "", true
+	}
+	if dir == "/" {
+		return p, true
+	}
+	if strings.HasPrefix(p, dir+"/") {
+		return p[len(dir):], true
+	}
+	return "", false
+}
+
+// Path returns the current virtual path of the file. Without
+// WithStableHandles it is the name the file was opened with. It fails with
+// ErrNotExist if the file was removed, or moved out of the base, while it
+// was open, as far as this can be detected.
+func (f *File) Path() (string, error) {
+	ppath, name := f.location()
+	if !f.opts.stableHandles {
+		return name, nil
+	}
+	current, ok := hostPath(f.f)
+	if !ok || current == ppath {
+		return name, nil
+	}
+	if strings.HasSuffix(current, " (deleted)") || !within(f.prefix, current) {
+		return "", &os.PathError{Op: "path", Path: name, Err: os.ErrNotExist}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ppath = current
+	f.name = vpath(f.prefix, current)
+	return f.name, nil
+}
@@ -0,0 +1,30 @@
+package basefs
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// hostPath returns the current path of the open file `f` on the host, if it
+// exposes its file descriptor.
+func hostPath(f absfs.File) (string, bool) {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return "", false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return "", false
+	}
+	var p string
+	cerr := rc.Control(func(fd uintptr) {
+		p, err = os.Readlink("/proc/self/fd/" + strconv.FormatUint(uint64(fd), 10))
+	})
+	if cerr != nil || err != nil {
+		return "", false
+	}
+	return p, true
+}
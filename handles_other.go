@@ -0,0 +1,10 @@
+//go:build !linux
+
+package basefs
+
+import "github.com/absfs/absfs"
+
+// hostPath can't find the current path of open files on this platform.
+func hostPath(f absfs.File) (string, bool) {
+	return "", false
+}
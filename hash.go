@@ -0,0 +1,96 @@
+package basefs
+
+import (
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// Hash returns the digest of the contents of the named file computed with a
+// hash created by `h`, e.g. sha256.New.
+func (f *FileSystem) Hash(name string, h func() hash.Hash) ([]byte, error) {
+	return hashFile(f.outer(), name, h)
+}
+
+// HashAll returns the digests of all regular files below `root` keyed by their
+// virtual paths. Files are hashed in parallel by GOMAXPROCS workers.
+func (f *FileSystem) HashAll(root string, h func() hash.Hash) (map[string][]byte, error) {
+	return hashAll(f.outer(), root, h)
+}
+
+// hashFile returns the digest of the contents of the file `name`.
+func hashFile(fs absfs.FileSystem, name string, newHash func() hash.Hash) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func hashAll(fs absfs.FileSystem, root string, h func() hash.Hash) (map[string][]byte, error) {
+	names := make(chan string)
+	done := make(chan struct{})
+	sums := make(map[string][]byte)
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			close(done)
+		}
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				sum, err := hashFile(fs, name, h)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				sums[name] = sum
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		select {
+		case names <- name:
+			return nil
+		case <-done:
+			return errStop
+		}
+	})
+	close(names)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
@@ -0,0 +1,58 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// hidden holds the patterns of virtual paths made invisible with Hide.
+type hidden struct {
+	mu       sync.RWMutex
+	patterns []string
+	n        atomic.Int32
+}
+
+// Hide makes virtual paths matching the glob `pattern`, in the syntax
+// understood by Watch's Include, and the files below them behave as if they
+// did not exist: every operation on them fails with ENOENT, including
+// creating them, and they are left out of directory listings and walks. It is
+// meant to mask internal files of a shared base, e.g. Hide("**/.git"). Unlike
+// WithDeny, patterns can be added while the filesystem is in use, and clones
+// keep the patterns hidden at the time they are made.
+func (f *FileSystem) Hide(pattern string) error {
+	if err := validPattern(pattern); err != nil {
+		return &os.PathError{Op: "hide", Path: pattern, Err: err}
+	}
+	f.opts.hidden.add(pattern)
+	return nil
+}
+
+func (h *hidden) add(patterns ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.patterns = append(h.patterns, patterns...)
+	h.n.Store(int32(len(h.patterns)))
+}
+
+// copy returns the patterns for a clone.
+func (h *hidden) copy() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]string(nil), h.patterns...)
+}
+
+// covers reports whether the virtual path `name` is hidden.
+func (h *hidden) covers(name string) bool {
+	if h.n.Load() == 0 {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return below(h.patterns, name)
+}
+
+// visible reports whether `ppath` on the underlying filesystem is not hidden.
+func (o *options) visible(ppath string) bool {
+	return !o.hidden.covers(vpath(o.base, ppath))
+}
@@ -0,0 +1,417 @@
+// Package httpapi exposes an absfs filesystem, typically a basefs, through a
+// REST/JSON API suitable for building file manager user interfaces.
+//
+// The handler serves the following endpoints, where {path} is a path in the
+// filesystem:
+//
+//	GET    /stat/{path}                 metadata of a file as JSON
+//	GET    /list/{path}?after=&limit=   a page of directory entries as JSON
+//	GET    /download/{path}             file contents, with Range support
+//	PUT    /upload/{path}               replace or create a file from the body
+//	POST   /mkdir/{path}                create a directory and its parents
+//	DELETE /delete/{path}?recursive=1   remove a file or directory
+//	POST   /move                        rename {"from", "to"}
+//
+// Every response includes an ETag for the file concerned. GET requests honor
+// If-None-Match and If-Modified-Since, PUT and DELETE requests honor If-Match
+// and If-None-Match ("*" to only create new files). Errors are returned as
+// {"error": message}.
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Option configures the handler returned by Handler.
+type Option func(*config)
+
+type config struct {
+	maxUpload int64
+	pageSize  int
+}
+
+// MaxUploadSize limits the size of uploaded files. By default uploads are not
+// limited.
+func MaxUploadSize(n int64) Option {
+	return func(c *config) {
+		c.maxUpload = n
+	}
+}
+
+// PageSize sets the default and maximum number of entries returned by a single
+// list request, 100 by default.
+func PageSize(n int) Option {
+	return func(c *config) {
+		c.pageSize = n
+	}
+}
+
+// Entry is the JSON representation of a file.
+type Entry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	IsDir   bool      `json:"dir"`
+	ETag    string    `json:"etag"`
+}
+
+// Page is the JSON representation of a list response. Next is the value of
+// the `after` parameter which returns the following page, it is empty on the
+// last page.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Next    string  `json:"next,omitempty"`
+}
+
+type api struct {
+	fs  absfs.FileSystem
+	cfg config
+}
+
+// Handler returns a handler serving the API for `fs`. Mount it below a
+// prefix with http.StripPrefix.
+func Handler(fs absfs.FileSystem, opts ...Option) http.Handler {
+	a := &api{fs: fs, cfg: config{pageSize: 100}}
+	for _, opt := range opts {
+		opt(&a.cfg)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stat/{path...}", a.stat)
+	mux.HandleFunc("GET /list/{path...}", a.list)
+	mux.HandleFunc("GET /download/{path...}", a.download)
+	mux.HandleFunc("PUT /upload/{path...}", a.upload)
+	mux.HandleFunc("POST /mkdir/{path...}", a.mkdir)
+	mux.HandleFunc("DELETE /delete/{path...}", a.remove)
+	mux.HandleFunc("POST /move", a.move)
+	return mux
+}
+
+func name(r *http.Request) string {
+	return path.Clean("/" + r.PathValue("path"))
+}
+
+func etag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+func entry(p string, info os.FileInfo) Entry {
+	return Entry{
+		Name:    info.Name(),
+		Path:    p,
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+		ETag:    etag(info),
+	}
+}
+
+// notModified reports whether a GET request for the file described by `info`
+// can be answered with 304 Not Modified.
+func notModified(r *http.Request, info os.FileInfo) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag(info))
+	}
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !info.ModTime().Truncate(time.Second).After(ims)
+	}
+	return false
+}
+
+// precondition checks the If-Match and If-None-Match headers of a modifying
+// request against the current state of the file, `info` is nil if it does not
+// exist.
+func precondition(r *http.Request, info os.FileInfo) bool {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if info == nil || !matchETag(im, etag(info)) {
+			return false
+		}
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if info != nil && matchETag(inm, etag(info)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchETag(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *api) stat(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	info, err := a.fs.Stat(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if notModified(r, info) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag(info))
+	writeJSON(w, http.StatusOK, entry(p, info))
+}
+
+func (a *api) list(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	limit := a.cfg.pageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeError(w, os.ErrInvalid)
+			return
+		}
+		limit = min(n, a.cfg.pageSize)
+	}
+	info, err := a.fs.Stat(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !info.IsDir() {
+		writeError(w, &os.PathError{Op: "list", Path: p, Err: errNotDir})
+		return
+	}
+	if notModified(r, info) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	f, err := a.fs.Open(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	after := r.URL.Query().Get("after")
+	i := sort.Search(len(infos), func(i int) bool {
+		return infos[i].Name() > after
+	})
+
+	page := Page{Entries: []Entry{}}
+	for ; i < len(infos) && len(page.Entries) < limit; i++ {
+		page.Entries = append(page.Entries, entry(path.Join(p, infos[i].Name()), infos[i]))
+	}
+	if i < len(infos) {
+		page.Next = infos[i-1].Name()
+	}
+	w.Header().Set("ETag", etag(info))
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (a *api) download(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	f, err := a.fs.Open(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if info.IsDir() {
+		writeError(w, &os.PathError{Op: "download", Path: p, Err: errIsDir})
+		return
+	}
+	w.Header().Set("ETag", etag(info))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (a *api) upload(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	info, err := a.fs.Stat(p)
+	if err != nil && !os.IsNotExist(err) {
+		writeError(w, err)
+		return
+	}
+	if !precondition(r, info) {
+		writeJSON(w, http.StatusPreconditionFailed, errorBody{"precondition failed"})
+		return
+	}
+	perm := os.FileMode(0644)
+	if info != nil {
+		if info.IsDir() {
+			writeError(w, &os.PathError{Op: "upload", Path: p, Err: errIsDir})
+			return
+		}
+		perm = info.Mode().Perm()
+	}
+
+	body := io.Reader(r.Body)
+	if a.cfg.maxUpload > 0 {
+		body = http.MaxBytesReader(w, r.Body, a.cfg.maxUpload)
+	}
+	// Write a temporary file next to the target and rename it into place, so
+	// readers never see a partial upload.
+	var rnd [8]byte
+	rand.Read(rnd[:])
+	tmp := path.Join(path.Dir(p), ".upload-"+hex.EncodeToString(rnd[:]))
+	f, err := a.fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	_, err = io.Copy(f, body)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = a.fs.Rename(tmp, p)
+	}
+	if err != nil {
+		a.fs.Remove(tmp)
+		writeError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if info == nil {
+		status = http.StatusCreated
+	}
+	a.respond(w, status, p)
+}
+
+func (a *api) mkdir(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	if err := a.fs.MkdirAll(p, 0755); err != nil {
+		writeError(w, err)
+		return
+	}
+	a.respond(w, http.StatusCreated, p)
+}
+
+func (a *api) remove(w http.ResponseWriter, r *http.Request) {
+	p := name(r)
+	if p == "/" {
+		writeError(w, &os.PathError{Op: "delete", Path: p, Err: os.ErrPermission})
+		return
+	}
+	info, err := a.lstat(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !precondition(r, info) {
+		writeJSON(w, http.StatusPreconditionFailed, errorBody{"precondition failed"})
+		return
+	}
+	if recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive")); recursive {
+		err = a.fs.RemoveAll(p)
+	} else {
+		err = a.fs.Remove(p)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) move(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+		writeError(w, os.ErrInvalid)
+		return
+	}
+	from, to := path.Clean("/"+req.From), path.Clean("/"+req.To)
+	if _, err := a.lstat(to); err == nil {
+		writeError(w, &os.PathError{Op: "move", Path: to, Err: os.ErrExist})
+		return
+	}
+	if err := a.fs.Rename(from, to); err != nil {
+		writeError(w, err)
+		return
+	}
+	a.respond(w, http.StatusOK, to)
+}
+
+// lstat stats `p` without following a final symlink if the filesystem
+// supports symlinks.
+func (a *api) lstat(p string) (os.FileInfo, error) {
+	if sl, ok := a.fs.(absfs.SymLinker); ok {
+		return sl.Lstat(p)
+	}
+	return a.fs.Stat(p)
+}
+
+// respond writes the metadata of `p` as the response.
+func (a *api) respond(w http.ResponseWriter, status int, p string) {
+	info, err := a.fs.Stat(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(info))
+	writeJSON(w, status, entry(p, info))
+}
+
+var (
+	errNotDir = errors.New("not a directory")
+	errIsDir  = errors.New("is a directory")
+)
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var maxErr *http.MaxBytesError
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case os.IsExist(err):
+		status = http.StatusConflict
+	case os.IsPermission(err):
+		status = http.StatusForbidden
+	case errors.As(err, &maxErr):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, os.ErrInvalid), errors.Is(err, errNotDir), errors.Is(err, errIsDir):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, errorBody{err.Error()})
+}
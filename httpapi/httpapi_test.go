@@ -0,0 +1,89 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/basefs/httpapi"
+	"github.com/absfs/osfs"
+)
+
+func TestHandler(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := httpapi.Handler(bfs, httpapi.PageSize(2), httpapi.MaxUploadSize(16))
+
+	do := func(method, target, body string, header ...string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+	expect := func(resp *http.Response, status int) string {
+		t.Helper()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != status {
+			t.Fatalf("got status %d, expected %d: %s", resp.StatusCode, status, data)
+		}
+		return string(data)
+	}
+
+	expect(do("POST", "/mkdir/docs", ""), http.StatusCreated)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		expect(do("PUT", "/upload/docs/"+name, "contents of "+name[:1]), http.StatusCreated)
+	}
+	expect(do("PUT", "/upload/docs/a.txt", "again", "If-None-Match", "*"), http.StatusPreconditionFailed)
+	expect(do("PUT", "/upload/docs/big.txt", strings.Repeat("x", 17)), http.StatusRequestEntityTooLarge)
+
+	resp := do("GET", "/stat/docs/a.txt", "")
+	etag := resp.Header.Get("ETag")
+	var e httpapi.Entry
+	json.Unmarshal([]byte(expect(resp, http.StatusOK)), &e)
+	if e.Path != "/docs/a.txt" || e.Size != 13 || e.ETag != etag {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	expect(do("GET", "/stat/docs/a.txt", "", "If-None-Match", etag), http.StatusNotModified)
+	if body := expect(do("GET", "/download/docs/a.txt", "", "Range", "bytes=0-7"), http.StatusPartialContent); body != "contents" {
+		t.Errorf("unexpected range body %q", body)
+	}
+
+	var page httpapi.Page
+	json.Unmarshal([]byte(expect(do("GET", "/list/docs?limit=5", ""), http.StatusOK)), &page)
+	if len(page.Entries) != 2 || page.Next != "b.txt" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	next := page.Next
+	page = httpapi.Page{}
+	json.Unmarshal([]byte(expect(do("GET", "/list/docs?after="+next, ""), http.StatusOK)), &page)
+	if len(page.Entries) != 1 || page.Entries[0].Name != "c.txt" || page.Next != "" {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	expect(do("POST", "/move", `{"from": "/docs/a.txt", "to": "/docs/b.txt"}`), http.StatusConflict)
+	expect(do("POST", "/move", `{"from": "/docs/a.txt", "to": "/moved.txt"}`), http.StatusOK)
+	expect(do("DELETE", "/delete/moved.txt", "", "If-Match", `"stale"`), http.StatusPreconditionFailed)
+	expect(do("DELETE", "/delete/moved.txt", "", "If-Match", etag), http.StatusNoContent)
+	expect(do("GET", "/stat/moved.txt", ""), http.StatusNotFound)
+	expect(do("DELETE", "/delete/docs?recursive=1", ""), http.StatusNoContent)
+	expect(do("GET", "/stat/..%2F..%2Fetc%2Fpasswd", ""), http.StatusNotFound)
+}
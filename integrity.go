@@ -0,0 +1,262 @@
+package basefs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrIntegrity is returned, wrapped in an *os.PathError, when opening a file
+// whose contents no longer match the hash recorded when it was written.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// WithIntegrity records a hash of every file written through basefs in the
+// index file `index`, an absolute path on the underlying filesystem, and
+// verifies it whenever the file is opened without truncating it. If `key` is
+// not nil the hash is an HMAC-SHA256 using `key`, otherwise a plain SHA-256.
+// Files without a recorded hash are not verified. Changes are appended to a
+// log next to the index, "<index>.log", which is merged into the index once it
+// has grown as large as the index, and closing a file fails if its hash can't
+// be recorded.
+func WithIntegrity(index string, key []byte) Option {
+	return func(o *options) error {
+		if !path.IsAbs(index) {
+			return &os.PathError{Op: "integrity", Path: index, Err: errors.New("not an absolute path")}
+		}
+		o.integrity = &integrityIndex{path: path.Clean(index), key: key}
+		return nil
+	}
+}
+
+// integrityIndex maps virtual paths to the hex encoded hashes of the files,
+// for WithIntegrity and WithChecksums.
+type integrityIndex struct {
+	mu     sync.Mutex
+	fs     absfs.FileSystem
+	prefix string
+	path   string
+	key    []byte
+	hash   func() hash.Hash
+	sums   map[string]string
+
+	// number of changes in the log which are not merged into the index yet
+	logged int
+}
+
+// indexChange is a line of the log of an integrityIndex, recording the hash
+// of a path or, if Sum is empty, its removal.
+type indexChange struct {
+	Path string `json:"path"`
+	Sum  string `json:"sum,omitempty"`
+}
+
+// minIndexLog is the number of changes the log of an index may hold before
+// it is merged into the index, however small the index is.
+const minIndexLog = 1024
+
+// load reads the index and its log from the underlying filesystem `fs`, a
+// missing index is treated as empty.
+func (ix *integrityIndex) load(fs absfs.FileSystem, prefix string) error {
+	ix.fs, ix.prefix = fs, prefix
+	ix.sums = make(map[string]string)
+	f, err := fs.Open(ix.path)
+	if os.IsNotExist(err) {
+		return ix.replay()
+	}
+	if err != nil {
+		return err
+	}
+	err = json.NewDecoder(f).Decode(&ix.sums)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return ix.replay()
+}
+
+// replay applies the changes in the log to the index. A line which is cut
+// short, by a crash while it was appended, ends the log.
+func (ix *integrityIndex) replay() error {
+	f, err := ix.fs.Open(ix.path + ".log")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var c indexChange
+		if json.Unmarshal(scanner.Bytes(), &c) != nil {
+			break
+		}
+		ix.apply(c)
+		ix.logged++
+	}
+	return scanner.Err()
+}
+
+// apply makes the change `c` to the index in memory.
+func (ix *integrityIndex) apply(c indexChange) {
+	if c.Sum == "" {
+		delete(ix.sums, c.Path)
+	} else {
+		ix.sums[c.Path] = c.Sum
+	}
+}
+
+// append makes the `changes` and appends them to the log, or merges the log
+// into the index once it holds as many changes as the index has entries. It
+// must be called with ix.mu held.
+func (ix *integrityIndex) append(changes ...indexChange) error {
+	for _, c := range changes {
+		ix.apply(c)
+	}
+	ix.logged += len(changes)
+	if ix.logged >= max(len(ix.sums), minIndexLog) {
+		return ix.save()
+	}
+	f, err := ix.fs.OpenFile(ix.path+".log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, c := range changes {
+		enc.Encode(c)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// save writes the index next to its final location, renames it into place
+// and removes the log merged into it. It must be called with ix.mu held.
+func (ix *integrityIndex) save() error {
+	tmp := ix.path + ".tmp"
+	f, err := ix.fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(ix.sums)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err := ix.fs.Rename(tmp, ix.path); err != nil {
+		return err
+	}
+	ix.logged = 0
+	if err := ix.fs.Remove(ix.path + ".log"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (ix *integrityIndex) newHash() hash.Hash {
+	if ix.key != nil {
+		return hmac.New(sha256.New, ix.key)
+	}
+	if ix.hash != nil {
+		return ix.hash()
+	}
+	return sha256.New()
+}
+
+func (ix *integrityIndex) sum(r io.Reader) (string, error) {
+	h := ix.newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// seal records the hash of the file at `ppath`, which is computed from its
+// contents unless it is passed as `digest`.
+func (ix *integrityIndex) seal(o *options, fs absfs.FileSystem, ppath string, digest []byte) error {
+	sum := hex.EncodeToString(digest)
+	if digest == nil {
+		f, err := o.open(fs, ppath, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		sum, err = ix.sum(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.append(indexChange{vpath(ix.prefix, ppath), sum})
+}
+
+// update keeps the index in line with removed, renamed and exchanged paths.
+func (ix *integrityIndex) update(op, name, target string) {
+	if op != "remove" && op != "removeall" && op != "rename" && op != "exchange" {
+		return
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var removed, moved []indexChange
+	for p, sum := range ix.sums {
+		if rest, ok := trimDir(name, p); ok {
+			removed = append(removed, indexChange{Path: p})
+			if op == "rename" || op == "exchange" {
+				moved = append(moved, indexChange{target + rest, sum})
+			}
+		} else if rest, ok := trimDir(target, p); ok && op == "exchange" {
+			removed = append(removed, indexChange{Path: p})
+			moved = append(moved, indexChange{name + rest, sum})
+		}
+	}
+	if len(removed) > 0 {
+		ix.append(append(removed, moved...)...)
+	}
+}
+
+// verify checks the contents of `f`, opened at `ppath`, against the index.
+func (ix *integrityIndex) verify(ppath string, f absfs.File) error {
+	name := vpath(ix.prefix, ppath)
+	ix.mu.Lock()
+	expected, ok := ix.sums[name]
+	ix.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	sum, err := ix.sum(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(sum), []byte(expected)) {
+		return &os.PathError{Op: "open", Path: name, Err: ErrIntegrity}
+	}
+	return nil
+}
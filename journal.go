@@ -0,0 +1,182 @@
+package basefs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// JournalRecord describes a single successful mutation. Paths are virtual.
+// Size and Hash (hex encoded SHA-256) are only set for operations that
+// changed the contents of a regular file.
+type JournalRecord struct {
+	Seq    uint64    `json:"seq"`
+	Op     string    `json:"op"`
+	Path   string    `json:"path"`
+	Target string    `json:"target,omitempty"`
+	Size   int64     `json:"size,omitempty"`
+	Hash   string    `json:"hash,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// JournalRetention is the number of records a Journal keeps in memory unless
+// SetRetention is called.
+const JournalRetention = 4096
+
+// Journal is an append only log of the mutations made through a filesystem
+// configured `WithJournal`. Records are numbered sequentially, the most recent
+// ones are kept in memory until trimmed and, if the journal has a writer,
+// appended to it as lines of JSON which can be read back with ReadJournal.
+type Journal struct {
+	mu      sync.Mutex
+	w       io.Writer
+	err     error
+	fn      func(JournalRecord)
+	seq     uint64
+	retain  int
+	records []JournalRecord
+}
+
+// NewJournal returns a Journal writing its records to `w`, which may be nil.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w, retain: JournalRetention}
+}
+
+// SetRetention limits the records kept in memory, for Since, to the `n` most
+// recent ones, discarding older records as new ones are appended. With zero,
+// records are only written and passed to OnRecord.
+func (j *Journal) SetRetention(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	j.retain = n
+	j.discard()
+}
+
+// Err returns the first error writing a record. Records are no longer written
+// after an error, but still numbered, kept and passed to OnRecord.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// OnRecord registers `fn` to be called with every record appended to the
+// journal.
+func (j *Journal) OnRecord(fn func(JournalRecord)) {
+	j.mu.Lock()
+	j.fn = fn
+	j.mu.Unlock()
+}
+
+// Seq returns the sequence number of the most recent record.
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// SetSeq sets the sequence number of the most recent record, allowing a
+// journal to continue the numbering of a previous log.
+func (j *Journal) SetSeq(seq uint64) {
+	j.mu.Lock()
+	j.seq = seq
+	j.mu.Unlock()
+}
+
+// Since returns the records held in memory with a sequence number greater than
+// `seq`. Records which were discarded, see SetRetention, are missing.
+func (j *Journal) Since(seq uint64) []JournalRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := sort.Search(len(j.records), func(i int) bool {
+		return j.records[i].Seq > seq
+	})
+	return append([]JournalRecord(nil), j.records[i:]...)
+}
+
+// Trim discards the records held in memory with a sequence number less than or
+// equal to `seq`.
+func (j *Journal) Trim(seq uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := sort.Search(len(j.records), func(i int) bool {
+		return j.records[i].Seq > seq
+	})
+	j.records = append(j.records[:0:0], j.records[i:]...)
+}
+
+func (j *Journal) append(r JournalRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq++
+	r.Seq = j.seq
+	r.Time = time.Now()
+	j.records = append(j.records, r)
+	j.discard()
+	if j.w != nil && j.err == nil {
+		data, err := json.Marshal(r)
+		if err == nil {
+			_, err = j.w.Write(append(data, '\n'))
+		}
+		j.err = err
+	}
+	if j.fn != nil {
+		j.fn(r)
+	}
+}
+
+// discard drops the oldest records beyond the retention.
+func (j *Journal) discard() {
+	if n := len(j.records) - j.retain; n > 0 {
+		clear(j.records[:n])
+		j.records = j.records[n:]
+	}
+}
+
+// ReadJournal reads the records written by a Journal from `r` and returns
+// those with a sequence number greater than `since`.
+func ReadJournal(r io.Reader, since uint64) ([]JournalRecord, error) {
+	var records []JournalRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return records, err
+		}
+		if rec.Seq > since {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// appendContent appends a record including the size and hash of the file
+// at `ppath` on the underlying filesystem `fs`.
+func (j *Journal) appendContent(o *options, fs absfs.FileSystem, op, ppath, name string) {
+	r := JournalRecord{Op: op, Path: name}
+	f, err := o.open(fs, ppath, os.O_RDONLY, 0)
+	if err == nil {
+		h := sha256.New()
+		r.Size, err = io.Copy(h, f)
+		f.Close()
+		if err == nil {
+			r.Hash = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	j.append(r)
+}
@@ -0,0 +1,346 @@
+package basefs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestJournal(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	j := basefs.NewJournal(buf)
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithJournal(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bfs.Mkdir("/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	f, err = bfs.Open("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	err = bfs.Rename("/dir/file.txt", "/dir/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bfs.Remove("/missing"); err == nil {
+		t.Fatal("expected an error removing a missing file")
+	}
+
+	tests := []basefs.JournalRecord{
+		{Seq: 1, Op: "mkdir", Path: "/dir"},
+		{Seq: 2, Op: "write", Path: "/dir/file.txt", Size: 5, Hash: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{Seq: 3, Op: "rename", Path: "/dir/file.txt", Target: "/dir/moved.txt"},
+	}
+
+	check := func(records []basefs.JournalRecord) {
+		t.Helper()
+		if len(records) != len(tests) {
+			t.Fatalf("got %d records, expected %d: %+v", len(records), len(tests), records)
+		}
+		for i, test := range tests {
+			r := records[i]
+			r.Time = test.Time
+			if r != test {
+				t.Errorf("%d: got %+v, expected %+v", i, r, test)
+			}
+		}
+	}
+
+	check(j.Since(0))
+	records, err := basefs.ReadJournal(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(records)
+
+	if records := j.Since(2); len(records) != 1 || records[0].Seq != 3 {
+		t.Errorf("unexpected records since 2: %+v", records)
+	}
+	j.Trim(2)
+	if records := j.Since(0); len(records) != 1 || records[0].Seq != 3 {
+		t.Errorf("unexpected records after trim: %+v", records)
+	}
+}
+
+// failingWriter fails every write after the first `n` bytes.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestJournalRetention(t *testing.T) {
+	bfs := newTestFS(t, nil)
+	j := basefs.NewJournal(&failingWriter{n: 100})
+	jfs, err := bfs.Clone(basefs.WithJournal(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.SetRetention(2)
+	for _, name := range []string{"/a", "/b", "/c"} {
+		if err := jfs.Mkdir(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records := j.Since(0); len(records) != 2 || records[0].Seq != 2 || records[1].Seq != 3 {
+		t.Errorf("expected the two most recent records, got %+v", records)
+	}
+	if err := j.Err(); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the write error, got %v", err)
+	}
+
+	j.SetRetention(0)
+	if err := jfs.Mkdir("/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if records := j.Since(0); len(records) != 0 || j.Seq() != 4 {
+		t.Errorf("expected no records to be kept, got %+v", records)
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	err = os.Mkdir(dir+"/base", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bfs, err := basefs.NewFS(ofs, dir+"/base", basefs.WithIntegrity(dir+"/index.json", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("trusted")
+	f.Close()
+	err = bfs.Rename("/file.txt", "/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = bfs.Open("/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// tamper with the file behind basefs' back, and reload the index
+	err = os.WriteFile(dir+"/base/moved.txt", []byte("tampered"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err = basefs.NewFS(ofs, dir+"/base", basefs.WithIntegrity(dir+"/index.json", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bfs.Open("/moved.txt")
+	if !errors.Is(err, basefs.ErrIntegrity) {
+		t.Fatalf("expected an integrity error, got %v", err)
+	}
+}
+
+func TestIntegrityLog(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	if err := os.Mkdir(dir+"/base", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bfs, err := basefs.NewFS(ofs, dir+"/base", basefs.WithIntegrity(dir+"/index.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a.txt", "/b.txt"} {
+		if err := bfs.WriteFile(name, []byte("trusted"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bfs.Remove("/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "/index.json"); !os.IsNotExist(err) {
+		t.Errorf("expected the changes to be logged instead of rewriting the index, got %v", err)
+	}
+	data, err := os.ReadFile(dir + "/index.json.log")
+	if err != nil || bytes.Count(data, []byte("\n")) != 3 {
+		t.Errorf("expected three logged changes, got %q %v", data, err)
+	}
+
+	if err := os.WriteFile(dir+"/base/a.txt", []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bfs, err = basefs.NewFS(ofs, dir+"/base", basefs.WithIntegrity(dir+"/index.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Open("/a.txt"); !errors.Is(err, basefs.ErrIntegrity) {
+		t.Errorf("expected the logged hash to be verified, got %v", err)
+	}
+
+	// the hash of a file which can't be recorded fails Close
+	bfs, err = basefs.NewFS(ofs, dir+"/base", basefs.WithIntegrity(dir+"/missing/index.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := bfs.Create("/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("unrecorded")
+	if err := f.Close(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the failure to record the hash, got %v", err)
+	}
+}
+
+func TestScanner(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	err = os.Mkdir(dir+"/base", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errInfected := errors.New("infected")
+	scanner := func(name string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte("EICAR")) {
+			return errInfected
+		}
+		return nil
+	}
+	bfs, err := basefs.NewFileSystem(ofs, dir+"/base", basefs.WithScanner(scanner), basefs.WithQuarantine(dir+"/quarantine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"/clean.txt": "clean", "/virus.txt": "xEICARx"} {
+		f, err := bfs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(data)
+		err = f.Close()
+		if name == "/clean.txt" && err != nil {
+			t.Fatal(err)
+		}
+		if name == "/virus.txt" && !errors.Is(err, errInfected) {
+			t.Fatalf("expected the file to be rejected, got %v", err)
+		}
+	}
+
+	if _, err := bfs.Stat("/clean.txt"); err != nil {
+		t.Error(err)
+	}
+	if _, err := bfs.Stat("/virus.txt"); !os.IsNotExist(err) {
+		t.Errorf("rejected file still exists: %v", err)
+	}
+	entries, err := os.ReadDir(dir + "/quarantine")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected one quarantined file, got %d %v", len(entries), err)
+	}
+}
+
+func TestDeniedContentTypes(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithDeniedContentTypes("text/html", "application/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name   string
+		Data   string
+		Type   string
+		Denied bool
+	}{
+		{"/notes.txt", "just some text", "text/plain; charset=utf-8", false},
+		{"/page.txt", "<html><body>hi</body></html>", "text/html; charset=utf-8", true},
+		{"/archive.bin", "PK\x03\x04 zipped", "application/zip", true},
+	}
+	for _, test := range tests {
+		f, err := bfs.Create(test.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(test.Data)
+		err = f.Close()
+		if test.Denied != errors.Is(err, basefs.ErrDeniedContentType) {
+			t.Errorf("%s: unexpected error %v", test.Name, err)
+		}
+		if test.Denied {
+			continue
+		}
+		ctype, err := bfs.DetectContentType(test.Name)
+		if err != nil || ctype != test.Type {
+			t.Errorf("%s: got %q %v, expected %q", test.Name, ctype, err, test.Type)
+		}
+	}
+}
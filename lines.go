@@ -0,0 +1,44 @@
+package basefs
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ForEachLine calls `fn` with each line of the named file, without its line
+// ending, reading the file as it goes rather than loading it at once. Lines
+// end with "\n" or "\r\n" and may be of any length, unlike with the default
+// buffer of bufio.Scanner. A final line without a line ending is included.
+// It stops at the first error, including one returned by `fn`, and returns
+// it.
+func (f *FileSystem) ForEachLine(name string, fn func(line string) error) error {
+	file, err := f.outer().Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return eachLine(file, fn)
+}
+
+// eachLine calls `fn` with the lines read from `r`.
+func eachLine(r io.Reader, fn func(line string) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			return nil
+		}
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if err := fn(line); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
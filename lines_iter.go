@@ -0,0 +1,28 @@
+//go:build go1.23
+
+package basefs
+
+import (
+	"errors"
+	"iter"
+)
+
+// errBreak ends ForEachLine when the loop over ReadLines is left early.
+var errBreak = errors.New("break")
+
+// ReadLines returns an iterator over the lines of the named file, read as
+// the loop proceeds, as described for ForEachLine. An error opening or
+// reading the file is yielded with an empty line, as the last element.
+func (f *FileSystem) ReadLines(name string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		err := f.ForEachLine(name, func(line string) error {
+			if !yield(line, nil) {
+				return errBreak
+			}
+			return nil
+		})
+		if err != nil && err != errBreak {
+			yield("", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build go1.23
+
+package basefs_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	bfs := newTestFS(t, map[string]string{"/file.txt": "one\r\n\n" + long + "\nlast"})
+
+	var lines []string
+	for line, err := range bfs.ReadLines("/file.txt") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 4 || lines[0] != "one" || lines[1] != "" || lines[2] != long || lines[3] != "last" {
+		t.Errorf("read %d lines: %.20q", len(lines), lines)
+	}
+
+	n := 0
+	for range bfs.ReadLines("/file.txt") {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("loop ran %d times after break", n)
+	}
+	for _, err := range bfs.ReadLines("/missing") {
+		if !os.IsNotExist(err) {
+			t.Errorf("expected a not exist error, got %v", err)
+		}
+	}
+
+	stop := errors.New("stop")
+	n = 0
+	err := bfs.ForEachLine("/file.txt", func(line string) error {
+		n++
+		if n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 2 {
+		t.Errorf("ForEachLine returned %v after %d lines", err, n)
+	}
+}
@@ -0,0 +1,288 @@
+package basefs
+
+import (
+	"bufio"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// manifestHeader starts every manifest and is followed by the name of the hash
+// algorithm.
+const manifestHeader = "# basefs manifest v1 "
+
+// GenerateManifest writes a manifest of the subtree at `root` to `w`. See
+// the package level GenerateManifest function for the format.
+func (f *FileSystem) GenerateManifest(w io.Writer, root string, algo crypto.Hash) error {
+	return GenerateManifest(f.outer(), w, root, algo)
+}
+
+// GenerateManifest writes a manifest of the subtree at `root` on `fs` to `w`.
+// The manifest is a header line naming the hash algorithm followed by one line
+// per entry below `root` in lexical order:
+//
+//	<hex hash> <octal mode> <size> <quoted path relative to root>
+//
+// Directories have a hash of "-" and a size of 0. Symbolic links are not
+// followed: they have a hash of "@", the length of their target as size, and
+// the quoted target after the path:
+//
+//	@ <octal mode> <size> <quoted path relative to root> <quoted target>
+//
+// Entries are written as they are visited so memory use does not grow with
+// the size of the tree. The hash implementation for `algo` must be linked into
+// the binary.
+func GenerateManifest(fs absfs.FileSystem, w io.Writer, root string, algo crypto.Hash) error {
+	if !algo.Available() {
+		return fmt.Errorf("hash algorithm %s unavailable", algo)
+	}
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString(manifestHeader + algo.String() + "\n")
+	if err != nil {
+		return err
+	}
+
+	root = path.Clean(root)
+	err = walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+		rel := strconv.Quote(relpath(root, name))
+		sum := "-"
+		size := int64(0)
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := readlink(fs, name)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(bw, "@ %o %d %s %s\n", uint32(info.Mode()), len(target), rel, strconv.Quote(target))
+			return err
+		case !info.IsDir():
+			digest, err := hashFile(fs, name, algo.New)
+			if err != nil {
+				return err
+			}
+			sum = hex.EncodeToString(digest)
+			size = info.Size()
+		}
+		_, err = fmt.Fprintf(bw, "%s %o %d %s\n", sum, uint32(info.Mode()), size, rel)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readlink returns the target of the symbolic link `name` on `fs`.
+func readlink(fs absfs.FileSystem, name string) (string, error) {
+	sfs, ok := fs.(absfs.SymlinkFileSystem)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	return sfs.Readlink(name)
+}
+
+// relpath returns `name` relative to its ancestor `root`.
+func relpath(root, name string) string {
+	if root == "/" {
+		return name[1:]
+	}
+	return name[len(root)+1:]
+}
+
+// MismatchKind describes how an entry differs from its manifest.
+type MismatchKind int
+
+const (
+	Missing MismatchKind = iota + 1
+	Extra
+	HashDiffers
+	ModeDiffers
+)
+
+func (k MismatchKind) String() string {
+	switch k {
+	case Missing:
+		return "missing"
+	case Extra:
+		return "extra"
+	case HashDiffers:
+		return "hash differs"
+	case ModeDiffers:
+		return "mode differs"
+	}
+	return "unknown"
+}
+
+// Mismatch is a difference between a tree and its manifest. Path is the
+// virtual path of the entry.
+type Mismatch struct {
+	Path string
+	Kind MismatchKind
+}
+
+func (m Mismatch) String() string {
+	return m.Path + ": " + m.Kind.String()
+}
+
+type manifestEntry struct {
+	hash   string
+	mode   os.FileMode
+	size   int64
+	target string
+}
+
+// VerifyManifest compares the subtree at `root` with a manifest written by
+// GenerateManifest and returns the mismatches found. An entry whose contents
+// changed is reported as HashDiffers, even if only its size differs.
+func (f *FileSystem) VerifyManifest(root string, manifest io.Reader) ([]Mismatch, error) {
+	return VerifyManifest(f.outer(), root, manifest)
+}
+
+// VerifyManifest compares the subtree at `root` on `fs` with a manifest
+// written by GenerateManifest and returns the mismatches found in lexical
+// order of the tree, followed by missing entries.
+func VerifyManifest(fs absfs.FileSystem, root string, manifest io.Reader) ([]Mismatch, error) {
+	algo, entries, err := readManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	root = path.Clean(root)
+	var mismatches []Mismatch
+	err = walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+		rel := relpath(root, name)
+		entry, ok := entries[rel]
+		if !ok {
+			mismatches = append(mismatches, Mismatch{name, Extra})
+			return nil
+		}
+		delete(entries, rel)
+
+		if entry.mode != info.Mode() {
+			mismatches = append(mismatches, Mismatch{name, ModeDiffers})
+		}
+		link := info.Mode()&os.ModeSymlink != 0
+		if link || entry.hash == "@" {
+			if !link || entry.hash != "@" {
+				mismatches = append(mismatches, Mismatch{name, HashDiffers})
+				return nil
+			}
+			target, err := readlink(fs, name)
+			if err != nil {
+				return err
+			}
+			if target != entry.target {
+				mismatches = append(mismatches, Mismatch{name, HashDiffers})
+			}
+			return nil
+		}
+		if info.IsDir() || entry.hash == "-" {
+			if info.IsDir() != (entry.hash == "-") {
+				mismatches = append(mismatches, Mismatch{name, HashDiffers})
+			}
+			return nil
+		}
+		if entry.size != info.Size() {
+			mismatches = append(mismatches, Mismatch{name, HashDiffers})
+			return nil
+		}
+		digest, err := hashFile(fs, name, algo.New)
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(digest) != entry.hash {
+			mismatches = append(mismatches, Mismatch{name, HashDiffers})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0, len(entries))
+	for rel := range entries {
+		missing = append(missing, rel)
+	}
+	sort.Strings(missing)
+	for _, rel := range missing {
+		mismatches = append(mismatches, Mismatch{path.Join(root, rel), Missing})
+	}
+	return mismatches, nil
+}
+
+func readManifest(r io.Reader) (crypto.Hash, map[string]manifestEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, errors.New("empty manifest")
+	}
+	header := scanner.Text()
+	if !strings.HasPrefix(header, manifestHeader) {
+		return 0, nil, errors.New("not a manifest")
+	}
+	var algo crypto.Hash
+	for h := crypto.MD4; h <= crypto.BLAKE2b_512; h++ {
+		if h.String() == header[len(manifestHeader):] {
+			algo = h
+		}
+	}
+	if !algo.Available() {
+		return 0, nil, fmt.Errorf("hash algorithm %s unavailable", header[len(manifestHeader):])
+	}
+
+	entries := make(map[string]manifestEntry)
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			return 0, nil, fmt.Errorf("manifest line %d: malformed entry", line)
+		}
+		mode, err := strconv.ParseUint(fields[1], 8, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		quoted, err := strconv.QuotedPrefix(fields[3])
+		if err != nil {
+			return 0, nil, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		rel, _ := strconv.Unquote(quoted)
+		var target string
+		if rest := fields[3][len(quoted):]; fields[0] == "@" {
+			target, err = strconv.Unquote(strings.TrimPrefix(rest, " "))
+			if err != nil {
+				return 0, nil, fmt.Errorf("manifest line %d: %w", line, err)
+			}
+		} else if rest != "" {
+			return 0, nil, fmt.Errorf("manifest line %d: malformed entry", line)
+		}
+		entries[rel] = manifestEntry{fields[0], os.FileMode(mode), size, target}
+	}
+	return algo, entries, scanner.Err()
+}
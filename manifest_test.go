@@ -0,0 +1,186 @@
+package basefs_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestGenerateManifest(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/root/b.txt":     "hello",
+		"/root/a/c.txt":   "",
+		"/root/a b/d.txt": "x",
+		"/other.txt":      "other",
+	})
+
+	buf := new(bytes.Buffer)
+	err := bfs.GenerateManifest(buf, "/root", crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	expected := []string{
+		"# basefs manifest v1 SHA-256",
+		`- 20000000755 0 "a"`,
+		`e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 644 0 "a/c.txt"`,
+		`- 20000000755 0 "a b"`,
+		`2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881 644 1 "a b/d.txt"`,
+		`2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 644 5 "b.txt"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("got manifest:\n%s", buf)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("%d: got %q, expected %q", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/keep.txt":    "keep",
+		"/tamper.txt":  "hello",
+		"/chmod.txt":   "mode",
+		"/remove.txt":  "gone",
+		"/dir/sub.txt": "sub",
+	})
+
+	buf := new(bytes.Buffer)
+	err := bfs.GenerateManifest(buf, "/", crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := buf.String()
+
+	mismatches, err := bfs.VerifyManifest("/", strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches %v", mismatches)
+	}
+
+	f, err := bfs.OpenFile("/tamper.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("jello")
+	f.Close()
+	if err = bfs.Chmod("/chmod.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = bfs.Remove("/remove.txt"); err != nil {
+		t.Fatal(err)
+	}
+	f, err = bfs.Create("/dir/extra.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mismatches, err = bfs.VerifyManifest("/", strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []basefs.Mismatch{
+		{"/chmod.txt", basefs.ModeDiffers},
+		{"/dir/extra.txt", basefs.Extra},
+		{"/tamper.txt", basefs.HashDiffers},
+		{"/remove.txt", basefs.Missing},
+	}
+	if len(mismatches) != len(expected) {
+		t.Fatalf("got mismatches %v, expected %v", mismatches, expected)
+	}
+	for i := range expected {
+		if mismatches[i] != expected[i] {
+			t.Errorf("%d: got %s, expected %s", i, mismatches[i], expected[i])
+		}
+	}
+}
+
+func TestHashAll(t *testing.T) {
+	files := map[string]string{
+		"/a.txt":     "a",
+		"/b/c.txt":   "c",
+		"/b/d/e.txt": "e",
+	}
+	bfs := newTestFS(t, files)
+
+	sums, err := bfs.HashAll("/", sha256.New)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != len(files) {
+		t.Fatalf("got %d sums, expected %d", len(sums), len(files))
+	}
+	for name, data := range files {
+		expected := sha256.Sum256([]byte(data))
+		sum, err := bfs.Hash(name, sha256.New)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sum, expected[:]) || !bytes.Equal(sums[name], expected[:]) {
+			t.Errorf("%s: got %x and %x, expected %x", name, sum, sums[name], expected)
+		}
+	}
+}
+
+func TestManifestSymlinks(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"/dir/file": "file"})
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range [][2]string{{"dir", "/dirlink"}, {"no such file", "/dangling"}} {
+		if err := bfs.Symlink(link[0], link[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := bfs.GenerateManifest(buf, "/", crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	manifest := buf.String()
+	for _, line := range []string{`@ 1000000777 13 "dangling" "/no such file"`, `@ 1000000777 4 "dirlink" "/dir"`} {
+		if !strings.Contains(manifest, "\n"+line+"\n") {
+			t.Errorf("expected the line %q in the manifest:\n%s", line, manifest)
+		}
+	}
+	if strings.Contains(manifest, `"dirlink/`) {
+		t.Errorf("the link to the directory was followed:\n%s", manifest)
+	}
+
+	mismatches, err := bfs.VerifyManifest("/", strings.NewReader(manifest))
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("got %v, %v", mismatches, err)
+	}
+	if err := bfs.Remove("/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("dir/file", "/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err = bfs.VerifyManifest("/", strings.NewReader(manifest))
+	if err != nil || len(mismatches) != 1 || mismatches[0] != (basefs.Mismatch{Path: "/dangling", Kind: basefs.HashDiffers}) {
+		t.Errorf("got %v, %v, expected the retargeted link to differ", mismatches, err)
+	}
+}
@@ -0,0 +1,119 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// MountReadOnly grafts the directory `dir` of the filesystem `fs` onto the
+// virtual path `virtualPath`, e.g. to share a pool of assets between
+// sandboxes. Paths at and below `virtualPath` refer to the files below `dir`,
+// with the checks of the filesystem's options applied to their virtual paths.
+// The mounted tree is read only whatever `fs` supports: every operation which
+// would change it, including renames into or out of it, fails with EROFS. As
+// with BindFile, the mount point is only listed in its directory if a
+// directory of that name exists there. Unbind removes the mount.
+func (f *FileSystem) MountReadOnly(virtualPath string, fs absfs.FileSystem, dir string) error {
+	ppath, err := f.path(virtualPath)
+	if err != nil {
+		return err
+	}
+	if ppath == f.prefix {
+		return &os.PathError{Op: "mount", Path: virtualPath, Err: os.ErrInvalid}
+	}
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return &os.PathError{Op: "mount", Path: virtualPath, Err: cause(err)}
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "mount", Path: virtualPath, Err: syscall.ENOTDIR}
+	}
+	f.opts.binds.set(ppath, &binding{fs: fs, path: path.Clean(dir), mount: true})
+	return nil
+}
+
+// openMounted opens a file below a directory mounted with MountReadOnly.
+func (b *binding) openMounted(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, b.check("open", name)
+	}
+	if flags&os.O_CREATE != 0 {
+		_, err := b.fs.Stat(b.path)
+		if os.IsNotExist(err) {
+			return nil, b.check("open", name)
+		}
+		if err == nil && flags&os.O_EXCL != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+	}
+	file, err := b.fs.OpenFile(b.path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, b.fixerr("open", name, err)
+	}
+	if flags&O_DIRECTORY != 0 {
+		info, err := file.Stat()
+		if err == nil && !info.IsDir() {
+			err = syscall.ENOTDIR
+		}
+		if err != nil {
+			file.Close()
+			return nil, b.fixerr("open", name, err)
+		}
+	}
+	return &boundFile{File: file, name: name, b: b}, nil
+}
+
+// lstat is stat not following a final symbolic link, where the filesystem of
+// the binding supports them.
+func (b *binding) lstat(name string) (os.FileInfo, error) {
+	sfs, ok := b.fs.(absfs.SymlinkFileSystem)
+	if !ok || b.content != nil {
+		return b.stat(name)
+	}
+	info, err := sfs.Lstat(b.path)
+	if err != nil {
+		return nil, b.fixerr("lstat", name, err)
+	}
+	return &fileinfo{info, path.Base(name)}, nil
+}
+
+// readlink returns the target of a symbolic link below a mounted directory,
+// as stored on the mounted filesystem.
+func (b *binding) readlink(name string) (string, error) {
+	sfs, ok := b.fs.(absfs.SymlinkFileSystem)
+	if !ok || b.content != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	target, err := sfs.Readlink(b.path)
+	return target, b.fixerr("readlink", name, err)
+}
+
+func (f *boundFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	for i, info := range infos {
+		infos[i] = &fileinfo{info, path.Base(info.Name())}
+	}
+	return infos, f.fixerr("readdir", err)
+}
+
+func (f *boundFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	for i, name := range names {
+		names[i] = path.Base(name)
+	}
+	return names, f.fixerr("readdir", err)
+}
+
+// fixerr reports errors under the virtual name of the file, keeping io.EOF
+// and the like intact.
+func (f *boundFile) fixerr(op string, err error) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		return f.b.fixerr(op, f.name, err)
+	}
+	return err
+}
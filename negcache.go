@@ -0,0 +1,115 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// WithNegativeCache remembers for `ttl` that up to `size` paths do not
+// exist, so that repeated lookups of missing files by Stat, Lstat and Open
+// don't reach the underlying filesystem. Creating a file, directory or
+// symlink, or renaming, through the filesystem empties the cache; as a
+// symlink may make any path resolvable, the cache is not updated selectively.
+func WithNegativeCache(size int, ttl time.Duration) Option {
+	return func(o *options) error {
+		if size <= 0 || ttl <= 0 {
+			return os.ErrInvalid
+		}
+		o.missing = &negativeCache{size: size, ttl: ttl, entries: make(map[statKey]time.Time)}
+		return nil
+	}
+}
+
+// negativeCache records paths on the underlying filesystem which don't exist.
+type negativeCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[statKey]time.Time
+
+	// generation, bumped by clear so that lookups which raced with a
+	// mutation are not stored
+	gen uint64
+}
+
+func (c *negativeCache) has(key statKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.entries[key]
+	if ok && !time.Now().Before(expires) {
+		delete(c.entries, key)
+		return false
+	}
+	return ok
+}
+
+// generation returns the generation to pass to add for a lookup starting
+// now.
+func (c *negativeCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add records that `key` doesn't exist, unless the cache was cleared since
+// `gen`.
+func (c *negativeCache) add(key statKey, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if len(c.entries) >= c.size {
+		// evict an arbitrary entry, preferring expired ones
+		now := time.Now()
+		var victim *statKey
+		for k, expires := range c.entries {
+			if victim == nil {
+				victim = &k
+			}
+			if !now.Before(expires) {
+				victim = &k
+				break
+			}
+		}
+		delete(c.entries, *victim)
+	}
+	c.entries[key] = time.Now().Add(c.ttl)
+}
+
+func (c *negativeCache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.gen++
+	c.mu.Unlock()
+}
+
+// lookup returns the FileInfo of `ppath` obtained with `stat`, consulting the
+// negative and stat caches.
+func (o *options) lookup(ppath string, lstat bool, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	if o.missing == nil {
+		return o.stats.lookup(ppath, lstat, stat)
+	}
+	op := "stat"
+	if lstat {
+		op = "lstat"
+	}
+	key := statKey{ppath, lstat}
+	if o.missing.has(key) {
+		return nil, o.notExist(op, ppath, os.ErrNotExist)
+	}
+	gen := o.missing.generation()
+	info, err := o.stats.lookup(ppath, lstat, stat)
+	if os.IsNotExist(err) {
+		o.missing.add(key, gen)
+		return nil, o.notExist(op, ppath, cause(err))
+	}
+	return info, err
+}
+
+// notExist returns the error reporting that `ppath` doesn't exist, the same
+// whether this was found by the negative cache or the underlying filesystem.
+func (o *options) notExist(op, ppath string, err error) error {
+	return &os.PathError{Op: op, Path: vpath(o.base, ppath), Err: err}
+}
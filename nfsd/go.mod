@@ -0,0 +1,22 @@
+module github.com/absfs/basefs/nfsd
+
+go 1.22.0
+
+require (
+	github.com/absfs/absfs v0.0.0-20230318165928-6f31c6ac7458
+	github.com/absfs/basefs v0.0.0
+	github.com/absfs/osfs v0.0.0-20220705103527-80b6215cf130
+	github.com/go-git/go-billy/v5 v5.6.0
+	github.com/willscott/go-nfs v0.0.4
+	github.com/willscott/go-nfs-client v0.0.0-20240104095149-b44639837b00
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/rasky/go-xdr v0.0.0-20170124162913-1a41d1a06c93 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+)
+
+replace github.com/absfs/basefs => ../
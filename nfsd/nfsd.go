@@ -0,0 +1,160 @@
+// Package nfsd serves an absfs filesystem, typically a basefs, over NFSv3 so
+// that virtual machines and containers can mount it directly. All requests go
+// through the filesystem's own methods, so the confinement and policies of a
+// basefs apply on the host side.
+package nfsd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	billy "github.com/go-git/go-billy/v5"
+	nfs "github.com/willscott/go-nfs"
+	"github.com/willscott/go-nfs/helpers"
+)
+
+// HandleLimit is the number of file handles cached by the handler returned
+// by Handler.
+const HandleLimit = 1024
+
+// Serve accepts NFS connections on `l` and serves `fs` to every client
+// mounting it, until `l` is closed.
+func Serve(l net.Listener, fs absfs.SymlinkFileSystem) error {
+	return nfs.Serve(l, Handler(fs))
+}
+
+// Handler returns an NFS handler exposing `fs` to every mount request without
+// authentication.
+func Handler(fs absfs.SymlinkFileSystem) nfs.Handler {
+	return helpers.NewCachingHandler(helpers.NewNullAuthHandler(Billy(fs)), HandleLimit)
+}
+
+// Billy adapts `fs` to the billy.Filesystem interface used by the NFS server.
+// The result also implements billy.Change.
+func Billy(fs absfs.SymlinkFileSystem) billy.Filesystem {
+	return &billyFS{fs}
+}
+
+type billyFS struct {
+	fs absfs.SymlinkFileSystem
+}
+
+func (b *billyFS) Create(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (b *billyFS) Open(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (b *billyFS) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	f, err := b.fs.OpenFile(filename, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &billyFile{f}, nil
+}
+
+func (b *billyFS) Stat(filename string) (os.FileInfo, error) {
+	return b.fs.Stat(filename)
+}
+
+func (b *billyFS) Rename(oldpath, newpath string) error {
+	return b.fs.Rename(oldpath, newpath)
+}
+
+func (b *billyFS) Remove(filename string) error {
+	return b.fs.Remove(filename)
+}
+
+func (b *billyFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (b *billyFS) TempFile(dir, prefix string) (billy.File, error) {
+	var r [8]byte
+	rand.Read(r[:])
+	return b.OpenFile(path.Join(dir, prefix+hex.EncodeToString(r[:])), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+func (b *billyFS) ReadDir(name string) ([]os.FileInfo, error) {
+	f, err := b.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+func (b *billyFS) MkdirAll(filename string, perm os.FileMode) error {
+	return b.fs.MkdirAll(filename, perm)
+}
+
+func (b *billyFS) Lstat(filename string) (os.FileInfo, error) {
+	return b.fs.Lstat(filename)
+}
+
+func (b *billyFS) Symlink(target, link string) error {
+	return b.fs.Symlink(target, link)
+}
+
+func (b *billyFS) Readlink(link string) (string, error) {
+	return b.fs.Readlink(link)
+}
+
+// Chroot returns a filesystem confined to the directory `p`.
+func (b *billyFS) Chroot(p string) (billy.Filesystem, error) {
+	fs, err := basefs.NewFS(b.fs, path.Join("/", p))
+	if err != nil {
+		return nil, err
+	}
+	return &billyFS{fs}, nil
+}
+
+func (b *billyFS) Root() string {
+	return "/"
+}
+
+func (b *billyFS) Chmod(name string, mode os.FileMode) error {
+	return b.fs.Chmod(name, mode)
+}
+
+func (b *billyFS) Lchown(name string, uid, gid int) error {
+	return b.fs.Lchown(name, uid, gid)
+}
+
+func (b *billyFS) Chown(name string, uid, gid int) error {
+	return b.fs.Chown(name, uid, gid)
+}
+
+func (b *billyFS) Chtimes(name string, atime, mtime time.Time) error {
+	return b.fs.Chtimes(name, atime, mtime)
+}
+
+// billyFile adapts an absfs.File to billy.File. Locking is not supported and
+// always succeeds.
+type billyFile struct {
+	absfs.File
+}
+
+func (f *billyFile) Lock() error {
+	return nil
+}
+
+func (f *billyFile) Unlock() error {
+	return nil
+}
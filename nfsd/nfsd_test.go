@@ -0,0 +1,81 @@
+package nfsd_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/basefs/nfsd"
+	"github.com/absfs/osfs"
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+)
+
+func TestServe(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go nfsd.Serve(l, bfs)
+
+	c, err := rpc.DialTCP("tcp", l.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	mounter := nfsc.Mount{Client: c}
+	target, err := mounter.Mount("/", rpc.AuthNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mounter.Unmount()
+
+	f, err := target.Open("/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("got %q %v", data, err)
+	}
+
+	w, err := target.OpenFile("/new.txt", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("written over nfs"))
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "new.txt"))
+	if err != nil || string(data) != "written over nfs" {
+		t.Errorf("got %q %v", data, err)
+	}
+
+	if _, _, err := target.Lookup("/../../etc/passwd"); err == nil {
+		t.Error("lookup escaped the base")
+	}
+}
@@ -0,0 +1,46 @@
+package basefs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+type lstater interface {
+	Lstat(name string) (os.FileInfo, error)
+}
+
+// checkNoFollow fails with ELOOP if O_NOFOLLOW is set in `flags` and `ppath`
+// is a symlink. The flag is also passed on to the underlying filesystem where
+// the platform defines it, this check makes it work with other backends.
+func checkNoFollow(fs absfs.FileSystem, ppath string, flags int) error {
+	if flags&O_NOFOLLOW == 0 {
+		return nil
+	}
+	l, ok := fs.(lstater)
+	if !ok {
+		return nil
+	}
+	info, err := l.Lstat(ppath)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return &os.PathError{Op: "open", Path: ppath, Err: syscall.ELOOP}
+	}
+	return nil
+}
+
+// checkDirectory fails with ENOTDIR if O_DIRECTORY is set in `flags` and the
+// file opened at `ppath` is not a directory.
+func checkDirectory(fs absfs.FileSystem, ppath string, flags int) error {
+	if flags&O_DIRECTORY == 0 {
+		return nil
+	}
+	info, err := fs.Stat(ppath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "open", Path: ppath, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
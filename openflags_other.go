@@ -0,0 +1,15 @@
+//go:build !unix
+
+package basefs
+
+// Flags for OpenFile in addition to those of the os package. O_NOFOLLOW makes
+// opening a symlink fail, and O_DIRECTORY opening anything but a directory.
+// They are honored for every underlying filesystem.
+const (
+	O_NOFOLLOW  = 0x10000000
+	O_DIRECTORY = 0x20000000
+)
+
+// platformFlags are the flags of OpenFile the underlying filesystem may
+// understand. The flags above are unknown to this platform.
+const platformFlags = 0
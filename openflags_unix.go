@@ -0,0 +1,17 @@
+//go:build unix
+
+package basefs
+
+import "syscall"
+
+// Flags for OpenFile in addition to those of the os package. O_NOFOLLOW makes
+// opening a symlink fail, and O_DIRECTORY opening anything but a directory.
+// They are honored for every underlying filesystem.
+const (
+	O_NOFOLLOW  = syscall.O_NOFOLLOW
+	O_DIRECTORY = syscall.O_DIRECTORY
+)
+
+// platformFlags are the flags of OpenFile the underlying filesystem may
+// understand.
+const platformFlags = O_NOFOLLOW | O_DIRECTORY
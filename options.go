@@ -0,0 +1,338 @@
+package basefs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/absfs/absfs"
+)
+
+// Option configures optional behavior of a FileSystem or SymlinkFileSystem.
+type Option func(*options) error
+
+type options struct {
+	base       string
+	baseInfo   os.FileInfo
+	revalidate bool
+	createBase bool
+	basePerm   os.FileMode
+	lazy       bool
+	baseMu     sync.Mutex
+	baseReady  atomic.Bool
+	failClosed bool
+	failed     atomic.Bool
+
+	journal *Journal
+	casDir  string
+	cas     *contentStore
+
+	integrity *integrityIndex
+	checksums *integrityIndex
+	intentLog string
+
+	scanner     ScanFunc
+	quarantine  string
+	deniedTypes []string
+	quota       int64
+	counter     *usageCounter
+	ledger      *ledger
+	regularOnly bool
+	noExec      bool
+	subtrees    []subtree
+
+	readOnly   bool
+	allow      []string
+	deny       []string
+	validators []PathValidator
+	rewriters  []func(string) string
+	aliases    aliases
+	binds      bindings
+	hidden     hidden
+
+	paths   *pathCache
+	stats   *statCache
+	missing *negativeCache
+	dirs    *dirCache
+
+	readAhead   int
+	writeBuffer int
+	syncPolicy  SyncPolicy
+	dirSync     bool
+
+	writeTransformers []func(io.Writer) io.WriteCloser
+	readTransformers  []func(io.Reader) io.Reader
+
+	stableHandles bool
+
+	files    openFiles
+	closers  closers
+	shutdown context.Context
+
+	// the type of the underlying filesystem, and profiling with
+	// WithProfileLabels and WithProfileHook
+	backend      string
+	profileCtx   context.Context
+	profilePaths bool
+	profileRate  uint64
+	profileHook  func(ProfileSample)
+	profileCount *atomic.Uint64
+}
+
+// newOptions applies `opts`, checks the base directory `dir` of the underlying
+// filesystem `fs` and prepares the resulting configuration for use with it.
+func newOptions(fs absfs.FileSystem, dir string, opts []Option) (*options, error) {
+	o := &options{base: dir, counter: new(usageCounter), ledger: new(ledger), backend: fmt.Sprintf("%T", fs)}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if !o.lazy {
+		err := o.initBase(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.casDir != "" {
+		cas, err := newContentStore(fs, o.casDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		o.cas = cas
+	}
+	if o.integrity != nil {
+		err := o.integrity.load(fs, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.checksums != nil {
+		err := o.checksums.load(fs, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	o.watchShutdown()
+	return o, nil
+}
+
+// WithJournal records every successful mutation in `j`.
+func WithJournal(j *Journal) Option {
+	return func(o *options) error {
+		o.journal = j
+		return nil
+	}
+}
+
+// openFile opens `ppath` on the underlying filesystem `fs`, verifying the
+// integrity of files opened for reading if enabled.
+func (o *options) openFile(fs absfs.FileSystem, ppath string, flags int, perm os.FileMode) (absfs.File, error) {
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		if err := o.modify("open", ppath); err != nil {
+			return nil, err
+		}
+	}
+	if o.regularOnly {
+		if err := o.checkKind(fs, ppath); err != nil {
+			return nil, err
+		}
+	}
+	if o.noExec {
+		perm &^= 0111
+	}
+	admitted, err := o.admit(fs, ppath, flags)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: vpath(o.base, ppath), Err: err}
+	}
+	if flags&os.O_CREATE != 0 {
+		o.creating()
+	} else if o.missing != nil && o.missing.has(statKey{ppath, false}) {
+		return nil, o.notExist("open", ppath, os.ErrNotExist)
+	}
+	if err := checkNoFollow(fs, ppath, flags); err != nil {
+		return nil, err
+	}
+	var gen uint64
+	if o.missing != nil {
+		gen = o.missing.generation()
+	}
+	f, err := o.open(fs, ppath, flags&^(O_NOFOLLOW|O_DIRECTORY)|flags&platformFlags, perm)
+	if o.missing != nil && os.IsNotExist(err) && flags&os.O_CREATE == 0 {
+		o.missing.add(statKey{ppath, false}, gen)
+		err = o.notExist("open", ppath, cause(err))
+	}
+	if err != nil && admitted {
+		o.counter.update(o.base, "remove", ppath, "")
+	}
+	if err == nil && flags&os.O_TRUNC != 0 && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		o.counter.set(ppath, 0)
+	}
+	if err == nil {
+		if err := checkDirectory(fs, ppath, flags); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if flags&os.O_CREATE != 0 {
+			if err := o.syncParents(fs, ppath); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	if err != nil || o.integrity == nil || flags&(os.O_WRONLY|os.O_TRUNC) != 0 {
+		return f, err
+	}
+
+	err = o.integrity.verify(ppath, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// creating invalidates the caches before a file may be created.
+func (o *options) creating() {
+	if o.dirs != nil {
+		o.dirs.clear()
+	}
+	if o.missing != nil {
+		o.missing.clear()
+	}
+}
+
+// open opens `ppath` on the underlying filesystem `fs` without any checks.
+func (o *options) open(fs absfs.FileSystem, ppath string, flags int, perm os.FileMode) (absfs.File, error) {
+	if o.cas != nil {
+		return o.cas.openFile(ppath, flags, perm)
+	}
+	return fs.OpenFile(ppath, flags, perm)
+}
+
+// stat adjusts the FileInfo of `ppath` returned by the underlying filesystem.
+func (o *options) stat(ppath string, info os.FileInfo) os.FileInfo {
+	if o.cas != nil {
+		return o.cas.stat(ppath, info)
+	}
+	return info
+}
+
+// truncate changes the size of the file `ppath` on the underlying filesystem
+// `fs`.
+func (o *options) truncate(fs absfs.FileSystem, ppath string, size int64) error {
+	if o.cas == nil {
+		return fs.Truncate(ppath, size)
+	}
+	f, err := o.open(fs, ppath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// record notifies the optional subsystems of a successful mutation. `name`
+// and `target` are virtual paths.
+func (o *options) record(op, name, target string) {
+	o.invalidate(op, name, target)
+	if op == "rename" && o.stableHandles {
+		o.files.moved(o.base, name, target)
+	}
+	if op == "exchange" && o.stableHandles {
+		o.files.exchanged(o.base, name, target)
+	}
+	if o.integrity != nil {
+		o.integrity.update(op, name, target)
+	}
+	if o.checksums != nil {
+		o.checksums.update(op, name, target)
+	}
+	if o.cas != nil {
+		o.cas.refs.update(op, name, target)
+	}
+	switch op {
+	case "remove", "removeall", "rename", "exchange":
+		ppath, _ := join(o.base, name)
+		ptarget, _ := join(o.base, target)
+		o.counter.update(o.base, op, ppath, ptarget)
+	}
+	if o.journal != nil {
+		o.journal.append(JournalRecord{Op: op, Path: name, Target: target})
+	}
+}
+
+// invalidate drops cached information about `name` and, for renames,
+// `target` after the mutation `op`.
+func (o *options) invalidate(op, name, target string) {
+	if o.stats != nil {
+		o.stats.clear()
+	}
+	if o.dirs != nil {
+		o.dirs.clear()
+	}
+	if o.missing != nil {
+		switch op {
+		case "mkdir", "mkdirall", "rename", "symlink":
+			o.missing.clear()
+		}
+	}
+}
+
+// recordContent notifies the optional subsystems of a successful change to
+// the contents of the file at `ppath` on the underlying filesystem `fs`.
+// `digest` is the checksum of the new contents, if it was computed while they
+// were written. It fails if the hash of the file can't be recorded.
+func (o *options) recordContent(fs absfs.FileSystem, op, ppath, name string, digest []byte) error {
+	if o.stats != nil {
+		o.stats.clear()
+	}
+	if o.dirs != nil {
+		o.dirs.clear()
+	}
+	var err error
+	if o.integrity != nil {
+		err = o.integrity.seal(o, fs, ppath, nil)
+	}
+	if o.checksums != nil {
+		if err1 := o.checksums.seal(o, fs, ppath, digest); err == nil {
+			err = err1
+		}
+	}
+	if o.journal != nil {
+		o.journal.appendContent(o, fs, op, ppath, name)
+	}
+	return err
+}
+
+// written is called when a file that was written to has been closed, with
+// the checksum of its contents if it is known.
+func (o *options) written(fs absfs.FileSystem, ppath, name string, digest []byte) error {
+	if len(o.deniedTypes) > 0 {
+		if err := o.checkContentType(fs, ppath, name); err != nil {
+			return err
+		}
+	}
+	if o.scanner != nil {
+		if err := o.scan(fs, ppath, name); err != nil {
+			return err
+		}
+	}
+	if err := o.checkUsage(fs, ppath, name); err != nil {
+		return err
+	}
+	if o.noExec && o.cas == nil {
+		if err := o.stripExec(fs, ppath); err != nil {
+			return err
+		}
+	}
+	return o.recordContent(fs, "write", ppath, name, digest)
+}
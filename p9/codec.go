@@ -0,0 +1,88 @@
+package p9
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShort = errors.New("p9: short message")
+
+// qid is the server's unique identification of a file.
+type qid struct {
+	typ     uint8
+	version uint32
+	path    uint64
+}
+
+// decoder reads the little endian fields of a message body. The first error
+// is sticky, so fields can be read without checking each one.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = errShort
+		return make([]byte, n)
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) u8() uint8 {
+	return d.next(1)[0]
+}
+
+func (d *decoder) u16() uint16 {
+	return binary.LittleEndian.Uint16(d.next(2))
+}
+
+func (d *decoder) u32() uint32 {
+	return binary.LittleEndian.Uint32(d.next(4))
+}
+
+func (d *decoder) u64() uint64 {
+	return binary.LittleEndian.Uint64(d.next(8))
+}
+
+func (d *decoder) str() string {
+	return string(d.next(int(d.u16())))
+}
+
+func (d *decoder) qid() qid {
+	return qid{d.u8(), d.u32(), d.u64()}
+}
+
+// encoder appends the little endian fields of a message body.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) u8(v uint8) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) u16(v uint16) {
+	e.b = binary.LittleEndian.AppendUint16(e.b, v)
+}
+
+func (e *encoder) u32(v uint32) {
+	e.b = binary.LittleEndian.AppendUint32(e.b, v)
+}
+
+func (e *encoder) u64(v uint64) {
+	e.b = binary.LittleEndian.AppendUint64(e.b, v)
+}
+
+func (e *encoder) str(s string) {
+	e.u16(uint16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) qid(q qid) {
+	e.u8(q.typ)
+	e.u32(q.version)
+	e.u64(q.path)
+}
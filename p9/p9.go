@@ -0,0 +1,860 @@
+// Package p9 serves an absfs filesystem, typically a basefs, over the
+// 9P2000.L protocol used by QEMU virtfs and similar guest mounts. Fids are
+// mapped onto virtual paths of the filesystem and every request goes through
+// its methods, so the confinement and policies of a basefs apply.
+//
+// Requests on a connection are handled one at a time.
+package p9
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Version is the protocol version spoken by the server.
+const Version = "9P2000.L"
+
+// MaxMessageSize is the largest message size negotiated by the server.
+const MaxMessageSize = 1 << 20
+
+// headerSize is the size of the size, type and tag fields of every message.
+const headerSize = 7
+
+// readHeaderSize is the size of an Rread message without its data.
+const readHeaderSize = headerSize + 4
+
+// message types
+const (
+	rlerror    = 7
+	tstatfs    = 8
+	tlopen     = 12
+	tlcreate   = 14
+	tsymlink   = 16
+	trename    = 20
+	treadlink  = 22
+	tgetattr   = 24
+	tsetattr   = 26
+	treaddir   = 40
+	tfsync     = 50
+	tlock      = 52
+	tgetlock   = 54
+	tmkdir     = 72
+	trenameat  = 74
+	tunlinkat  = 76
+	tversion   = 100
+	tattach    = 104
+	tflush     = 108
+	twalk      = 110
+	tread      = 116
+	twrite     = 118
+	tclunk     = 120
+	tremove    = 122
+	qidDir     = 0x80
+	qidSymlink = 0x02
+)
+
+// Linux open flags and mode bits used on the wire.
+const (
+	lRDWR     = 02
+	lWRONLY   = 01
+	lCREAT    = 0100
+	lEXCL     = 0200
+	lTRUNC    = 01000
+	lAPPEND   = 02000
+	lIFDIR    = 0040000
+	lIFREG    = 0100000
+	lIFLNK    = 0120000
+	lREMOVDIR = 0x200
+)
+
+// Linux error numbers returned in Rlerror messages.
+const (
+	ePERM    = 1
+	eNOENT   = 2
+	eIO      = 5
+	eBADF    = 9
+	eACCES   = 13
+	eEXIST   = 17
+	eNOTDIR  = 20
+	eISDIR   = 21
+	eINVAL   = 22
+	eNOTEMPT = 39
+	eNOTSUP  = 95
+)
+
+// setattr valid bits
+const (
+	setMode     = 0x1
+	setUID      = 0x2
+	setGID      = 0x4
+	setSize     = 0x8
+	setAtime    = 0x10
+	setMtime    = 0x20
+	setAtimeSet = 0x80
+	setMtimeSet = 0x100
+)
+
+// getattrBasic is the mask of the attributes returned by Tgetattr.
+const getattrBasic = 0x7ff
+
+// Serve accepts 9P connections on `l` and serves `fs` on each of them until
+// `l` is closed.
+func Serve(l net.Listener, fs absfs.SymlinkFileSystem) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ServeConn(c, fs)
+	}
+}
+
+// ServeConn serves `fs` on the single connection `rw` until it fails or is
+// closed by the client, and closes it.
+func ServeConn(rw io.ReadWriteCloser, fs absfs.SymlinkFileSystem) error {
+	c := &conn{fs: fs, rw: rw, msize: MaxMessageSize, fids: make(map[uint32]*fid)}
+	defer c.close()
+	for {
+		typ, tag, body, err := c.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		e := &encoder{b: make([]byte, headerSize, 64)}
+		rtype := uint8(typ + 1)
+		if err := c.handle(typ, &decoder{b: body}, e); err != nil {
+			e.b = e.b[:headerSize]
+			e.u32(errno(err))
+			rtype = rlerror
+		}
+		binary.LittleEndian.PutUint32(e.b, uint32(len(e.b)))
+		e.b[4] = rtype
+		binary.LittleEndian.PutUint16(e.b[5:], tag)
+		if _, err := rw.Write(e.b); err != nil {
+			return err
+		}
+	}
+}
+
+type conn struct {
+	fs    absfs.SymlinkFileSystem
+	rw    io.ReadWriteCloser
+	msize uint32
+	fids  map[uint32]*fid
+}
+
+// fid is a reference to a file held by the client.
+type fid struct {
+	path    string
+	file    absfs.File
+	append  bool
+	entries []os.FileInfo
+}
+
+func (c *conn) read() (typ uint8, tag uint16, body []byte, err error) {
+	var hdr [headerSize]byte
+	if _, err = io.ReadFull(c.rw, hdr[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[:])
+	if size < headerSize || size > c.msize {
+		return 0, 0, nil, errors.New("p9: invalid message size")
+	}
+	body = make([]byte, size-headerSize)
+	if _, err = io.ReadFull(c.rw, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return hdr[4], binary.LittleEndian.Uint16(hdr[5:]), body, nil
+}
+
+func (c *conn) close() {
+	c.clunkAll()
+	c.rw.Close()
+}
+
+func (c *conn) clunkAll() {
+	for n, f := range c.fids {
+		if f.file != nil {
+			f.file.Close()
+		}
+		delete(c.fids, n)
+	}
+}
+
+func (c *conn) fid(n uint32) (*fid, error) {
+	f, ok := c.fids[n]
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	return f, nil
+}
+
+// child returns the path of the entry `name` in the directory of fid `n`.
+func (c *conn) child(n uint32, name string) (string, error) {
+	f, err := c.fid(n)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return "", syscall.EINVAL
+	}
+	return path.Join(f.path, name), nil
+}
+
+func (c *conn) iounit() uint32 {
+	return c.msize - readHeaderSize
+}
+
+func (c *conn) qid(p string) (qid, error) {
+	info, err := c.fs.Lstat(p)
+	if err != nil {
+		return qid{}, err
+	}
+	return qidOf(p, info), nil
+}
+
+// qidOf derives a qid from the virtual path and attributes of a file.
+func qidOf(p string, info os.FileInfo) qid {
+	h := fnv.New64a()
+	h.Write([]byte(p))
+	q := qid{version: uint32(info.ModTime().UnixNano()), path: h.Sum64()}
+	switch {
+	case info.IsDir():
+		q.typ = qidDir
+	case info.Mode()&os.ModeSymlink != 0:
+		q.typ = qidSymlink
+	}
+	return q
+}
+
+func (c *conn) handle(typ uint8, d *decoder, e *encoder) error {
+	var err error
+	switch typ {
+	case tversion:
+		err = c.version(d, e)
+	case tattach:
+		err = c.attach(d, e)
+	case twalk:
+		err = c.walk(d, e)
+	case tlopen:
+		err = c.lopen(d, e)
+	case tlcreate:
+		err = c.lcreate(d, e)
+	case tread:
+		err = c.readFile(d, e)
+	case twrite:
+		err = c.write(d, e)
+	case tclunk:
+		err = c.clunk(d)
+	case tremove:
+		err = c.remove(d)
+	case tgetattr:
+		err = c.getattr(d, e)
+	case tsetattr:
+		err = c.setattr(d)
+	case treaddir:
+		err = c.readdir(d, e)
+	case tmkdir:
+		err = c.mkdir(d, e)
+	case tsymlink:
+		err = c.symlink(d, e)
+	case treadlink:
+		err = c.readlink(d, e)
+	case trename:
+		err = c.rename(d)
+	case trenameat:
+		err = c.renameat(d)
+	case tunlinkat:
+		err = c.unlinkat(d)
+	case tfsync:
+		err = c.fsync(d)
+	case tstatfs:
+		c.statfs(e)
+	case tflush:
+		d.u16()
+	case tlock:
+		// Locks are advisory and granted unconditionally.
+		e.u8(0)
+	case tgetlock:
+		c.getlock(d, e)
+	default:
+		return syscall.ENOTSUP
+	}
+	if err == nil && d.err != nil {
+		return syscall.EINVAL
+	}
+	return err
+}
+
+func (c *conn) version(d *decoder, e *encoder) error {
+	msize, version := d.u32(), d.str()
+	if msize < readHeaderSize+1 {
+		return syscall.EINVAL
+	}
+	if msize < MaxMessageSize {
+		c.msize = msize
+	}
+	c.clunkAll()
+	if version != Version {
+		version = "unknown"
+	}
+	e.u32(c.msize)
+	e.str(version)
+	return nil
+}
+
+func (c *conn) attach(d *decoder, e *encoder) error {
+	n := d.u32()
+	d.u32() // afid, authentication is not supported
+	d.str() // uname
+	d.str() // aname
+	if _, ok := c.fids[n]; ok {
+		return syscall.EBADF
+	}
+	q, err := c.qid("/")
+	if err != nil {
+		return err
+	}
+	c.fids[n] = &fid{path: "/"}
+	e.qid(q)
+	return nil
+}
+
+func (c *conn) walk(d *decoder, e *encoder) error {
+	n, newfid, count := d.u32(), d.u32(), d.u16()
+	names := make([]string, count)
+	for i := range names {
+		names[i] = d.str()
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.fids[newfid]; ok && newfid != n {
+		return syscall.EBADF
+	}
+
+	p := f.path
+	var qids []qid
+	for i, name := range names {
+		if name == "" || strings.Contains(name, "/") {
+			err = syscall.EINVAL
+		} else {
+			next := path.Join(p, name)
+			var q qid
+			q, err = c.qid(next)
+			if err == nil {
+				p = next
+				qids = append(qids, q)
+				continue
+			}
+		}
+		if i == 0 {
+			return err
+		}
+		break
+	}
+	if len(qids) == len(names) {
+		c.fids[newfid] = &fid{path: p}
+	}
+	e.u16(uint16(len(qids)))
+	for _, q := range qids {
+		e.qid(q)
+	}
+	return nil
+}
+
+// openFlags converts Linux open flags into os flags.
+func openFlags(l uint32) int {
+	var flags int
+	switch l & 3 {
+	case lWRONLY:
+		flags = os.O_WRONLY
+	case lRDWR:
+		flags = os.O_RDWR
+	}
+	if l&lCREAT != 0 {
+		flags |= os.O_CREATE
+	}
+	if l&lEXCL != 0 {
+		flags |= os.O_EXCL
+	}
+	if l&lTRUNC != 0 {
+		flags |= os.O_TRUNC
+	}
+	if l&lAPPEND != 0 {
+		flags |= os.O_APPEND
+	}
+	return flags
+}
+
+func (c *conn) lopen(d *decoder, e *encoder) error {
+	n, flags := d.u32(), d.u32()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		return syscall.EBADF
+	}
+	q, err := c.qid(f.path)
+	if err != nil {
+		return err
+	}
+	f.file, err = c.fs.OpenFile(f.path, openFlags(flags)&^(os.O_CREATE|os.O_EXCL), 0)
+	if err != nil {
+		f.file = nil
+		return err
+	}
+	f.append = flags&lAPPEND != 0
+	e.qid(q)
+	e.u32(c.iounit())
+	return nil
+}
+
+func (c *conn) lcreate(d *decoder, e *encoder) error {
+	n, name, flags, mode := d.u32(), d.str(), d.u32(), d.u32()
+	d.u32() // gid
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	f := c.fids[n]
+	if f.file != nil {
+		return syscall.EBADF
+	}
+	file, err := c.fs.OpenFile(p, openFlags(flags)|os.O_CREATE, os.FileMode(mode).Perm())
+	if err != nil {
+		return err
+	}
+	q, err := c.qid(p)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.path, f.file, f.append = p, file, flags&lAPPEND != 0
+	e.qid(q)
+	e.u32(c.iounit())
+	return nil
+}
+
+func (c *conn) readFile(d *decoder, e *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	if count > c.iounit() {
+		count = c.iounit()
+	}
+	e.u32(0)
+	start := len(e.b)
+	e.b = append(e.b, make([]byte, count)...)
+	got, err := f.file.ReadAt(e.b[start:], int64(off))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	e.b = e.b[:start+got]
+	binary.LittleEndian.PutUint32(e.b[start-4:], uint32(got))
+	return nil
+}
+
+func (c *conn) write(d *decoder, e *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	data := d.next(int(count))
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	var wrote int
+	if f.append {
+		wrote, err = f.file.Write(data)
+	} else {
+		wrote, err = f.file.WriteAt(data, int64(off))
+	}
+	if err != nil {
+		return err
+	}
+	e.u32(uint32(wrote))
+	return nil
+}
+
+func (c *conn) clunk(d *decoder) error {
+	n := d.u32()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	delete(c.fids, n)
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+func (c *conn) remove(d *decoder) error {
+	n := d.u32()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	delete(c.fids, n)
+	if f.file != nil {
+		f.file.Close()
+	}
+	return c.fs.Remove(f.path)
+}
+
+func (c *conn) getattr(d *decoder, e *encoder) error {
+	n := d.u32()
+	d.u64() // request mask, all basic attributes are always returned
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	info, err := c.fs.Lstat(f.path)
+	if err != nil {
+		return err
+	}
+
+	mode := uint32(info.Mode().Perm())
+	switch {
+	case info.IsDir():
+		mode |= lIFDIR
+	case info.Mode()&os.ModeSymlink != 0:
+		mode |= lIFLNK
+	default:
+		mode |= lIFREG
+	}
+	uid, gid, nlink := owner(info)
+	size := uint64(info.Size())
+	mtime := info.ModTime()
+
+	e.u64(getattrBasic)
+	e.qid(qidOf(f.path, info))
+	e.u32(mode)
+	e.u32(uid)
+	e.u32(gid)
+	e.u64(nlink)
+	e.u64(0) // rdev
+	e.u64(size)
+	e.u64(4096)               // blksize
+	e.u64((size + 511) / 512) // blocks
+	for i := 0; i < 3; i++ {
+		// atime, mtime and ctime
+		e.u64(uint64(mtime.Unix()))
+		e.u64(uint64(mtime.Nanosecond()))
+	}
+	for i := 0; i < 4; i++ {
+		// btime, gen and data version
+		e.u64(0)
+	}
+	return nil
+}
+
+func (c *conn) setattr(d *decoder) error {
+	n, valid, mode, uid, gid, size := d.u32(), d.u32(), d.u32(), d.u32(), d.u32(), d.u64()
+	atime := time.Unix(int64(d.u64()), int64(d.u64()))
+	mtime := time.Unix(int64(d.u64()), int64(d.u64()))
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if d.err != nil {
+		return syscall.EINVAL
+	}
+
+	if valid&setMode != 0 {
+		if err := c.fs.Chmod(f.path, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if valid&(setUID|setGID) != 0 {
+		u, g := -1, -1
+		if valid&setUID != 0 {
+			u = int(uid)
+		}
+		if valid&setGID != 0 {
+			g = int(gid)
+		}
+		if err := c.fs.Chown(f.path, u, g); err != nil {
+			return err
+		}
+	}
+	if valid&setSize != 0 {
+		if err := c.fs.Truncate(f.path, int64(size)); err != nil {
+			return err
+		}
+	}
+	if valid&(setAtime|setMtime) != 0 {
+		info, err := c.fs.Stat(f.path)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		a, m := info.ModTime(), info.ModTime()
+		if valid&setAtime != 0 {
+			a = now
+			if valid&setAtimeSet != 0 {
+				a = atime
+			}
+		}
+		if valid&setMtime != 0 {
+			m = now
+			if valid&setMtimeSet != 0 {
+				m = mtime
+			}
+		}
+		if err := c.fs.Chtimes(f.path, a, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) readdir(d *decoder, e *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	if off == 0 || f.entries == nil {
+		// Offsets index a listing taken when the client starts reading.
+		dir, err := c.fs.Open(f.path)
+		if err != nil {
+			return err
+		}
+		f.entries, err = dir.Readdir(-1)
+		dir.Close()
+		if err != nil {
+			return err
+		}
+		sort.Slice(f.entries, func(i, j int) bool {
+			return f.entries[i].Name() < f.entries[j].Name()
+		})
+	}
+	if count > c.iounit() {
+		count = c.iounit()
+	}
+
+	e.u32(0)
+	start := len(e.b)
+	for i := off; i < uint64(len(f.entries)); i++ {
+		info := f.entries[i]
+		if len(e.b)-start+13+8+1+2+len(info.Name()) > int(count) {
+			break
+		}
+		q := qidOf(path.Join(f.path, info.Name()), info)
+		e.qid(q)
+		e.u64(i + 1)
+		e.u8(direntType(info))
+		e.str(info.Name())
+	}
+	binary.LittleEndian.PutUint32(e.b[start-4:], uint32(len(e.b)-start))
+	return nil
+}
+
+// direntType returns the Linux DT_* type of a directory entry.
+func direntType(info os.FileInfo) uint8 {
+	switch {
+	case info.IsDir():
+		return 4
+	case info.Mode()&os.ModeSymlink != 0:
+		return 10
+	case info.Mode().IsRegular():
+		return 8
+	}
+	return 0
+}
+
+func (c *conn) mkdir(d *decoder, e *encoder) error {
+	n, name, mode := d.u32(), d.str(), d.u32()
+	d.u32() // gid
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	if err := c.fs.Mkdir(p, os.FileMode(mode).Perm()); err != nil {
+		return err
+	}
+	q, err := c.qid(p)
+	if err != nil {
+		return err
+	}
+	e.qid(q)
+	return nil
+}
+
+func (c *conn) symlink(d *decoder, e *encoder) error {
+	n, name, target := d.u32(), d.str(), d.str()
+	d.u32() // gid
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	if err := c.fs.Symlink(target, p); err != nil {
+		return err
+	}
+	q, err := c.qid(p)
+	if err != nil {
+		return err
+	}
+	e.qid(q)
+	return nil
+}
+
+func (c *conn) readlink(d *decoder, e *encoder) error {
+	f, err := c.fid(d.u32())
+	if err != nil {
+		return err
+	}
+	target, err := c.fs.Readlink(f.path)
+	if err != nil {
+		return err
+	}
+	e.str(target)
+	return nil
+}
+
+func (c *conn) rename(d *decoder) error {
+	n, dir, name := d.u32(), d.u32(), d.str()
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.child(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := c.fs.Rename(f.path, p); err != nil {
+		return err
+	}
+	f.path = p
+	return nil
+}
+
+func (c *conn) renameat(d *decoder) error {
+	olddir, oldname, newdir, newname := d.u32(), d.str(), d.u32(), d.str()
+	oldpath, err := c.child(olddir, oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := c.child(newdir, newname)
+	if err != nil {
+		return err
+	}
+	return c.fs.Rename(oldpath, newpath)
+}
+
+func (c *conn) unlinkat(d *decoder) error {
+	n, name, flags := d.u32(), d.str(), d.u32()
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	info, err := c.fs.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != (flags&lREMOVDIR != 0) {
+		if info.IsDir() {
+			return syscall.EISDIR
+		}
+		return syscall.ENOTDIR
+	}
+	return c.fs.Remove(p)
+}
+
+func (c *conn) fsync(d *decoder) error {
+	f, err := c.fid(d.u32())
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	return f.file.Sync()
+}
+
+func (c *conn) statfs(e *encoder) {
+	e.u32(0x01021997) // V9FS_MAGIC
+	e.u32(4096)       // block size
+	for i := 0; i < 6; i++ {
+		// blocks, free blocks, available blocks, files, free files and fsid
+		// are unknown
+		e.u64(0)
+	}
+	e.u32(255) // maximum name length
+}
+
+func (c *conn) getlock(d *decoder, e *encoder) {
+	d.u32() // fid
+	d.u8()  // type
+	start, length, pid, client := d.u64(), d.u64(), d.u32(), d.str()
+	e.u8(2) // F_UNLCK, there are never conflicting locks
+	e.u64(start)
+	e.u64(length)
+	e.u32(pid)
+	e.str(client)
+}
+
+// errno maps `err` to a Linux error number.
+func errno(err error) uint32 {
+	var en syscall.Errno
+	switch {
+	case errors.As(err, &en):
+		switch en {
+		case syscall.EPERM:
+			return ePERM
+		case syscall.ENOENT:
+			return eNOENT
+		case syscall.EBADF:
+			return eBADF
+		case syscall.EACCES:
+			return eACCES
+		case syscall.EEXIST:
+			return eEXIST
+		case syscall.ENOTDIR:
+			return eNOTDIR
+		case syscall.EISDIR:
+			return eISDIR
+		case syscall.EINVAL:
+			return eINVAL
+		case syscall.ENOTEMPTY:
+			return eNOTEMPT
+		case syscall.ENOTSUP:
+			return eNOTSUP
+		}
+	case errors.Is(err, os.ErrNotExist):
+		return eNOENT
+	case errors.Is(err, os.ErrExist):
+		return eEXIST
+	case errors.Is(err, os.ErrPermission):
+		return eACCES
+	case errors.Is(err, os.ErrInvalid):
+		return eINVAL
+	}
+	return eIO
+}
@@ -0,0 +1,200 @@
+package p9
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+// client is a minimal 9P2000.L client for testing the server.
+type client struct {
+	t   *testing.T
+	c   net.Conn
+	tag uint16
+}
+
+// call sends a message of type `typ` with the body built by `body` and
+// returns the decoded reply body, or the error number of an Rlerror.
+func (c *client) call(typ uint8, body func(e *encoder)) (*decoder, uint32) {
+	c.t.Helper()
+	e := &encoder{b: make([]byte, headerSize)}
+	body(e)
+	binary.LittleEndian.PutUint32(e.b, uint32(len(e.b)))
+	e.b[4] = typ
+	c.tag++
+	binary.LittleEndian.PutUint16(e.b[5:], c.tag)
+	if _, err := c.c.Write(e.b); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(c.c, hdr[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	reply := make([]byte, binary.LittleEndian.Uint32(hdr[:])-headerSize)
+	if _, err := io.ReadFull(c.c, reply); err != nil {
+		c.t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint16(hdr[5:]) != c.tag {
+		c.t.Fatalf("unexpected tag %d", binary.LittleEndian.Uint16(hdr[5:]))
+	}
+	d := &decoder{b: reply}
+	if hdr[4] == rlerror {
+		return nil, d.u32()
+	}
+	if hdr[4] != typ+1 {
+		c.t.Fatalf("unexpected reply type %d to %d", hdr[4], typ)
+	}
+	return d, 0
+}
+
+func (c *client) must(typ uint8, body func(e *encoder)) *decoder {
+	c.t.Helper()
+	d, errno := c.call(typ, body)
+	if errno != 0 {
+		c.t.Fatalf("message %d failed with errno %d", typ, errno)
+	}
+	return d
+}
+
+func (c *client) walk(fid, newfid uint32, names ...string) (int, uint32) {
+	c.t.Helper()
+	d, errno := c.call(twalk, func(e *encoder) {
+		e.u32(fid)
+		e.u32(newfid)
+		e.u16(uint16(len(names)))
+		for _, n := range names {
+			e.str(n)
+		}
+	})
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(d.u16()), 0
+}
+
+func TestServeConn(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "sub", "hello.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, conn := net.Pipe()
+	go ServeConn(server, bfs)
+	defer conn.Close()
+	c := &client{t: t, c: conn}
+
+	d := c.must(tversion, func(e *encoder) {
+		e.u32(8192)
+		e.str(Version)
+	})
+	if msize, version := d.u32(), d.str(); msize != 8192 || version != Version {
+		t.Fatalf("unexpected version reply %d %q", msize, version)
+	}
+	d = c.must(tattach, func(e *encoder) {
+		e.u32(0)
+		e.u32(^uint32(0))
+		e.str("user")
+		e.str("")
+		e.u32(0)
+	})
+	if q := d.qid(); q.typ != qidDir {
+		t.Errorf("root is not a directory: %+v", q)
+	}
+
+	// read an existing file
+	if n, errno := c.walk(0, 1, "sub", "hello.txt"); n != 2 || errno != 0 {
+		t.Fatalf("walk failed: %d %d", n, errno)
+	}
+	c.must(tlopen, func(e *encoder) { e.u32(1); e.u32(0) })
+	d = c.must(tread, func(e *encoder) { e.u32(1); e.u64(1); e.u32(100) })
+	if n := d.u32(); string(d.next(int(n))) != "ello" {
+		t.Error("unexpected file contents")
+	}
+	d = c.must(tgetattr, func(e *encoder) { e.u32(1); e.u64(getattrBasic) })
+	d.u64()
+	d.qid()
+	if mode := d.u32(); mode != lIFREG|0644 {
+		t.Errorf("unexpected mode %o", mode)
+	}
+	c.must(tclunk, func(e *encoder) { e.u32(1) })
+
+	// walking above the root stays inside the base
+	if n, _ := c.walk(0, 2, "..", ".."); n != 2 {
+		t.Fatalf("walk to .. failed")
+	}
+	if _, errno := c.walk(2, 3, filepath.Base(dir)); errno != eNOENT {
+		t.Errorf("expected ENOENT walking out of the base, got %d", errno)
+	}
+
+	// create and write a new file
+	if n, errno := c.walk(0, 4, "sub"); n != 1 || errno != 0 {
+		t.Fatalf("walk failed: %d %d", n, errno)
+	}
+	c.must(tlcreate, func(e *encoder) {
+		e.u32(4)
+		e.str("new.txt")
+		e.u32(lWRONLY | lTRUNC)
+		e.u32(0600)
+		e.u32(0)
+	})
+	d = c.must(twrite, func(e *encoder) {
+		e.u32(4)
+		e.u64(0)
+		e.u32(7)
+		e.b = append(e.b, "written"...)
+	})
+	if n := d.u32(); n != 7 {
+		t.Errorf("wrote %d bytes", n)
+	}
+	c.must(tclunk, func(e *encoder) { e.u32(4) })
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "new.txt"))
+	if err != nil || string(data) != "written" {
+		t.Errorf("got %q %v", data, err)
+	}
+
+	// list the directory
+	c.walk(0, 5, "sub")
+	c.must(tlopen, func(e *encoder) { e.u32(5); e.u32(0) })
+	d = c.must(treaddir, func(e *encoder) { e.u32(5); e.u64(0); e.u32(4096) })
+	d = &decoder{b: d.next(int(d.u32()))}
+	var names []string
+	for len(d.b) > 0 {
+		d.qid()
+		d.u64()
+		d.u8()
+		names = append(names, d.str())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "hello.txt" || names[1] != "new.txt" {
+		t.Errorf("unexpected entries %q", names)
+	}
+
+	c.must(tunlinkat, func(e *encoder) { e.u32(5); e.str("new.txt"); e.u32(0) })
+	if _, err := os.Stat(filepath.Join(dir, "sub", "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("file was not removed: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package p9
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the owner, group and link count of the file described by
+// `info`.
+func owner(info os.FileInfo) (uid, gid uint32, nlink uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid, uint64(st.Nlink)
+	}
+	return 0, 0, 1
+}
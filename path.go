@@ -0,0 +1,140 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// join cleans the virtual path `name`, absolute or relative to the root of
+// the base, and joins it to the clean path `prefix` in a single pass. It
+// reports false if ".." elements would climb above the base. Short paths are
+// assembled on the stack, so the returned string is the only allocation.
+func join(prefix, name string) (string, bool) {
+	var stack [256]byte
+	buf := stack[:0]
+	if n := len(prefix) + 1 + len(name); n > len(stack) {
+		buf = make([]byte, 0, n)
+	}
+	if prefix != "/" {
+		buf = append(buf, prefix...)
+	}
+	base := len(buf)
+
+	for i := 0; i < len(name); {
+		for i < len(name) && name[i] == '/' {
+			i++
+		}
+		j := i
+		for j < len(name) && name[j] != '/' {
+			j++
+		}
+		elem := name[i:j]
+		i = j
+
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(buf) == base {
+				return "", false
+			}
+			// every element below the base was appended with a leading '/'
+			k := len(buf) - 1
+			for buf[k] != '/' {
+				k--
+			}
+			buf = buf[:k]
+		default:
+			buf = append(buf, '/')
+			buf = append(buf, elem...)
+		}
+	}
+	if len(buf) == 0 {
+		return "/", true
+	}
+	return string(buf), true
+}
+
+// errEscape is returned for paths which would resolve outside the base.
+func errEscape(name string) error {
+	return &os.PathError{Op: "open", Path: name, Err: errors.New("no such file or directory")}
+}
+
+// Clean returns the absolute virtual path that `name` refers to, exactly as
+// the filesystem interprets it: names use forward slashes, relative names are
+// relative to the root of the base and the empty name is the working
+// directory. It fails if ".." elements would climb above the root, unless the
+// base is the root of the underlying filesystem, where they stop at the root
+// as usual.
+func (f *FileSystem) Clean(name string) (string, error) {
+	if name == "" {
+		name = f.cwd
+	}
+	if f.prefix == "/" {
+		return path.Clean("/" + name), nil
+	}
+	p, ok := join("/", name)
+	if !ok {
+		return "", errEscape(name)
+	}
+	return p, nil
+}
+
+// Join joins the elements with slashes and returns the Clean result. Unlike
+// path.Join, ".." elements are not allowed to climb above the root.
+func (f *FileSystem) Join(elem ...string) (string, error) {
+	var parts []string
+	for _, e := range elem {
+		if e != "" {
+			parts = append(parts, e)
+		}
+	}
+	return f.Clean(strings.Join(parts, "/"))
+}
+
+// Rel returns the relative path which leads from the directory `base` to
+// `target`, after cleaning both with Clean.
+func (f *FileSystem) Rel(base, target string) (string, error) {
+	from, err := f.Clean(base)
+	if err != nil {
+		return "", err
+	}
+	to, err := f.Clean(target)
+	if err != nil {
+		return "", err
+	}
+	if from == to {
+		return ".", nil
+	}
+	a, b := strings.Split(from, "/")[1:], strings.Split(to, "/")[1:]
+	if from == "/" {
+		a = nil
+	}
+	if to == "/" {
+		b = nil
+	}
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	parts := make([]string, 0, len(a)-i+len(b)-i)
+	for range a[i:] {
+		parts = append(parts, "..")
+	}
+	return strings.Join(append(parts, b[i:]...), "/"), nil
+}
+
+// Contains reports whether `name` falls inside the base once cleaned.
+// Absolute names are taken as paths on the underlying filesystem, e.g. from a
+// configuration file, and relative names as virtual paths, which are inside
+// unless ".." elements climb above the root.
+func (f *FileSystem) Contains(name string) bool {
+	name = filepath.ToSlash(name)
+	if !path.IsAbs(name) {
+		_, err := f.Clean(name)
+		return name != "" && err == nil
+	}
+	return within(f.prefix, path.Clean(name))
+}
@@ -0,0 +1,290 @@
+package basefs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestPath(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+	bfs, err := basefs.NewFS(ofs, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name string
+		Path string
+	}{
+		{"/", base},
+		{"", base},
+		{"/a/b", base + "/a/b"},
+		{"a/b", base + "/a/b"},
+		{"/a//b/./c/", base + "/a/b/c"},
+		{"/a/../b", base + "/b"},
+		{"a/..", base},
+		{"./a", base + "/a"},
+		{"/..", ""},
+		{"../x", ""},
+		{"/a/../../x", ""},
+		{"../" + filepath.Base(base) + "x", ""},
+	}
+	for _, test := range tests {
+		p, err := bfs.Path(test.Name)
+		if test.Path == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", test.Name, p)
+			}
+			continue
+		}
+		if err != nil || p != test.Path {
+			t.Errorf("%q: got %q %v, expected %q", test.Name, p, err, test.Path)
+		}
+	}
+}
+
+func TestPathCache(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+	bfs, err := basefs.NewFS(ofs, base, basefs.WithPathCache(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, name := range []string{"/a/b", "a/c", "/a/./b"} {
+			p, err := bfs.Path(name)
+			if err != nil || p != base+"/a/"+filepath.Base(name) {
+				t.Errorf("%q: got %q %v", name, p, err)
+			}
+		}
+		if _, err := bfs.Path("../x"); err == nil {
+			t.Error("expected an error escaping the base")
+		}
+	}
+	if n := bfs.CachedPaths(); n != 2 {
+		t.Errorf("got %d cached paths, expected 2", n)
+	}
+
+	err = bfs.MkdirAll("/a/b", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bfs.RemoveAll("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the translation is lexical, so removing the files doesn't change it
+	if n := bfs.CachedPaths(); n != 2 {
+		t.Errorf("got %d cached paths after removing their parent, expected 2", n)
+	}
+	if p, err := bfs.Path("/a/b"); err != nil || p != base+"/a/b" {
+		t.Errorf("got %q %v", p, err)
+	}
+}
+
+func BenchmarkPath(b *testing.B) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir, err := filepath.Abs(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithPathCache(128))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range []string{"/assets/css/site.css", "assets/css/site.css", "/assets//css/./old/../site.css"} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bfs.Path(name)
+			}
+		})
+		b.Run("cached"+name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cfs.Path(name)
+			}
+		})
+	}
+}
+
+func TestCleanJoinRel(t *testing.T) {
+	bfs := newTestFS(t, nil)
+	if err := bfs.Chdir("/work"); err != nil {
+		t.Fatal(err)
+	}
+
+	clean := []struct {
+		Name string
+		Path string
+	}{
+		{"", "/work"},
+		{"/", "/"},
+		{"a/b", "/a/b"},
+		{"/a//b/./c/", "/a/b/c"},
+		{"/a/../b", "/b"},
+		{"/..", ""},
+		{"a/../../x", ""},
+	}
+	for _, test := range clean {
+		p, err := bfs.Clean(test.Name)
+		if test.Path == "" {
+			if err == nil {
+				t.Errorf("Clean(%q): expected an error, got %q", test.Name, p)
+			}
+			continue
+		}
+		if err != nil || p != test.Path {
+			t.Errorf("Clean(%q): got %q %v, expected %q", test.Name, p, err, test.Path)
+		}
+	}
+
+	if p, err := bfs.Join("a", "", "b/c", "../d"); err != nil || p != "/a/b/d" {
+		t.Errorf("Join: got %q %v", p, err)
+	}
+	if p, err := bfs.Join("/a", "../.."); err == nil {
+		t.Errorf("Join: expected an error climbing above the root, got %q", p)
+	}
+
+	rel := []struct {
+		Base, Target, Rel string
+	}{
+		{"/a/b", "/a/b", "."},
+		{"/a/b", "/a/b/c", "c"},
+		{"/a/b", "/a/c/d", "../c/d"},
+		{"/", "/a", "a"},
+		{"/a/b", "/", "../.."},
+	}
+	for _, test := range rel {
+		p, err := bfs.Rel(test.Base, test.Target)
+		if err != nil || p != test.Rel {
+			t.Errorf("Rel(%q, %q): got %q %v, expected %q", test.Base, test.Target, p, err, test.Rel)
+		}
+	}
+}
+
+func TestSecureJoin(t *testing.T) {
+	tests := []struct {
+		Unsafe, Path string
+	}{
+		{"a/b", "/base/a/b"},
+		{"/a/../b", "/base/b"},
+		{"", "/base"},
+		{"..", ""},
+		{"a/../../etc", ""},
+	}
+	for _, test := range tests {
+		p, err := basefs.SecureJoin("/base", test.Unsafe)
+		if test.Path == "" {
+			if !errors.Is(err, basefs.ErrOutsideBase) {
+				t.Errorf("%q: expected ErrOutsideBase, got %q %v", test.Unsafe, p, err)
+			}
+			continue
+		}
+		if err != nil || p != test.Path {
+			t.Errorf("%q: got %q %v, expected %q", test.Unsafe, p, err, test.Path)
+		}
+	}
+
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"rel":    "a/b",
+		"abs":    base + "/a",
+		"up":     "../..",
+		"out":    "/etc",
+		"a/loop": "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(filepath.FromSlash(target), filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	fsTests := []struct {
+		Unsafe, Path string
+	}{
+		{"rel/c", base + "/a/b/c"},
+		{"abs/b", base + "/a/b"},
+		{"rel/../x", base + "/a/x"},
+		{"missing/../a", base + "/a"},
+		{"up", ""},
+		{"out", ""},
+		{"a/loop", ""},
+	}
+	for _, test := range fsTests {
+		p, err := basefs.SecureJoinFS(ofs, base, test.Unsafe)
+		if test.Path == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", test.Unsafe, p)
+			}
+			continue
+		}
+		if err != nil || p != test.Path {
+			t.Errorf("%q: got %q %v, expected %q", test.Unsafe, p, err, test.Path)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	bfs := newTestFS(t, nil)
+	base := basefs.Prefix(bfs)
+
+	tests := []struct {
+		Name     string
+		Contains bool
+	}{
+		{base, true},
+		{base + "/a/b", true},
+		{base + "/a/../../x", false},
+		{base + "x", false},
+		{"/etc/passwd", false},
+		{"a/b", true},
+		{"a/../..", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := bfs.Contains(test.Name); got != test.Contains {
+			t.Errorf("%q: got %v, expected %v", test.Name, got, test.Contains)
+		}
+	}
+}
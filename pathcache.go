@@ -0,0 +1,62 @@
+package basefs
+
+import (
+	"container/list"
+	"os"
+	"sync"
+)
+
+// WithPathCache remembers the translation of up to `size` recently used
+// names into paths on the underlying filesystem, so that names which are
+// used repeatedly are not cleaned and joined every time. The translation is
+// lexical and doesn't depend on the files on the underlying filesystem, so
+// the entries stay valid when files are removed or renamed.
+func WithPathCache(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return os.ErrInvalid
+		}
+		o.paths = &pathCache{size: size, entries: make(map[string]*list.Element)}
+		return nil
+	}
+}
+
+// pathCache is a bounded LRU cache of names and their paths on the
+// underlying filesystem.
+type pathCache struct {
+	mu      sync.Mutex
+	size    int
+	order   list.List
+	entries map[string]*list.Element
+}
+
+type pathEntry struct {
+	name  string
+	ppath string
+}
+
+func (c *pathCache) get(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*pathEntry).ppath, true
+}
+
+func (c *pathCache) put(name, ppath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[name] = c.order.PushFront(&pathEntry{name, ppath})
+	if c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*pathEntry).name)
+	}
+}
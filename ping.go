@@ -0,0 +1,87 @@
+package basefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/absfs/absfs"
+)
+
+// PingOption configures Ping.
+type PingOption func(*pingOptions)
+
+type pingOptions struct {
+	write bool
+}
+
+// ProbeWrite makes Ping also create and remove a probe file in the base, to
+// verify that the filesystem is writable.
+func ProbeWrite() PingOption {
+	return func(o *pingOptions) {
+		o.write = true
+	}
+}
+
+// Ping verifies that the base directory is still reachable on the underlying
+// filesystem. It returns ctx.Err() if `ctx` is done before the check
+// completes, which may keep running in the background if the underlying
+// filesystem does not respond.
+func (f *FileSystem) Ping(ctx context.Context, opts ...PingOption) error {
+	return ping(ctx, f.fs, f.prefix, opts)
+}
+
+func ping(ctx context.Context, fs absfs.FileSystem, prefix string, opts []PingOption) error {
+	var o pingOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- probe(fs, prefix, o.write)
+	}()
+	select {
+	case err := <-done:
+		var perr *os.PathError
+		if errors.As(err, &perr) {
+			// the path on the underlying filesystem is not exposed
+			err = perr.Err
+		}
+		if err != nil {
+			return &os.PathError{Op: "ping", Path: "/", Err: err}
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// probe checks the base directory `dir` and, if `write` is set, creates and
+// removes a file in it.
+func probe(fs absfs.FileSystem, dir string, write bool) error {
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "stat", Path: dir, Err: errors.New("not a directory")}
+	}
+	if !write {
+		return nil
+	}
+	name := path.Join(dir, ".basefs-ping-"+randomName())
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err1 := fs.Remove(name); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package basefs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// WithReadOnly makes every operation which would change the filesystem fail
+// with EROFS.
+func WithReadOnly() Option {
+	return func(o *options) error {
+		o.readOnly = true
+		return nil
+	}
+}
+
+// WithAllow restricts access to virtual paths matching at least one of the
+// glob patterns, in the syntax understood by Watch's Include, and to the files
+// below them. Directories on the way to such paths remain accessible so they
+// can be reached. Other paths fail with a permission error.
+func WithAllow(patterns ...string) Option {
+	return func(o *options) error {
+		for _, pattern := range patterns {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+		// Clones share the slice with the filesystem they were made from.
+		o.allow = append(o.allow[:len(o.allow):len(o.allow)], patterns...)
+		return nil
+	}
+}
+
+// WithDeny makes virtual paths matching any of the glob patterns, and the files
+// below them, fail with a permission error. Denied files are still listed in
+// their directories. WithDeny takes precedence over WithAllow.
+func WithDeny(patterns ...string) Option {
+	return func(o *options) error {
+		for _, pattern := range patterns {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.deny = append(o.deny[:len(o.deny):len(o.deny)], patterns...)
+		return nil
+	}
+}
+
+// PathValidator checks the names used with a filesystem. ValidatePath is
+// called with the clean absolute virtual path of every name passed to the
+// filesystem before the underlying filesystem is accessed, and the operation
+// fails with its error.
+type PathValidator interface {
+	ValidatePath(name string) error
+}
+
+// PathValidatorFunc adapts a function to the PathValidator interface.
+type PathValidatorFunc func(name string) error
+
+// ValidatePath calls v(name).
+func (v PathValidatorFunc) ValidatePath(name string) error {
+	return v(name)
+}
+
+// WithValidator checks every name with `v`, after the checks of any
+// validators given before.
+func WithValidator(v PathValidator) Option {
+	return func(o *options) error {
+		o.validators = append(o.validators[:len(o.validators):len(o.validators)], v)
+		return nil
+	}
+}
+
+// WithPathRewriter passes every name to `rw`, as a clean absolute virtual
+// path, and uses the path it returns instead, e.g. to map a legacy layout to
+// a new one. The result is cleaned again, and checked by validators, WithAllow
+// and WithDeny like any other name. Rewriters are applied in the order given.
+func WithPathRewriter(rw func(string) string) Option {
+	return func(o *options) error {
+		o.rewriters = append(o.rewriters[:len(o.rewriters):len(o.rewriters)], rw)
+		return nil
+	}
+}
+
+// rewrite applies the path rewriters and aliases to the virtual path `name`.
+func (o *options) rewrite(name string) (string, error) {
+	for _, rw := range o.rewriters {
+		p, ok := join("/", name)
+		if !ok {
+			return "", errEscape(name)
+		}
+		name = rw(p)
+	}
+	if o.aliases.n.Load() > 0 {
+		p, ok := join("/", name)
+		if !ok {
+			return "", errEscape(name)
+		}
+		name = o.aliases.resolve(p)
+	}
+	return name, nil
+}
+
+// restricted reports whether access is limited by WithAllow, WithDeny or
+// WithValidator.
+func (o *options) restricted() bool {
+	return len(o.allow) > 0 || len(o.deny) > 0 || len(o.validators) > 0 || o.hidden.n.Load() > 0
+}
+
+// permit checks whether `ppath` on the underlying filesystem may be accessed.
+func (o *options) permit(ppath string) error {
+	name := vpath(o.base, ppath)
+	if o.hidden.covers(name) {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	for _, v := range o.validators {
+		if err := v.ValidatePath(name); err != nil {
+			return &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if below(o.deny, name) || len(o.allow) > 0 && !below(o.allow, name) && !above(o.allow, name) {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+// modify checks whether `ppath` on the underlying filesystem may be changed by
+// the operation `op`.
+func (o *options) modify(op, ppath string) error {
+	if o.readOnly {
+		return &os.PathError{Op: op, Path: vpath(o.base, ppath), Err: syscall.EROFS}
+	}
+	if b := o.binds.get(ppath); b != nil {
+		return b.check(op, vpath(o.base, ppath))
+	}
+	if len(o.subtrees) > 0 {
+		return o.checkSubtrees(op, ppath)
+	}
+	return nil
+}
+
+// below reports whether the virtual path `name` or one of its parent
+// directories matches any of `patterns`.
+func below(patterns []string, name string) bool {
+	for {
+		if matchAny(patterns, name) {
+			return true
+		}
+		if name == "/" {
+			return false
+		}
+		name = path.Dir(name)
+	}
+}
+
+// above reports whether the virtual path `name` may be a parent directory of
+// paths matching any of `patterns`.
+func above(patterns []string, name string) bool {
+	if name == "/" {
+		return true
+	}
+	parts := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			return true
+		}
+		if matchPrefix(strings.Split(pattern, "/"), parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether the path elements `name` may be the leading
+// elements of a path matching `pattern`.
+func matchPrefix(pattern, name []string) bool {
+	for ; len(name) > 0; pattern, name = pattern[1:], name[1:] {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRegularFilesOnly makes opening anything but regular files and
+// directories, such as devices, sockets or named pipes placed in the base by
+// other writers, fail with a permission error. Files are checked before they
+// are opened, so that opening a named pipe does not block.
+func WithRegularFilesOnly() Option {
+	return func(o *options) error {
+		o.regularOnly = true
+		return nil
+	}
+}
+
+// WithNoExec removes the executable bits from the permissions of regular
+// files when they are created, written to or changed with Chmod or SetAttrs.
+// Directories keep theirs, as they are needed to access their entries.
+func WithNoExec() Option {
+	return func(o *options) error {
+		o.noExec = true
+		return nil
+	}
+}
+
+// checkKind fails with a permission error if `ppath` on the underlying
+// filesystem `fs` exists and is neither a regular file nor a directory.
+func (o *options) checkKind(fs absfs.FileSystem, ppath string) error {
+	info, err := fs.Stat(ppath)
+	if err != nil || info.Mode().IsRegular() || info.IsDir() {
+		return nil
+	}
+	return &os.PathError{Op: "open", Path: vpath(o.base, ppath), Err: os.ErrPermission}
+}
+
+// stripExec removes the executable bits of the regular file `ppath` on the
+// underlying filesystem `fs`.
+func (o *options) stripExec(fs absfs.FileSystem, ppath string) error {
+	info, err := fs.Stat(ppath)
+	if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+		return err
+	}
+	return fs.Chmod(ppath, info.Mode().Perm()&^0111)
+}
+
+// execMode returns `mode` without its executable bits if WithNoExec is set
+// and `ppath` on the underlying filesystem `fs` is not a directory.
+func (o *options) execMode(fs absfs.FileSystem, ppath string, mode os.FileMode) os.FileMode {
+	if !o.noExec {
+		return mode
+	}
+	if info, err := fs.Stat(ppath); err == nil && info.IsDir() {
+		return mode
+	}
+	return mode &^ 0111
+}
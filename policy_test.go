@@ -0,0 +1,736 @@
+package basefs_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestValidator(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errLong := errors.New("name too long")
+	errUpper := errors.New("upper case name")
+	var seen []string
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir),
+		basefs.WithValidator(basefs.PathValidatorFunc(func(name string) error {
+			seen = append(seen, name)
+			if utf8.RuneCountInString(name) > 10 {
+				return errLong
+			}
+			return nil
+		})),
+		basefs.WithValidator(basefs.PathValidatorFunc(func(name string) error {
+			if strings.ToLower(name) != name {
+				return errUpper
+			}
+			return nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name string
+		Err  error
+	}{
+		{"/ok", nil},
+		{"./b/../c", nil},
+		{"/much/too/long", errLong},
+		{"/Upper", errUpper},
+	}
+	for _, test := range tests {
+		err := bfs.WriteFile(test.Name, nil, 0644)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("%s: got %v, expected %v", test.Name, err, test.Err)
+		}
+	}
+	if !strings.Contains(strings.Join(seen, " "), " /c ") {
+		t.Errorf("expected the validator to see the clean path /c, got %q", seen)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Upper")); !os.IsNotExist(err) {
+		t.Errorf("expected /Upper not to be created, got %v", err)
+	}
+}
+
+func TestPathRewriter(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir),
+		basefs.WithPathRewriter(strings.ToLower),
+		basefs.WithPathRewriter(func(name string) string {
+			if rest, ok := strings.CutPrefix(name, "/legacy/"); ok {
+				return "/v2/" + rest
+			}
+			return name
+		}),
+		basefs.WithDeny("/secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MkdirAll("/V2", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/Legacy/./File.TXT", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "v2", "file.txt")); err != nil {
+		t.Errorf("expected the file to be written to /v2/file.txt: %v", err)
+	}
+	if _, err := bfs.Stat("/SECRET"); !os.IsPermission(err) {
+		t.Errorf("expected rewritten names to be checked, got %v", err)
+	}
+	if _, err := bfs.Stat("/a/../../x"); err == nil {
+		t.Error("expected an error for a name escaping the base")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"a.txt": "data", "d/": ""})
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := bfs.ReadFile("/a.txt"); err != nil || string(data) != "data" {
+		t.Errorf("read %q %v", data, err)
+	}
+	for op, fn := range map[string]func() error{
+		"write":  func() error { return bfs.WriteFile("/b.txt", nil, 0644) },
+		"mkdir":  func() error { return bfs.Mkdir("/e", 0755) },
+		"remove": func() error { return bfs.Remove("/a.txt") },
+		"rename": func() error { return bfs.Rename("/a.txt", "/d/a.txt") },
+		"chmod":  func() error { return bfs.Chmod("/a.txt", 0600) },
+	} {
+		if err := fn(); !errors.Is(err, syscall.EROFS) {
+			t.Errorf("%s: expected EROFS, got %v", op, err)
+		}
+	}
+	if _, err := bfs.OpenFile("/a.txt", os.O_RDWR, 0); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected opening for writing to fail with EROFS, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllowDeny(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{
+		"public/a.txt":        "a",
+		"public/secret/b.txt": "b",
+		"public/c.key":        "c",
+		"private/d.txt":       "d",
+	})
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir),
+		basefs.WithAllow("/public"),
+		basefs.WithDeny("/public/secret", "*.key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name string
+		Ok   bool
+	}{
+		{"/", true},
+		{"/public", true},
+		{"/public/a.txt", true},
+		{"/public/secret", false},
+		{"/public/secret/b.txt", false},
+		{"/public/c.key", false},
+		{"/private", false},
+		{"/private/d.txt", false},
+	}
+	for _, test := range tests {
+		_, err := bfs.Stat(test.Name)
+		if test.Ok && err != nil || !test.Ok && !os.IsPermission(err) {
+			t.Errorf("%s: got %v", test.Name, err)
+		}
+	}
+	if err := bfs.WriteFile("/private/e.txt", nil, 0644); !os.IsPermission(err) {
+		t.Errorf("expected writing outside the allowed paths to fail, got %v", err)
+	}
+	names, err := bfs.ReadDir("/public")
+	if err != nil || len(names) != 3 {
+		t.Errorf("expected denied files to be listed, got %v %v", names, err)
+	}
+
+	for _, opt := range []basefs.Option{basefs.WithAllow("["), basefs.WithDeny("/a/[")} {
+		if _, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), opt); err == nil {
+			t.Error("expected an error for an invalid pattern")
+		}
+	}
+}
+
+func TestAlias(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/releases/1/version": "1",
+		"/releases/2/version": "2",
+	})
+	if err := bfs.Alias("/current", "/releases/1"); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		data, err := bfs.ReadFile(name)
+		if err != nil {
+			return err.Error()
+		}
+		return string(data)
+	}
+	if v := read("/current/version"); v != "1" {
+		t.Errorf("got %q", v)
+	}
+	if err := bfs.Alias("current", "releases/2/"); err != nil {
+		t.Fatal(err)
+	}
+	if v := read("current/./version"); v != "2" {
+		t.Errorf("got %q after changing the alias", v)
+	}
+	if v := read("/currentx/version"); !strings.Contains(v, "no such file") {
+		t.Errorf("expected only whole elements to match, got %q", v)
+	}
+
+	clone, err := bfs.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Alias("/current", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/current"); !os.IsNotExist(err) {
+		t.Errorf("expected the alias to be removed, got %v", err)
+	}
+	if _, err := clone.Stat("/current/version"); err != nil {
+		t.Errorf("expected the clone to keep the alias: %v", err)
+	}
+
+	if err := bfs.Alias("/", "/releases"); err == nil {
+		t.Error("expected an error aliasing the root")
+	}
+	if err := bfs.Alias("/escape", "/.."); err == nil {
+		t.Error("expected an error for a target outside the base")
+	}
+	if err := bfs.Alias("/up", "/releases"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/up/../../x"); err == nil {
+		t.Error("expected an error climbing above the root through an alias")
+	}
+}
+
+func TestBindFile(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	if err := os.WriteFile(filepath.Join(dir, "app.conf"), []byte("debug=0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "state"), []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bfs := newTestFS(t, map[string]string{"/etc/hosts": "localhost"})
+	if err := bfs.BindFile("/etc/app.conf", ofs, dir+"/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.BindFile("/var/state", ofs, dir+"/state", basefs.BindWritable()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.BindFile("/etc/dir", ofs, dir); err == nil {
+		t.Error("expected an error binding a directory")
+	}
+
+	data, err := bfs.ReadFile("/etc/app.conf")
+	if err != nil || string(data) != "debug=0" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	info, err := bfs.Stat("/etc/app.conf")
+	if err != nil || info.Name() != "app.conf" || info.Size() != 7 {
+		t.Fatalf("got %v, %v", info, err)
+	}
+	if err := bfs.WriteFile("/etc/app.conf", []byte("debug=1"), 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS writing a read only binding, got %v", err)
+	}
+	if err := bfs.Chmod("/etc/app.conf", 0600); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS changing a read only binding, got %v", err)
+	}
+	if err := bfs.Remove("/etc/app.conf"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("expected EBUSY removing a binding, got %v", err)
+	}
+	if err := bfs.Rename("/etc/app.conf", "/etc/old.conf"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("expected EBUSY renaming a binding, got %v", err)
+	}
+
+	if err := bfs.WriteFile("/var/state", []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "state")); string(data) != "1" {
+		t.Errorf("expected the bound file to be written, got %q", data)
+	}
+	f, err := bfs.OpenFile("/var/state", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "/var/state" {
+		t.Errorf("got name %q", f.Name())
+	}
+	f.Close()
+	if _, err := bfs.Stat("/var/app.conf"); !os.IsNotExist(err) {
+		t.Errorf("expected the backing directory to stay hidden, got %v", err)
+	}
+
+	if err := bfs.Unbind("/etc/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/etc/app.conf"); !os.IsNotExist(err) {
+		t.Errorf("expected the binding to be removed, got %v", err)
+	}
+	if err := bfs.Unbind("/etc/app.conf"); err == nil {
+		t.Error("expected an error removing a missing binding")
+	}
+}
+
+func TestHide(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/.git/config":     "x",
+		"/src/.git/HEAD":   "x",
+		"/src/main.go":     "x",
+		"/internal/state":  "x",
+		"/internal2/state": "x",
+	})
+	if err := bfs.Hide("**/.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Hide("/internal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Hide("[x"); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+
+	for _, name := range []string{"/.git", "/src/.git/HEAD", "/internal/state", "/internal/new"} {
+		if _, err := bfs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected ENOENT, got %v", name, err)
+		}
+	}
+	if _, err := bfs.Create("/internal/new"); !os.IsNotExist(err) {
+		t.Errorf("expected creating a hidden file to fail with ENOENT, got %v", err)
+	}
+	if _, err := bfs.Stat("/internal2/state"); err != nil {
+		t.Error(err)
+	}
+
+	names := func(dir string) string {
+		entries, err := bfs.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return strings.Join(names, " ")
+	}
+	if got := names("/"); got != "internal2 src" {
+		t.Errorf("got %q", got)
+	}
+	if got := names("/src"); got != "main.go" {
+		t.Errorf("got %q", got)
+	}
+
+	f, err := bfs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var read []string
+	for {
+		batch, err := f.Readdirnames(1)
+		if err != nil {
+			break
+		}
+		read = append(read, batch...)
+	}
+	if len(read) != 2 {
+		t.Errorf("expected 2 names reading one at a time, got %v", read)
+	}
+
+	var walked []string
+	err = bfs.Walk("/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(walked, " "); got != "/ /internal2 /internal2/state /src /src/main.go" {
+		t.Errorf("walked %q", got)
+	}
+}
+
+func TestRegisterVirtual(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/run/status.json": "stale",
+		"/run/pid":         "1",
+	})
+	calls := 0
+	err := bfs.RegisterVirtual("/run/status.json", func() ([]byte, error) {
+		calls++
+		return []byte(`{"ok":true}`), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errDown := errors.New("down")
+	err = bfs.RegisterVirtual("/health", func() ([]byte, error) {
+		return nil, errDown
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := bfs.ReadFile("/run/status.json")
+	if err != nil || string(data) != `{"ok":true}` {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	info, err := bfs.Stat("/run/status.json")
+	if err != nil || info.Size() != 11 || info.Mode() != 0444 {
+		t.Fatalf("got %v, %v", info, err)
+	}
+	if _, err := bfs.ReadFile("/health"); !errors.Is(err, errDown) {
+		t.Errorf("expected the error of the generator, got %v", err)
+	}
+	if err := bfs.WriteFile("/run/status.json", nil, 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+	if err := bfs.Remove("/run/status.json"); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+
+	entries, err := bfs.ReadDir("/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != "pid status.json" {
+		t.Errorf("got %q", got)
+	}
+	if calls < 3 {
+		t.Errorf("expected the contents to be generated on each access, got %d calls", calls)
+	}
+
+	if err := bfs.RegisterVirtual("/run/status.json", nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := bfs.ReadFile("/run/status.json"); string(data) != "stale" {
+		t.Errorf("expected the file to be visible again, got %q", data)
+	}
+}
+
+func TestMountReadOnly(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "img", "logo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("css"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bfs := newTestFS(t, map[string]string{"/app/main.go": "x"})
+	if err := bfs.MountReadOnly("/app/assets", ofs, filepath.ToSlash(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.MountReadOnly("/app/css", ofs, filepath.ToSlash(dir)+"/style.css"); err == nil {
+		t.Error("expected an error mounting a file")
+	}
+
+	data, err := bfs.ReadFile("/app/assets/img/logo.png")
+	if err != nil || string(data) != "png" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	info, err := bfs.Stat("/app/assets")
+	if err != nil || !info.IsDir() || info.Name() != "assets" {
+		t.Fatalf("got %v, %v", info, err)
+	}
+
+	var walked []string
+	err = bfs.Walk("/app/assets", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(walked, " "); got != "/app/assets /app/assets/img /app/assets/img/logo.png /app/assets/style.css" {
+		t.Errorf("walked %q", got)
+	}
+
+	for name, err := range map[string]error{
+		"write":  bfs.WriteFile("/app/assets/style.css", nil, 0644),
+		"create": bfs.WriteFile("/app/assets/new.css", nil, 0644),
+		"mkdir":  bfs.Mkdir("/app/assets/fonts", 0755),
+		"remove": bfs.RemoveAll("/app/assets/img"),
+		"rename": bfs.Rename("/app/assets/style.css", "/app/style.css"),
+		"chmod":  bfs.Chmod("/app/assets/style.css", 0600),
+	} {
+		if !errors.Is(err, syscall.EROFS) {
+			t.Errorf("%s: expected EROFS, got %v", name, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "style.css")); string(data) != "css" {
+		t.Errorf("expected the mounted file to be unchanged, got %q", data)
+	}
+	if _, err := bfs.Stat("/app/assets/../assets/../main.go"); err != nil {
+		t.Errorf("expected paths out of the mount to refer to the base: %v", err)
+	}
+
+	if err := bfs.Unbind("/app/assets/img"); err == nil {
+		t.Error("expected an error unbinding a path below a mount")
+	}
+	if err := bfs.Unbind("/app/assets"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/app/assets/style.css"); !os.IsNotExist(err) {
+		t.Errorf("expected the mount to be removed, got %v", err)
+	}
+}
+
+func TestSubtreePolicy(t *testing.T) {
+	base := newTestFS(t, map[string]string{
+		"/config/app.conf":  "x",
+		"/uploads/a":        "12345",
+		"/scratch/old":      "x",
+		"/scratch/sub/new":  "x",
+		"/scratch/sub/old2": "x",
+	})
+	bfs, err := base.Clone(
+		basefs.WithSubtreePolicy("/config", basefs.SubtreePolicy{ReadOnly: true}),
+		basefs.WithSubtreePolicy("uploads", basefs.SubtreePolicy{Quota: 8}),
+		basefs.WithSubtreePolicy("/scratch", basefs.SubtreePolicy{CleanAfter: basefs.Duration(time.Hour)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Clone(basefs.WithSubtreePolicy("/x", basefs.SubtreePolicy{ReadOnly: true, CleanAfter: 1})); err == nil {
+		t.Error("expected an error for a read only subtree to be cleaned")
+	}
+
+	if err := bfs.WriteFile("/config/app.conf", []byte("y"), 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+	if err := bfs.Rename("/config", "/config2"); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS renaming the subtree, got %v", err)
+	}
+	if err := bfs.WriteFile("/app.conf", []byte("y"), 0644); err != nil {
+		t.Errorf("expected files outside the subtree to be writable: %v", err)
+	}
+
+	if err := bfs.WriteFile("/uploads/b", []byte("123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/uploads/c", []byte("123"), 0644); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the subtree quota to be exceeded, got %v", err)
+	}
+	if err := bfs.WriteFile("/big", []byte("1234567890"), 0644); err != nil {
+		t.Errorf("expected the quota to apply to the subtree only: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"/scratch/old", "/scratch/sub/old2"} {
+		if err := bfs.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bfs.CleanTemp(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for name, exists := range map[string]bool{"/scratch/old": false, "/scratch/sub/old2": false, "/scratch/sub/new": true} {
+		if _, err := bfs.Stat(name); (err == nil) != exists {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	c := bfs.Config()
+	if p := c.Subtrees["/uploads"]; p.Quota != 8 {
+		t.Errorf("got config %+v", c.Subtrees)
+	}
+}
+
+func TestSubtreeUsage(t *testing.T) {
+	base := newTestFS(t, map[string]string{
+		"/projects/a/x":     "123",
+		"/projects/a/sub/y": "45",
+		"/projects/b/z":     "6",
+	})
+	bfs, err := base.Clone(basefs.WithSubtreePolicy("/projects/a", basefs.SubtreePolicy{Quota: 100, MaxFiles: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := bfs.Usage("/projects/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != (basefs.Usage{Bytes: 5, Files: 2, Quota: 100, MaxFiles: 3}) {
+		t.Errorf("got %+v", u)
+	}
+	if u, err := bfs.Usage("/"); err != nil || u.Bytes != 6 || u.Files != 3 || u.Quota != 0 {
+		t.Errorf("got %+v, %v", u, err)
+	}
+
+	if err := bfs.WriteFile("/projects/a/w", []byte("7"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile("/projects/a/v", []byte("8"), 0644); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the file limit to be exceeded, got %v", err)
+	}
+	if _, err := bfs.Stat("/projects/a/v"); !os.IsNotExist(err) {
+		t.Errorf("expected the rejected file to be removed, got %v", err)
+	}
+	if err := bfs.WriteFile("/projects/b/v", []byte("8"), 0644); err != nil {
+		t.Errorf("expected other subtrees to be unlimited: %v", err)
+	}
+
+	if err := bfs.Rename("/projects/a/sub", "/projects/b/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := bfs.Usage("/projects/a"); err != nil || u.Bytes != 4 || u.Files != 2 {
+		t.Errorf("got %+v, %v after moving files out of the subtree", u, err)
+	}
+	f, err := bfs.Create("/projects/a/v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, 97)); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the subtree quota to be exceeded, got %v", err)
+	}
+	if _, err := f.Write(make([]byte, 96)); err != nil {
+		t.Error(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := bfs.Usage("/projects/a"); err != nil || u.Bytes != 100 || u.Files != 3 {
+		t.Errorf("got %+v, %v", u, err)
+	}
+}
+
+func TestRegularFilesOnly(t *testing.T) {
+	base := newTestFS(t, map[string]string{"/file": "x"})
+	bfs, err := base.Clone(basefs.WithRegularFilesOnly(), basefs.WithNoExec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(basefs.Prefix(base), "sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	if _, err := bfs.Open("/sock"); !os.IsPermission(err) {
+		t.Errorf("expected opening a socket to fail, got %v", err)
+	}
+	if _, err := base.Open("/sock"); os.IsPermission(err) {
+		t.Errorf("expected the option to apply to the clone only, got %v", err)
+	}
+	if _, err := bfs.ReadFile("/file"); err != nil {
+		t.Error(err)
+	}
+	if _, err := bfs.ReadDir("/"); err != nil {
+		t.Error(err)
+	}
+
+	mode := func(name string) os.FileMode {
+		info, err := bfs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+	if err := bfs.WriteFile("/run.sh", []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if m := mode("/run.sh"); m&0111 != 0 {
+		t.Errorf("expected the executable bits to be removed, got %v", m)
+	}
+	if err := bfs.Chmod("/file", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if m := mode("/file"); m != 0644 {
+		t.Errorf("got %v after chmod", m)
+	}
+	if err := bfs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Chmod("/dir", 0750); err != nil {
+		t.Fatal(err)
+	}
+	if m := mode("/dir"); m != 0750 {
+		t.Errorf("expected directories to keep their executable bits, got %v", m)
+	}
+}
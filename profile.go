@@ -0,0 +1,136 @@
+package basefs
+
+import (
+	"context"
+	"os"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// WithProfileLabels labels the goroutines running operations of the
+// filesystem, like Open, Stat, Rename and the reads and writes of its files,
+// with runtime/pprof labels for the duration of the operation, so that CPU
+// and goroutine profiles attribute the time spent to them. The labels are
+// "basefs.op", the name of the operation, and "basefs.backend", the type of
+// the underlying filesystem, added to the labels of `ctx`, which the
+// goroutine is labeled with again when the operation returns. Since pprof
+// has no way to find the current labels of a goroutine, labels set by the
+// caller in other ways are replaced, so pass the context holding them, e.g.
+// using Clone with the context of a request.
+func WithProfileLabels(ctx context.Context) Option {
+	return func(o *options) error {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		o.profileCtx = ctx
+		return nil
+	}
+}
+
+// WithProfilePaths adds the label "basefs.path", the virtual path the
+// operation is on, to the labels set with WithProfileLabels. Profiles get an
+// entry for every path, so it is meant for debugging rather than continuous
+// profiling.
+func WithProfilePaths() Option {
+	return func(o *options) error {
+		o.profilePaths = true
+		return nil
+	}
+}
+
+// ProfileSample describes an operation sampled with WithProfileHook.
+type ProfileSample struct {
+	// Op is the name of the operation, as in the "basefs.op" label.
+	Op string
+
+	// Path is the virtual path the operation was on.
+	Path string
+
+	// Backend is the type of the underlying filesystem.
+	Backend string
+
+	// Duration is the time the operation took, including the time blocked
+	// in the underlying filesystem.
+	Duration time.Duration
+
+	// Allocated is the number of bytes allocated on the heap by the whole
+	// process while the operation ran, which only approximates the
+	// allocations of the operation when other goroutines are busy.
+	Allocated uint64
+}
+
+// WithProfileHook calls `fn` with a ProfileSample for one in `rate`
+// operations, as labeled with WithProfileLabels, e.g. to feed latency
+// histograms or find operations which allocate a lot. A rate of 1 samples
+// every operation. `fn` runs in the goroutine of the operation, after it
+// returned, and should be fast.
+func WithProfileHook(rate int, fn func(ProfileSample)) Option {
+	return func(o *options) error {
+		if rate < 1 || fn == nil {
+			return os.ErrInvalid
+		}
+		o.profileRate, o.profileHook = uint64(rate), fn
+		o.profileCount = new(atomic.Uint64)
+		return nil
+	}
+}
+
+// done is returned by profile for operations which aren't profiled.
+func done() {}
+
+// profile labels the calling goroutine with the operation `op` on the
+// virtual path `name` until the returned function is called, and samples the
+// operation for the profile hook.
+func (o *options) profile(op, name string) func() {
+	if o.profileCtx == nil && o.profileHook == nil {
+		return done
+	}
+	ctx := o.profileCtx
+	if ctx != nil {
+		labels := []string{"basefs.op", op, "basefs.backend", o.backend}
+		if o.profilePaths {
+			labels = append(labels, "basefs.path", name)
+		}
+		pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels(labels...)))
+	}
+	sampled := o.profileHook != nil && o.profileCount.Add(1)%o.profileRate == 0
+	var start time.Time
+	var allocated uint64
+	if sampled {
+		start, allocated = time.Now(), heapAllocated()
+	}
+	return func() {
+		if ctx != nil {
+			pprof.SetGoroutineLabels(ctx)
+		}
+		if sampled {
+			o.profileHook(ProfileSample{
+				Op:        op,
+				Path:      name,
+				Backend:   o.backend,
+				Duration:  time.Since(start),
+				Allocated: heapAllocated() - allocated,
+			})
+		}
+	}
+}
+
+// profile profiles the operation `op` on the file.
+func (f *File) profile(op string) func() {
+	if f.opts.profileCtx == nil && f.opts.profileHook == nil {
+		return done
+	}
+	return f.opts.profile(op, f.Name())
+}
+
+// heapAllocated returns the number of bytes allocated on the heap so far.
+func heapAllocated() uint64 {
+	s := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s[0].Value.Uint64()
+}
@@ -0,0 +1,213 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrQuotaExceeded is returned when a write would take the total size of the
+// files below the base over the configured quota, or the size or number of
+// the files of a subtree over the limits of its SubtreePolicy.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// WithQuota limits the total size of the regular files below the base to
+// `bytes`. The usage is counted by walking the base once, when it is first
+// needed, and then kept up to date as files are written, truncated, removed
+// and renamed through the filesystem, so that a write, truncation or
+// WriteFile which would take it over the quota fails with an *os.PathError
+// wrapping ErrQuotaExceeded before any of its bytes are written. Changes made
+// to the underlying filesystem directly are only noticed for the files which
+// are later written to: such a file is checked again when it is closed, and
+// if the usage is over the quota it is removed, or quarantined, and Close
+// returns an *os.PathError with Op "quota". The quota also determines the
+// numbers reported by StatFS.
+func WithQuota(bytes int64) Option {
+	return func(o *options) error {
+		if bytes <= 0 {
+			return os.ErrInvalid
+		}
+		o.quota = bytes
+		return nil
+	}
+}
+
+// Usage is the storage used below a directory, see FileSystem.Usage.
+type Usage struct {
+	// Bytes is the total size and Files the number of the regular files.
+	Bytes int64
+	Files int64
+
+	// Quota and MaxFiles are the limits of the directory, from WithQuota for
+	// the root and from its policy for a subtree, or zero if not limited.
+	Quota    int64
+	MaxFiles int64
+}
+
+// Usage returns the storage used by the regular files below the virtual
+// directory `dir`, along with its limits, e.g. to bill storage per subtree.
+func (f *FileSystem) Usage(dir string) (Usage, error) {
+	ppath, err := f.path(dir)
+	if err != nil {
+		return Usage{}, err
+	}
+	if _, err := f.fs.Stat(ppath); err != nil {
+		return Usage{}, f.fixerr(err)
+	}
+	var quota, maxFiles int64
+	name := vpath(f.prefix, ppath)
+	if name == "/" {
+		quota = f.opts.quota
+	}
+	for _, s := range f.opts.subtrees {
+		if s.dir == name {
+			quota, maxFiles = s.Quota, s.MaxFiles
+		}
+	}
+	u, err := f.opts.counter.usage(f.opts, f.fs, ppath, quota > 0 || maxFiles > 0)
+	if err != nil {
+		return Usage{}, f.fixerr(err)
+	}
+	u.Quota, u.MaxFiles = quota, maxFiles
+	return u, nil
+}
+
+// limits returns the limits on the usage of the directories below the base.
+func (o *options) limits() []limit {
+	var limits []limit
+	if o.quota > 0 {
+		limits = append(limits, limit{dir: o.base, bytes: o.quota})
+	}
+	for _, s := range o.subtrees {
+		if s.Quota > 0 || s.MaxFiles > 0 {
+			dir, _ := join(o.base, s.dir)
+			limits = append(limits, limit{dir: dir, bytes: s.Quota, files: s.MaxFiles})
+		}
+	}
+	return limits
+}
+
+// admit prepares the counting of the writes to the file at `ppath`, which is
+// about to be opened with `flags`, and counts the file if it may be created,
+// failing with ErrQuotaExceeded if a directory can't hold another file. It
+// reports whether the file was counted.
+func (o *options) admit(fs absfs.FileSystem, ppath string, flags int) (bool, error) {
+	limits := o.limits()
+	if limits == nil || flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return false, nil
+	}
+	return o.counter.admit(o, fs, ppath, flags&os.O_CREATE != 0, limits)
+}
+
+// grow counts `delta` more bytes of the file at `ppath` before they are
+// written, failing with ErrQuotaExceeded if they would take a directory over
+// its limits.
+func (o *options) grow(fs absfs.FileSystem, ppath string, delta int64) error {
+	limits := o.limits()
+	if limits == nil {
+		return nil
+	}
+	return o.counter.grow(o, fs, ppath, delta, limits)
+}
+
+// resize counts the file at `ppath` with the size `size` before it is
+// truncated, failing like grow.
+func (o *options) resize(fs absfs.FileSystem, ppath string, size int64) error {
+	limits := o.limits()
+	if limits == nil {
+		return nil
+	}
+	return o.counter.resize(o, fs, ppath, size, limits)
+}
+
+// settle counts the file at `ppath` with its actual size, if the usage is
+// counted.
+func (o *options) settle(fs absfs.FileSystem, ppath string) {
+	if !o.counter.active() {
+		return
+	}
+	info, err := fs.Stat(ppath)
+	switch {
+	case os.IsNotExist(err):
+		o.counter.update(o.base, "remove", ppath, "")
+	case err == nil && info.Mode().IsRegular():
+		o.counter.set(ppath, o.stat(ppath, info).Size())
+	}
+}
+
+// checkUsage counts the file at `ppath` after it was written to with its
+// actual size and rejects it if its directory is over its limits, which
+// happens if the file or others were changed on the underlying filesystem
+// directly.
+func (o *options) checkUsage(fs absfs.FileSystem, ppath, name string) error {
+	o.settle(fs, ppath)
+	if !o.counter.over(ppath, o.limits()) {
+		return nil
+	}
+	return o.reject(fs, ppath, name, "quota", ErrQuotaExceeded)
+}
+
+// track starts counting the writes to the file against the quotas, if it was
+// opened for writing and quotas are configured.
+func (f *File) track() {
+	if f.opts.limits() != nil && f.flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.tracked, f.size = true, f.opts.counter.size(f.ppath)
+	}
+}
+
+// claim counts `n` bytes written at the offset `off`, or at the offset of the
+// next write if `off` is negative, against the quotas before they are
+// written. It returns the offset.
+func (f *File) claim(op string, off, n int64) (int64, error) {
+	if !f.tracked {
+		return off, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off < 0 {
+		off = f.off
+		if f.flags&os.O_APPEND != 0 {
+			off = f.size
+		}
+	}
+	if end := off + n; end > f.size {
+		if err := f.opts.grow(f.fs, f.ppath, end-f.size); err != nil {
+			return off, &os.PathError{Op: op, Path: f.name, Err: err}
+		}
+		f.size = end
+	}
+	return off, nil
+}
+
+// resize counts the file with the size `size` before it is truncated.
+func (f *File) resize(op string, size int64) error {
+	if !f.tracked {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.opts.grow(f.fs, f.ppath, size-f.size); err != nil {
+		return &os.PathError{Op: op, Path: f.name, Err: err}
+	}
+	f.size = size
+	return nil
+}
+
+// seeked records the offset of the next write.
+func (f *File) seeked(off int64) {
+	if f.tracked {
+		f.mu.Lock()
+		f.off = off
+		f.mu.Unlock()
+	}
+}
+
+// advance moves the offset of the next write by `n` bytes read.
+func (f *File) advance(n int64) {
+	if f.tracked {
+		f.mu.Lock()
+		f.off += n
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,134 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// WithReadAhead makes files opened read only fetch `size` bytes at a time.
+// Once a file has been read sequentially for a whole block, the following
+// block is read in the background while the current one is consumed, hiding
+// the latency of slow underlying filesystems from streaming readers. Seeking
+// discards the buffered data.
+func WithReadAhead(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return os.ErrInvalid
+		}
+		o.readAhead = size
+		return nil
+	}
+}
+
+// readAhead buffers the data of a file read sequentially. It reads the file
+// with ReadAt only, keeping track of the offset itself.
+type readAhead struct {
+	f    absfs.File
+	size int
+
+	pos    int64  // offset of the next byte returned by Read
+	buf    []byte // data at pos
+	err    error  // error after buf has been consumed
+	streak int    // blocks consumed without seeking
+
+	pending chan block // the block following buf, being read in the background
+	wg      sync.WaitGroup
+}
+
+type block struct {
+	data []byte
+	err  error
+}
+
+func newReadAhead(f absfs.File, size int) *readAhead {
+	return &readAhead{f: f, size: size}
+}
+
+// fetch reads the block at `off`.
+func (r *readAhead) fetch(off int64) block {
+	data := make([]byte, r.size)
+	n, err := r.f.ReadAt(data, off)
+	if err == nil && n < len(data) {
+		err = io.EOF
+	}
+	return block{data[:n], err}
+}
+
+// prefetch starts reading the block at `off` in the background.
+func (r *readAhead) prefetch(off int64) {
+	r.pending = make(chan block, 1)
+	r.wg.Add(1)
+	go func(pending chan block) {
+		defer r.wg.Done()
+		pending <- r.fetch(off)
+	}(r.pending)
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var b block
+		if r.pending != nil {
+			b = <-r.pending
+			r.pending = nil
+			r.streak++
+		} else {
+			b = r.fetch(r.pos)
+		}
+		r.buf, r.err = b.data, b.err
+		if r.err == nil && r.streak > 0 {
+			r.prefetch(r.pos + int64(len(r.buf)))
+		}
+		if len(r.buf) == 0 {
+			return 0, r.err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.pos += int64(n)
+	if len(r.buf) == 0 && r.err == nil && r.pending == nil {
+		// the first block after a seek has been consumed
+		r.streak++
+		r.prefetch(r.pos)
+	}
+	return n, nil
+}
+
+func (r *readAhead) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		end, err := r.f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		offset += end
+	default:
+		return 0, errors.New("Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: invalid offset")
+	}
+	if offset != r.pos {
+		r.pos = offset
+		r.buf, r.err, r.pending, r.streak = nil, nil, nil, 0
+	}
+	return offset, nil
+}
+
+// wait waits for background reads to finish, before the file is closed.
+func (r *readAhead) wait() {
+	r.wg.Wait()
+}
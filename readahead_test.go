@@ -0,0 +1,131 @@
+package basefs_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestReadAhead(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	err = os.WriteFile(filepath.Join(dir, "file.bin"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithReadAhead(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := bfs.Open("/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := iotest.TestReader(f, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// small sequential reads interleaved with seeks
+	buf := make([]byte, 300)
+	for _, off := range []int64{0, 2500, 9900, 10, 5000} {
+		pos, err := f.Seek(off, io.SeekStart)
+		if err != nil || pos != off {
+			t.Fatalf("seek to %d: got %d %v", off, pos, err)
+		}
+		for i := 0; i < 5; i++ {
+			n, err := io.ReadFull(f, buf)
+			end := min(off+int64(len(buf)), int64(len(data)))
+			if !bytes.Equal(buf[:n], data[off:end]) {
+				t.Fatalf("read at %d: got wrong data", off)
+			}
+			if err != nil {
+				if end != int64(len(data)) {
+					t.Fatalf("read at %d: %v", off, err)
+				}
+				break
+			}
+			off = end
+		}
+	}
+	if pos, err := f.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(data))-10 {
+		t.Fatalf("seek from the end: got %d %v", pos, err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Errorf("got %d bytes %v, expected the last 10", len(rest), err)
+	}
+}
+
+func TestWriteBuffer(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithWriteBuffer(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := func() string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Write([]byte(", "))
+	if got := contents(); got != "" {
+		t.Errorf("got %q before flushing, expected nothing", got)
+	}
+	f.WriteString("world, and more")
+	if got := contents(); got != "hello, " {
+		t.Errorf("got %q, expected the full buffer to be written", got)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(); got != "hello, world, and more" {
+		t.Errorf("got %q after Sync", got)
+	}
+
+	f.WriteString("!")
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("J")
+	f.Write(bytes.Repeat([]byte("."), 20))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := contents(), "J...................."+"e!"; got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
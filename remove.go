@@ -0,0 +1,192 @@
+package basefs
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/absfs/osfs"
+)
+
+// ErrTooManyMatches is returned by RemoveGlob when a pattern matches more
+// files than allowed by MaxMatches.
+var ErrTooManyMatches = errors.New("too many matches")
+
+// RemoveOption configures RemoveGlob.
+type RemoveOption func(*removeOptions) error
+
+type removeOptions struct {
+	dryRun     bool
+	maxMatches int
+	olderThan  time.Duration
+}
+
+// RemoveDryRun makes RemoveGlob only report the files it would remove.
+func RemoveDryRun() RemoveOption {
+	return func(o *removeOptions) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// MaxMatches makes RemoveGlob fail with ErrTooManyMatches, without removing
+// anything, if the pattern matches more than `n` files.
+func MaxMatches(n int) RemoveOption {
+	return func(o *removeOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxMatches = n
+		return nil
+	}
+}
+
+// OlderThan limits RemoveGlob to files last modified more than `d` ago.
+func OlderThan(d time.Duration) RemoveOption {
+	return func(o *removeOptions) error {
+		if d < 0 {
+			return os.ErrInvalid
+		}
+		o.olderThan = d
+		return nil
+	}
+}
+
+// RemoveGlob removes the files and directories, with everything below them,
+// whose virtual paths match `pattern` and returns their paths. Patterns use
+// the syntax of path.Match with the addition of `**` matching any number of
+// directories, and relative patterns are relative to the root of the base,
+// e.g. "**/*.tmp" matches every file ending in .tmp. The root itself is never
+// removed. All matches are collected before the first one is removed.
+func (f *FileSystem) RemoveGlob(pattern string, opts ...RemoveOption) ([]string, error) {
+	o := new(removeOptions)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if !path.IsAbs(pattern) {
+		pattern = "/" + pattern
+	}
+	if err := validPattern(pattern); err != nil {
+		return nil, &os.PathError{Op: "removeglob", Path: pattern, Err: err}
+	}
+
+	var matches []string
+	now := time.Now()
+	root := literalPrefix(pattern)
+	err := walk(f.outer(), root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if p == "/" {
+			return nil
+		}
+		if ok, _ := match(pattern, p); !ok {
+			return nil
+		}
+		if o.olderThan > 0 && now.Sub(info.ModTime()) <= o.olderThan {
+			return nil
+		}
+		matches = append(matches, p)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.maxMatches > 0 && len(matches) > o.maxMatches {
+		return nil, &os.PathError{Op: "removeglob", Path: pattern, Err: ErrTooManyMatches}
+	}
+	if o.dryRun {
+		return matches, nil
+	}
+
+	for i, p := range matches {
+		if err := f.outer().RemoveAll(p); err != nil {
+			return matches[:i], err
+		}
+	}
+	return matches, nil
+}
+
+// literalPrefix returns the directory of the absolute `pattern` up to its
+// first element with glob syntax.
+func literalPrefix(pattern string) string {
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if elem == "**" || strings.ContainsAny(elem, `*?[\`) {
+			return path.Clean("/" + strings.Join(elems[:i], "/"))
+		}
+	}
+	return path.Dir(pattern)
+}
+
+// RemoveSecure overwrites the contents of the named regular file `passes`
+// times with random data, syncing each pass to disk, before removing it. It
+// fails with errors.ErrUnsupported unless the file is stored in place on the
+// host, see Capabilities. Note that journaling and copy on write filesystems
+// as well as flash storage may still keep copies of the old contents.
+func (f *FileSystem) RemoveSecure(name string, passes int) error {
+	if passes <= 0 {
+		return os.ErrInvalid
+	}
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.modify("remove", ppath); err != nil {
+		return err
+	}
+	if !f.Capabilities().SecureRemove {
+		return &os.PathError{Op: "removesecure", Path: name, Err: errors.ErrUnsupported}
+	}
+
+	host := f.fs.(*osfs.FileSystem)
+	info, err := host.Lstat(ppath)
+	if err != nil {
+		return f.fixerr(err)
+	}
+	if info.IsDir() {
+		return &os.PathError{Op: "removesecure", Path: name, Err: syscall.EISDIR}
+	}
+	if !info.Mode().IsRegular() {
+		return &os.PathError{Op: "removesecure", Path: name, Err: os.ErrInvalid}
+	}
+	if err := shred(host, ppath, info.Size(), passes); err != nil {
+		return f.fixerr(err)
+	}
+	return f.Remove(name)
+}
+
+// shred overwrites the first `size` bytes of `ppath` with random data.
+func shred(fs *osfs.FileSystem, ppath string, size int64, passes int) error {
+	file, err := fs.OpenFile(ppath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < passes && err == nil; i++ {
+		_, err = file.Seek(0, io.SeekStart)
+		if err == nil {
+			_, err = io.CopyN(file, rand.Reader, size)
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+	}
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package basefs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestRemoveGlob(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/a.tmp":       "a",
+		"/keep.txt":    "keep",
+		"/dir/b.tmp":   "b",
+		"/dir/c.txt":   "c",
+		"/cache.tmp/d": "d",
+	})
+
+	tests := []struct {
+		Pattern string
+		Opts    []basefs.RemoveOption
+		Matches string
+		Err     error
+	}{
+		{"*.tmp", []basefs.RemoveOption{basefs.RemoveDryRun()}, "/a.tmp /cache.tmp", nil},
+		{"**/*.tmp", []basefs.RemoveOption{basefs.MaxMatches(2)}, "", basefs.ErrTooManyMatches},
+		{"**/*.tmp", []basefs.RemoveOption{basefs.OlderThan(time.Hour)}, "", nil},
+		{"/dir/*.tmp", nil, "/dir/b.tmp", nil},
+		{"**/*.tmp", nil, "/a.tmp /cache.tmp", nil},
+		{"/missing/*", nil, "", nil},
+		{"/**", []basefs.RemoveOption{basefs.RemoveDryRun()}, "/dir /keep.txt", nil},
+	}
+	for _, test := range tests {
+		matches, err := bfs.RemoveGlob(test.Pattern, test.Opts...)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("%s: got error %v, expected %v", test.Pattern, err, test.Err)
+			continue
+		}
+		if strings.Join(matches, " ") != test.Matches {
+			t.Errorf("%s: got %q, expected %q", test.Pattern, matches, test.Matches)
+		}
+	}
+
+	for _, name := range []string{"/a.tmp", "/dir/b.tmp", "/cache.tmp"} {
+		if _, err := bfs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected it to be removed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"/keep.txt", "/dir/c.txt"} {
+		if _, err := bfs.Stat(name); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRemoveSecure(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/secret": "secret data",
+		"/dir/":   "",
+	})
+	if !bfs.Capabilities().SecureRemove {
+		t.Skip("secure removal not supported")
+	}
+	if err := bfs.RemoveSecure("/secret", 0); err != os.ErrInvalid {
+		t.Errorf("expected ErrInvalid for 0 passes, got %v", err)
+	}
+	if err := bfs.RemoveSecure("/dir", 1); err == nil {
+		t.Error("expected an error removing a directory")
+	}
+	if err := bfs.RemoveSecure("/secret", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/secret"); !os.IsNotExist(err) {
+		t.Errorf("expected /secret to be removed, got %v", err)
+	}
+
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithContentStore(filepath.ToSlash(dir)+"/.objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfs.WriteFile("/secret", []byte("secret data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfs.RemoveSecure("/secret", 1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported with a content store, got %v", err)
+	}
+}
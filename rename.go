@@ -0,0 +1,141 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// renameMu serializes the renames which are emulated in several steps.
+var renameMu sync.Mutex
+
+// ExchangeRename atomically exchanges the files or directories `a` and `b`,
+// which must both exist, e.g. to swap a tree prepared in "/next" with
+// "/current" without a moment where "/current" is missing. It uses
+// renameat2(2) with RENAME_EXCHANGE for os filesystems on Linux. Elsewhere it
+// falls back to three renames through a temporary name, which are serialized
+// with the other emulated renames of the process, but are not atomic for other
+// observers.
+func (f *FileSystem) ExchangeRename(a, b string) error {
+	linkErr := &os.LinkError{Op: "exchange", Old: a, New: b}
+	apath, err := f.path(a)
+	if err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	bpath, err := f.path(b)
+	if err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if err := f.opts.modify("rename", apath); err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if err := f.opts.modify("rename", bpath); err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if apath == bpath {
+		_, err = f.fs.Stat(apath)
+	} else {
+		err = exchange(f.fs, apath, bpath)
+	}
+	if err != nil {
+		linkErr.Err = cause(err)
+		return linkErr
+	}
+	f.opts.record("exchange", vpath(f.prefix, apath), vpath(f.prefix, bpath))
+	return f.fixerr(f.opts.syncParents(f.fs, apath, bpath))
+}
+
+// exchange exchanges `apath` and `bpath` on `fs`, falling back to three
+// renames if the platform or filesystem has no atomic exchange. The first
+// renames are undone if a later one fails.
+func exchange(fs absfs.FileSystem, apath, bpath string) error {
+	err := hostExchange(fs, apath, bpath)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	tmp := path.Join(path.Dir(apath), ".basefs-exchange-"+randomName())
+	if err := fs.Rename(apath, tmp); err != nil {
+		return err
+	}
+	if err := fs.Rename(bpath, apath); err != nil {
+		fs.Rename(tmp, apath)
+		return err
+	}
+	if err := fs.Rename(tmp, bpath); err != nil {
+		fs.Rename(apath, bpath)
+		fs.Rename(tmp, apath)
+		return err
+	}
+	return nil
+}
+
+// RenameNoReplace renames `oldname` to `newname` like Rename, but fails with
+// an error matching os.ErrExist instead of replacing `newname` if it exists,
+// e.g. for workers claiming jobs by renaming them into their own directory. It
+// uses renameat2(2) with RENAME_NOREPLACE for os filesystems on Linux.
+// Elsewhere the check and the rename are serialized with the other emulated
+// renames of the process, but a file created at `newname` by others in
+// between is replaced.
+func (f *FileSystem) RenameNoReplace(oldname, newname string) error {
+	linkErr := &os.LinkError{Op: "rename", Old: oldname, New: newname}
+	oldpath, err := f.path(oldname)
+	if err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	newpath, err := f.path(newname)
+	if err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if err := f.opts.modify("rename", oldpath); err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if err := f.opts.modify("rename", newpath); err != nil {
+		linkErr.Err = err
+		return linkErr
+	}
+	if err := renameNoReplace(f.fs, oldpath, newpath); err != nil {
+		linkErr.Err = cause(err)
+		return linkErr
+	}
+	f.opts.record("rename", vpath(f.prefix, oldpath), vpath(f.prefix, newpath))
+	return f.fixerr(f.opts.syncParents(f.fs, oldpath, newpath))
+}
+
+// renameNoReplace renames `oldpath` to `newpath` on `fs` unless `newpath`
+// exists, checking for it first if the platform or filesystem can't do both
+// at once.
+func renameNoReplace(fs absfs.FileSystem, oldpath, newpath string) error {
+	err := hostRenameNoReplace(fs, oldpath, newpath)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	stat := fs.Stat
+	if l, ok := fs.(lstater); ok {
+		stat = l.Lstat
+	}
+	_, err = stat(newpath)
+	if err == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EEXIST}
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	return fs.Rename(oldpath, newpath)
+}
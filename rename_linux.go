@@ -0,0 +1,38 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+	"golang.org/x/sys/unix"
+)
+
+// hostExchange exchanges `apath` and `bpath` with renameat2(2) if `fs` is an
+// osfs.FileSystem, and fails with errors.ErrUnsupported if it isn't or the
+// host filesystem doesn't support RENAME_EXCHANGE.
+func hostExchange(fs absfs.FileSystem, apath, bpath string) error {
+	return renameat2(fs, apath, bpath, unix.RENAME_EXCHANGE)
+}
+
+// hostRenameNoReplace renames `oldpath` to `newpath` unless it exists, like
+// hostExchange with RENAME_NOREPLACE.
+func hostRenameNoReplace(fs absfs.FileSystem, oldpath, newpath string) error {
+	return renameat2(fs, oldpath, newpath, unix.RENAME_NOREPLACE)
+}
+
+func renameat2(fs absfs.FileSystem, oldpath, newpath string, flags uint) error {
+	if _, ok := fs.(*osfs.FileSystem); !ok {
+		return errors.ErrUnsupported
+	}
+	err := unix.Renameat2(unix.AT_FDCWD, filepath.FromSlash(oldpath), unix.AT_FDCWD, filepath.FromSlash(newpath), flags)
+	switch err {
+	case nil:
+		return nil
+	case unix.ENOSYS, unix.EINVAL:
+		return errors.ErrUnsupported
+	}
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+}
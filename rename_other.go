@@ -0,0 +1,19 @@
+//go:build !linux
+
+package basefs
+
+import (
+	"errors"
+
+	"github.com/absfs/absfs"
+)
+
+// hostExchange is not supported on this platform.
+func hostExchange(fs absfs.FileSystem, apath, bpath string) error {
+	return errors.ErrUnsupported
+}
+
+// hostRenameNoReplace is not supported on this platform.
+func hostRenameNoReplace(fs absfs.FileSystem, oldpath, newpath string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,112 @@
+package basefs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestExchangeRename(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// connFS is not an osfs.FileSystem, so exchanges are emulated.
+	for _, fs := range []absfs.FileSystem{ofs, connFS{ofs}} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir = filepath.ToSlash(dir)
+		writeTree(t, dir+"/base", map[string]string{
+			"/current/index.html": "v1",
+			"/next/index.html":    "v2",
+			"/next/new.html":      "new",
+			"/file":               "file",
+		})
+		bfs, err := basefs.NewFileSystem(fs, dir+"/base", basefs.WithChecksums(dir+"/sums.json", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bfs.WriteFile("/current/index.html", []byte("v1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		read := func(name string) string {
+			t.Helper()
+			data, err := os.ReadFile(dir + "/base" + name)
+			if err != nil {
+				t.Fatalf("%T: %v", fs, err)
+			}
+			return string(data)
+		}
+
+		if err := bfs.ExchangeRename("/current", "/next"); err != nil {
+			t.Fatalf("%T: %v", fs, err)
+		}
+		if read("/current/index.html") != "v2" || read("/current/new.html") != "new" || read("/next/index.html") != "v1" {
+			t.Errorf("%T: directories not exchanged", fs)
+		}
+		if _, err := bfs.Checksum("/next/index.html"); err != nil {
+			t.Errorf("%T: checksum did not follow the exchange: %v", fs, err)
+		}
+		if err := bfs.ExchangeRename("/file", "/next/index.html"); err != nil {
+			t.Fatalf("%T: %v", fs, err)
+		}
+		if read("/file") != "v1" || read("/next/index.html") != "file" {
+			t.Errorf("%T: files not exchanged", fs)
+		}
+
+		err = bfs.ExchangeRename("/file", "/missing")
+		if !os.IsNotExist(err) {
+			t.Errorf("%T: expected a not exist error, got %v", fs, err)
+		}
+		if read("/file") != "v1" {
+			t.Errorf("%T: failed exchange changed the file", fs)
+		}
+		entries, err := os.ReadDir(dir + "/base")
+		if err != nil || len(entries) != 3 {
+			t.Errorf("%T: %d entries in the base, want 3 (%v)", fs, len(entries), err)
+		}
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []absfs.FileSystem{ofs, connFS{ofs}} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTree(t, dir, map[string]string{"/jobs/1": "job", "/claimed/": ""})
+		bfs, err := basefs.NewFileSystem(fs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := bfs.RenameNoReplace("/jobs/1", "/claimed/1"); err != nil {
+			t.Fatalf("%T: %v", fs, err)
+		}
+		if err := bfs.WriteFile("/jobs/1", []byte("again"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = bfs.RenameNoReplace("/jobs/1", "/claimed/1")
+		if !errors.Is(err, os.ErrExist) {
+			t.Errorf("%T: expected ErrExist, got %v", fs, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "claimed", "1"))
+		if err != nil || string(data) != "job" {
+			t.Errorf("%T: claimed file replaced: %q %v", fs, data, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "jobs", "1")); err != nil {
+			t.Errorf("%T: source of the failed rename: %v", fs, err)
+		}
+	}
+}
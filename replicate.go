@@ -0,0 +1,195 @@
+package basefs
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// ReplicateOption configures Replicate.
+type ReplicateOption func(*replicateOptions) error
+
+type replicateOptions struct {
+	continuous bool
+}
+
+// Continuous keeps applying changes to the destination after the initial copy
+// until the Replica is closed.
+func Continuous() ReplicateOption {
+	return func(o *replicateOptions) error {
+		o.continuous = true
+		return nil
+	}
+}
+
+// Replica is a copy of a filesystem on another filesystem, kept up to date if
+// created with the Continuous option. Errors applying changes are delivered on
+// Errors, which must be drained and is closed when the Replica is closed.
+type Replica struct {
+	Errors <-chan error
+
+	src    absfs.FileSystem
+	dst    absfs.FileSystem
+	dir    string
+	w      *Watcher
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+// Close stops applying changes to the destination.
+func (r *Replica) Close() error {
+	var err error
+	r.once.Do(func() {
+		close(r.done)
+		if r.w != nil {
+			err = r.w.Close()
+		}
+		r.wg.Wait()
+		close(r.errors)
+	})
+	return err
+}
+
+// Replicate copies the whole tree to `dstDir` on `dst`, creating `dstDir` if
+// needed.
+func (f *FileSystem) Replicate(dst absfs.FileSystem, dstDir string, opts ...ReplicateOption) (*Replica, error) {
+	return replicate(f.outer().(watchfs), dst, dstDir, opts)
+}
+
+type watchfs interface {
+	absfs.FileSystem
+	Watch(name string, opts ...WatchOption) (*Watcher, error)
+}
+
+func replicate(src watchfs, dst absfs.FileSystem, dstDir string, opts []ReplicateOption) (*Replica, error) {
+	var o replicateOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if !path.IsAbs(dstDir) {
+		return nil, &os.PathError{Op: "replicate", Path: dstDir, Err: os.ErrInvalid}
+	}
+	err := dst.MkdirAll(dstDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replica{
+		src:    src,
+		dst:    dst,
+		dir:    dstDir,
+		errors: make(chan error),
+		done:   make(chan struct{}),
+	}
+	r.Errors = r.errors
+
+	// Start watching before copying so no change can fall between the copy and
+	// the first event.
+	if o.continuous {
+		r.w, err = src.Watch("/", Recursive())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = walk(src, "/", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return r.copy(name, info)
+	})
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if r.w != nil {
+		r.wg.Add(1)
+		go r.run()
+	}
+	return r, nil
+}
+
+func (r *Replica) run() {
+	defer r.wg.Done()
+	for {
+		var err error
+		select {
+		case <-r.done:
+			return
+		case e, ok := <-r.w.Events:
+			if !ok {
+				return
+			}
+			err = r.apply(e.Path)
+		case err = <-r.w.Errors:
+		}
+		if err == nil {
+			continue
+		}
+		select {
+		case r.errors <- err:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// apply brings `name` on the destination in line with the source.
+func (r *Replica) apply(name string) error {
+	stat := r.src.Stat
+	if l, ok := r.src.(lstater); ok {
+		stat = l.Lstat
+	}
+	info, err := stat(name)
+	if os.IsNotExist(err) {
+		err = r.dst.RemoveAll(path.Join(r.dir, name))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.copy(name, info)
+}
+
+// copy copies `name`, described by `info`, to the destination. Symbolic links
+// are recreated, with absolute targets moved into the replica, if both
+// filesystems support them and skipped otherwise.
+func (r *Replica) copy(name string, info os.FileInfo) error {
+	target := path.Join(r.dir, name)
+	stat := r.dst.Stat
+	if l, ok := r.dst.(lstater); ok {
+		stat = l.Lstat
+	}
+	// Links on the destination are replaced rather than written through.
+	if dinfo, err := stat(target); err == nil && (dinfo.IsDir() != info.IsDir() || dinfo.Mode()&os.ModeSymlink != 0) {
+		err = r.dst.RemoveAll(target)
+		if err != nil {
+			return err
+		}
+	}
+	switch mode := info.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		return copySymlink(r.src, name, r.dst, target, r.dir)
+	case mode.IsRegular():
+		return copyFile(r.src, name, r.dst, target, info, nil)
+	case !mode.IsDir():
+		return nil
+	}
+
+	err := r.dst.MkdirAll(target, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return r.dst.Chmod(target, info.Mode().Perm())
+}
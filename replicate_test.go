@@ -0,0 +1,150 @@
+package basefs_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestReplicate(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst = filepath.Join(dst, "replica")
+
+	err = os.MkdirAll(filepath.Join(src, "a", "b"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(src, "a", "b", "file.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := bfs.Replicate(ofs, filepath.ToSlash(dst), basefs.Continuous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	data, err := os.ReadFile(filepath.Join(dst, "a", "b", "file.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("initial copy: %q %v", data, err)
+	}
+
+	f, err := bfs.Create("/a/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("world")
+	f.Close()
+	err = bfs.RemoveAll("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(filepath.Join(dst, "a", "new.txt"))
+		_, err1 := os.Stat(filepath.Join(dst, "a", "b"))
+		if err == nil && string(data) == "world" && os.IsNotExist(err1) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replica not updated: %q %v %v", data, err, err1)
+		}
+		select {
+		case err := <-r.Errors:
+			t.Fatal(err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestReplicateSymlinks(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, src, map[string]string{"/target": "secret", "/dir/file": "file"})
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("/target", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.Symlink("/dir", "/dirlink"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := bfs.Replicate(ofs, filepath.ToSlash(dst), basefs.Continuous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	linked := func(name, target string) error {
+		p := filepath.Join(dst, name)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s replicated as %v, want a symbolic link", name, info.Mode())
+		}
+		if got, _ := os.Readlink(p); got != filepath.Join(dst, target) {
+			return fmt.Errorf("%s links to %s, want %s", name, got, filepath.Join(dst, target))
+		}
+		return nil
+	}
+	for name, target := range map[string]string{"link": "target", "dirlink": "dir"} {
+		if err := linked(name, target); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := bfs.Symlink("/missing", "/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := linked("dangling", "missing")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-r.Errors:
+			t.Fatal(err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
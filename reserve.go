@@ -0,0 +1,91 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ledger holds the space reserved with Reserve. It is shared by clones.
+type ledger struct {
+	mu   sync.Mutex
+	held int64
+}
+
+// Reservation is space set aside with Reserve.
+type Reservation struct {
+	l *ledger
+	n int64
+}
+
+// ReserveSpace checks that `n` more bytes can be stored below the base, so
+// that a large transfer can fail early instead of running out of space
+// halfway and leaving a partial file behind. It fails with ErrQuotaExceeded
+// if the bytes would take the usage over the quota set with WithQuota, and
+// with ENOSPC if the underlying filesystem has less than `n` bytes available,
+// counting the space held by reservations as used. The check passes if
+// neither a quota nor the capacity of the underlying filesystem is known. The
+// space isn't set aside, see Reserve for that.
+func (f *FileSystem) ReserveSpace(n int64) error {
+	if n < 0 {
+		return &os.PathError{Op: "reservespace", Path: "/", Err: os.ErrInvalid}
+	}
+	l := f.opts.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return f.checkSpace("reservespace", l.held+n)
+}
+
+// Reserve sets `n` bytes aside for a write which is about to start, failing
+// like ReserveSpace if there isn't room for them next to the bytes already
+// reserved. Reservations only count against other reservations and checks in
+// the same process, so concurrent uploads which reserve their size first
+// can't together exceed the quota or the free space. The reservation should
+// be released as soon as the data is written.
+func (f *FileSystem) Reserve(n int64) (*Reservation, error) {
+	if n < 0 {
+		return nil, &os.PathError{Op: "reserve", Path: "/", Err: os.ErrInvalid}
+	}
+	l := f.opts.ledger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := f.checkSpace("reserve", l.held+n); err != nil {
+		return nil, err
+	}
+	l.held += n
+	return &Reservation{l: l, n: n}, nil
+}
+
+// Release returns the reserved space. Releasing a reservation more than once
+// has no effect.
+func (r *Reservation) Release() {
+	r.l.mu.Lock()
+	r.l.held -= r.n
+	r.n = 0
+	r.l.mu.Unlock()
+}
+
+// checkSpace checks that `n` more bytes fit below the base.
+func (f *FileSystem) checkSpace(op string, n int64) error {
+	if f.opts.quota > 0 {
+		u, err := f.opts.counter.usage(f.opts, f.fs, f.prefix, true)
+		if err != nil {
+			return f.fixerr(err)
+		}
+		if u.Bytes+n > f.opts.quota {
+			return &os.PathError{Op: op, Path: "/", Err: ErrQuotaExceeded}
+		}
+	}
+	_, _, avail, err := backendStatFS(f.fs, f.prefix)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: op, Path: "/", Err: err}
+	}
+	if uint64(n) > avail {
+		return &os.PathError{Op: op, Path: "/", Err: syscall.ENOSPC}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"github.com/absfs/absfs"
+)
+
+// ScanFunc inspects the contents of a newly written file, identified by its
+// virtual path. Returning an error rejects the file.
+type ScanFunc func(name string, r io.Reader) error
+
+// WithScanner calls `fn` whenever a file that was written to is closed. A
+// rejected file is removed, or moved to the quarantine directory if one is
+// configured, and Close returns an *os.PathError with Op "scan" wrapping the
+// error returned by `fn`.
+func WithScanner(fn ScanFunc) Option {
+	return func(o *options) error {
+		o.scanner = fn
+		return nil
+	}
+}
+
+// WithQuarantine moves files rejected by the scanner, the content type policy
+// or the quota to `dir`, an absolute path on the underlying filesystem outside
+// the base, instead of removing them.
+func WithQuarantine(dir string) Option {
+	return func(o *options) error {
+		if !path.IsAbs(dir) {
+			return &os.PathError{Op: "quarantine", Path: dir, Err: errors.New("not an absolute path")}
+		}
+		o.quarantine = path.Clean(dir)
+		return nil
+	}
+}
+
+// scan runs the scanner over the file at `ppath` and disposes of the file if
+// it is rejected.
+func (o *options) scan(fs absfs.FileSystem, ppath, name string) error {
+	f, err := o.open(fs, ppath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	verdict := o.scanner(name, f)
+	f.Close()
+	if verdict == nil {
+		return nil
+	}
+
+	return o.reject(fs, ppath, name, "scan", verdict)
+}
+
+// reject removes or quarantines the file at `ppath` and returns an
+// *os.PathError wrapping `reason`.
+func (o *options) reject(fs absfs.FileSystem, ppath, name, op string, reason error) error {
+	var err error
+	if o.quarantine != "" {
+		err = fs.MkdirAll(o.quarantine, 0700)
+		if err == nil {
+			dst := path.Join(o.quarantine, randomName()+"-"+path.Base(ppath))
+			err = fs.Rename(ppath, dst)
+			if err == nil {
+				o.counter.update(o.base, "rename", ppath, dst)
+			}
+		}
+	} else {
+		err = fs.Remove(ppath)
+		if err == nil {
+			o.counter.update(o.base, "remove", ppath, "")
+		}
+	}
+	if err != nil {
+		return errors.Join(reason, err)
+	}
+	if o.cas != nil {
+		o.cas.refs.update("remove", vpath(o.base, ppath), "")
+	}
+	return &os.PathError{Op: op, Path: name, Err: reason}
+}
@@ -0,0 +1,103 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrOutsideBase is returned by SecureJoin and SecureJoinFS for paths which
+// would resolve outside the base directory.
+var ErrOutsideBase = errors.New("path outside of base directory")
+
+// SecureJoin joins the untrusted slash separated path `unsafe`, absolute or
+// relative, to the directory `base` the way basefs translates virtual paths.
+// It fails with ErrOutsideBase if ".." elements would climb above `base`
+// instead of stopping there. The check is purely lexical, see SecureJoinFS to
+// also resolve symbolic links.
+func SecureJoin(base, unsafe string) (string, error) {
+	p, ok := join(path.Clean("/"+base), unsafe)
+	if !ok {
+		return "", &os.PathError{Op: "securejoin", Path: unsafe, Err: ErrOutsideBase}
+	}
+	return p, nil
+}
+
+// SecureJoinFS is SecureJoin resolving the symbolic links on `fs` along the
+// way, so that the result names the file `unsafe` refers to on `fs`. As on
+// the host, ".." after a link refers to the parent of the link's target.
+// Relative link targets must stay inside `base` and absolute ones must point
+// into it, as the targets of links created through basefs do. Elements which
+// don't exist are joined lexically. More than 40 links fail with ELOOP.
+func SecureJoinFS(fs absfs.SymlinkFileSystem, base, unsafe string) (string, error) {
+	base = path.Clean("/" + base)
+	outside := &os.PathError{Op: "securejoin", Path: unsafe, Err: ErrOutsideBase}
+
+	cur := base
+	queue := elements(unsafe)
+	links := 0
+	missing := false
+	for len(queue) > 0 {
+		elem := queue[0]
+		queue = queue[1:]
+		if elem == ".." {
+			if cur == base {
+				return "", outside
+			}
+			cur = path.Dir(cur)
+			continue
+		}
+		next := path.Join(cur, elem)
+		if missing {
+			cur = next
+			continue
+		}
+		info, err := fs.Lstat(next)
+		if os.IsNotExist(err) {
+			missing = true
+			cur = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", &os.PathError{Op: "securejoin", Path: unsafe, Err: syscall.ELOOP}
+		}
+		target, err := fs.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			rest, ok := trimDir(base, path.Clean(target))
+			if !ok {
+				return "", outside
+			}
+			cur, target = base, rest
+		}
+		queue = append(elements(target), queue...)
+	}
+	return cur, nil
+}
+
+// elements splits the slash separated path `p` into its non-empty elements
+// other than ".".
+func elements(p string) []string {
+	var elems []string
+	for _, elem := range strings.Split(p, "/") {
+		if elem != "" && elem != "." {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
@@ -0,0 +1,151 @@
+package basefs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/absfs/absfs"
+)
+
+// ServerOption configures the handler returned by FileServer.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	listing bool
+	hash    func() hash.Hash
+}
+
+// ListDirectories enables HTML listings of directories without an index.html
+// file. By default requests for such directories fail with 404 Not Found.
+func ListDirectories() ServerOption {
+	return func(o *serverOptions) {
+		o.listing = true
+	}
+}
+
+// HashETags derives ETags from a hash of the file contents computed with
+// `h`, rather than from the size and modification time of the file.
+func HashETags(h func() hash.Hash) ServerOption {
+	return func(o *serverOptions) {
+		o.hash = h
+	}
+}
+
+// FileServer returns a handler serving GET and HEAD requests from the
+// filesystem, with support for Range requests, ETags and conditional
+// requests.
+func (f *FileSystem) FileServer(opts ...ServerOption) http.Handler {
+	return newFileServer(f.outer(), opts)
+}
+
+type fileServer struct {
+	fs   absfs.FileSystem
+	opts serverOptions
+}
+
+func newFileServer(fs absfs.FileSystem, opts []ServerOption) *fileServer {
+	s := &fileServer{fs: fs}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	info, err := s.fs.Stat(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		index := path.Join(name, "index.html")
+		if iinfo, err := s.fs.Stat(index); err == nil && iinfo.Mode().IsRegular() {
+			name, info = index, iinfo
+		} else if s.opts.listing {
+			s.list(w, r, name)
+			return
+		} else {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+	if s.opts.hash != nil {
+		sum, err := hashFile(s.fs, name, s.opts.hash)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		etag = `"` + hex.EncodeToString(sum) + `"`
+	}
+	f, err := s.fs.Open(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// list writes an HTML listing of the directory `name`.
+func (s *fileServer) list(w http.ResponseWriter, r *http.Request, name string) {
+	if p := r.URL.Path; p == "" || p[len(p)-1] != '/' {
+		// relative to the requested URL, which may be longer than r.URL.Path
+		// behind http.StripPrefix
+		if p == "" {
+			if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+				p = u.Path
+			}
+		}
+		u := url.URL{Path: path.Base(p) + "/"}
+		w.Header().Set("Location", u.String())
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+	infos, err := readDir(s.fs, name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n<pre>\n")
+	for _, info := range infos {
+		n := info.Name()
+		if info.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,84 @@
+package basefs_test
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/absfs/basefs"
+)
+
+func TestFileServer(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/hello.txt":       "hello, world",
+		"/dir/a.txt":       "a",
+		"/site/index.html": "<p>index</p>",
+	})
+
+	get := func(h http.Handler, target string, header ...string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+	body := func(resp *http.Response) string {
+		t.Helper()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	h := bfs.FileServer()
+	resp := get(h, "/hello.txt")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || body(resp) != "hello, world" || etag == "" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, etag)
+	}
+	if resp := get(h, "/hello.txt", "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+	if resp := get(h, "/hello.txt", "If-Modified-Since", resp.Header.Get("Last-Modified")); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+	if resp := get(h, "/hello.txt", "Range", "bytes=7-11"); resp.StatusCode != http.StatusPartialContent || body(resp) != "world" {
+		t.Errorf("unexpected range response %d", resp.StatusCode)
+	}
+	if resp := get(h, "/site/"); !strings.Contains(body(resp), "index") {
+		t.Error("index.html was not served")
+	}
+	if resp := get(h, "/dir/"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a directory, got %d", resp.StatusCode)
+	}
+	if resp := get(h, "/../../etc/passwd"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 outside the base, got %d", resp.StatusCode)
+	}
+
+	h = bfs.FileServer(basefs.ListDirectories(), basefs.HashETags(sha256.New))
+	if resp := get(h, "/dir/"); !strings.Contains(body(resp), `<a href="a.txt">a.txt</a>`) {
+		t.Error("directory listing is missing entries")
+	}
+	resp = get(h, "/hello.txt")
+	if etag := resp.Header.Get("ETag"); len(etag) != 2+sha256.Size*2 {
+		t.Errorf("unexpected hash ETag %q", etag)
+	}
+
+	h = http.StripPrefix("/files", bfs.FileServer(basefs.ListDirectories()))
+	for target, location := range map[string]string{"/files": "files/", "/files/dir": "dir/"} {
+		resp := get(h, target)
+		if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != location {
+			t.Errorf("%s: got %d to %q", target, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	if resp := get(h, "/files/"); !strings.Contains(body(resp), `<a href="dir/">dir/</a>`) {
+		t.Error("the root listing is missing entries behind StripPrefix")
+	}
+}
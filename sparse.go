@@ -0,0 +1,123 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// SparseFile is implemented by files that can locate the holes of sparse
+// files.
+type SparseFile interface {
+	SeekData(offset int64) (int64, error)
+	SeekHole(offset int64) (int64, error)
+}
+
+// SeekData moves the offset of the file to the start of the first data region
+// at or after `offset` and returns it, as lseek(2) with SEEK_DATA does. It
+// fails with ENXIO if there is no data after `offset`. Where the underlying
+// file can't locate holes, the whole file is treated as data.
+func (f *File) SeekData(offset int64) (int64, error) {
+	return f.seekSparse(offset, false)
+}
+
+// SeekHole moves the offset of the file to the start of the first hole at or
+// after `offset` and returns it, as lseek(2) with SEEK_HOLE does. The end of
+// the file counts as a hole. It fails with ENXIO if `offset` is past the end
+// of the file.
+func (f *File) SeekHole(offset int64) (int64, error) {
+	return f.seekSparse(offset, true)
+}
+
+func (f *File) seekSparse(offset int64, hole bool) (int64, error) {
+	if err := f.stream("seek"); err != nil {
+		return 0, err
+	}
+	f.unhash()
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	ret, err := seekSparse(f.f, offset, hole)
+	if err != nil {
+		return 0, fixerr(f.prefix, err)
+	}
+	if f.ra != nil {
+		f.ra.Seek(ret, io.SeekStart)
+	}
+	return ret, nil
+}
+
+// seekSparse seeks `f` to the next hole or data region at or after `offset`.
+// The call is passed on to the underlying file if it implements SparseFile,
+// uses the whence values of lseek(2) where supported, and treats the file as
+// a single data region otherwise.
+func seekSparse(f absfs.File, offset int64, hole bool) (int64, error) {
+	if s, ok := f.(SparseFile); ok {
+		if hole {
+			return s.SeekHole(offset)
+		}
+		return s.SeekData(offset)
+	}
+	if hasSparseSeek {
+		whence := seekData
+		if hole {
+			whence = seekHole
+		}
+		ret, err := f.Seek(offset, whence)
+		if err == nil || errors.Is(err, syscall.ENXIO) {
+			return ret, err
+		}
+	}
+
+	cur, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 || offset >= size {
+		f.Seek(cur, io.SeekStart)
+		if offset < 0 {
+			return 0, syscall.EINVAL
+		}
+		return 0, syscall.ENXIO
+	}
+	if hole {
+		offset = size
+	}
+	return f.Seek(offset, io.SeekStart)
+}
+
+// copySparse copies the data regions of `in` to `out`, which must be empty,
+// leaving holes where `in` has them, and extends `out` to `size`.
+func copySparse(out, in absfs.File, size int64) error {
+	buf := make([]byte, 32*1024)
+	for off := int64(0); off < size; {
+		data, err := seekSparse(in, off, false)
+		if errors.Is(err, syscall.ENXIO) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		hole, err := seekSparse(in, data, true)
+		if err != nil {
+			return err
+		}
+		if _, err := in.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := out.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyBuffer(out, io.LimitReader(in, hole-data), buf); err != nil {
+			return err
+		}
+		off = hole
+	}
+	return out.Truncate(size)
+}
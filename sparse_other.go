@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package basefs
+
+// Holes in sparse files can't be located on this platform.
+const (
+	hasSparseSeek = false
+	seekData      = -1
+	seekHole      = -1
+)
@@ -0,0 +1,12 @@
+//go:build linux || darwin || freebsd
+
+package basefs
+
+import "golang.org/x/sys/unix"
+
+// The whence values of lseek(2) to find holes in sparse files.
+const (
+	hasSparseSeek = true
+	seekData      = unix.SEEK_DATA
+	seekHole      = unix.SEEK_HOLE
+)
@@ -0,0 +1,89 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// WithStatCache remembers the results of Stat and Lstat for `ttl`, to save
+// round trips to slow underlying filesystems. Any mutation through the
+// filesystem, including closing a file that was written to, empties the
+// cache, but changes made to the underlying filesystem directly, or to open
+// files which are not closed yet, may go unnoticed until the entries expire.
+func WithStatCache(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl <= 0 {
+			return os.ErrInvalid
+		}
+		o.stats = &statCache{ttl: ttl, entries: make(map[statKey]statEntry)}
+		return nil
+	}
+}
+
+// statCache memoizes the FileInfos of paths on the underlying filesystem.
+type statCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[statKey]statEntry
+	sweepAt int
+
+	// generation, bumped by clear so that results of stats which raced with
+	// a mutation are not stored
+	gen uint64
+}
+
+type statKey struct {
+	ppath string
+	lstat bool
+}
+
+type statEntry struct {
+	info    os.FileInfo
+	expires time.Time
+}
+
+// lookup returns the cached FileInfo of `ppath`, calling `stat` if there is
+// none. A nil cache always calls `stat`.
+func (c *statCache) lookup(ppath string, lstat bool, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	if c == nil {
+		return stat(ppath)
+	}
+	key := statKey{ppath, lstat}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.info, nil
+	}
+
+	info, err := stat(ppath)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return info, nil
+	}
+	if len(c.entries) >= c.sweepAt {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2*len(c.entries) + 1024
+	}
+	c.entries[key] = statEntry{info, now.Add(c.ttl)}
+	return info, nil
+}
+
+// clear empties the cache.
+func (c *statCache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.gen++
+	c.mu.Unlock()
+}
@@ -0,0 +1,389 @@
+package basefs_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestStatCache(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithStatCache(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := func(name string) int64 {
+		t.Helper()
+		info, err := bfs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	if n := size("/file.txt"); n != 5 {
+		t.Fatalf("got size %d, expected 5", n)
+	}
+
+	// changes behind the back of basefs are not seen until a mutation
+	err = os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello, world"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := size("/file.txt"); n != 5 {
+		t.Errorf("got size %d, expected the cached size 5", n)
+	}
+	err = bfs.Mkdir("/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := size("/file.txt"); n != 12 {
+		t.Errorf("got size %d after a mutation, expected 12", n)
+	}
+
+	err = bfs.Truncate("/file.txt", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := size("/file.txt"); n != 1 {
+		t.Errorf("got size %d after truncating, expected 1", n)
+	}
+	err = bfs.Remove("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Lstat("/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected the removed file to be gone, got %v", err)
+	}
+}
+
+// racingFS runs `during` once, while the first Stat of `name`, or the first
+// Readdir of `dir`, is in progress.
+type racingFS struct {
+	*osfs.FileSystem
+	name   string
+	dir    string
+	during func()
+}
+
+func (fs *racingFS) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Stat(name)
+	if name == fs.name {
+		fs.race()
+	}
+	return info, err
+}
+
+func (fs *racingFS) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	f, err := fs.FileSystem.OpenFile(name, flag, perm)
+	if err != nil || name != fs.dir {
+		return f, err
+	}
+	return &racingDir{f, fs}, nil
+}
+
+func (fs *racingFS) race() {
+	if during := fs.during; during != nil {
+		fs.during = nil
+		during()
+	}
+}
+
+type racingDir struct {
+	absfs.File
+	fs *racingFS
+}
+
+func (d *racingDir) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(n)
+	d.fs.race()
+	return infos, err
+}
+
+func TestStatCacheRace(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfs := &racingFS{FileSystem: ofs, name: filepath.ToSlash(dir) + "/file.txt"}
+	bfs, err := basefs.NewFS(rfs, filepath.ToSlash(dir), basefs.WithStatCache(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is truncated after the first Stat returned, but before the
+	// result is cached
+	rfs.during = func() {
+		if err := bfs.Truncate("/file.txt", 1); err != nil {
+			t.Error(err)
+		}
+	}
+	if info, err := bfs.Stat("/file.txt"); err != nil || info.Size() != 5 {
+		t.Fatalf("got %v, %v", info, err)
+	}
+	if info, err := bfs.Stat("/file.txt"); err != nil || info.Size() != 1 {
+		t.Errorf("got a stale size after a racing mutation: %v, %v", info, err)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithNegativeCache(2, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bfs.Stat("/file.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	if _, err := bfs.Open("/file.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	// files created behind the back of basefs are not seen
+	err = os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Stat("/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected the missing file to be cached, got %v", err)
+	}
+	if _, err := bfs.Lstat("/file.txt"); err != nil {
+		t.Errorf("Lstat is cached separately: %v", err)
+	}
+
+	// creating through basefs invalidates the cache
+	if _, err := bfs.Stat("/dir"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing directory, got %v", err)
+	}
+	err = bfs.Mkdir("/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dir", "/file.txt"} {
+		if _, err := bfs.Stat(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := bfs.Stat("/new.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	f, err := bfs.Create("/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := bfs.Stat("/new.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir), basefs.WithDirCache(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func() []string {
+		t.Helper()
+		f, err := bfs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var names []string
+		for {
+			batch, err := f.Readdirnames(1)
+			names = append(names, batch...)
+			if err == io.EOF {
+				return names
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, name := range []string{"/a", "/b"} {
+		err = bfs.Mkdir(name, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := names(); len(got) != 2 {
+		t.Fatalf("got %q, expected two entries", got)
+	}
+	err = os.Mkdir(filepath.Join(dir, "c"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 2 {
+		t.Errorf("got %q, expected the cached entries", got)
+	}
+	err = bfs.Remove("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 2 || got[0] == "a" || got[1] == "a" {
+		t.Errorf("got %q after a mutation, expected b and c", got)
+	}
+}
+
+func TestStatMany(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("/file%02d.txt", i)
+		if i%10 != 3 {
+			err = os.WriteFile(filepath.Join(dir, name), make([]byte, i), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		names = append(names, name)
+	}
+	names = append(names, "../escape")
+
+	infos, errs := bfs.StatMany(names)
+	if len(infos) != len(names) || len(errs) != len(names) {
+		t.Fatalf("got %d infos and %d errors for %d names", len(infos), len(errs), len(names))
+	}
+	for i, name := range names[:50] {
+		if i%10 == 3 {
+			if !os.IsNotExist(errs[i]) {
+				t.Errorf("%s: expected a missing file, got %v", name, errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil || infos[i].Size() != int64(i) || "/"+infos[i].Name() != name {
+			t.Errorf("%s: got %v %v", name, infos[i], errs[i])
+		}
+	}
+	if errs[50] == nil {
+		t.Error("expected an error for a name escaping the base")
+	}
+}
+
+func TestDirCacheRace(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfs := &racingFS{FileSystem: ofs, dir: filepath.ToSlash(dir)}
+	bfs, err := basefs.NewFS(rfs, filepath.ToSlash(dir), basefs.WithDirCache(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is created after the directory was read, but before the
+	// entries are cached
+	rfs.during = func() {
+		if err := bfs.WriteFile("/file.txt", nil, 0644); err != nil {
+			t.Error(err)
+		}
+	}
+	if names, err := bfs.ReadDir("/"); err != nil || len(names) != 0 {
+		t.Fatalf("got %v, %v", names, err)
+	}
+	if names, err := bfs.ReadDir("/"); err != nil || len(names) != 1 {
+		t.Errorf("got a stale listing after a racing mutation: %v, %v", names, err)
+	}
+}
+
+func TestNegativeCacheRace(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfs := &racingFS{FileSystem: ofs, name: filepath.ToSlash(dir) + "/file.txt"}
+	bfs, err := basefs.NewFS(rfs, filepath.ToSlash(dir), basefs.WithNegativeCache(8, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is created after the first Stat failed, but before the
+	// failure is cached
+	rfs.during = func() {
+		if err := bfs.WriteFile("/file.txt", nil, 0644); err != nil {
+			t.Error(err)
+		}
+	}
+	_, miss := bfs.Stat("/file.txt")
+	if !os.IsNotExist(miss) {
+		t.Fatalf("expected a missing file, got %v", miss)
+	}
+	if _, err := bfs.Stat("/file.txt"); err != nil {
+		t.Errorf("the file is missing after a racing mutation: %v", err)
+	}
+
+	// hits and misses report the same path
+	_, miss = bfs.Stat("/other.txt")
+	_, hit := bfs.Stat("/other.txt")
+	var mp, hp *os.PathError
+	if !errors.As(miss, &mp) || !errors.As(hit, &hp) || mp.Path != "/other.txt" || hp.Path != mp.Path {
+		t.Errorf("got %v from the filesystem and %v from the cache", miss, hit)
+	}
+}
@@ -0,0 +1,64 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+
+	"github.com/absfs/absfs"
+)
+
+// StatFSer is implemented by filesystems which can report their capacity.
+type StatFSer interface {
+	StatFS() (total, free, avail uint64, err error)
+}
+
+// StatFS returns the size of the filesystem holding the base, the number of
+// free bytes and the number of bytes available to unprivileged users. The
+// numbers come from the underlying filesystem if it implements StatFSer or is
+// an osfs.FileSystem on a supported platform. If a quota is configured the
+// quota is reported as the total size, and the free space is limited to the
+// unused part of the quota. Otherwise errors.ErrUnsupported is returned if
+// the underlying filesystem cannot report its capacity.
+func (f *FileSystem) StatFS() (total, free, avail uint64, err error) {
+	return statFS(f.fs, f.prefix, f.opts)
+}
+
+func statFS(fs absfs.FileSystem, prefix string, o *options) (total, free, avail uint64, err error) {
+	total, free, avail, err = backendStatFS(fs, prefix)
+	if o.quota == 0 {
+		if err != nil {
+			err = &os.PathError{Op: "statfs", Path: "/", Err: err}
+		}
+		return total, free, avail, err
+	}
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return 0, 0, 0, &os.PathError{Op: "statfs", Path: "/", Err: err}
+	}
+	hasBackend := err == nil
+
+	u, err := o.counter.usage(o, fs, prefix, true)
+	if err != nil {
+		return 0, 0, 0, fixerr(prefix, err)
+	}
+	used := u.Bytes
+	left := uint64(0)
+	if used < o.quota {
+		left = uint64(o.quota - used)
+	}
+	if !hasBackend || left < free {
+		free = left
+	}
+	if !hasBackend || left < avail {
+		avail = left
+	}
+	return uint64(o.quota), free, avail, nil
+}
+
+// backendStatFS returns the capacity of the underlying filesystem `fs`
+// holding `dir`, or errors.ErrUnsupported if it can't report it.
+func backendStatFS(fs absfs.FileSystem, dir string) (total, free, avail uint64, err error) {
+	if s, ok := fs.(StatFSer); ok {
+		return s.StatFS()
+	}
+	return hostStatFS(fs, dir)
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd)
+
+package basefs
+
+import (
+	"errors"
+
+	"github.com/absfs/absfs"
+)
+
+// hostStatFS is not supported on this platform.
+func hostStatFS(fs absfs.FileSystem, dir string) (total, free, avail uint64, err error) {
+	return 0, 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,267 @@
+package basefs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestStatFS(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bfs, err := basefs.NewFS(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, free, avail, err := bfs.StatFS()
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Log("statfs is not supported on this platform")
+	} else if err != nil {
+		t.Fatal(err)
+	} else if total == 0 || free > total || avail > free {
+		t.Errorf("unexpected capacity %d, %d free, %d available", total, free, avail)
+	}
+
+	qfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithQuota(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, size int) error {
+		f, err := qfs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteString(strings.Repeat("x", size))
+		return errors.Join(err, f.Close())
+	}
+
+	if err := write("/a.txt", 60); err != nil {
+		t.Fatal(err)
+	}
+	total, free, avail, err = qfs.StatFS()
+	if err != nil || total != 100 || free != 40 || avail != 40 {
+		t.Errorf("got %d, %d free, %d available, %v, expected 100, 40 free, 40 available", total, free, avail, err)
+	}
+
+	err = write("/b.txt", 50)
+	if !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+	if info, err := qfs.Stat("/b.txt"); err != nil || info.Size() != 0 {
+		t.Errorf("the write over the quota wasn't rejected before it landed: %v", err)
+	}
+	if err := write("/b.txt", 40); err != nil {
+		t.Fatal(err)
+	}
+	if _, free, _, _ := qfs.StatFS(); free != 0 {
+		t.Errorf("got %d bytes free, expected none", free)
+	}
+}
+
+func TestQuotaCounter(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"/a.txt": strings.Repeat("x", 60), "/d/": ""})
+	qfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithQuota(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := func() uint64 {
+		_, free, _, err := qfs.StatFS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return free
+	}
+	if n := free(); n != 40 {
+		t.Fatalf("got %d bytes free, expected 40", n)
+	}
+
+	// the usage is counted once, not by walking the base again
+	writeTree(t, dir, map[string]string{"/outside.txt": strings.Repeat("x", 30)})
+	if n := free(); n != 40 {
+		t.Errorf("got %d bytes free after a change behind the filesystem, expected 40", n)
+	}
+
+	if err := qfs.Truncate("/a.txt", 200); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the truncation to exceed the quota, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil || info.Size() != 60 {
+		t.Errorf("the truncation over the quota happened: %v", err)
+	}
+	f, err := qfs.OpenFile("/a.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte(strings.Repeat("y", 60)), 30); err != nil {
+		t.Error(err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(strings.Repeat("z", 20))); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the write to exceed the quota, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := free(); n != 10 {
+		t.Errorf("got %d bytes free, expected 10", n)
+	}
+
+	if err := qfs.Rename("/a.txt", "/d/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := free(); n != 10 {
+		t.Errorf("got %d bytes free after a rename, expected 10", n)
+	}
+	if err := qfs.RemoveAll("/d"); err != nil {
+		t.Fatal(err)
+	}
+	if n := free(); n != 100 {
+		t.Errorf("got %d bytes free after the removal, expected 100", n)
+	}
+
+	// files changed behind the filesystem are counted when written to
+	f, err = qfs.OpenFile("/outside.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := free(); n != 69 {
+		t.Errorf("got %d bytes free, expected 69", n)
+	}
+}
+
+func TestReserveSpace(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"/a.txt": strings.Repeat("x", 60)})
+
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.ReserveSpace(1 << 10); err != nil {
+		t.Errorf("reserving a little space: %v", err)
+	}
+	if _, _, _, err := bfs.StatFS(); err == nil {
+		if err := bfs.ReserveSpace(1 << 62); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("expected ENOSPC, got %v", err)
+		}
+	}
+
+	qfs, err := bfs.Clone(basefs.WithQuota(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qfs.ReserveSpace(40); err != nil {
+		t.Errorf("reserving the rest of the quota: %v", err)
+	}
+	if err := qfs.ReserveSpace(41); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the quota to be exceeded, got %v", err)
+	}
+	if err := qfs.WriteFile("/c.txt", make([]byte, 30), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := qfs.ReserveSpace(11); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the written bytes to count, got %v", err)
+	}
+	if err := qfs.Remove("/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	err = qfs.CopyFile("/a.txt", "/b.txt", basefs.CheckSpace())
+	if !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected the copy to exceed the quota, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("copy started despite the check: %v", err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir), basefs.WithQuota(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err := bfs.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	granted := make(chan *basefs.Reservation, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := bfs.Reserve(30)
+			if err == nil {
+				granted <- r
+			} else if !errors.Is(err, basefs.ErrQuotaExceeded) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(granted)
+	var held []*basefs.Reservation
+	for r := range granted {
+		held = append(held, r)
+	}
+	if len(held) != 3 {
+		t.Fatalf("%d reservations of 30 bytes granted within a quota of 100", len(held))
+	}
+	if err := clone.ReserveSpace(11); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("expected reservations to count for clones, got %v", err)
+	}
+
+	held[0].Release()
+	held[0].Release()
+	if _, err := clone.Reserve(40); err != nil {
+		t.Errorf("reserving released space: %v", err)
+	}
+	if err := bfs.ReserveSpace(1); !errors.Is(err, basefs.ErrQuotaExceeded) {
+		t.Errorf("releasing twice returned space twice: %v", err)
+	}
+}
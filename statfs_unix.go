@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd
+
+package basefs
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+)
+
+// hostStatFS returns the capacity of the host filesystem holding `dir` if
+// `fs` is an osfs.FileSystem.
+func hostStatFS(fs absfs.FileSystem, dir string) (total, free, avail uint64, err error) {
+	if _, ok := fs.(*osfs.FileSystem); !ok {
+		return 0, 0, 0, errors.ErrUnsupported
+	}
+	var st syscall.Statfs_t
+	err = syscall.Statfs(filepath.FromSlash(dir), &st)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	return uint64(st.Blocks) * bsize, uint64(st.Bfree) * bsize, uint64(st.Bavail) * bsize, nil
+}
@@ -0,0 +1,45 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+)
+
+// statWorkers bounds the number of concurrent Stat calls made by StatMany.
+const statWorkers = 16
+
+// StatMany returns the FileInfos of all `names`, calling Stat on the
+// underlying filesystem concurrently. The FileInfo and error of each name are
+// at its index in the returned slices.
+func (f *FileSystem) StatMany(names []string) ([]os.FileInfo, []error) {
+	return statMany(names, f.path, f.statPath)
+}
+
+func statMany(names []string, translate func(string) (string, error), stat func(ppath, name string) (os.FileInfo, error)) ([]os.FileInfo, []error) {
+	infos := make([]os.FileInfo, len(names))
+	errs := make([]error, len(names))
+	ppaths := make([]string, len(names))
+	for i, name := range names {
+		ppaths[i], errs[i] = translate(name)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(statWorkers, len(names)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				infos[i], errs[i] = stat(ppaths[i], names[i])
+			}
+		}()
+	}
+	for i := range names {
+		if errs[i] == nil {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return infos, errs
+}
@@ -0,0 +1,94 @@
+package basefs
+
+import (
+	"os"
+	"sort"
+	"syscall"
+)
+
+// SubtreePolicy is the policy of a directory and the files below it, see
+// WithSubtreePolicy. Zero values stand for disabled settings.
+type SubtreePolicy struct {
+	// ReadOnly makes every change below the directory, and to the directory
+	// itself, fail with EROFS.
+	ReadOnly bool `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+
+	// Quota limits the total size of the regular files below the directory,
+	// as WithQuota does for the base.
+	Quota int64 `json:"quota,omitempty" yaml:"quota,omitempty"`
+
+	// MaxFiles limits the number of regular files below the directory. It is
+	// counted like Quota, so that creating a file which would exceed it fails
+	// with ErrQuotaExceeded before the file is created.
+	MaxFiles int64 `json:"max_files,omitempty" yaml:"max_files,omitempty"`
+
+	// CleanAfter makes CleanTemp, and so StartTempGC, remove the files below
+	// the directory which have not been modified for CleanAfter.
+	CleanAfter Duration `json:"clean_after,omitempty" yaml:"clean_after,omitempty"`
+}
+
+// subtree is a policy of the virtual directory `dir`.
+type subtree struct {
+	dir string
+	SubtreePolicy
+}
+
+// WithSubtreePolicy applies `p` to the virtual directory `dir` and the files
+// below it, in addition to the options of the whole filesystem and the
+// policies of the directories above it, e.g. to make "/config" read only and
+// limit "/uploads" to 1 GB. A subtree can't be both read only and cleaned.
+func WithSubtreePolicy(dir string, p SubtreePolicy) Option {
+	return func(o *options) error {
+		d, ok := join("/", dir)
+		if !ok || p.Quota < 0 || p.MaxFiles < 0 || p.CleanAfter < 0 || p.ReadOnly && p.CleanAfter > 0 {
+			return os.ErrInvalid
+		}
+		// Clones share the slice with the filesystem they were made from.
+		o.subtrees = append(o.subtrees[:len(o.subtrees):len(o.subtrees)], subtree{d, p})
+		return nil
+	}
+}
+
+// covers reports whether the virtual path `name` is in the subtree.
+func (s *subtree) covers(name string) bool {
+	_, ok := trimDir(s.dir, name)
+	return ok
+}
+
+// checkSubtrees fails with EROFS if `ppath` on the underlying filesystem is in
+// a read only subtree.
+func (o *options) checkSubtrees(op, ppath string) error {
+	name := vpath(o.base, ppath)
+	for i := range o.subtrees {
+		if s := &o.subtrees[i]; s.ReadOnly && s.covers(name) {
+			return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+		}
+	}
+	return nil
+}
+
+// subtreePolicies returns the subtree policies by directory.
+func (o *options) subtreePolicies() map[string]SubtreePolicy {
+	if len(o.subtrees) == 0 {
+		return nil
+	}
+	m := make(map[string]SubtreePolicy, len(o.subtrees))
+	for _, s := range o.subtrees {
+		m[s.dir] = s.SubtreePolicy
+	}
+	return m
+}
+
+// subtreeOptions returns the options applying the subtree policies `m`.
+func subtreeOptions(m map[string]SubtreePolicy) []Option {
+	dirs := make([]string, 0, len(m))
+	for dir := range m {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	opts := make([]Option, len(dirs))
+	for i, dir := range dirs {
+		opts[i] = WithSubtreePolicy(dir, m[dir])
+	}
+	return opts
+}
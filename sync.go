@@ -0,0 +1,144 @@
+package basefs
+
+import (
+	"os"
+	"path"
+	"sort"
+
+	"github.com/absfs/absfs"
+)
+
+// SyncOption configures SyncTo.
+type SyncOption func(*syncOptions) error
+
+type syncOptions struct {
+	diff   []DiffOption
+	dryRun bool
+	keep   bool
+}
+
+// DryRun reports the changes SyncTo would make without applying them.
+func DryRun() SyncOption {
+	return func(o *syncOptions) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// KeepExtraneous leaves entries that only exist in the destination in place.
+func KeepExtraneous() SyncOption {
+	return func(o *syncOptions) error {
+		o.keep = true
+		return nil
+	}
+}
+
+// SyncDiffOptions configures how SyncTo detects changes, e.g. to compare file
+// contents or to exclude paths with Ignore.
+func SyncDiffOptions(opts ...DiffOption) SyncOption {
+	return func(o *syncOptions) error {
+		o.diff = append(o.diff, opts...)
+		return nil
+	}
+}
+
+// SyncTo makes the tree of `dst` match this filesystem. New and changed files
+// are copied along with their permissions and modification times, symbolic
+// links are recreated with the same target if both filesystems support them
+// and skipped otherwise, and extraneous entries in `dst` are removed. It
+// returns the changes applied to `dst`, removals of whole directories are
+// reported once.
+func (f *FileSystem) SyncTo(dst absfs.FileSystem, opts ...SyncOption) ([]Change, error) {
+	return syncTo(f.outer(), dst, opts)
+}
+
+func syncTo(src, dst absfs.FileSystem, opts []SyncOption) ([]Change, error) {
+	var o syncOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []Change
+	var removed string
+	dirs := make(map[string]bool)
+	err := diff(dst, src, o.diff, func(c Change) error {
+		if removed != "" && within(removed, c.Path) && c.Kind == Removed {
+			return nil
+		}
+		if c.Kind == Removed && o.keep {
+			return nil
+		}
+		changes = append(changes, c)
+		if c.Kind == Removed || c.Kind == Modified && c.Old.IsDir() != c.New.IsDir() {
+			removed = c.Path
+		}
+		if o.dryRun {
+			return nil
+		}
+
+		dirs[path.Dir(c.Path)] = true
+		if c.New != nil && c.New.IsDir() {
+			dirs[c.Path] = true
+		}
+		return applyChange(src, dst, c)
+	})
+	if err != nil || o.dryRun {
+		return changes, err
+	}
+
+	// Restore directory modification times, deepest first, after their
+	// contents have been changed.
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		info, err := src.Stat(name)
+		if err != nil {
+			return changes, err
+		}
+		err = dst.Chtimes(name, info.ModTime(), info.ModTime())
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+func applyChange(src, dst absfs.FileSystem, c Change) error {
+	switch {
+	case c.Kind == Removed:
+		return dst.RemoveAll(c.Path)
+	case c.Kind == Modified && c.Old.IsDir() != c.New.IsDir():
+		err := dst.RemoveAll(c.Path)
+		if err != nil {
+			return err
+		}
+	case c.Kind == Modified && c.New.IsDir():
+		return dst.Chmod(c.Path, c.New.Mode().Perm())
+	}
+
+	if c.New.IsDir() {
+		err := dst.Mkdir(c.Path, c.New.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		return dst.Chmod(c.Path, c.New.Mode().Perm())
+	}
+	// A link in the destination must not be written through.
+	if c.Old != nil && c.Old.Mode()&os.ModeSymlink != 0 {
+		if err := dst.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	switch mode := c.New.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		return copySymlink(src, c.Path, dst, c.Path, "/")
+	case !mode.IsRegular():
+		return nil
+	}
+	return copyFile(src, c.Path, dst, c.Path, c.New, nil)
+}
@@ -0,0 +1,108 @@
+package basefs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// CreateTemp creates a new file in the directory `dir`, or TempDir if `dir` is
+// empty, opens it for reading and writing and returns it, as os.CreateTemp
+// does. The name is made from `pattern` by replacing its last "*" with a
+// random string, or by appending one. Use Name to find its path and
+// RemoveOnClose to have it removed with the filesystem.
+func (f *FileSystem) CreateTemp(dir, pattern string) (absfs.File, error) {
+	dir, err := f.tempDir(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for try := 0; ; try++ {
+		file, err := f.outer().OpenFile(tempName(dir, pattern), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) && try < 100 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// MkdirTemp creates a new directory in the directory `dir`, or TempDir if
+// `dir` is empty, and returns its path, as os.MkdirTemp does. The name is made
+// from `pattern` as by CreateTemp.
+func (f *FileSystem) MkdirTemp(dir, pattern string) (string, error) {
+	dir, err := f.tempDir(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	for try := 0; ; try++ {
+		name := tempName(dir, pattern)
+		err := f.outer().Mkdir(name, 0700)
+		if os.IsExist(err) && try < 100 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// tempDir returns the directory to create a temporary file in, creating
+// TempDir if it is used.
+func (f *FileSystem) tempDir(dir, pattern string) (string, error) {
+	if strings.Contains(pattern, "/") {
+		return "", &os.PathError{Op: "createtemp", Path: pattern, Err: errors.New("pattern contains path separator")}
+	}
+	if dir != "" {
+		return dir, nil
+	}
+	dir = f.TempDir()
+	if err := f.outer().MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func tempName(dir, pattern string) string {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	return path.Join(dir, prefix+randomName()+suffix)
+}
+
+// RemoveOnClose registers the file or directory `name` to be removed, along
+// with everything below it, when the filesystem is closed, e.g. for the
+// scratch files of a session made with CreateTemp or MkdirTemp. The path is
+// removed even if it was renamed to `name` or its contents replaced after the
+// call, and it is not an error if it doesn't exist by then.
+func (f *FileSystem) RemoveOnClose(name string) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if ppath == f.prefix {
+		return &os.PathError{Op: "removeonclose", Path: name, Err: os.ErrInvalid}
+	}
+	if err := f.opts.modify("remove", ppath); err != nil {
+		return err
+	}
+	f.opts.closers.add(removal{f, vpath(f.prefix, ppath)})
+	return nil
+}
+
+// removal removes a path registered with RemoveOnClose when it is closed.
+type removal struct {
+	fs   *FileSystem
+	name string
+}
+
+func (r removal) Close() error {
+	err := r.fs.outer().RemoveAll(r.name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
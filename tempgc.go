@@ -0,0 +1,150 @@
+package basefs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CleanTemp removes the files and empty directories below TempDir which have
+// not been modified for `olderThan`, along with abandoned staging files of
+// the content store, and returns the number of entries removed. TempDir
+// itself is kept. Subtrees with a CleanAfter policy are cleaned the same way,
+// using their own age limit.
+func (f *FileSystem) CleanTemp(olderThan time.Duration) (int, error) {
+	now := time.Now()
+	removed, err := f.cleanDir(f.TempDir(), now.Add(-olderThan))
+	if err != nil {
+		return removed, err
+	}
+	for _, s := range f.opts.subtrees {
+		if s.CleanAfter > 0 {
+			n, err := f.cleanDir(s.dir, now.Add(-time.Duration(s.CleanAfter)))
+			removed += n
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	if f.opts.cas != nil {
+		n, err := f.opts.cas.cleanStage(now.Add(-olderThan))
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// cleanDir removes the files and empty directories below `dir` last modified
+// before `cutoff`.
+func (f *FileSystem) cleanDir(dir string, cutoff time.Time) (int, error) {
+	var files, dirs []string
+	err := walk(f.outer(), dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if p == dir || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, p)
+		} else {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, p := range files {
+		if err := f.outer().Remove(p); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	// Directories which still hold recent files are left in place.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, p := range dirs {
+		if f.outer().Remove(p) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// cleanStage removes staging files last modified before `cutoff`, which were
+// left behind by writers that never closed their files.
+func (cs *contentStore) cleanStage(cutoff time.Time) (int, error) {
+	infos, err := readDir(cs.fs, cs.dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), "tmp-") || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := cs.fs.Remove(path.Join(cs.dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// tempGC runs CleanTemp periodically.
+type tempGC struct {
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+	release func()
+}
+
+// Close stops the collection. A run in progress is finished first.
+func (gc *tempGC) Close() error {
+	gc.once.Do(func() {
+		gc.release()
+		close(gc.done)
+		gc.wg.Wait()
+	})
+	return nil
+}
+
+// StartTempGC calls CleanTemp with `olderThan` every `interval` in the
+// background until the returned Closer or the filesystem is closed. Errors
+// are not reported, the files involved are retried on the next run.
+func (f *FileSystem) StartTempGC(interval, olderThan time.Duration) (io.Closer, error) {
+	if interval <= 0 {
+		return nil, os.ErrInvalid
+	}
+	gc := &tempGC{done: make(chan struct{})}
+	gc.release = func() { f.opts.closers.remove(gc) }
+	f.opts.closers.add(gc)
+
+	gc.wg.Add(1)
+	go func() {
+		defer gc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-gc.done:
+				return
+			case <-ticker.C:
+				f.CleanTemp(olderThan)
+			}
+		}
+	}()
+	return gc, nil
+}
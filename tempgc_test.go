@@ -0,0 +1,109 @@
+package basefs_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanTemp(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{
+		"/keep":         "keep",
+		"/tmp/old":      "old",
+		"/tmp/new":      "new",
+		"/tmp/dir/old":  "old",
+		"/tmp/busy/new": "new",
+	})
+	if bfs.TempDir() != "/tmp" {
+		t.Skipf("unexpected temp directory %s", bfs.TempDir())
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"/keep", "/tmp/old", "/tmp/dir/old", "/tmp/dir", "/tmp/busy"} {
+		if err := bfs.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := bfs.CleanTemp(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("removed %d entries, expected 3", n)
+	}
+	for _, name := range []string{"/tmp/old", "/tmp/dir"} {
+		if _, err := bfs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected it to be removed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"/keep", "/tmp", "/tmp/new", "/tmp/busy/new"} {
+		if _, err := bfs.Stat(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	gc, err := bfs.StartTempGC(10*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := bfs.Stat("/tmp/new"); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("temp files were not collected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := bfs.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveOnClose(t *testing.T) {
+	bfs := newTestFS(t, map[string]string{"/keep": "keep", "/work/": ""})
+	f, err := bfs.CreateTemp("/work", "session-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	if !strings.HasPrefix(name, "/work/session-") || !strings.HasSuffix(name, ".log") {
+		t.Errorf("CreateTemp name %s doesn't match the pattern", name)
+	}
+	dir, err := bfs.MkdirTemp("", "scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.WriteFile(dir+"/data", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.CreateTemp("", "a/*"); err == nil {
+		t.Error("CreateTemp accepted a pattern with a separator")
+	}
+
+	for _, name := range []string{name, dir, "/gone"} {
+		if err := bfs.RemoveOnClose(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bfs.RemoveOnClose("/"); err == nil {
+		t.Error("RemoveOnClose accepted the root")
+	}
+	// The file is still open, Close closes it before removing it.
+	if err := bfs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{name, dir} {
+		if _, err := bfs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected it to be removed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"/keep", "/work"} {
+		if _, err := bfs.Stat(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package basefs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// WithWriteTransformer passes the data written to files through the writer
+// returned by `t`, which writes the transformed data to the file it is given
+// and is closed when the file is closed, e.g. to normalize line endings of
+// everything written into the filesystem. Transformers apply to files opened
+// for writing with O_TRUNC or O_APPEND, as by Create and WriteFile, where the
+// data written forms a stream. Reading, seeking and writing at an offset fail
+// on these files with errors.ErrUnsupported. Transformers given earlier see
+// the data first.
+func WithWriteTransformer(t func(io.Writer) io.WriteCloser) Option {
+	return func(o *options) error {
+		o.writeTransformers = append(o.writeTransformers[:len(o.writeTransformers):len(o.writeTransformers)], t)
+		return nil
+	}
+}
+
+// WithReadTransformer passes the data read from files opened read only
+// through the reader returned by `t`, which reads from the file it is given.
+// Seeking and reading at an offset fail on these files with
+// errors.ErrUnsupported, and Stat reports the size of the stored data.
+// Transformers given earlier see the data first.
+func WithReadTransformer(t func(io.Reader) io.Reader) Option {
+	return func(o *options) error {
+		o.readTransformers = append(o.readTransformers[:len(o.readTransformers):len(o.readTransformers)], t)
+		return nil
+	}
+}
+
+// transformWriter returns the writer passing data through the write
+// transformers to `w`.
+func (o *options) transformWriter(w io.Writer) io.WriteCloser {
+	tw := &transformWriter{Writer: w}
+	for i := len(o.writeTransformers) - 1; i >= 0; i-- {
+		wc := o.writeTransformers[i](tw.Writer)
+		tw.Writer = wc
+		tw.closers = append(tw.closers, wc)
+	}
+	return tw
+}
+
+// transformWriter is a chain of write transformers.
+type transformWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// Close closes the transformers, starting with the one seeing the data
+// first, so that each one can flush its output into the next.
+func (w *transformWriter) Close() error {
+	var errs []error
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if err := w.closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// transformReader returns the reader passing data read from `r` through the
+// read transformers.
+func (o *options) transformReader(r io.Reader) io.Reader {
+	for _, t := range o.readTransformers {
+		r = t(r)
+	}
+	return r
+}
+
+// transform sets up the transformers for a file opened with `flags`.
+func (f *File) transform(flags int) {
+	switch {
+	case flags&(os.O_WRONLY|os.O_RDWR) == 0:
+		f.transformed = len(f.opts.readTransformers) > 0
+	case flags&(os.O_TRUNC|os.O_APPEND) != 0 && len(f.opts.writeTransformers) > 0:
+		f.transformed = true
+		f.tw = f.opts.transformWriter(fileWriter{f})
+	}
+}
+
+// fileWriter writes the output of the write transformers to the file.
+type fileWriter struct {
+	f *File
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return w.f.write(p)
+}
+
+// fileReader is the input of the read transformers.
+type fileReader struct {
+	f *File
+}
+
+func (r fileReader) Read(p []byte) (int, error) {
+	return r.f.read(p)
+}
+
+// stream fails with errors.ErrUnsupported for operations needing random
+// access to transformed files.
+func (f *File) stream(op string) error {
+	if !f.transformed {
+		return nil
+	}
+	return &os.PathError{Op: op, Path: f.Name(), Err: errors.ErrUnsupported}
+}
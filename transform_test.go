@@ -0,0 +1,81 @@
+package basefs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absfs/basefs"
+)
+
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+func (u upperWriter) Close() error {
+	return nil
+}
+
+type suffixWriter struct {
+	w      io.Writer
+	suffix string
+}
+
+func (s suffixWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s suffixWriter) Close() error {
+	_, err := io.WriteString(s.w, s.suffix)
+	return err
+}
+
+func TestTransformers(t *testing.T) {
+	base := newTestFS(t, map[string]string{"/old": "x"})
+	bfs, err := base.Clone(
+		basefs.WithWriteTransformer(func(w io.Writer) io.WriteCloser { return upperWriter{w} }),
+		basefs.WithWriteTransformer(func(w io.Writer) io.WriteCloser { return suffixWriter{w, "!"} }),
+		basefs.WithReadTransformer(func(r io.Reader) io.Reader { return io.MultiReader(strings.NewReader(">"), r) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := bfs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(f, "abc")
+	f.Write([]byte("def"))
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected seeking a transformed stream to fail, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := base.ReadFile("/file"); string(data) != "ABCDEF!" {
+		t.Errorf("stored %q", data)
+	}
+	if data, _ := bfs.ReadFile("/file"); string(data) != ">ABCDEF!" {
+		t.Errorf("read %q", data)
+	}
+
+	f, err = bfs.OpenFile("/old", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("y"), 0); err != nil {
+		t.Errorf("expected files written in place not to be transformed: %v", err)
+	}
+	f.Close()
+	if data, _ := base.ReadFile("/old"); string(data) != "y" {
+		t.Errorf("stored %q", data)
+	}
+}
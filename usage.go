@@ -0,0 +1,271 @@
+package basefs
+
+import (
+	"os"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// usageCounter keeps the sizes of the regular files below the base, so that
+// quotas can be checked without walking the base. It is filled by walking the
+// base once, when it is first needed, and then kept up to date by the writes
+// and mutations made through the filesystem. It is shared by clones.
+type usageCounter struct {
+	mu     sync.Mutex
+	seeded bool
+
+	// sizes of the files by path on the underlying filesystem, and the
+	// usage of the limited directories
+	sizes  map[string]int64
+	totals map[string]*Usage
+}
+
+// limit is a limit on the usage of the directory `dir` on the underlying
+// filesystem. Zero values stand for no limit.
+type limit struct {
+	dir   string
+	bytes int64
+	files int64
+}
+
+// seed walks the base of `fs` to fill the counter if this hasn't been done
+// yet. It must be called with the lock held.
+func (c *usageCounter) seed(o *options, fs absfs.FileSystem) error {
+	if c.seeded {
+		return nil
+	}
+	sizes := make(map[string]int64)
+	err := walk(fs, o.base, func(ppath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			sizes[ppath] = o.stat(ppath, info).Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.sizes, c.totals, c.seeded = sizes, make(map[string]*Usage), true
+	return nil
+}
+
+// active reports whether the counter is in use.
+func (c *usageCounter) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seeded
+}
+
+// usage returns the usage of the directory `dir`, which is kept up to date
+// from then on if `keep` is set.
+func (c *usageCounter) usage(o *options, fs absfs.FileSystem, dir string, keep bool) (Usage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.seed(o, fs); err != nil {
+		return Usage{}, err
+	}
+	if keep {
+		return *c.total(dir), nil
+	}
+	return c.sum(dir), nil
+}
+
+// total returns the kept usage of `dir`, summing it up the first time.
+func (c *usageCounter) total(dir string) *Usage {
+	t, ok := c.totals[dir]
+	if !ok {
+		u := c.sum(dir)
+		t = &u
+		c.totals[dir] = t
+	}
+	return t
+}
+
+// sum adds up the usage of `dir`.
+func (c *usageCounter) sum(dir string) Usage {
+	var u Usage
+	for p, n := range c.sizes {
+		if within(dir, p) {
+			u.Bytes += n
+			u.Files++
+		}
+	}
+	return u
+}
+
+// size returns the counted size of the file at `ppath`.
+func (c *usageCounter) size(ppath string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sizes[ppath]
+}
+
+// admit fills the counter before the file at `ppath` is opened for writing
+// and, if it may be `created`, counts it, unless it is known already or this
+// takes a directory over the number of files one of the `limits` allows. It
+// reports whether the file was counted.
+func (c *usageCounter) admit(o *options, fs absfs.FileSystem, ppath string, created bool, limits []limit) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.seed(o, fs); err != nil {
+		return false, err
+	}
+	if _, ok := c.sizes[ppath]; ok || !created {
+		return false, nil
+	}
+	for _, l := range limits {
+		if l.files > 0 && within(l.dir, ppath) && c.total(l.dir).Files >= l.files {
+			return false, ErrQuotaExceeded
+		}
+	}
+	c.put(ppath, 0)
+	return true, nil
+}
+
+// grow adds `delta` bytes to the size of the file at `ppath`, unless this
+// takes a directory over the size one of the `limits` allows.
+func (c *usageCounter) grow(o *options, fs absfs.FileSystem, ppath string, delta int64, limits []limit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.seed(o, fs); err != nil {
+		return err
+	}
+	return c.add(ppath, delta, limits)
+}
+
+// resize sets the size of the file at `ppath` to `size`, failing like grow.
+func (c *usageCounter) resize(o *options, fs absfs.FileSystem, ppath string, size int64, limits []limit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.seed(o, fs); err != nil {
+		return err
+	}
+	return c.add(ppath, size-c.sizes[ppath], limits)
+}
+
+// add adds `delta` bytes to the size of the file at `ppath` if the `limits`
+// allow it.
+func (c *usageCounter) add(ppath string, delta int64, limits []limit) error {
+	if delta > 0 {
+		for _, l := range limits {
+			if l.bytes > 0 && within(l.dir, ppath) && c.total(l.dir).Bytes+delta > l.bytes {
+				return ErrQuotaExceeded
+			}
+		}
+	}
+	c.put(ppath, c.sizes[ppath]+delta)
+	return nil
+}
+
+// over reports whether the file at `ppath` is in a directory which is over
+// one of the `limits`.
+func (c *usageCounter) over(ppath string, limits []limit) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.seeded {
+		return false
+	}
+	for _, l := range limits {
+		if !within(l.dir, ppath) {
+			continue
+		}
+		t := c.total(l.dir)
+		if l.bytes > 0 && t.Bytes > l.bytes || l.files > 0 && t.Files > l.files {
+			return true
+		}
+	}
+	return false
+}
+
+// set records the size of the file at `ppath`, if the counter is in use.
+func (c *usageCounter) set(ppath string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seeded {
+		c.put(ppath, size)
+	}
+}
+
+// update follows the mutation `op` of `ppath` and, for renames and
+// exchanges, `target`, if the counter is in use. Both are paths on the
+// underlying filesystem below `base`.
+func (c *usageCounter) update(base, op, ppath, target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.seeded {
+		return
+	}
+	switch op {
+	case "remove", "removeall":
+		c.take(ppath)
+	case "rename":
+		moved := c.take(ppath)
+		c.take(target)
+		c.place(base, moved, ppath, target)
+	case "exchange":
+		a, b := c.take(ppath), c.take(target)
+		c.place(base, a, ppath, target)
+		c.place(base, b, target, ppath)
+	}
+}
+
+// take forgets the files at or below `ppath` and returns their sizes.
+func (c *usageCounter) take(ppath string) map[string]int64 {
+	taken := make(map[string]int64)
+	if n, ok := c.sizes[ppath]; ok {
+		taken[ppath] = n
+	} else {
+		for p, n := range c.sizes {
+			if within(ppath, p) {
+				taken[p] = n
+			}
+		}
+	}
+	for p := range taken {
+		c.drop(p)
+	}
+	return taken
+}
+
+// place records the files `taken` from below `from` below `to`, unless they
+// left the base.
+func (c *usageCounter) place(base string, taken map[string]int64, from, to string) {
+	if !within(base, to) {
+		return
+	}
+	for p, n := range taken {
+		c.put(to+p[len(from):], n)
+	}
+}
+
+// put records the size of the file at `ppath`.
+func (c *usageCounter) put(ppath string, size int64) {
+	n, ok := c.sizes[ppath]
+	for dir, t := range c.totals {
+		if within(dir, ppath) {
+			t.Bytes += size - n
+			if !ok {
+				t.Files++
+			}
+		}
+	}
+	c.sizes[ppath] = size
+}
+
+// drop forgets the file at `ppath`.
+func (c *usageCounter) drop(ppath string) {
+	n, ok := c.sizes[ppath]
+	if !ok {
+		return
+	}
+	for dir, t := range c.totals {
+		if within(dir, ppath) {
+			t.Bytes -= n
+			t.Files--
+		}
+	}
+	delete(c.sizes, ppath)
+}
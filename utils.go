@@ -1,25 +1,76 @@
 package basefs
 
 import (
+	"reflect"
+
 	"github.com/absfs/absfs"
 )
 
-// Unwrap checks if `fs` is a `*basefs.FileSystem` and if so returns the
-// underlying `absfs.FileSystem`, otherwise it returns `fs`
+// Unwrap checks if `fs` is a `*basefs.FileSystem` or `*basefs.SymlinkFileSystem`
+// and if so returns the underlying `absfs.FileSystem`, otherwise it returns
+// `fs`. Use As to look through several layers of wrappers.
 func Unwrap(fs absfs.FileSystem) absfs.FileSystem {
-	bfs, ok := fs.(*SymlinkFileSystem)
-	if ok {
+	switch bfs := fs.(type) {
+	case *SymlinkFileSystem:
+		return bfs.fs
+	case *FileSystem:
 		return bfs.fs
 	}
 	return fs
 }
 
-// Prefix checks if `fs` is a `*basefs.FileSystem` and if so returns the prefix.
-// otherwise it returns an empty string
+// Prefix checks if `fs` is a `*basefs.FileSystem` or `*basefs.SymlinkFileSystem`
+// and if so returns the prefix, otherwise it returns an empty string.
 func Prefix(fs absfs.FileSystem) string {
-	bfs, ok := fs.(*SymlinkFileSystem)
-	if ok {
+	switch bfs := fs.(type) {
+	case *SymlinkFileSystem:
+		return bfs.prefix
+	case *FileSystem:
 		return bfs.prefix
 	}
 	return ""
 }
+
+// Unwrap returns the underlying filesystem.
+func (f *FileSystem) Unwrap() absfs.FileSystem {
+	return f.fs
+}
+
+// Unwrap returns the file of the underlying filesystem.
+func (f *File) Unwrap() absfs.File {
+	return f.f
+}
+
+// As finds the first filesystem or file in the chain starting at `v` that is
+// assignable to the value pointed to by `target`, sets `target` to it and
+// returns true, or returns false if there is none. The chain is followed
+// through methods `Unwrap() absfs.FileSystem` and `Unwrap() absfs.File`, as
+// implemented by FileSystem, SymlinkFileSystem and File, so As discovers
+// concrete types below any number of wrappers. Like with errors.As, values
+// may implement a method `As(any) bool` to match other types. As panics if
+// `target` is not a non-nil pointer.
+func As(v, target any) bool {
+	val := reflect.ValueOf(target)
+	if target == nil || val.Kind() != reflect.Ptr || val.IsNil() {
+		panic("basefs: target must be a non-nil pointer")
+	}
+	typ := val.Type().Elem()
+	for v != nil {
+		if reflect.TypeOf(v).AssignableTo(typ) {
+			val.Elem().Set(reflect.ValueOf(v))
+			return true
+		}
+		if x, ok := v.(interface{ As(any) bool }); ok && x.As(target) {
+			return true
+		}
+		switch u := v.(type) {
+		case interface{ Unwrap() absfs.FileSystem }:
+			v = u.Unwrap()
+		case interface{ Unwrap() absfs.File }:
+			v = u.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package basefs
+
+import "github.com/absfs/absfs"
+
+// VectorFile is implemented by files which support vectored reads and
+// writes at an offset.
+type VectorFile interface {
+	ReadV(bufs [][]byte, off int64) (int, error)
+	WriteV(bufs [][]byte, off int64) (int, error)
+}
+
+// ReadV reads into `bufs` in order, starting at the offset `off` of the file,
+// and returns the total number of bytes read. As with ReadAt, a non-nil error
+// is returned if fewer bytes than the combined size of `bufs` were read. The
+// call is passed on to the underlying file if it implements VectorFile, uses
+// preadv(2) for os files where supported, and is emulated otherwise.
+func (f *File) ReadV(bufs [][]byte, off int64) (int, error) {
+	if err := f.stream("read"); err != nil {
+		return 0, err
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	n, err := readV(f.f, bufs, off)
+	return n, fixerr(f.prefix, err)
+}
+
+// WriteV writes `bufs` in order, starting at the offset `off` of the file,
+// and returns the total number of bytes written. The call is passed on to the
+// underlying file if it implements VectorFile, uses pwritev(2) for os files
+// where supported, and is emulated otherwise.
+func (f *File) WriteV(bufs [][]byte, off int64) (int, error) {
+	if err := f.stream("write"); err != nil {
+		return 0, err
+	}
+	f.unhash()
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	if _, err := f.claim("write", off, int64(size(bufs))); err != nil {
+		return 0, err
+	}
+	n, err := writeV(f.f, bufs, off)
+	f.modified(n)
+	if err == nil {
+		err = f.syncWrite()
+	}
+	return n, fixerr(f.prefix, err)
+}
+
+func readV(f absfs.File, bufs [][]byte, off int64) (int, error) {
+	if v, ok := f.(VectorFile); ok {
+		return v.ReadV(bufs, off)
+	}
+	if n, ok, err := preadv(f, bufs, off); ok {
+		return n, err
+	}
+	var total int
+	for _, b := range bufs {
+		n, err := f.ReadAt(b, off)
+		total += n
+		off += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func writeV(f absfs.File, bufs [][]byte, off int64) (int, error) {
+	if v, ok := f.(VectorFile); ok {
+		return v.WriteV(bufs, off)
+	}
+	if n, ok, err := pwritev(f, bufs, off); ok {
+		return n, err
+	}
+	var total int
+	for _, b := range bufs {
+		n, err := f.WriteAt(b, off)
+		total += n
+		off += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// advance drops the first `n` bytes from `bufs`.
+func advance(bufs [][]byte, n int) [][]byte {
+	for len(bufs) > 0 && n >= len(bufs[0]) {
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	if len(bufs) > 0 && n > 0 {
+		bufs = append([][]byte{bufs[0][n:]}, bufs[1:]...)
+	}
+	return bufs
+}
+
+// size returns the combined length of `bufs`.
+func size(bufs [][]byte) int {
+	var n int
+	for _, b := range bufs {
+		n += len(b)
+	}
+	return n
+}
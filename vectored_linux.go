@@ -0,0 +1,75 @@
+package basefs
+
+import (
+	"io"
+	"syscall"
+
+	"github.com/absfs/absfs"
+	"golang.org/x/sys/unix"
+)
+
+// preadv reads with preadv(2) if `f` exposes its file descriptor, reporting
+// false otherwise.
+func preadv(f absfs.File, bufs [][]byte, off int64) (total int, ok bool, err error) {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return 0, false, nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	want := size(bufs)
+	for total < want && err == nil {
+		var n int
+		cerr := rc.Read(func(fd uintptr) bool {
+			n, err = unix.Preadv(int(fd), bufs, off)
+			return true
+		})
+		if cerr != nil {
+			return total, true, cerr
+		}
+		if n <= 0 && err == nil {
+			err = io.EOF
+		}
+		if n > 0 {
+			total += n
+			off += int64(n)
+			bufs = advance(bufs, n)
+		}
+	}
+	return total, true, err
+}
+
+// pwritev writes with pwritev(2) if `f` exposes its file descriptor,
+// reporting false otherwise.
+func pwritev(f absfs.File, bufs [][]byte, off int64) (total int, ok bool, err error) {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return 0, false, nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	want := size(bufs)
+	for total < want && err == nil {
+		var n int
+		cerr := rc.Write(func(fd uintptr) bool {
+			n, err = unix.Pwritev(int(fd), bufs, off)
+			return true
+		})
+		if cerr != nil {
+			return total, true, cerr
+		}
+		if n <= 0 && err == nil {
+			err = io.ErrShortWrite
+		}
+		if n > 0 {
+			total += n
+			off += int64(n)
+			bufs = advance(bufs, n)
+		}
+	}
+	return total, true, err
+}
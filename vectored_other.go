@@ -0,0 +1,15 @@
+//go:build !linux
+
+package basefs
+
+import "github.com/absfs/absfs"
+
+// preadv is not supported on this platform.
+func preadv(f absfs.File, bufs [][]byte, off int64) (int, bool, error) {
+	return 0, false, nil
+}
+
+// pwritev is not supported on this platform.
+func pwritev(f absfs.File, bufs [][]byte, off int64) (int, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,66 @@
+package basefs_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+// connFS opens plain os files, which expose their file descriptors.
+type connFS struct {
+	*osfs.FileSystem
+}
+
+func (connFS) OpenFile(name string, flags int, perm os.FileMode) (absfs.File, error) {
+	f, err := os.OpenFile(name, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func TestVectored(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []absfs.SymlinkFileSystem{ofs, connFS{ofs}} {
+		dir, err := filepath.Abs(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bfs, err := basefs.NewFS(fs, filepath.ToSlash(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := bfs.Create("/file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bf := f.(*basefs.File)
+		n, err := bf.WriteV([][]byte{[]byte("head"), nil, []byte("-body-"), []byte("tail")}, 2)
+		if err != nil || n != 14 {
+			t.Fatalf("%T: wrote %d %v", fs, n, err)
+		}
+
+		a, b, c := make([]byte, 3), make([]byte, 4), make([]byte, 20)
+		n, err = bf.ReadV([][]byte{a, b, c}, 0)
+		if n != 16 || err != io.EOF {
+			t.Errorf("%T: read %d %v, expected 16 and EOF", fs, n, err)
+		}
+		got := append(append(a, b...), c[:9]...)
+		if !bytes.Equal(got, []byte("\x00\x00head-body-tail")) {
+			t.Errorf("%T: got %q", fs, got)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
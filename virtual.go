@@ -0,0 +1,214 @@
+package basefs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// RegisterVirtual makes a read only file with the contents returned by
+// `content` appear at the virtual path `name`, e.g. to expose metadata of a
+// sandbox to the processes using it. `content` is called whenever the file is
+// opened or its FileInfo is needed, and its error is returned by the
+// operation. Virtual files are listed in their directory if it exists on the
+// underlying filesystem, and replace any file of the same name. Changing or
+// removing them fails with EROFS. A nil `content` removes the virtual file.
+func (f *FileSystem) RegisterVirtual(name string, content func() ([]byte, error)) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if ppath == f.prefix {
+		return &os.PathError{Op: "registervirtual", Path: name, Err: os.ErrInvalid}
+	}
+	if content == nil {
+		if b := f.opts.binds.get(ppath); b != nil && b.content != nil {
+			f.opts.binds.set(ppath, nil)
+		}
+		return nil
+	}
+	f.opts.binds.set(ppath, &binding{content: content})
+	return nil
+}
+
+// reshaped reports whether directory listings may differ from those of the
+// underlying filesystem, because of Hide, RegisterVirtual or MountReadOnly.
+func (o *options) reshaped() bool {
+	return o.hidden.n.Load() > 0 || o.binds.virtual.Load() > 0 || o.binds.mounts.Load() > 0
+}
+
+// listVirtual returns the FileInfos of the virtual files in the directory
+// `dir` on the underlying filesystem, sorted by name.
+func (o *options) listVirtual(dir string) []os.FileInfo {
+	if o.binds.virtual.Load() == 0 {
+		return nil
+	}
+	o.binds.mu.RLock()
+	var infos []os.FileInfo
+	for ppath, b := range o.binds.m {
+		if b.content == nil || path.Dir(ppath) != dir || !o.visible(ppath) {
+			continue
+		}
+		info, err := b.statVirtual(ppath)
+		if err != nil {
+			info = &virtualInfo{name: path.Base(ppath), modTime: time.Now()}
+		}
+		infos = append(infos, info)
+	}
+	o.binds.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos
+}
+
+func (b *binding) statVirtual(name string) (os.FileInfo, error) {
+	data, err := b.content()
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return &virtualInfo{name: path.Base(name), size: int64(len(data)), modTime: time.Now()}, nil
+}
+
+func (b *binding) openVirtual(name string) (absfs.File, error) {
+	data, err := b.content()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := &virtualInfo{name: path.Base(name), size: int64(len(data)), modTime: time.Now()}
+	return &virtualFile{name: name, r: bytes.NewReader(data), info: info}, nil
+}
+
+// virtualInfo describes a virtual file.
+type virtualInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *virtualInfo) Name() string       { return i.name }
+func (i *virtualInfo) Size() int64        { return i.size }
+func (i *virtualInfo) Mode() os.FileMode  { return 0444 }
+func (i *virtualInfo) ModTime() time.Time { return i.modTime }
+func (i *virtualInfo) IsDir() bool        { return false }
+func (i *virtualInfo) Sys() interface{}   { return nil }
+
+// virtualFile is an open virtual file, holding the contents generated when it
+// was opened.
+type virtualFile struct {
+	name   string
+	r      *bytes.Reader
+	info   os.FileInfo
+	closed atomic.Bool
+}
+
+// err returns the error of the operation `op`, if the file is closed or
+// `fail` is set.
+func (f *virtualFile) err(op string, fail error) error {
+	if f.closed.Load() {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if fail != nil {
+		return &os.PathError{Op: op, Path: f.name, Err: fail}
+	}
+	return nil
+}
+
+func (f *virtualFile) Name() string {
+	return f.name
+}
+
+func (f *virtualFile) Read(p []byte) (int, error) {
+	if err := f.err("read", nil); err != nil {
+		return 0, err
+	}
+	return f.r.Read(p)
+}
+
+func (f *virtualFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.err("read", nil); err != nil {
+		return 0, err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func (f *virtualFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.err("seek", nil); err != nil {
+		return 0, err
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *virtualFile) Write(p []byte) (int, error) {
+	return 0, f.err("write", syscall.EBADF)
+}
+
+func (f *virtualFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.err("write", syscall.EBADF)
+}
+
+func (f *virtualFile) WriteString(s string) (int, error) {
+	return 0, f.err("write", syscall.EBADF)
+}
+
+func (f *virtualFile) Truncate(size int64) error {
+	return f.err("truncate", syscall.EBADF)
+}
+
+func (f *virtualFile) Sync() error {
+	return f.err("sync", nil)
+}
+
+func (f *virtualFile) Stat() (os.FileInfo, error) {
+	if err := f.err("stat", nil); err != nil {
+		return nil, err
+	}
+	return f.info, nil
+}
+
+func (f *virtualFile) Readdir(n int) ([]os.FileInfo, error) {
+	return nil, f.err("readdir", syscall.ENOTDIR)
+}
+
+func (f *virtualFile) Readdirnames(n int) ([]string, error) {
+	return nil, f.err("readdir", syscall.ENOTDIR)
+}
+
+func (f *virtualFile) Close() error {
+	if f.closed.Swap(true) {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+// addVirtual adds the virtual files of the directory to the entries `infos`
+// read from it with Readdir(n), once the underlying directory is read to the
+// end.
+func (f *File) addVirtual(infos []os.FileInfo, n int, err error) ([]os.FileInfo, error) {
+	if !f.listed {
+		f.listed = true
+		dir, _ := f.location()
+		f.virtuals = f.opts.listVirtual(dir)
+	}
+	if len(f.virtuals) == 0 {
+		return infos, err
+	}
+	if n <= 0 {
+		if err == nil {
+			infos = append(infos, f.virtuals...)
+			f.virtuals = nil
+		}
+		return infos, err
+	}
+	if len(infos) == 0 && err == io.EOF {
+		k := min(n, len(f.virtuals))
+		infos, f.virtuals = f.virtuals[:k:k], f.virtuals[k:]
+		return infos, nil
+	}
+	return infos, err
+}
@@ -0,0 +1,224 @@
+package basefs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// WithIntentLog makes the helpers which replace a file by writing a temporary
+// file next to it and renaming it into place, CopyFile and WriteFileAtomic,
+// record what they are about to do in the directory `dir`, an absolute path
+// on the underlying filesystem, before changing anything. An operation is
+// marked committed once its temporary file is completely written and synced.
+// If the process dies before the operation is finished, Recover completes it
+// if it was committed and rolls it back by removing the temporary file
+// otherwise, so the destination is either left alone or fully replaced.
+// Without an intent log, CopyFile writes to the destination directly.
+func WithIntentLog(dir string) Option {
+	return func(o *options) error {
+		if !path.IsAbs(dir) {
+			return &os.PathError{Op: "intentlog", Path: dir, Err: errors.New("not an absolute path")}
+		}
+		o.intentLog = path.Clean(dir)
+		return nil
+	}
+}
+
+// intent is an entry of the intent log. Paths are on the underlying
+// filesystem.
+type intent struct {
+	ID     string `json:"id"`
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Temp   string `json:"temp"`
+	Commit bool   `json:"commit,omitempty"`
+}
+
+// logIntent writes `in` to the intent log, replacing the previous state of
+// the same operation. Entries are synced and renamed into place, so they are
+// never seen half written.
+func (o *options) logIntent(fs absfs.FileSystem, in *intent) error {
+	if o.intentLog == "" {
+		return nil
+	}
+	if err := fs.MkdirAll(o.intentLog, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(o.intentLog, in.ID+".tmp")
+	f, err := fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	return fs.Rename(tmp, path.Join(o.intentLog, in.ID+".json"))
+}
+
+// forgetIntent removes the finished operation `in` from the intent log.
+func (o *options) forgetIntent(fs absfs.FileSystem, in *intent) {
+	if o.intentLog != "" {
+		fs.Remove(path.Join(o.intentLog, in.ID+".json"))
+	}
+}
+
+// replace replaces the file `name` by a temporary file in the same directory,
+// which is written by `write` and synced, unless the sync policy is
+// SyncNever, before it is renamed into place. The steps are recorded in the
+// intent log if there is one.
+func (f *FileSystem) replace(op, name string, write func(tmp string) error) error {
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if ppath == f.prefix {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	tpath := path.Join(path.Dir(ppath), ".basefs-tmp-"+randomName())
+	tmp := vpath(f.prefix, tpath)
+
+	in := &intent{ID: randomName(), Op: op, Path: ppath, Temp: tpath}
+	if err := f.opts.logIntent(f.fs, in); err != nil {
+		return err
+	}
+	defer f.opts.forgetIntent(f.fs, in)
+
+	err = write(tmp)
+	if err == nil && f.opts.syncPolicy != SyncNever {
+		err = syncPath(f.fs, tpath)
+	}
+	if err == nil && f.opts.intentLog != "" {
+		in.Commit = true
+		err = f.opts.logIntent(f.fs, in)
+	}
+	if err == nil {
+		err = f.outer().Rename(tmp, name)
+	}
+	if err != nil {
+		f.outer().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// syncPath commits the contents of the file at `ppath` on `fs` to stable
+// storage.
+func syncPath(fs absfs.FileSystem, ppath string) error {
+	f, err := fs.Open(ppath)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// WriteFileAtomic writes `data` to the named file like WriteFile, but through
+// a temporary file in the same directory which is synced and renamed over the
+// file, so readers and crashes see either the old or the new contents. The
+// file is created with `perm` even if it existed before. See WithIntentLog
+// for recovering from crashes in the middle of the operation.
+func (f *FileSystem) WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	return f.replace("writefileatomic", name, func(tmp string) error {
+		return f.WriteFile(tmp, data, perm)
+	})
+}
+
+// Recover completes or rolls back the operations in the intent log which
+// were interrupted, see WithIntentLog, and returns how many it found. It
+// can't tell interrupted operations from running ones, so it must be called
+// before the filesystem is used, e.g. right after creating it at startup.
+// Operations which can't be recovered are left in the log and reported in
+// the returned error.
+func (f *FileSystem) Recover() (int, error) {
+	o := f.opts
+	if o.intentLog == "" {
+		return 0, nil
+	}
+	infos, err := readDir(f.fs, o.intentLog)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var errs []error
+	for _, info := range infos {
+		p := path.Join(o.intentLog, info.Name())
+		switch {
+		case strings.HasSuffix(p, ".tmp"):
+			// An entry which was never renamed into place, the operation
+			// didn't go on.
+			f.fs.Remove(p)
+			continue
+		case !strings.HasSuffix(p, ".json"):
+			continue
+		}
+		n++
+		in, err := readIntent(f.fs, p)
+		if err == nil {
+			err = o.recover(f.fs, in)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.fs.Remove(p)
+	}
+	return n, errors.Join(errs...)
+}
+
+func readIntent(fs absfs.FileSystem, p string) (*intent, error) {
+	f, err := fs.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := new(intent)
+	if err := json.NewDecoder(f).Decode(in); err != nil {
+		return nil, &os.PathError{Op: "recover", Path: p, Err: err}
+	}
+	return in, nil
+}
+
+// recover completes the operation `in` if it was committed, and removes its
+// temporary file otherwise. Either may have happened already.
+func (o *options) recover(fs absfs.FileSystem, in *intent) error {
+	if in.Commit {
+		err := fs.Rename(in.Temp, in.Path)
+		if err == nil {
+			o.record("rename", vpath(o.base, in.Temp), vpath(o.base, in.Path))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	err := fs.Remove(in.Temp)
+	if err == nil {
+		o.record("remove", vpath(o.base, in.Temp), "")
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
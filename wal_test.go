@@ -0,0 +1,100 @@
+package basefs_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+func TestIntentLog(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+	base, log := dir+"/base", dir+"/intents"
+	writeTree(t, base, map[string]string{"/a": "old a", "/b": "old b", "/src": "source"})
+	bfs, err := basefs.NewFileSystem(ofs, base, basefs.WithIntentLog(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(base + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	entries := func(dir string) int {
+		t.Helper()
+		names, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return len(names)
+	}
+
+	if err := bfs.WriteFileAtomic("/a", []byte("new a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bfs.CopyFile("/src", "/copy"); err != nil {
+		t.Fatal(err)
+	}
+	if content("/a") != "new a" || content("/copy") != "source" {
+		t.Error("files not replaced")
+	}
+	if n := entries(base); n != 4 {
+		t.Errorf("%d entries in the base, want 4", n)
+	}
+	if n := entries(log); n != 0 {
+		t.Errorf("%d entries left in the intent log", n)
+	}
+
+	// Simulate a crash after the temporary file of /a was committed, and one
+	// while the temporary file of /b was being written.
+	interrupted := func(id, name string, commit bool) {
+		t.Helper()
+		tmp := base + "/.basefs-tmp-" + id
+		if err := os.WriteFile(tmp, []byte("recovered "+id), 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(map[string]any{"id": id, "op": "writefileatomic", "path": base + name, "temp": tmp, "commit": commit})
+		if err := os.WriteFile(log+"/"+id+".json", data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(log, 0700); err != nil {
+		t.Fatal(err)
+	}
+	interrupted("1", "/a", true)
+	interrupted("2", "/b", false)
+	if err := os.WriteFile(log+"/3.tmp", []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := bfs.Recover()
+	if err != nil || n != 2 {
+		t.Fatalf("Recover() = %d, %v, want 2, nil", n, err)
+	}
+	if got := content("/a"); got != "recovered 1" {
+		t.Errorf("/a = %q, want the committed contents", got)
+	}
+	if got := content("/b"); got != "old b" {
+		t.Errorf("/b = %q, want the old contents", got)
+	}
+	if n := entries(base); n != 4 {
+		t.Errorf("%d entries in the base after Recover, want 4", n)
+	}
+	if n := entries(log); n != 0 {
+		t.Errorf("%d entries left in the intent log after Recover", n)
+	}
+}
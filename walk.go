@@ -0,0 +1,495 @@
+package basefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/absfs/absfs"
+)
+
+// WalkOption configures Walk and FastWalk. With any options the tree is
+// walked by basefs itself instead of the underlying filesystem.
+type WalkOption func(*walkOptions) error
+
+type walkOptions struct {
+	follow     bool
+	maxDepth   int
+	maxEntries int
+	tolerant   bool
+	ordered    bool
+	batch      int
+}
+
+// ErrWalkLimit is returned when a walk exceeds a limit set with MaxDepth or
+// MaxEntries.
+var ErrWalkLimit = errors.New("walk limit exceeded")
+
+// FollowSymlinks makes the walk descend into directories reached through
+// symbolic links, reporting them with the FileInfo of the directory. Each
+// directory is walked once, where the underlying filesystem identifies files
+// by device and inode, and symbolic links are followed at most 40 levels deep
+// otherwise, so cycles end the walk of the branch with ELOOP.
+func FollowSymlinks() WalkOption {
+	return func(o *walkOptions) error {
+		o.follow = true
+		return nil
+	}
+}
+
+// MaxDepth aborts the walk with ErrWalkLimit when it reaches a file more than
+// `n` directories below the root.
+func MaxDepth(n int) WalkOption {
+	return func(o *walkOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxDepth = n
+		return nil
+	}
+}
+
+// MaxEntries aborts the walk with ErrWalkLimit when it reaches more than `n`
+// files, counting the root.
+func MaxEntries(n int) WalkOption {
+	return func(o *walkOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.maxEntries = n
+		return nil
+	}
+}
+
+// ContinueOnError keeps walking when a directory can't be read or a symbolic
+// link can't be followed. The walk function is called without the error and
+// the errors are returned joined once the walk is done.
+func ContinueOnError() WalkOption {
+	return func(o *walkOptions) error {
+		o.tolerant = true
+		return nil
+	}
+}
+
+// Ordered makes FastWalk call the walk function sequentially and in lexical
+// order, as Walk does, instead of passing the walk on to a possibly concurrent
+// FastWalk of the underlying filesystem.
+func Ordered() WalkOption {
+	return func(o *walkOptions) error {
+		o.ordered = true
+		return nil
+	}
+}
+
+// ReadBatch makes the walk read directories `n` entries at a time, and walk
+// their entries in the order they are listed, instead of reading and sorting
+// each directory as a whole, so that no more than `n` entries of a directory
+// are held in memory at once, even in directories with millions of entries.
+// Each directory on the path from the root to the current entry is kept open.
+func ReadBatch(n int) WalkOption {
+	return func(o *walkOptions) error {
+		if n <= 0 {
+			return os.ErrInvalid
+		}
+		o.batch = n
+		return nil
+	}
+}
+
+func newWalkOptions(opts []WalkOption) (*walkOptions, error) {
+	o := new(walkOptions)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+type walker interface {
+	Walk(string, func(string, os.FileInfo, error) error) error
+}
+
+type fastwalker interface {
+	FastWalk(string, func(string, os.FileMode) error) error
+}
+
+// Walk calls `fn` for `name` and every file below it, as filepath.Walk does.
+// Without options, hidden paths, virtual files or mounts the walk is passed on
+// to the underlying filesystem if it implements Walk, otherwise it walks basefs
+// in lexical order, or in the order directories are listed with ReadBatch.
+// Returning filepath.SkipDir from `fn` skips a directory, or the remaining
+// entries of the directory of a file, and filepath.SkipAll ends the walk
+// without error. If the filesystem is closed during the walk, it ends with
+// ErrClosed.
+func (f *FileSystem) Walk(name string, fn filepath.WalkFunc, opts ...WalkOption) error {
+	o, err := newWalkOptions(opts)
+	if err != nil {
+		return err
+	}
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.closed("walk", name); err != nil {
+		return err
+	}
+	walkFn := fn
+	fn = func(path string, info os.FileInfo, err error) error {
+		if err := f.opts.closed("walk", path); err != nil {
+			return err
+		}
+		return walkFn(path, info, err)
+	}
+	wfs, ok := f.fs.(walker)
+	if !ok || len(opts) > 0 || f.opts.reshaped() {
+		return o.walk(f.outer(), vpath(f.prefix, ppath), fn)
+	}
+	var s stopper
+	return s.result(wfs.Walk(ppath, func(path string, info os.FileInfo, err error) error {
+		if s.stopped() {
+			return filepath.SkipAll
+		}
+		p := vpath(f.prefix, path)
+		if info != nil {
+			info = f.opts.stat(path, info)
+		}
+		return s.check(fn(p, info, err))
+	}))
+}
+
+// FastWalk calls `fn` for `name` and every file below it with the type bits of
+// its mode. Without options, hidden paths, virtual files or mounts the walk is
+// passed on to the underlying filesystem if it implements FastWalk, which may
+// call `fn` concurrently, otherwise it walks basefs in lexical order.
+// filepath.SkipDir and filepath.SkipAll are honored as by Walk, except that in
+// a concurrent walk SkipDir returned for a file only skips that file, and `fn`
+// may still be running in other goroutines when it returns SkipAll. Like
+// Walk, it ends with ErrClosed if the filesystem is closed.
+func (f *FileSystem) FastWalk(name string, fn absfs.FastWalkFunc, opts ...WalkOption) error {
+	o, err := newWalkOptions(opts)
+	if err != nil {
+		return err
+	}
+	ppath, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.closed("walk", name); err != nil {
+		return err
+	}
+	walkFn := fn
+	fn = func(path string, mode os.FileMode) error {
+		if err := f.opts.closed("walk", path); err != nil {
+			return err
+		}
+		return walkFn(path, mode)
+	}
+	wfs, ok := f.fs.(fastwalker)
+	if !ok || len(opts) > 0 || f.opts.reshaped() {
+		return o.walk(f.outer(), vpath(f.prefix, ppath), func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return fn(p, info.Mode().Type())
+		})
+	}
+	var s stopper
+	return s.result(wfs.FastWalk(ppath, func(path string, mode os.FileMode) error {
+		if s.stopped() {
+			return filepath.SkipAll
+		}
+		p := vpath(f.prefix, path)
+		err := s.check(fn(p, mode))
+		if err == filepath.SkipDir && !mode.IsDir() && mode&os.ModeSymlink == 0 {
+			return nil
+		}
+		return err
+	}))
+}
+
+// stopper ends walks of underlying filesystems when the walk function returns
+// filepath.SkipAll, which they may not support or see from several
+// goroutines at once.
+type stopper struct {
+	done atomic.Bool
+}
+
+func (s *stopper) stopped() bool {
+	return s.done.Load()
+}
+
+// check notes whether `err` ends the walk and returns it.
+func (s *stopper) check(err error) error {
+	if err == filepath.SkipAll {
+		s.done.Store(true)
+	}
+	return err
+}
+
+// result returns the result of a walk, which is successful if it was ended
+// with SkipAll.
+func (s *stopper) result(err error) error {
+	if s.stopped() && (err == nil || err == filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// WalkResult is a file reported by FastWalkChan. The last result carries the
+// error that ended the walk, if any, in Err and no path.
+type WalkResult struct {
+	Path string
+	Mode os.FileMode
+	Err  error
+}
+
+// FastWalkChan runs FastWalk in the background and delivers the files it
+// reports on the returned channel, which is closed when the walk is done. The
+// walk only proceeds as fast as the results are received. Cancelling `ctx`
+// stops the walk and closes the channel without reporting ctx.Err(). Closing
+// the filesystem stops it too, with ErrClosed in the last result.
+func (f *FileSystem) FastWalkChan(ctx context.Context, name string, opts ...WalkOption) <-chan WalkResult {
+	results := make(chan WalkResult)
+	done := f.opts.closers.doneChan()
+	go func() {
+		defer close(results)
+		err := f.FastWalk(name, func(path string, mode os.FileMode) error {
+			select {
+			case results <- WalkResult{Path: path, Mode: mode}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-done:
+				return &os.PathError{Op: "walk", Path: path, Err: ErrClosed}
+			}
+		}, opts...)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		select {
+		case results <- WalkResult{Err: err}:
+		case <-ctx.Done():
+		}
+	}()
+	return results
+}
+
+// maxSymlinks is the number of symbolic links followed in a row before a walk
+// gives up with ELOOP.
+const maxSymlinks = 40
+
+// treeWalk walks a filesystem through the absfs interfaces. It keeps the
+// directories being walked on an explicit stack rather than recursing, so
+// the depth of a tree is only limited by memory.
+type treeWalk struct {
+	fs      absfs.FileSystem
+	fn      filepath.WalkFunc
+	o       *walkOptions
+	visited map[fileID]bool
+	entries int
+	errs    []error
+	stack   []*dirFrame
+}
+
+// dirFrame is a directory on the stack of a treeWalk, with the entries not
+// walked yet.
+type dirFrame struct {
+	name  string
+	info  os.FileInfo
+	depth int
+	links int
+
+	// the remaining entries, sorted by name, or the batch read last from
+	// the open directory with ReadBatch
+	infos []os.FileInfo
+	file  absfs.File
+}
+
+// walk walks `root` on `fs`. Symbolic links below `root` are reported as
+// they are listed by their directory and only followed if requested.
+func (o *walkOptions) walk(fs absfs.FileSystem, root string, fn filepath.WalkFunc) error {
+	w := &treeWalk{fs: fs, fn: fn, o: o}
+	if o.follow {
+		w.visited = make(map[fileID]bool)
+	}
+	info, err := fs.Stat(root)
+	if err != nil {
+		err = w.call(root, nil, err)
+	} else {
+		err = w.run(root, info)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		err = nil
+	}
+	if len(w.errs) > 0 {
+		return errors.Join(append(w.errs, err)...)
+	}
+	return err
+}
+
+// run walks `name`, described by `info`, and everything below it. A SkipDir
+// returned for a file ends the walk of its directory.
+func (w *treeWalk) run(name string, info os.FileInfo) error {
+	defer func() {
+		for len(w.stack) > 0 {
+			w.pop()
+		}
+	}()
+	err := w.visit(name, info, 0, 0)
+	for err == nil && len(w.stack) > 0 {
+		d := w.stack[len(w.stack)-1]
+		info, err1 := w.next(d)
+		if info == nil {
+			w.pop()
+			err = err1
+			continue
+		}
+		err = w.visit(path.Join(d.name, info.Name()), info, d.depth+1, d.links)
+		if err == filepath.SkipDir {
+			w.pop()
+			err = nil
+		}
+	}
+	return err
+}
+
+// visit calls the walk function for `name`, `depth` directories below the
+// root, and, if it is a directory, pushes it on the stack so that its entries
+// are walked next.
+func (w *treeWalk) visit(name string, info os.FileInfo, depth, links int) error {
+	w.entries++
+	if w.o.maxDepth > 0 && depth > w.o.maxDepth || w.o.maxEntries > 0 && w.entries > w.o.maxEntries {
+		return &os.PathError{Op: "walk", Path: name, Err: ErrWalkLimit}
+	}
+	if w.o.follow && info.Mode()&os.ModeSymlink != 0 {
+		target, err := w.fs.Stat(name)
+		if err == nil && target.IsDir() {
+			if links == maxSymlinks {
+				return w.call(name, info, &os.PathError{Op: "walk", Path: name, Err: syscall.ELOOP})
+			}
+			info, links = target, links+1
+		}
+	}
+	if !info.IsDir() {
+		return w.fn(name, info, nil)
+	}
+	if w.visited != nil {
+		if id, ok := identify(info); ok {
+			if w.visited[id] {
+				return w.skip(w.fn(name, info, nil))
+			}
+			w.visited[id] = true
+		}
+	}
+
+	d := &dirFrame{name: name, info: info, depth: depth, links: links}
+	var err error
+	if w.o.batch > 0 {
+		d.file, err = w.fs.Open(name)
+	} else {
+		d.infos, err = readDir(w.fs, name)
+	}
+	err1 := w.call(name, info, err)
+	if err != nil || err1 != nil {
+		if d.file != nil {
+			d.file.Close()
+		}
+		return w.skip(err1)
+	}
+	w.stack = append(w.stack, d)
+	return nil
+}
+
+// next returns the next entry of the directory `d`, or nil when it is done.
+// Errors reading the directory are passed to the walk function, which is
+// called for the directory again, as filepath.WalkDir does.
+func (w *treeWalk) next(d *dirFrame) (os.FileInfo, error) {
+	if len(d.infos) == 0 && d.file != nil {
+		infos, err := d.file.Readdir(w.o.batch)
+		if len(infos) > 0 {
+			d.infos = infos
+		} else if err != nil && err != io.EOF {
+			return nil, w.skip(w.call(d.name, d.info, err))
+		}
+	}
+	if len(d.infos) == 0 {
+		return nil, nil
+	}
+	info := d.infos[0]
+	// Entries are released as the walk proceeds.
+	d.infos[0] = nil
+	d.infos = d.infos[1:]
+	return info, nil
+}
+
+// pop removes the directory on top of the stack.
+func (w *treeWalk) pop() {
+	d := w.stack[len(w.stack)-1]
+	if d.file != nil {
+		d.file.Close()
+	}
+	w.stack[len(w.stack)-1] = nil
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// call calls the walk function, or records `err` if the walk continues on
+// errors.
+func (w *treeWalk) call(name string, info os.FileInfo, err error) error {
+	if err != nil && w.o.tolerant {
+		w.errs = append(w.errs, err)
+		if info == nil {
+			return nil
+		}
+		err = nil
+	}
+	return w.fn(name, info, err)
+}
+
+// skip turns SkipDir returned for a directory into nil.
+func (w *treeWalk) skip(err error) error {
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// errStop is used internally to abort a walk early.
+var errStop = errors.New("stop walking")
+
+// walk calls `fn` for `root` and every file below it in lexical order using
+// only the absfs.FileSystem interface, so it works with any backend. As with
+// filepath.Walk, returning filepath.SkipDir from `fn` skips a directory and
+// filepath.SkipAll ends the walk.
+func walk(fs absfs.FileSystem, root string, fn filepath.WalkFunc) error {
+	return new(walkOptions).walk(fs, root, fn)
+}
+
+// walkDir walks `name`, described by `info`, and everything below it.
+func walkDir(fs absfs.FileSystem, name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	w := &treeWalk{fs: fs, fn: fn, o: new(walkOptions)}
+	return w.run(name, info)
+}
+
+// readDir returns the entries of the directory `name` sorted by name.
+func readDir(fs absfs.FileSystem, name string) ([]os.FileInfo, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
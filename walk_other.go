@@ -0,0 +1,20 @@
+//go:build !unix
+
+package basefs
+
+import "os"
+
+// fileID identifies a file on the host.
+type fileID struct {
+	dev, ino uint64
+}
+
+// identify can't identify files on this platform.
+func identify(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// owner can't tell the owner of files on this platform.
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
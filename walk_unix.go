@@ -0,0 +1,33 @@
+//go:build unix
+
+package basefs
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file on the host.
+type fileID struct {
+	dev, ino uint64
+}
+
+// identify returns the device and inode of the file described by `info`, if
+// it comes from the os package.
+func identify(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{uint64(st.Dev), uint64(st.Ino)}, true
+}
+
+// owner returns the owner and group of the file described by `info`, if it
+// comes from the os package.
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
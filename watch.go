@@ -0,0 +1,540 @@
+package basefs
+
+import (
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/osfs"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Op describes a set of file operations reported by a Watcher.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+func (op Op) String() string {
+	var b strings.Builder
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{{Create, "CREATE"}, {Write, "WRITE"}, {Remove, "REMOVE"}, {Rename, "RENAME"}, {Chmod, "CHMOD"}} {
+		if op&o.op == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString(o.name)
+	}
+	if b.Len() == 0 {
+		return "[no events]"
+	}
+	return b.String()
+}
+
+// Event describes a change to a file or directory. Path is always a virtual
+// path, the prefix of the underlying filesystem is never exposed.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// pollInterval is how often a polling Watcher compares the watched path
+// against its last snapshot.
+const pollInterval = time.Second
+
+// WatchOption configures a Watcher.
+type WatchOption func(*watchOptions) error
+
+type watchOptions struct {
+	recursive bool
+	include   []string
+	exclude   []string
+	coalesce  time.Duration
+}
+
+// Recursive watches the entire subtree below a watched directory, including
+// directories created after the Watcher was started.
+func Recursive() WatchOption {
+	return func(o *watchOptions) error {
+		o.recursive = true
+		return nil
+	}
+}
+
+// Include only reports events for virtual paths matching at least one of the
+// glob patterns. Patterns use the syntax of path.Match with the addition of
+// `**` matching any number of directories, e.g. "/src/**/*.go". A pattern
+// without slashes is matched against the base name only.
+func Include(patterns ...string) WatchOption {
+	return func(o *watchOptions) error {
+		for _, pattern := range patterns {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.include = append(o.include, patterns...)
+		return nil
+	}
+}
+
+// Exclude suppresses events for virtual paths matching any of the glob
+// patterns. Excluded directories are not descended into by recursive
+// Watchers.
+func Exclude(patterns ...string) WatchOption {
+	return func(o *watchOptions) error {
+		for _, pattern := range patterns {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.exclude = append(o.exclude, patterns...)
+		return nil
+	}
+}
+
+// Coalesce collects events for the duration `d` after the first event of a
+// burst and then delivers a single event per path carrying the union of the
+// observed operations.
+func Coalesce(d time.Duration) WatchOption {
+	return func(o *watchOptions) error {
+		o.coalesce = d
+		return nil
+	}
+}
+
+func (o *watchOptions) excluded(name string) bool {
+	return matchAny(o.exclude, name)
+}
+
+func (o *watchOptions) wanted(name string) bool {
+	if o.excluded(name) {
+		return false
+	}
+	return len(o.include) == 0 || matchAny(o.include, name)
+}
+
+// Watcher delivers change notifications for a watched file or directory.
+// Watching a directory reports changes to its direct children unless the
+// Recursive option is given. Events and Errors are closed when the Watcher is
+// closed.
+type Watcher struct {
+	Events <-chan Event
+	Errors <-chan error
+
+	opts   watchOptions
+	prefix string
+	in     chan Event
+	events chan Event
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+	stop   func() error
+	err    error
+
+	// release stops tracking the Watcher in the filesystem it belongs to
+	release func()
+
+	// interrupted is set if the Watcher was stopped by closing the
+	// filesystem
+	interrupted atomic.Bool
+}
+
+// Err returns ErrClosed if the Watcher was stopped because the filesystem it
+// belongs to was closed, and nil otherwise. It tells why Events and Errors
+// were closed.
+func (w *Watcher) Err() error {
+	if w.interrupted.Load() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// stopWatch stops a Watcher when the filesystem is closed.
+type stopWatch struct {
+	w *Watcher
+}
+
+func (s stopWatch) Close() error {
+	s.w.interrupted.Store(true)
+	return s.w.Close()
+}
+
+// Close stops the Watcher and releases its resources.
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		if w.release != nil {
+			w.release()
+		}
+		close(w.done)
+		if w.stop != nil {
+			w.err = w.stop()
+		}
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	})
+	return w.err
+}
+
+// publish hands an event with a path on the underlying filesystem to the
+// dispatcher.
+func (w *Watcher) publish(p string, op Op) bool {
+	select {
+	case w.in <- Event{vpath(w.prefix, p), op}:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *Watcher) sendEvent(e Event) bool {
+	select {
+	case w.events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.errors <- fixerr(w.prefix, err):
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// dispatch filters published events and, if requested, coalesces them before
+// they are delivered.
+func (w *Watcher) dispatch() {
+	defer w.wg.Done()
+
+	var order []string
+	pending := make(map[string]Op)
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case e := <-w.in:
+			if !w.opts.wanted(e.Path) {
+				continue
+			}
+			if w.opts.coalesce <= 0 {
+				if !w.sendEvent(e) {
+					return
+				}
+				continue
+			}
+			if _, ok := pending[e.Path]; !ok {
+				order = append(order, e.Path)
+			}
+			pending[e.Path] |= e.Op
+			if flush == nil {
+				flush = time.After(w.opts.coalesce)
+			}
+		case <-flush:
+			for _, p := range order {
+				if !w.sendEvent(Event{p, pending[p]}) {
+					return
+				}
+				delete(pending, p)
+			}
+			order = order[:0]
+			flush = nil
+		}
+	}
+}
+
+func newWatcher(prefix string, opts ...WatchOption) (*Watcher, error) {
+	w := &Watcher{
+		prefix: prefix,
+		in:     make(chan Event),
+		events: make(chan Event),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(&w.opts); err != nil {
+			return nil, err
+		}
+	}
+	w.Events = w.events
+	w.Errors = w.errors
+	w.wg.Add(1)
+	go w.dispatch()
+	return w, nil
+}
+
+// Watch reports changes to the named file or directory. The Watcher is
+// stopped when the filesystem is closed, see Watcher.Err.
+func (f *FileSystem) Watch(name string, opts ...WatchOption) (*Watcher, error) {
+	ppath, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.opts.closed("watch", name); err != nil {
+		return nil, err
+	}
+
+	return watch(f.fs, f.prefix, ppath, f.opts, opts)
+}
+
+// watch uses the native notification facility of the operating system when
+// the underlying filesystem is an osfs, and falls back to polling otherwise.
+func watch(fs absfs.FileSystem, prefix, ppath string, o *options, opts []WatchOption) (*Watcher, error) {
+	if _, err := fs.Stat(ppath); err != nil {
+		return nil, fixerr(prefix, err)
+	}
+	w, err := newWatcher(prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fs.(*osfs.FileSystem); ok {
+		err = w.notify(ppath)
+	} else {
+		w.poll(fs, ppath)
+	}
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	w.release = func() { o.closers.remove(stopWatch{w}) }
+	o.closers.add(stopWatch{w})
+	if err := o.closed("watch", vpath(prefix, ppath)); err != nil {
+		// The filesystem was closed while the Watcher was set up.
+		w.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Watcher) notify(ppath string) error {
+	nw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w.stop = nw.Close
+
+	// add watches `dir`, and everything below it for recursive watchers. When
+	// `announce` is set, Create events are published for the existing entries
+	// since they may have appeared before the watch was in place.
+	add := func(dir string, announce bool) error {
+		if !w.opts.recursive {
+			return nw.Add(filepath.FromSlash(dir))
+		}
+		return filepath.WalkDir(filepath.FromSlash(dir), func(p string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			p = filepath.ToSlash(p)
+			if announce && p != dir && !w.publish(p, Create) {
+				return iofs.SkipAll
+			}
+			if !d.IsDir() {
+				if p == dir {
+					// a recursive watch of a file watches just the file
+					return nw.Add(filepath.FromSlash(p))
+				}
+				return nil
+			}
+			if p != dir && w.opts.excluded(vpath(w.prefix, p)) {
+				return filepath.SkipDir
+			}
+			return nw.Add(filepath.FromSlash(p))
+		})
+	}
+	err = add(ppath, false)
+	if err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case e, ok := <-nw.Events:
+				if !ok {
+					return
+				}
+				p := filepath.ToSlash(e.Name)
+				if !within(w.prefix, p) {
+					continue
+				}
+				if !w.publish(p, Op(e.Op)&(Create|Write|Remove|Rename|Chmod)) {
+					return
+				}
+				if w.opts.recursive && e.Op.Has(fsnotify.Create) {
+					info, err := os.Lstat(e.Name)
+					if err == nil && info.IsDir() && !w.opts.excluded(vpath(w.prefix, p)) {
+						err = add(p, true)
+					}
+					if err != nil && !os.IsNotExist(err) && !w.sendError(err) {
+						return
+					}
+				}
+			case err, ok := <-nw.Errors:
+				if !ok {
+					return
+				}
+				if !w.sendError(err) {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+type snapshot map[string]os.FileInfo
+
+// snapshot records the state of `ppath` and, for directories, of its entries
+// or of its whole subtree for recursive watchers.
+func (w *Watcher) snapshot(fs absfs.FileSystem, ppath string) (snapshot, error) {
+	info, err := fs.Stat(ppath)
+	if err != nil {
+		return nil, err
+	}
+	snap := snapshot{ppath: info}
+	if !info.IsDir() {
+		return snap, nil
+	}
+
+	dirs := []string{ppath}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		f, err := fs.Open(dir)
+		if err != nil {
+			if dir != ppath && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		infos, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			p := path.Join(dir, info.Name())
+			snap[p] = info
+			if w.opts.recursive && info.IsDir() && !w.opts.excluded(vpath(w.prefix, p)) {
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	return snap, nil
+}
+
+// diff returns the operations that turn the snapshot `old` into `snap`.
+func (snap snapshot) diff(old snapshot) map[string]Op {
+	ops := make(map[string]Op)
+	for p, info := range snap {
+		prev, ok := old[p]
+		if !ok {
+			ops[p] = Create
+			continue
+		}
+		var op Op
+		if !info.IsDir() && (info.Size() != prev.Size() || !info.ModTime().Equal(prev.ModTime())) {
+			op |= Write
+		}
+		if info.Mode() != prev.Mode() {
+			op |= Chmod
+		}
+		if op != 0 {
+			ops[p] = op
+		}
+	}
+	for p := range old {
+		if _, ok := snap[p]; !ok {
+			ops[p] = Remove
+		}
+	}
+	return ops
+}
+
+func (w *Watcher) poll(fs absfs.FileSystem, ppath string) {
+	last, _ := w.snapshot(fs, ppath)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			snap, err := w.snapshot(fs, ppath)
+			if err != nil && !os.IsNotExist(err) {
+				if !w.sendError(err) {
+					return
+				}
+				continue
+			}
+			ops := snap.diff(last)
+			paths := make([]string, 0, len(ops))
+			for p := range ops {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			for _, p := range paths {
+				if !w.publish(p, ops[p]) {
+					return
+				}
+			}
+			last = snap
+		}
+	}()
+}
+
+// within reports whether the path `p` on the underlying filesystem is inside
+// `prefix`.
+func within(prefix, p string) bool {
+	return p == prefix || prefix == "/" || strings.HasPrefix(p, prefix+"/")
+}
+
+// vpath converts a path on the underlying filesystem into a virtual path.
+func vpath(prefix, p string) string {
+	if prefix == "/" {
+		return p
+	}
+	p = strings.TrimPrefix(p, prefix)
+	if p == "" {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,249 @@
+package basefs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+)
+
+// opaque hides the concrete type of the wrapped filesystem, forcing basefs to
+// use its generic code paths.
+type opaque struct {
+	absfs.FileSystem
+}
+
+func waitEvent(t *testing.T, w *basefs.Watcher, path string, op basefs.Op) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-w.Events:
+			if e.Path == path && e.Op&op != 0 {
+				return
+			}
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s %s", op, path)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+
+	tests := []struct {
+		Name string
+		FS   absfs.FileSystem
+	}{
+		{"native", ofs},
+		{"poll", opaque{ofs}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := os.Mkdir(filepath.Join(dir, test.Name), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bfs, err := basefs.NewFileSystem(test.FS, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := bfs.Watch("/" + test.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			name := "/" + test.Name + "/file.txt"
+			f, err := bfs.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			waitEvent(t, w, name, basefs.Create)
+
+			err = bfs.Remove(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitEvent(t, w, name, basefs.Remove)
+		})
+	}
+}
+
+func TestWatchRecursive(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+
+	tests := []struct {
+		Name string
+		FS   absfs.FileSystem
+	}{
+		{"native", ofs},
+		{"poll", opaque{ofs}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			root := "/" + test.Name
+			err := os.MkdirAll(filepath.Join(dir, test.Name, "src"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bfs, err := basefs.NewFileSystem(test.FS, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := bfs.Watch(root, basefs.Recursive(), basefs.Include(root+"/src/**/*.go"), basefs.Exclude("vendor"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			for _, name := range []string{"/src/vendor/a", "/src/pkg/sub"} {
+				err = bfs.MkdirAll(root+name, 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// give the native watcher a chance to add the new directories
+			time.Sleep(100 * time.Millisecond)
+			for _, name := range []string{"/src/vendor/a/x.go", "/src/pkg/sub/notes.txt", "/src/pkg/sub/main.go"} {
+				f, err := bfs.Create(root + name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+			}
+
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case e := <-w.Events:
+					if e.Path == root+"/src/pkg/sub/main.go" {
+						return
+					}
+					t.Fatalf("unexpected event %s", e)
+				case err := <-w.Errors:
+					t.Fatal(err)
+				case <-timeout:
+					t.Fatal("timed out waiting for event")
+				}
+			}
+		})
+	}
+}
+
+func TestWatchRecursiveFile(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.ToSlash(dir)
+
+	tests := []struct {
+		Name string
+		FS   absfs.FileSystem
+	}{
+		{"native", ofs},
+		{"poll", opaque{ofs}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			name := "/" + test.Name + ".txt"
+			err := os.WriteFile(filepath.Join(dir, test.Name+".txt"), nil, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bfs, err := basefs.NewFileSystem(test.FS, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := bfs.Watch(name, basefs.Recursive())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			err = bfs.WriteFile(name, []byte("changed"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitEvent(t, w, name, basefs.Write)
+		})
+	}
+}
+
+func TestWatchCoalesce(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := bfs.Watch("/", basefs.Coalesce(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	f, err := bfs.Create("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		f.WriteString("data\n")
+	}
+	f.Close()
+
+	select {
+	case e := <-w.Events:
+		if e.Path != "/file.txt" || e.Op != basefs.Create|basefs.Write {
+			t.Fatalf("unexpected event %s", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	select {
+	case e := <-w.Events:
+		t.Fatalf("unexpected event %s", e)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,94 @@
+package basefs
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// WithWriteBuffer collects the data written to files with Write and
+// WriteString in a buffer of `size` bytes, which is written to the
+// underlying filesystem when it is full and before any other operation on
+// the file, including Sync and Close. Writes larger than the buffer are not
+// buffered. Errors writing the buffer are returned by the operation which
+// caused it to be written.
+func WithWriteBuffer(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return os.ErrInvalid
+		}
+		o.writeBuffer = size
+		return nil
+	}
+}
+
+// writeBuffer coalesces small sequential writes to a file.
+type writeBuffer struct {
+	mu  sync.Mutex
+	f   absfs.File
+	buf []byte
+}
+
+func newWriteBuffer(f absfs.File, size int) *writeBuffer {
+	return &writeBuffer{f: f, buf: make([]byte, 0, size)}
+}
+
+func (w *writeBuffer) write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf)+len(p) > cap(w.buf) {
+		if err := w.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= cap(w.buf) {
+		return w.f.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *writeBuffer) writeString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf)+len(s) > cap(w.buf) {
+		if err := w.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if len(s) >= cap(w.buf) {
+		return w.f.WriteString(s)
+	}
+	w.buf = append(w.buf, s...)
+	return len(s), nil
+}
+
+// flush writes out the buffered data.
+func (w *writeBuffer) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+func (w *writeBuffer) flushLocked() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	n, err := w.f.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	// keep what could not be written, to be retried by the next flush
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	return err
+}
+
+// flush writes out the data buffered by WithWriteBuffer, if any.
+func (f *File) flush() error {
+	if f.wb == nil {
+		return nil
+	}
+	return fixerr(f.prefix, f.wb.flush())
+}
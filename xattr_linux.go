@@ -0,0 +1,86 @@
+package basefs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyHostXattrs copies the extended attributes of the host file `src` to
+// `dst`, the POSIX ACLs among them if `acls` is set and the others if
+// `xattrs` is set. Symbolic links are not followed. Attributes which the
+// filesystems don't support or the process may not read or set are skipped.
+func copyHostXattrs(src, dst string, xattrs, acls bool) error {
+	names, err := listXattrs(src)
+	if skipXattr(err) {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: "listxattr", Path: src, Err: err}
+	}
+	for _, name := range names {
+		acl := strings.HasPrefix(name, "system.posix_acl_")
+		if acl && !acls || !acl && !xattrs {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err == nil {
+			err = unix.Lsetxattr(dst, name, value, 0)
+		}
+		if err != nil && !skipXattr(err) {
+			return &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+	return nil
+}
+
+// skipXattr reports whether the error `err` of an extended attribute call
+// means that the attribute should be skipped.
+func skipXattr(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) || errors.Is(err, unix.ENODATA)
+}
+
+func listXattrs(name string) ([]string, error) {
+	for {
+		n, err := unix.Llistxattr(name, nil)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		n, err = unix.Llistxattr(name, buf)
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, b := range bytes.Split(buf[:n], []byte{0}) {
+			if len(b) > 0 {
+				names = append(names, string(b))
+			}
+		}
+		return names, nil
+	}
+}
+
+func getXattr(name, attr string) ([]byte, error) {
+	for {
+		n, err := unix.Lgetxattr(name, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		n, err = unix.Lgetxattr(name, attr, buf)
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
@@ -0,0 +1,50 @@
+package basefs_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/absfs/basefs"
+	"github.com/absfs/osfs"
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyXattrs(t *testing.T) {
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{"/src": "data"})
+	if err := unix.Setxattr(filepath.Join(dir, "src"), "user.origin", []byte("upload"), 0); err != nil {
+		t.Skipf("no user xattrs here: %v", err)
+	}
+	bfs, err := basefs.NewFileSystem(ofs, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(name string) string {
+		buf := make([]byte, 64)
+		n, err := unix.Getxattr(filepath.Join(dir, name), "user.origin", buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+
+	if err := bfs.CopyFile("/src", "/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if v := get("plain"); v != "" {
+		t.Errorf("xattr copied without PreserveXattrs: %q", v)
+	}
+	if err := bfs.CopyFile("/src", "/copy", basefs.Preserve(basefs.PreserveXattrs)); err != nil {
+		t.Fatal(err)
+	}
+	if v := get("copy"); v != "upload" {
+		t.Errorf("xattr not copied: %q", v)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package basefs
+
+// copyHostXattrs doesn't copy extended attributes on this platform.
+func copyHostXattrs(src, dst string, xattrs, acls bool) error {
+	return nil
+}
@@ -0,0 +1,197 @@
+package basefs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// maxLinkSize is the largest symlink target read from a zip archive.
+const maxLinkSize = 4096
+
+// WriteZip writes the tree below `root` to `w` as a zip archive.
+func (f *FileSystem) WriteZip(w io.Writer, root string) error {
+	return writeZip(f.outer(), w, root)
+}
+
+// ExtractZip extracts the zip archive read from `r` into the directory
+// `dest`, with the same protections and options as ExtractTar. Readers which
+// also implement io.ReaderAt and report their size, such as files,
+// *bytes.Reader and *io.SectionReader, are read in place; other readers are
+// buffered in memory. See ExtractZipReaderAt.
+func (f *FileSystem) ExtractZip(r io.Reader, dest string, opts ...ExtractOption) error {
+	return extractZipReader(f.outer(), r, dest, opts)
+}
+
+// ExtractZipReaderAt extracts the zip archive of `size` bytes in `r` into the
+// directory `dest`, streaming each entry directly from `r`.
+func (f *FileSystem) ExtractZipReaderAt(r io.ReaderAt, size int64, dest string, opts ...ExtractOption) error {
+	return extractZip(f.outer(), r, size, dest, opts)
+}
+
+func writeZip(fs absfs.FileSystem, w io.Writer, root string) error {
+	root = path.Clean("/" + root)
+	zw := zip.NewWriter(w)
+	err := walk(fs, root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = relpath(root, p)
+
+		switch {
+		case info.IsDir():
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+
+		case info.Mode()&os.ModeSymlink != 0:
+			sfs, ok := fs.(absfs.SymlinkFileSystem)
+			if !ok {
+				return nil
+			}
+			target, err := sfs.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if path.IsAbs(target) {
+				target = relTarget(path.Dir(p), path.Clean(target))
+			}
+			// ExtractZip would reject links leaving the tree
+			if _, err := ValidateSymlinkTarget(root, p, target); err != nil {
+				return &os.PathError{Op: "zip", Path: p, Err: ErrUnsafePath}
+			}
+			zf, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(zf, target)
+			return err
+
+		case info.Mode().IsRegular():
+			hdr.Method = zip.Deflate
+			zf, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			in, err := fs.Open(p)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(zf, in)
+			in.Close()
+			return err
+		}
+		return nil
+	})
+	if err1 := zw.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// relTarget returns the path of `target` relative to the directory `dir`,
+// both clean absolute virtual paths.
+func relTarget(dir, target string) string {
+	elems := func(p string) []string {
+		if p == "/" {
+			return nil
+		}
+		return strings.Split(p[1:], "/")
+	}
+	from, to := elems(dir), elems(target)
+	for len(from) > 0 && len(to) > 0 && from[0] == to[0] {
+		from, to = from[1:], to[1:]
+	}
+	rel := strings.Repeat("../", len(from)) + strings.Join(to, "/")
+	if rel == "" {
+		return "."
+	}
+	return path.Clean(rel)
+}
+
+func extractZipReader(fs absfs.FileSystem, r io.Reader, dest string, opts []ExtractOption) error {
+	switch ra := r.(type) {
+	case interface {
+		io.ReaderAt
+		Size() int64
+	}:
+		return extractZip(fs, ra, ra.Size(), dest, opts)
+	case interface {
+		io.ReaderAt
+		Stat() (os.FileInfo, error)
+	}:
+		info, err := ra.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(fs, ra, info.Size(), dest, opts)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return extractZip(fs, bytes.NewReader(data), int64(len(data)), dest, opts)
+}
+
+func extractZip(fs absfs.FileSystem, r io.ReaderAt, size int64, dest string, opts []ExtractOption) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	x, err := newExtractor(fs, dest, opts)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		err = x.extractZip(zf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractZip(zf *zip.File) error {
+	name, err := x.entry(zf.Name)
+	if err != nil {
+		return err
+	}
+	mode := zf.Mode()
+	if mode.IsDir() {
+		return x.dir(name, mode.Perm())
+	}
+	if x.opts.maxEntry > 0 && zf.UncompressedSize64 > uint64(x.opts.maxEntry) {
+		return &os.PathError{Op: "extract", Path: zf.Name, Err: ErrArchiveLimit}
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := io.ReadAll(io.LimitReader(rc, maxLinkSize))
+		if err != nil {
+			return err
+		}
+		return x.symlink(name, zf.Name, string(target))
+	case mode.IsRegular():
+		err = x.write(name, zf.Name, rc, mode.Perm())
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return x.fs.Chtimes(name, zf.Modified, zf.Modified)
+}